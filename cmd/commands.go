@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Subcommands of the binary; consume runs when none is given
+const (
+	commandConsume   = "consume"
+	commandMigrate   = "migrate"
+	commandReprocess = "reprocess"
+)
+
+// command is a parsed command line
+type command struct {
+	name string
+	// file is the DLQ dump replayed by reprocess, which stops at the first
+	// failing message unless continueOnError is set; fromSource reads each
+	// message back from the position recorded in its dead letter envelope
+	file            string
+	continueOnError bool
+	fromSource      bool
+}
+
+// runners executes each subcommand
+type runners struct {
+	consume   func() error
+	migrate   func() error
+	reprocess func(file string, continueOnError, fromSource bool) error
+}
+
+// parseCommand parses the arguments following the program name
+func parseCommand(args []string, output io.Writer) (command, error) {
+	name := commandConsume
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	cmd := command{name: name}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	switch name {
+	case commandConsume, commandMigrate:
+	case commandReprocess:
+		flags.StringVar(&cmd.file, "file", "", "newline-delimited dump of dead-lettered messages to replay")
+		flags.BoolVar(&cmd.continueOnError, "continue-on-error", false, "keep replaying after a message fails")
+		flags.BoolVar(&cmd.fromSource, "from-source", false, "read each message from its source topic at the recorded offset")
+	default:
+		return command{}, fmt.Errorf("unknown command %q, expected one of: %s", name,
+			strings.Join([]string{commandConsume, commandMigrate, commandReprocess}, ", "))
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return command{}, err
+	}
+	if flags.NArg() > 0 {
+		return command{}, fmt.Errorf("unexpected arguments for %s: %s", name, strings.Join(flags.Args(), " "))
+	}
+	if name == commandReprocess && cmd.file == "" {
+		return command{}, errors.New("reprocess requires --file")
+	}
+	return cmd, nil
+}
+
+// run executes the runner of cmd
+func (c command) run(r runners) error {
+	switch c.name {
+	case commandMigrate:
+		return r.migrate()
+	case commandReprocess:
+		return r.reprocess(c.file, c.continueOnError, c.fromSource)
+	default:
+		return r.consume()
+	}
+}
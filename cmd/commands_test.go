@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		expected  command
+		expectErr bool
+	}{
+		{"no arguments consumes", nil, command{name: commandConsume}, false},
+		{"consume", []string{"consume"}, command{name: commandConsume}, false},
+		{"migrate", []string{"migrate"}, command{name: commandMigrate}, false},
+		{"reprocess with file", []string{"reprocess", "--file", "dlq.jsonl"}, command{name: commandReprocess, file: "dlq.jsonl"}, false},
+		{"reprocess with file assignment", []string{"reprocess", "-file=dlq.jsonl"}, command{name: commandReprocess, file: "dlq.jsonl"}, false},
+		{"reprocess continuing on error", []string{"reprocess", "--file", "dlq.jsonl", "--continue-on-error"}, command{name: commandReprocess, file: "dlq.jsonl", continueOnError: true}, false},
+		{"reprocess from source", []string{"reprocess", "--file", "dlq.jsonl", "--from-source"}, command{name: commandReprocess, file: "dlq.jsonl", fromSource: true}, false},
+		{"reprocess without file", []string{"reprocess"}, command{}, true},
+		{"unknown command", []string{"backfill"}, command{}, true},
+		{"unknown flag", []string{"migrate", "--force"}, command{}, true},
+		{"flag without command", []string{"--file", "dlq.jsonl"}, command{}, true},
+		{"extra arguments", []string{"consume", "now"}, command{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := parseCommand(tt.args, io.Discard)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("parseCommand() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if cmd != tt.expected {
+				t.Errorf("parseCommand() = %+v, expected %+v", cmd, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCommand_Run(t *testing.T) {
+	var called []string
+	r := runners{
+		consume: func() error {
+			called = append(called, commandConsume)
+			return nil
+		},
+		migrate: func() error {
+			called = append(called, commandMigrate)
+			return nil
+		},
+		reprocess: func(file string, continueOnError, fromSource bool) error {
+			called = append(called, commandReprocess+" "+file)
+			return nil
+		},
+	}
+
+	for _, cmd := range []command{
+		{name: commandMigrate},
+		{name: commandReprocess, file: "dlq.jsonl"},
+		{name: commandConsume},
+	} {
+		if err := cmd.run(r); err != nil {
+			t.Fatalf("run(%s) should not return error, got: %v", cmd.name, err)
+		}
+	}
+
+	expected := []string{commandMigrate, commandReprocess + " dlq.jsonl", commandConsume}
+	if len(called) != len(expected) {
+		t.Fatalf("Expected runners %v, got %v", expected, called)
+	}
+	for i := range expected {
+		if called[i] != expected[i] {
+			t.Errorf("Runner %d = %s, expected %s", i, called[i], expected[i])
+		}
+	}
+}
+
+func TestCommand_Run_MigrateDoesNotConsume(t *testing.T) {
+	migrateErr := errors.New("migration failed")
+	consumed := false
+	r := runners{
+		consume: func() error {
+			consumed = true
+			return nil
+		},
+		migrate:   func() error { return migrateErr },
+		reprocess: func(string, bool, bool) error { return nil },
+	}
+
+	if err := (command{name: commandMigrate}).run(r); !errors.Is(err, migrateErr) {
+		t.Errorf("Expected migrate error, got %v", err)
+	}
+	if consumed {
+		t.Error("migrate should exit without starting the consumer")
+	}
+}
@@ -2,13 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"gorm.io/gorm"
+	"net"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
+	"transaction-consumer/internal/domain/repositories"
 	"transaction-consumer/internal/infrastructures/config"
+	"transaction-consumer/internal/infrastructures/database/memory"
 	"transaction-consumer/internal/infrastructures/database/postgres"
+	"transaction-consumer/internal/infrastructures/health"
+	"transaction-consumer/internal/infrastructures/metrics"
+	"transaction-consumer/internal/infrastructures/schemaregistry"
+	"transaction-consumer/internal/infrastructures/spill"
+	"transaction-consumer/internal/tools/replay"
 	"transaction-consumer/internal/usecases"
 	"transaction-consumer/pkg/logger"
 
@@ -20,37 +31,100 @@ func main() {
 	// Initialize logger
 	log := logger.NewLogger()
 
+	cmd, err := parseCommand(os.Args[1:], os.Stderr)
+	if err != nil {
+		log.Fatal("Invalid command line", "error", err)
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatal("Failed to load configuration", "error", err)
 	}
+	log = logger.NewLoggerWithTimeFormat(cfg.App.LogTimeFormat)
 
-	// Initialize database
-	db, err := postgres.NewConnection(cfg.Database, cfg.App)
+	// Interrupts cancel startup, e.g. while waiting for the database, as well
+	// as consumption
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err = cmd.run(runners{
+		consume: func() error { return runConsume(ctx, cfg, log) },
+		migrate: func() error { return runMigrate(ctx, cfg, log) },
+		reprocess: func(file string, continueOnError, fromSource bool) error {
+			return runReprocess(ctx, cfg, log, file, continueOnError, fromSource)
+		},
+	})
+	stop()
 	if err != nil {
-		log.Fatal("Failed to connect to database", "error", err)
+		log.Fatal("Command failed", "command", cmd.name, "error", err)
 	}
-	defer func(db *gorm.DB) {
-		err := postgres.CloseConnection(db)
-		if err != nil {
-			log.Error("Failed to close database connection", "error", err)
-		} else {
-			log.Info("Database connection closed successfully")
-		}
-	}(db)
+}
+
+// runConsume consumes transactions until interrupted or a fatal consumer error
+func runConsume(ctx context.Context, cfg *config.Config, log logger.Logger) error {
+	started := time.Now()
+	db, transactionRepo, closeDB, err := openStorage(ctx, cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+	log.Info("Connected to transaction store", "driver", cfg.Database.Driver,
+		"duration", time.Since(started).Round(time.Millisecond))
 
-	// Initialize repository
-	transactionRepo := postgres.NewTransactionRepository(db, log)
+	if db != nil {
+		if err := postgres.AutoMigrate(db, cfg.Database); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
 
-	// Initialize use case
-	transactionUsecase := usecases.NewTransactionUseCase(transactionRepo, log)
+	if err := resolveBrokers(ctx, cfg, log); err != nil {
+		return err
+	}
 
 	// Initialize Kafka consumer
-	kafkaConsumer, err := kafkainfra.NewConsumer(cfg.Kafka, log)
+	consumerOpts := []kafkainfra.Option{
+		kafkainfra.WithInvalidMessagePolicy(cfg.InvalidMessagePolicy()),
+		kafkainfra.WithOrdering(cfg.App.ProcessingOrder),
+	}
+	if cfg.Kafka.DLQTopic != "" {
+		deadLetter, err := kafkainfra.NewDeadLetterPublisher(cfg.Kafka)
+		if err != nil {
+			return fmt.Errorf("failed to create dead letter publisher: %w", err)
+		}
+		defer func() {
+			if err := deadLetter.Close(); err != nil {
+				log.Error("Failed to close dead letter publisher", "error", err)
+			}
+		}()
+		consumerOpts = append(consumerOpts, kafkainfra.WithDeadLetterPublisher(deadLetter))
+	}
+	if len(cfg.Kafka.StatusPriorities) > 0 {
+		consumerOpts = append(consumerOpts, kafkainfra.WithPriority(kafkahandler.StatusPriority(cfg.Kafka.StatusPriorities)))
+	}
+	if cfg.App.TransactionalOffsetsEnabled {
+		consumerOpts = append(consumerOpts, kafkainfra.WithOffsetStore(postgres.NewProcessedOffsetRepository(db, log)))
+	}
+	if !cfg.Database.IsMemory() {
+		// Keep concurrent processing within the connection pool
+		maxInFlight := cfg.Database.MaxOpenConns
+		if cfg.Database.IsSQLite() {
+			maxInFlight = 1
+		}
+		consumerOpts = append(consumerOpts, kafkainfra.WithMaxInFlight(maxInFlight))
+	}
+	// The reader joins the consumer group as soon as it is created, after
+	// which the group cannot be repositioned
+	if err := seekConsumerGroup(ctx, cfg, log); err != nil {
+		return err
+	}
+
+	consumerLog := logger.NewSampledLogger(log, cfg.App.LogSampleEvery, cfg.App.LogSampleInterval)
+	consumerStarted := time.Now()
+	kafkaConsumer, err := kafkainfra.NewConsumer(cfg.Kafka, consumerLog, consumerOpts...)
 	if err != nil {
-		log.Fatal("Failed to create Kafka consumer", "error", err)
+		return fmt.Errorf("failed to create Kafka consumer: %w", err)
 	}
+	log.Info("Created Kafka consumer", "topic", cfg.Kafka.Topic,
+		"duration", time.Since(consumerStarted).Round(time.Millisecond))
 	defer func(kafkaConsumer *kafkainfra.Consumer) {
 		err := kafkaConsumer.Close()
 		if err != nil {
@@ -60,26 +134,312 @@ func main() {
 		}
 	}(kafkaConsumer)
 
-	// Initialize Kafka handler
-	kafkaHandler := kafkahandler.NewTransactionHandler(transactionUsecase, log)
+	persistedEvents, closePublisher, err := openPersistedEventPublisher(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closePublisher()
+
+	transactionUsecase := newTransactionUseCase(cfg, log, db, transactionRepo, persistedEvents)
+	var spillWAL *spill.WAL
+	var drainUsecase usecases.TransactionUseCase
+	if cfg.App.SpillDir != "" {
+		spillWAL, err = spill.Open(cfg.App.SpillDir, cfg.App.SpillMaxBytes, log)
+		if err != nil {
+			return fmt.Errorf("failed to open spill: %w", err)
+		}
+		// The drain stores through a use case without the spill, so a
+		// transaction failing again stays in place instead of being appended
+		drainUsecase = transactionUsecase
+		transactionUsecase = newTransactionUseCase(cfg, log, db, transactionRepo, persistedEvents, usecases.WithSpill(spillWAL))
+	}
+	kafkaHandler := newTransactionHandler(cfg, log, db, transactionUsecase)
+
+	// Start health server
+	healthServer := health.NewServer(cfg.App.Port, log, kafkaConsumer.IsReady)
+	healthServer.Handle("/metrics", metrics.Handler())
+	healthServer.HandlePause(kafkaConsumer)
+	if cfg.App.Debug {
+		healthServer.HandleDebugConfig(cfg.Sanitized())
+	}
+	go func() {
+		if err := healthServer.Start(); err != nil {
+			log.Error("Health server error", "error", err)
+		}
+	}()
 
 	// Start consuming
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	// Start consumer in goroutine
-	go func() {
-		if err := kafkaConsumer.Consume(ctx, kafkaHandler.HandleMessage); err != nil {
-			log.Error("Kafka consumer error", "error", err)
+	// SQLite lives in a local file, so only server pools can go stale
+	if db != nil && !cfg.Database.IsSQLite() && cfg.Database.HealthCheckInterval > 0 {
+		poolCheck, err := postgres.NewPoolHealthCheck(db, cfg.Database.MaxIdleConns, log)
+		if err != nil {
+			return fmt.Errorf("failed to create database health check: %w", err)
 		}
+		go poolCheck.Run(ctx, cfg.Database.HealthCheckInterval)
+	}
+
+	if spillWAL != nil {
+		go spillWAL.Run(ctx, cfg.App.SpillDrainInterval, usecases.DrainSpilled(drainUsecase, log))
+	}
+
+	// Start consumer in goroutine; consumeErr is set before consumerDone is
+	// closed
+	consumerDone := make(chan struct{})
+	var consumeErr error
+	go func() {
+		defer close(consumerDone)
+		consumeErr = kafkaConsumer.Consume(ctx, kafkaHandler.Handle)
 	}()
 
-	// Wait for interrupt signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	// Wait for interrupt signal or consumption to end, on a fatal consumer
+	// error or after KAFKA_MAX_MESSAGES
+	select {
+	case <-ctx.Done():
+	case <-consumerDone:
+	}
 
-	log.Info("Shutting down...")
+	log.Info("Shutting down...", "processed", kafkaConsumer.Processed(),
+		"uptime", time.Since(started).Round(time.Millisecond))
 	cancel()
-	time.Sleep(2 * time.Second) // Grace period
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer shutdownCancel()
+	if err := healthServer.Shutdown(shutdownCtx); err != nil {
+		log.Error("Failed to shut down health server", "error", err)
+	}
+
+	time.Sleep(cfg.App.ShutdownGracePeriod)
+
+	// Interrupts end consumption with a cancelled context, which is not a
+	// failure
+	<-consumerDone
+	if consumeErr != nil && !errors.Is(consumeErr, context.Canceled) {
+		return fmt.Errorf("kafka consumer stopped: %w", consumeErr)
+	}
+	return nil
+}
+
+// runMigrate applies the schema migration regardless of DB_AUTO_MIGRATE and
+// exits
+func runMigrate(ctx context.Context, cfg *config.Config, log logger.Logger) error {
+	if cfg.Database.IsMemory() {
+		log.Info("In-memory storage has no schema to migrate")
+		return nil
+	}
+
+	db, _, closeDB, err := openStorage(ctx, cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	dbCfg := cfg.Database
+	dbCfg.AutoMigrate = true
+	if err := postgres.AutoMigrate(db, dbCfg); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	log.Info("Database migrated successfully")
+	return nil
+}
+
+// runReprocess feeds every line of file, one dead letter envelope or raw
+// message each, through the transaction handler and fails when any message
+// did
+func runReprocess(ctx context.Context, cfg *config.Config, log logger.Logger, file string, continueOnError, fromSource bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer f.Close()
+
+	db, transactionRepo, closeDB, err := openStorage(ctx, cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	if err := resolveBrokers(ctx, cfg, log); err != nil {
+		return err
+	}
+
+	persistedEvents, closePublisher, err := openPersistedEventPublisher(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closePublisher()
+
+	kafkaHandler := newTransactionHandler(cfg, log, db, newTransactionUseCase(cfg, log, db, transactionRepo, persistedEvents),
+		kafkahandler.WithReprocessing(cfg.App.ReprocessEnabled))
+
+	replayOpts := []replay.Option{replay.WithContinueOnError(continueOnError)}
+	if fromSource {
+		fetcher, err := kafkainfra.NewSourceFetcher(cfg.Kafka)
+		if err != nil {
+			return fmt.Errorf("failed to create source fetcher: %w", err)
+		}
+		replayOpts = append(replayOpts, replay.WithFromSource(fetcher.Fetch))
+	}
+
+	replayer := replay.New(kafkaHandler.HandleMessage, log, replayOpts...)
+	result, err := replayer.Run(ctx, f)
+	log.Info("Reprocessed dead-lettered messages",
+		"file", file, "succeeded", result.Succeeded, "failed", result.Failed)
+	if err != nil {
+		return fmt.Errorf("failed to reprocess %s: %w", file, err)
+	}
+	if result.Failed > 0 {
+		return fmt.Errorf("%d of %d messages in %s failed to reprocess",
+			result.Failed, result.Succeeded+result.Failed, file)
+	}
+	return nil
+}
+
+// openStorage connects the configured transaction store; db is nil for the
+// in-memory store, and closeDB releases the connection
+func openStorage(ctx context.Context, cfg *config.Config, log logger.Logger) (*gorm.DB, repositories.TransactionRepository, func(), error) {
+	if cfg.Database.IsMemory() {
+		log.Warn("Storing transactions in memory, they are lost on shutdown")
+		return nil, memory.NewTransactionRepository(log), func() {}, nil
+	}
+
+	db, err := postgres.NewConnection(ctx, cfg.Database, cfg.App)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	closeDB := func() {
+		if err := postgres.CloseConnection(db); err != nil {
+			log.Error("Failed to close database connection", "error", err)
+		} else {
+			log.Info("Database connection closed successfully")
+		}
+	}
+
+	transactionRepo := postgres.NewTransactionRepository(db, log,
+		postgres.WithTableName(cfg.Database.TableName),
+		postgres.WithQueryTimeout(cfg.Database.QueryTimeout),
+		postgres.WithReadTimeout(cfg.Database.ReadTimeout),
+		postgres.WithWriteTimeout(cfg.Database.WriteTimeout),
+	)
+	return db, transactionRepo, closeDB, nil
+}
+
+// seekConsumerGroup commits the recovery point configured by
+// KAFKA_SEEK_OFFSET or KAFKA_SEEK_TIME, if any, for the consumer group to
+// resume from
+func seekConsumerGroup(ctx context.Context, cfg *config.Config, log logger.Logger) error {
+	if cfg.Kafka.SeekOffset < 0 && cfg.Kafka.SeekTime.IsZero() {
+		return nil
+	}
+
+	seeker, err := kafkainfra.NewGroupSeeker(cfg.Kafka)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer group seeker: %w", err)
+	}
+	if cfg.Kafka.SeekOffset >= 0 {
+		if err := seeker.Seek(ctx, cfg.Kafka.SeekPartition, cfg.Kafka.SeekOffset); err != nil {
+			return fmt.Errorf("failed to seek Kafka consumer group: %w", err)
+		}
+		log.Info("Consumer group seeked to offset", "groupID", cfg.Kafka.GroupID,
+			"partition", cfg.Kafka.SeekPartition, "offset", cfg.Kafka.SeekOffset)
+		return nil
+	}
+
+	if err := seeker.SeekToTime(ctx, cfg.Kafka.SeekTime); err != nil {
+		return fmt.Errorf("failed to seek Kafka consumer group: %w", err)
+	}
+	log.Info("Consumer group seeked to time", "groupID", cfg.Kafka.GroupID,
+		"time", cfg.Kafka.SeekTime.Format(time.RFC3339))
+	return nil
+}
+
+// resolveBrokers replaces a KAFKA_BROKERS SRV entry by the brokers it
+// resolves to, so every Kafka client connects to the same list
+func resolveBrokers(ctx context.Context, cfg *config.Config, log logger.Logger) error {
+	brokers, err := kafkainfra.ResolveBrokers(ctx, cfg.Kafka.Brokers, net.DefaultResolver)
+	if err != nil {
+		return fmt.Errorf("failed to resolve Kafka brokers: %w", err)
+	}
+	if !slices.Equal(brokers, cfg.Kafka.Brokers) {
+		log.Info("Resolved Kafka brokers from DNS SRV", "record", cfg.Kafka.Brokers[0], "brokers", brokers)
+	}
+	cfg.Kafka.Brokers = brokers
+	return nil
+}
+
+// openPersistedEventPublisher connects the publisher of persisted events when
+// KAFKA_PERSISTED_TOPIC is set, returning the use case option publishing to
+// it and the function closing it
+func openPersistedEventPublisher(cfg *config.Config, log logger.Logger) (usecases.Option, func(), error) {
+	if cfg.Kafka.PersistedTopic == "" {
+		return usecases.WithPersistedEventPublisher(nil), func() {}, nil
+	}
+
+	publisher, err := kafkainfra.NewPersistedEventPublisher(cfg.Kafka)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create persisted event publisher: %w", err)
+	}
+	closePublisher := func() {
+		if err := publisher.Close(); err != nil {
+			log.Error("Failed to close persisted event publisher", "error", err)
+		}
+	}
+	return usecases.WithPersistedEventPublisher(publisher), closePublisher, nil
+}
+
+// newTransactionUseCase wires the use case storing transactions in
+// transactionRepo behind a circuit breaker; opts apply after the configured
+// options
+func newTransactionUseCase(cfg *config.Config, log logger.Logger, db *gorm.DB, transactionRepo repositories.TransactionRepository, opts ...usecases.Option) usecases.TransactionUseCase {
+	usecaseOpts := []usecases.Option{
+		usecases.WithRejectBalanceMismatch(cfg.App.RejectBalanceMismatch),
+		usecases.WithRejectBalanceMagnitudeMismatch(cfg.App.RejectBalanceMagnitudeMismatch),
+		usecases.WithBalanceContinuityCheck(cfg.App.BalanceContinuityCheck),
+		usecases.WithDuplicateDiff(cfg.App.DuplicateDiffEnabled),
+		usecases.WithAmountSignNormalization(cfg.App.NormalizeAmountSign),
+		usecases.WithAllowZeroAmount(cfg.App.AllowZeroAmount),
+		usecases.WithTransactionalOffsets(cfg.App.TransactionalOffsetsEnabled),
+		usecases.WithReprocessing(cfg.App.ReprocessEnabled),
+		usecases.WithDryRun(cfg.App.DryRun),
+		usecases.WithDedupCache(cfg.App.DedupCacheSize),
+		usecases.WithPersistedEventRequired(cfg.Kafka.PersistedEventRequired),
+		usecases.WithDefaultCurrency(cfg.App.DefaultCurrency),
+		usecases.WithValidators(cfg.App.Validators...),
+		usecases.WithTransactionTypes(cfg.App.TransactionTypes...),
+		usecases.WithTransactionStatuses(cfg.App.TransactionStatuses...),
+		usecases.WithValidateAll(cfg.App.ValidateAll),
+	}
+	if cfg.App.AuditLogEnabled {
+		usecaseOpts = append(usecaseOpts, usecases.WithAuditSink(postgres.NewAuditLogRepository(db, log)))
+	}
+	usecaseOpts = append(usecaseOpts, opts...)
+	transactionRepo = usecases.NewCircuitBreakerRepository(transactionRepo, log, cfg.Database.BreakerThreshold, cfg.Database.BreakerCooldown)
+	return usecases.NewTransactionUseCase(transactionRepo, log, usecaseOpts...)
+}
+
+// newTransactionHandler wires the handler decoding messages into
+// transactionUsecase, applying opts after the configured options
+func newTransactionHandler(cfg *config.Config, log logger.Logger, db *gorm.DB, transactionUsecase usecases.TransactionUseCase, opts ...kafkahandler.Option) *kafkahandler.TransactionHandler {
+	handlerOpts := []kafkahandler.Option{
+		kafkahandler.WithMaxMessageSize(cfg.Kafka.MaxMessageBytes),
+		kafkahandler.WithStrictDecoding(cfg.Kafka.StrictDecoding),
+		kafkahandler.WithTenantHeader(cfg.Kafka.TenantHeader),
+		kafkahandler.WithRequiredHeaders(cfg.Kafka.RequiredHeaders...),
+		kafkahandler.WithRedactedFields(cfg.App.LogRedactFields...),
+		kafkahandler.WithAllowedTypes(cfg.App.AllowedTransactionTypes...),
+		kafkahandler.WithRawPayload(cfg.App.StoreRawPayload),
+	}
+	if cfg.App.ProcessingLogEnabled && !cfg.App.DryRun {
+		handlerOpts = append(handlerOpts, kafkahandler.WithProcessingLog(postgres.NewProcessingLogRepository(db, log)))
+	}
+	switch {
+	case cfg.Kafka.IsAvro():
+		handlerOpts = append(handlerOpts, kafkahandler.WithAvro(schemaregistry.NewClient(cfg.Kafka.SchemaRegistryURL)))
+	case cfg.Kafka.IsProtobuf():
+		handlerOpts = append(handlerOpts, kafkahandler.WithProtobuf())
+	}
+	return kafkahandler.NewTransactionHandler(transactionUsecase, log, append(handlerOpts, opts...)...)
 }
@@ -0,0 +1,112 @@
+package deliveries
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/infrastructures/metrics"
+	"transaction-consumer/internal/infrastructures/schemaregistry"
+
+	"github.com/hamba/avro/v2"
+)
+
+// ParseErrorUnknownSchema marks Avro messages whose schema ID is not registered
+const ParseErrorUnknownSchema = "unknown_schema"
+
+// confluentHeaderSize is the length of the Confluent wire-format prefix: a
+// zero magic byte followed by a big-endian 4-byte schema ID
+const confluentHeaderSize = 5
+
+// SchemaRegistry resolves Avro writer schemas by their registry ID
+type SchemaRegistry interface {
+	Schema(ctx context.Context, id int) (avro.Schema, error)
+}
+
+// WithAvro decodes messages as Confluent wire-format Avro, resolving their
+// schemas through registry, instead of JSON
+func WithAvro(registry SchemaRegistry) Option {
+	return func(h *TransactionHandler) {
+		h.schemaRegistry = registry
+	}
+}
+
+// avroTransactionMessage mirrors KafkaTransactionMessage for Avro payloads;
+// timestamps use the timestamp-millis or timestamp-micros logical types
+type avroTransactionMessage struct {
+	ID                       string    `avro:"id"`
+	UserID                   int64     `avro:"userId"`
+	AccountID                string    `avro:"accountId"`
+	TransactionID            string    `avro:"transactionId"`
+	TransactionType          string    `avro:"transactionType"`
+	TransactionStatus        string    `avro:"transactionStatus"`
+	Amount                   float64   `avro:"amount"`
+	BalanceBefore            float64   `avro:"balanceBefore"`
+	BalanceAfter             float64   `avro:"balanceAfter"`
+	Currency                 string    `avro:"currency"`
+	Description              *string   `avro:"description"`
+	ExternalReference        *string   `avro:"externalReference"`
+	PaymentMethod            *string   `avro:"paymentMethod"`
+	Metadata                 *string   `avro:"metadata"`
+	IsAccessibleFromExternal bool      `avro:"isAccessibleFromExternal"`
+	CreatedAt                time.Time `avro:"createdAt"`
+	UpdatedAt                time.Time `avro:"updatedAt"`
+}
+
+// decodeAvro decodes a Confluent wire-format Avro message
+func (h *TransactionHandler) decodeAvro(ctx context.Context, message []byte) (*entities.Transaction, error) {
+	if len(message) < confluentHeaderSize || message[0] != 0 {
+		metrics.ParseErrors.WithLabelValues(ParseErrorMalformed).Inc()
+		return nil, consumer.NewPermanentError(ParseErrorMalformed, errors.New("missing Confluent wire-format prefix"))
+	}
+
+	schemaID := int(binary.BigEndian.Uint32(message[1:confluentHeaderSize]))
+	schema, err := h.schemaRegistry.Schema(ctx, schemaID)
+	if err != nil {
+		if errors.Is(err, schemaregistry.ErrSchemaNotFound) {
+			metrics.ParseErrors.WithLabelValues(ParseErrorUnknownSchema).Inc()
+			return nil, consumer.NewPermanentError(ParseErrorUnknownSchema, err)
+		}
+		return nil, fmt.Errorf("failed to resolve schema %d: %w", schemaID, err)
+	}
+
+	var avroMsg avroTransactionMessage
+	if err := avro.Unmarshal(schema, message[confluentHeaderSize:], &avroMsg); err != nil {
+		metrics.ParseErrors.WithLabelValues(ParseErrorMalformed).Inc()
+		return nil, consumer.NewPermanentError(ParseErrorMalformed, fmt.Errorf("failed to decode avro message: %w", err))
+	}
+
+	kafkaMsg := KafkaTransactionMessage{
+		ID:                       avroMsg.ID,
+		UserID:                   avroMsg.UserID,
+		AccountID:                avroMsg.AccountID,
+		TransactionID:            avroMsg.TransactionID,
+		TransactionType:          avroMsg.TransactionType,
+		TransactionStatus:        avroMsg.TransactionStatus,
+		Amount:                   avroMsg.Amount,
+		BalanceBefore:            avroMsg.BalanceBefore,
+		BalanceAfter:             avroMsg.BalanceAfter,
+		Currency:                 avroMsg.Currency,
+		ExternalReference:        avroMsg.ExternalReference,
+		Metadata:                 avroMsg.Metadata,
+		IsAccessibleFromExternal: avroMsg.IsAccessibleFromExternal,
+	}
+	if avroMsg.Description != nil {
+		kafkaMsg.Description = *avroMsg.Description
+	}
+	if avroMsg.PaymentMethod != nil {
+		kafkaMsg.PaymentMethod = *avroMsg.PaymentMethod
+	}
+
+	if err := validateMessage(&kafkaMsg); err != nil {
+		return nil, err
+	}
+
+	ctx = h.withTransactionLogger(ctx, kafkaMsg.TransactionID)
+	return newTransaction(&kafkaMsg,
+		h.timestampOrNow(ctx, avroMsg.CreatedAt, "createdAt"),
+		h.timestampOrNow(ctx, avroMsg.UpdatedAt, "updatedAt")), nil
+}
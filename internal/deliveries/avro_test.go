@@ -0,0 +1,169 @@
+package deliveries
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/infrastructures/schemaregistry"
+
+	"github.com/hamba/avro/v2"
+)
+
+const testTransactionSchema = `{
+	"type": "record",
+	"name": "Transaction",
+	"namespace": "com.onegate.payment",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "userId", "type": "long"},
+		{"name": "accountId", "type": "string"},
+		{"name": "transactionId", "type": "string"},
+		{"name": "transactionType", "type": "string"},
+		{"name": "transactionStatus", "type": "string"},
+		{"name": "amount", "type": "double"},
+		{"name": "balanceBefore", "type": "double"},
+		{"name": "balanceAfter", "type": "double"},
+		{"name": "currency", "type": "string"},
+		{"name": "description", "type": ["null", "string"], "default": null},
+		{"name": "externalReference", "type": ["null", "string"], "default": null},
+		{"name": "paymentMethod", "type": ["null", "string"], "default": null},
+		{"name": "metadata", "type": ["null", "string"], "default": null},
+		{"name": "isAccessibleFromExternal", "type": "boolean"},
+		{"name": "createdAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "updatedAt", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "producer", "type": "string", "default": ""}
+	]
+}`
+
+// newStubRegistry serves testTransactionSchema under schemaID and counts lookups
+func newStubRegistry(t *testing.T, schemaID int, lookups *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*lookups++
+		if r.URL.Path != fmt.Sprintf("/schemas/ids/%d", schemaID) {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"schema": testTransactionSchema})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// confluentPayload encodes record with testTransactionSchema in the
+// Confluent wire format
+func confluentPayload(t *testing.T, schemaID int, record map[string]any) []byte {
+	t.Helper()
+	schema := avro.MustParse(testTransactionSchema)
+	body, err := avro.Marshal(schema, record)
+	if err != nil {
+		t.Fatalf("Failed to encode avro record: %v", err)
+	}
+
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(schemaID))
+	return append(header, body...)
+}
+
+func testAvroRecord() map[string]any {
+	description := "Avro transaction"
+	createdAt := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC)
+	return map[string]any{
+		"id":                       "trans-id-123",
+		"userId":                   int64(456),
+		"accountId":                "account-456",
+		"transactionId":            "trans-avro",
+		"transactionType":          "TOPUP",
+		"transactionStatus":        "SUCCESS",
+		"amount":                   250.75,
+		"balanceBefore":            1000.0,
+		"balanceAfter":             1250.75,
+		"currency":                 "IDR",
+		"description":              &description,
+		"externalReference":        nil,
+		"paymentMethod":            map[string]any{"string": "GOPAY"},
+		"metadata":                 nil,
+		"isAccessibleFromExternal": true,
+		"createdAt":                createdAt,
+		"updatedAt":                createdAt,
+		"producer":                 "payment-service",
+	}
+}
+
+func TestTransactionHandler_Handle_Avro(t *testing.T) {
+	var lookups int
+	registry := schemaregistry.NewClient(newStubRegistry(t, 42, &lookups).URL)
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithAvro(registry))
+
+	payload := confluentPayload(t, 42, testAvroRecord())
+	for i := 0; i < 2; i++ {
+		if err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: payload}); err != nil {
+			t.Fatalf("Handle should not return error, got: %v", err)
+		}
+	}
+
+	if lookups != 1 {
+		t.Errorf("Expected schema to be fetched once, got %d lookups", lookups)
+	}
+	if len(mockUseCase.processed) != 2 {
+		t.Fatalf("Expected 2 processed transactions, got %d", len(mockUseCase.processed))
+	}
+
+	tx := mockUseCase.processed[0]
+	if tx.TransactionID != "trans-avro" {
+		t.Errorf("Expected transaction ID trans-avro, got %s", tx.TransactionID)
+	}
+	if tx.TransactionType != entities.TransactionTypeTopup {
+		t.Errorf("Expected transaction type TOPUP, got %s", tx.TransactionType)
+	}
+	if tx.UserID != 456 || tx.Amount != 250.75 || tx.BalanceAfter != 1250.75 {
+		t.Errorf("Unexpected numeric fields: %+v", tx)
+	}
+	if tx.Description == nil || *tx.Description != "Avro transaction" {
+		t.Errorf("Expected description to be decoded, got %v", tx.Description)
+	}
+	if tx.PaymentMethod == nil || *tx.PaymentMethod != "GOPAY" {
+		t.Errorf("Expected payment method GOPAY, got %v", tx.PaymentMethod)
+	}
+	if tx.ExternalReference != nil {
+		t.Errorf("Expected nil external reference, got %v", *tx.ExternalReference)
+	}
+	if expected := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC); !tx.CreatedAt.Equal(expected) {
+		t.Errorf("Expected createdAt %v, got %v", expected, tx.CreatedAt)
+	}
+}
+
+func TestTransactionHandler_Handle_AvroErrors(t *testing.T) {
+	var lookups int
+	registry := schemaregistry.NewClient(newStubRegistry(t, 42, &lookups).URL)
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{}, WithAvro(registry))
+
+	tests := []struct {
+		name   string
+		value  []byte
+		reason string
+	}{
+		{"missing prefix", []byte(`{"transactionId":"trans-json"}`), ParseErrorMalformed},
+		{"too short", []byte{0, 0, 0}, ParseErrorMalformed},
+		{"unknown schema", confluentPayload(t, 7, testAvroRecord()), ParseErrorUnknownSchema},
+		{"truncated body", confluentPayload(t, 42, testAvroRecord())[:12], ParseErrorMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: tt.value})
+			reason, ok := consumer.IsPermanent(err)
+			if !ok || reason != tt.reason {
+				t.Errorf("Expected permanent %q error, got %v", tt.reason, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package deliveries
+
+import "time"
+
+// Clock tells the time used for message timestamps the producer did not
+// provide and for processing log entries
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock reading the system time
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,195 @@
+package deliveries
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/infrastructures/metrics"
+	"transaction-consumer/pkg/logger"
+	"unicode"
+)
+
+// Message schema versions understood by the handler; messages without a
+// schemaVersion are treated as SchemaVersionV1
+const (
+	SchemaVersionV1 = 1
+	SchemaVersionV2 = 2
+)
+
+// ParseErrorUnsupportedVersion marks messages with an unknown schema version
+const ParseErrorUnsupportedVersion = "unsupported_version"
+
+// KafkaTransactionMessageV2 is the v2 message format, which carries RFC3339
+// timestamps instead of Java LocalDateTime arrays
+type KafkaTransactionMessageV2 struct {
+	KafkaTransactionMessage
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// decode routes message to the decoder matching its format and schema version
+func (h *TransactionHandler) decode(ctx context.Context, message []byte) (*entities.Transaction, error) {
+	switch {
+	case h.schemaRegistry != nil:
+		return h.decodeAvro(ctx, message)
+	case h.protobuf:
+		return h.decodeProtobuf(ctx, message)
+	}
+
+	message = camelCaseKeys(message)
+
+	var envelope struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return nil, parseError(err)
+	}
+
+	switch envelope.SchemaVersion {
+	case 0, SchemaVersionV1:
+		return h.decodeV1(ctx, message)
+	case SchemaVersionV2:
+		return h.decodeV2(ctx, message)
+	default:
+		metrics.ParseErrors.WithLabelValues(ParseErrorUnsupportedVersion).Inc()
+		return nil, consumer.NewPermanentError(ParseErrorUnsupportedVersion,
+			fmt.Errorf("unsupported schema version: %d", envelope.SchemaVersion))
+	}
+}
+
+// decodeV1 decodes the original message format
+func (h *TransactionHandler) decodeV1(ctx context.Context, message []byte) (*entities.Transaction, error) {
+	var kafkaMsg KafkaTransactionMessage
+	if err := h.unmarshal(message, &kafkaMsg); err != nil {
+		return nil, parseError(err)
+	}
+	if err := validateMessage(&kafkaMsg); err != nil {
+		return nil, err
+	}
+
+	transaction, err := h.kafkaMessageToEntity(h.withTransactionLogger(ctx, kafkaMsg.TransactionID), &kafkaMsg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert message to entities: %w", err)
+	}
+	return transaction, nil
+}
+
+// decodeV2 decodes the v2 message format
+func (h *TransactionHandler) decodeV2(ctx context.Context, message []byte) (*entities.Transaction, error) {
+	var kafkaMsg KafkaTransactionMessageV2
+	if err := h.unmarshal(message, &kafkaMsg); err != nil {
+		return nil, parseError(err)
+	}
+	if err := validateMessage(&kafkaMsg.KafkaTransactionMessage); err != nil {
+		return nil, err
+	}
+
+	ctx = h.withTransactionLogger(ctx, kafkaMsg.TransactionID)
+	return newTransaction(&kafkaMsg.KafkaTransactionMessage,
+		h.timestampOrNow(ctx, kafkaMsg.CreatedAt, "createdAt"),
+		h.timestampOrNow(ctx, kafkaMsg.UpdatedAt, "updatedAt")), nil
+}
+
+// unmarshal decodes message into v, rejecting unknown fields in strict mode
+func (h *TransactionHandler) unmarshal(message []byte, v any) error {
+	if !h.strictDecoding {
+		return json.Unmarshal(message, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("invalid data after top-level value")
+	}
+	return nil
+}
+
+// camelCaseKeys renames the snake_case top-level keys of a JSON object to
+// the camelCase keys of the message structs; a key present in both forms
+// keeps its camelCase value. Messages that are not JSON objects are returned
+// unchanged for the decoder to reject
+func camelCaseKeys(message []byte) []byte {
+	if !bytes.Contains(message, []byte("_")) {
+		return message
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return message
+	}
+
+	renamed := false
+	for key, value := range fields {
+		if !strings.Contains(key, "_") {
+			continue
+		}
+		camel := snakeToCamel(key)
+		if _, ok := fields[camel]; !ok {
+			fields[camel] = value
+		}
+		delete(fields, key)
+		renamed = true
+	}
+	if !renamed {
+		return message
+	}
+
+	normalized, err := json.Marshal(fields)
+	if err != nil {
+		return message
+	}
+	return normalized
+}
+
+// snakeToCamel converts a snake_case key such as transaction_id to
+// transactionId
+func snakeToCamel(key string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range key {
+		switch {
+		case r == '_':
+			upper = b.Len() > 0
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// timestampOrNow returns ts in UTC, falling back to the current time when the
+// message did not carry the field
+func (h *TransactionHandler) timestampOrNow(ctx context.Context, ts time.Time, field string) time.Time {
+	if ts.IsZero() {
+		logger.FromContext(ctx, h.logger).Warn("Missing timestamp, using current time", "field", field)
+		return h.clock.Now().UTC()
+	}
+	return ts.UTC()
+}
+
+// parseError classifies a JSON decoding error as a permanent failure
+func parseError(err error) error {
+	if strings.HasPrefix(err.Error(), "json: unknown field") {
+		metrics.ParseErrors.WithLabelValues(ParseErrorUnknownField).Inc()
+		return consumer.NewPermanentError(ParseErrorUnknownField, fmt.Errorf("unexpected message field: %w", err))
+	}
+	if isTruncated(err) {
+		metrics.ParseErrors.WithLabelValues(ParseErrorTruncated).Inc()
+		return consumer.NewPermanentError(ParseErrorTruncated, fmt.Errorf("truncated message: %w", err))
+	}
+	metrics.ParseErrors.WithLabelValues(ParseErrorMalformed).Inc()
+	return consumer.NewPermanentError(ParseErrorMalformed, fmt.Errorf("failed to unmarshal message: %w", err))
+}
@@ -0,0 +1,218 @@
+package deliveries
+
+import (
+	"context"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/infrastructures/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTransactionHandler_decode_V1(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	for name, message := range map[string]string{
+		"implicit": `{"userId":1,"accountId":"acc-1","transactionId":"trans-v1","transactionType":"TOPUP","amount":100,"createdAt":[2024,1,15,10,30,45],"updatedAt":[2024,1,15,10,30,45]}`,
+		"explicit": `{"schemaVersion":1,"userId":1,"accountId":"acc-1","transactionId":"trans-v1","transactionType":"TOPUP","amount":100,"createdAt":[2024,1,15,10,30,45],"updatedAt":[2024,1,15,10,30,45]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			transaction, err := handler.decode(context.Background(), []byte(message))
+			if err != nil {
+				t.Fatalf("decode should not return error, got: %v", err)
+			}
+
+			expected := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC)
+			if transaction.TransactionID != "trans-v1" {
+				t.Errorf("Expected transaction ID trans-v1, got %s", transaction.TransactionID)
+			}
+			if transaction.TransactionType != entities.TransactionTypeTopup {
+				t.Errorf("Expected transaction type TOPUP, got %s", transaction.TransactionType)
+			}
+			if !transaction.CreatedAt.Equal(expected) {
+				t.Errorf("Expected createdAt %v, got %v", expected, transaction.CreatedAt)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_decode_V2(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	message := `{"schemaVersion":2,"userId":1,"accountId":"acc-1","transactionId":"trans-v2","transactionType":"PAYMENT","paymentMethod":"GOPAY",` +
+		`"amount":50,"createdAt":"2024-01-15T17:30:45+07:00","updatedAt":"2024-01-15T10:31:00Z"}`
+
+	transaction, err := handler.decode(context.Background(), []byte(message))
+	if err != nil {
+		t.Fatalf("decode should not return error, got: %v", err)
+	}
+
+	if transaction.TransactionID != "trans-v2" {
+		t.Errorf("Expected transaction ID trans-v2, got %s", transaction.TransactionID)
+	}
+	if transaction.PaymentMethod == nil || *transaction.PaymentMethod != "GOPAY" {
+		t.Errorf("Expected payment method GOPAY, got %v", transaction.PaymentMethod)
+	}
+	if expected := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC); !transaction.CreatedAt.Equal(expected) {
+		t.Errorf("Expected createdAt %v, got %v", expected, transaction.CreatedAt)
+	}
+	if transaction.CreatedAt.Location() != time.UTC {
+		t.Errorf("Expected createdAt in UTC, got %v", transaction.CreatedAt.Location())
+	}
+	if expected := time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC); !transaction.UpdatedAt.Equal(expected) {
+		t.Errorf("Expected updatedAt %v, got %v", expected, transaction.UpdatedAt)
+	}
+}
+
+func TestTransactionHandler_decode_SnakeCaseKeys(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	camel := `{"userId":1,"accountId":"account-1","transactionId":"trans-1","transactionType":"PAYMENT",` +
+		`"transactionStatus":"SUCCESS","amount":100,"balanceBefore":1000,"balanceAfter":900,"paymentMethod":"GOPAY",` +
+		`"isAccessibleFromExternal":true,"createdAt":[2024,1,15,10,30,45],"updatedAt":[2024,1,15,10,30,45]}`
+	snake := `{"user_id":1,"account_id":"account-1","transaction_id":"trans-1","transaction_type":"PAYMENT",` +
+		`"transaction_status":"SUCCESS","amount":100,"balance_before":1000,"balance_after":900,"payment_method":"GOPAY",` +
+		`"is_accessible_from_external":true,"created_at":[2024,1,15,10,30,45],"updated_at":[2024,1,15,10,30,45]}`
+
+	expected, err := handler.decode(context.Background(), []byte(camel))
+	if err != nil {
+		t.Fatalf("decode should not return error, got: %v", err)
+	}
+	transaction, err := handler.decode(context.Background(), []byte(snake))
+	if err != nil {
+		t.Fatalf("decode should not return error, got: %v", err)
+	}
+
+	if transaction.UserID != expected.UserID ||
+		transaction.AccountID != expected.AccountID ||
+		transaction.TransactionID != expected.TransactionID ||
+		transaction.TransactionType != expected.TransactionType ||
+		transaction.TransactionStatus != expected.TransactionStatus ||
+		transaction.BalanceBefore != expected.BalanceBefore ||
+		transaction.BalanceAfter != expected.BalanceAfter ||
+		*transaction.PaymentMethod != *expected.PaymentMethod ||
+		transaction.IsAccessibleFromExternal != expected.IsAccessibleFromExternal ||
+		!transaction.CreatedAt.Equal(expected.CreatedAt) {
+		t.Errorf("snake_case message decoded to %+v, expected %+v", transaction, expected)
+	}
+}
+
+func TestTransactionHandler_decode_SnakeCaseSchemaVersion(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	transaction, err := handler.decode(context.Background(),
+		[]byte(`{"schema_version":2,"user_id":1,"account_id":"acc-1","transaction_id":"trans-v2","transaction_type":"TOPUP","created_at":"2024-01-15T10:30:45Z","updated_at":"2024-01-15T10:30:45Z"}`))
+	if err != nil {
+		t.Fatalf("decode should not return error, got: %v", err)
+	}
+	if expected := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC); !transaction.CreatedAt.Equal(expected) {
+		t.Errorf("Expected createdAt %v, got %v", expected, transaction.CreatedAt)
+	}
+}
+
+func TestCamelCaseKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{"camelCase unchanged", `{"transactionId":"TXN_1"}`, `{"transactionId":"TXN_1"}`},
+		{"snake_case renamed", `{"transaction_id":"TXN-1"}`, `{"transactionId":"TXN-1"}`},
+		{"camelCase wins", `{"transaction_id":"snake","transactionId":"camel"}`, `{"transactionId":"camel"}`},
+		{"nested keys kept", `{"metadata_json":{"inner_key":1}}`, `{"metadataJson":{"inner_key":1}}`},
+		{"not an object", `[1,"a_b"]`, `[1,"a_b"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(camelCaseKeys([]byte(tt.message))); got != tt.expected {
+				t.Errorf("camelCaseKeys(%s) = %s, expected %s", tt.message, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_decode_V2RejectsArrayTimestamps(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	_, err := handler.decode(context.Background(), []byte(`{"schemaVersion":2,"transactionId":"trans-v2","createdAt":[2024,1,15,10,30,45]}`))
+
+	if reason, ok := consumer.IsPermanent(err); !ok || reason != ParseErrorMalformed {
+		t.Errorf("Expected permanent %q error, got %v", ParseErrorMalformed, err)
+	}
+}
+
+func TestTransactionHandler_HandleMessage_UnsupportedSchemaVersion(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{})
+	before := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorUnsupportedVersion))
+
+	err := handler.HandleMessage(context.Background(), []byte(`{"schemaVersion":99,"transactionId":"trans-v99"}`))
+
+	reason, ok := consumer.IsPermanent(err)
+	if !ok || reason != ParseErrorUnsupportedVersion {
+		t.Fatalf("Expected permanent %q error, got %v", ParseErrorUnsupportedVersion, err)
+	}
+	if err.Error() != "unsupported schema version: 99" {
+		t.Errorf("Expected descriptive error, got %q", err.Error())
+	}
+	if got := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorUnsupportedVersion)) - before; got != 1 {
+		t.Errorf("Expected unsupported version metric to increase by 1, got %v", got)
+	}
+	if len(mockUseCase.processed) != 0 {
+		t.Error("No transaction should be processed for an unsupported schema version")
+	}
+}
+
+func TestTransactionHandler_decode_UnknownField(t *testing.T) {
+	messages := map[string]string{
+		"v1": `{"userId":1,"accountId":"acc-1","transactionId":"trans-1","transactionType":"TOPUP","amount":100,"transactionRef":"renamed",` +
+			`"createdAt":[2024,1,15,10,30,45],"updatedAt":[2024,1,15,10,30,45]}`,
+		"v2": `{"schemaVersion":2,"userId":1,"accountId":"acc-1","transactionId":"trans-1","transactionType":"TOPUP","amount":100,"transactionRef":"renamed",` +
+			`"createdAt":"2024-01-15T10:30:45Z","updatedAt":"2024-01-15T10:30:45Z"}`,
+	}
+
+	for version, message := range messages {
+		t.Run(version+" lenient", func(t *testing.T) {
+			handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+			transaction, err := handler.decode(context.Background(), []byte(message))
+			if err != nil {
+				t.Fatalf("decode should ignore unknown fields by default, got: %v", err)
+			}
+			if transaction.TransactionID != "trans-1" {
+				t.Errorf("Expected transaction ID trans-1, got %s", transaction.TransactionID)
+			}
+		})
+
+		t.Run(version+" strict", func(t *testing.T) {
+			handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{}, WithStrictDecoding(true))
+			before := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorUnknownField))
+
+			_, err := handler.decode(context.Background(), []byte(message))
+			if reason, ok := consumer.IsPermanent(err); !ok || reason != ParseErrorUnknownField {
+				t.Errorf("Expected permanent %q error, got %v", ParseErrorUnknownField, err)
+			}
+			if got := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorUnknownField)) - before; got != 1 {
+				t.Errorf("Expected unknown_field parse error metric to increase by 1, got %v", got)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_decode_StrictClassifiesParseErrors(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{}, WithStrictDecoding(true))
+
+	tests := map[string]string{
+		`{"transactionId":"trans-1","amount":`: ParseErrorTruncated,
+		`{"transactionId":"trans-1"} {}`:       ParseErrorMalformed,
+	}
+	for message, expected := range tests {
+		_, err := handler.decodeV1(context.Background(), []byte(message))
+		if reason, ok := consumer.IsPermanent(err); !ok || reason != expected {
+			t.Errorf("decodeV1(%s): expected permanent %q error, got %v", message, expected, err)
+		}
+	}
+}
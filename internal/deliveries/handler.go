@@ -3,29 +3,197 @@ package deliveries
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/infrastructures/metrics"
 	"transaction-consumer/internal/usecases"
 	"transaction-consumer/pkg/logger"
+	"transaction-consumer/pkg/tracing"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Parse error reasons used for metrics and dead-letter markers
+const (
+	ParseErrorTruncated = "truncated"
+	ParseErrorMalformed = "malformed"
+	ParseErrorOversized = "oversized"
+
+	// ParseErrorUnknownField marks JSON messages with fields the message
+	// structs do not know, rejected in strict decoding mode
+	ParseErrorUnknownField = "unknown_field"
+
+	ParseErrorInvalidTimestamp = "invalid_timestamp"
+
+	// ParseErrorInvalidMessage marks decoded messages failing
+	// KafkaTransactionMessage.Validate
+	ParseErrorInvalidMessage = "invalid_message"
+)
+
+// ReasonInvalidTransaction marks decoded messages rejected by validation
+const ReasonInvalidTransaction = "invalid_transaction"
+
+// ReasonPanic marks messages whose handling panicked
+const ReasonPanic = "panic"
+
+// ReasonMissingHeader marks messages lacking a required Kafka header
+const ReasonMissingHeader = "missing_header"
+
+// Sources of the event time the time in queue is measured from
+const (
+	timeInQueueMessage   = "message_timestamp"
+	timeInQueueCreatedAt = "created_at"
 )
 
 // TransactionHandler handles transaction messages from Kafka
 type TransactionHandler struct {
 	transactionUseCase usecases.TransactionUseCase
 	logger             logger.Logger
+	processingLog      repositories.ProcessingLogRepository
+	tracer             trace.Tracer
+	schemaRegistry     SchemaRegistry
+	protobuf           bool
+	maxMessageSize     int
+	strictDecoding     bool
+	tenantHeader       string
+	requiredHeaders    []string
+	clock              Clock
+	redactFields       redactFields
+	allowedTypes       map[entities.TransactionType]struct{}
+	storeRawPayload    bool
+	reprocessing       bool
+}
+
+// Option configures optional behaviour of the transaction handler
+type Option func(*TransactionHandler)
+
+// WithProcessingLog records the outcome of every settled message
+func WithProcessingLog(repo repositories.ProcessingLogRepository) Option {
+	return func(h *TransactionHandler) {
+		h.processingLog = repo
+	}
+}
+
+// WithTracerProvider traces message handling with tp
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(h *TransactionHandler) {
+		h.tracer = tracing.Tracer(tp)
+	}
+}
+
+// WithMaxMessageSize rejects messages larger than size bytes before decoding
+// them; zero disables the limit
+func WithMaxMessageSize(size int) Option {
+	return func(h *TransactionHandler) {
+		h.maxMessageSize = size
+	}
+}
+
+// WithStrictDecoding rejects JSON messages carrying fields the message
+// structs do not know, so a renamed field is dead-lettered instead of
+// silently decoded as its zero value
+func WithStrictDecoding(strict bool) Option {
+	return func(h *TransactionHandler) {
+		h.strictDecoding = strict
+	}
+}
+
+// WithTenantHeader stores the value of the header name, e.g. "tenant-id", as
+// the tenant of every transaction; messages without it have no tenant unless
+// the header is also required
+func WithTenantHeader(name string) Option {
+	return func(h *TransactionHandler) {
+		h.tenantHeader = name
+	}
+}
+
+// WithRequiredHeaders rejects messages lacking any of the headers names
+// before decoding them, dead-lettering them
+func WithRequiredHeaders(names ...string) Option {
+	return func(h *TransactionHandler) {
+		h.requiredHeaders = names
+	}
+}
+
+// WithClock replaces the system clock, e.g. with a fixed one in tests
+func WithClock(clock Clock) Option {
+	return func(h *TransactionHandler) {
+		h.clock = clock
+	}
+}
+
+// WithRedactedFields masks the values of the message fields names, e.g.
+// "accountId", wherever messages and decoded transactions are logged
+func WithRedactedFields(names ...string) Option {
+	return func(h *TransactionHandler) {
+		h.redactFields = newRedactFields(names)
+	}
+}
+
+// WithAllowedTypes skips transactions of any other type than types without
+// storing them; no types allow all
+func WithAllowedTypes(types ...string) Option {
+	return func(h *TransactionHandler) {
+		if len(types) == 0 {
+			h.allowedTypes = nil
+			return
+		}
+		h.allowedTypes = make(map[entities.TransactionType]struct{}, len(types))
+		for _, t := range types {
+			h.allowedTypes[entities.TransactionType(strings.ToUpper(strings.TrimSpace(t)))] = struct{}{}
+		}
+	}
+}
+
+// WithRawPayload stores the received message with every transaction. JSON
+// messages are stored as is, binary Avro and protobuf ones as a base64 JSON
+// string since the column holds JSON
+func WithRawPayload(store bool) Option {
+	return func(h *TransactionHandler) {
+		h.storeRawPayload = store
+	}
+}
+
+// WithReprocessing stores transactions through ReprocessTransaction,
+// overwriting the stored rows instead of skipping transactions already
+// processed; it is meant for replaying messages, not for normal consumption
+func WithReprocessing(enabled bool) Option {
+	return func(h *TransactionHandler) {
+		h.reprocessing = enabled
+	}
 }
 
 // NewTransactionHandler creates a new transaction handler
-func NewTransactionHandler(uc usecases.TransactionUseCase, log logger.Logger) *TransactionHandler {
-	return &TransactionHandler{
+func NewTransactionHandler(uc usecases.TransactionUseCase, log logger.Logger, opts ...Option) *TransactionHandler {
+	h := &TransactionHandler{
 		transactionUseCase: uc,
 		logger:             log,
+		tracer:             tracing.Tracer(nil),
+		clock:              systemClock{},
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-// KafkaTransactionMessage represents the incoming Kafka message structure
+// KafkaTransactionMessage represents the incoming Kafka message structure.
+// Keys may be camelCase, as tagged, or snake_case, e.g. transaction_id;
+// userId, accountId, transactionId, which the message key may supply,
+// transactionType and amount are required
 type KafkaTransactionMessage struct {
+	SchemaVersion            int           `json:"schemaVersion,omitempty"`
 	ID                       string        `json:"id"`
 	UserID                   int64         `json:"userId"`
 	AccountID                string        `json:"accountId"`
@@ -45,47 +213,413 @@ type KafkaTransactionMessage struct {
 	UpdatedAt                []interface{} `json:"updatedAt"`
 }
 
-// HandleMessage handles incoming transaction messages
+// maxTransactionIDLength is the size of the varchar transaction_id column
+const maxTransactionIDLength = 50
+
+// Validate checks the shape of a decoded message before it is converted to a
+// transaction. transactionId may be empty as the message key may supply it,
+// which Handle checks once it did, and missing timestamps fall back to the
+// current time
+func (m *KafkaTransactionMessage) Validate() error {
+	if m.TransactionID != "" {
+		if err := validateTransactionID(m.TransactionID); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case m.UserID <= 0:
+		return fmt.Errorf("userId must be positive, got: %d", m.UserID)
+	case strings.TrimSpace(m.AccountID) == "":
+		return errors.New("accountId is required")
+	case strings.TrimSpace(m.TransactionType) == "":
+		return errors.New("transactionType is required")
+	}
+
+	for _, amount := range []struct {
+		field string
+		value float64
+	}{
+		{"amount", m.Amount},
+		{"balanceBefore", m.BalanceBefore},
+		{"balanceAfter", m.BalanceAfter},
+	} {
+		if amount.value < 0 {
+			return fmt.Errorf("%s must not be negative, got: %v", amount.field, amount.value)
+		}
+	}
+
+	for _, timestamp := range []struct {
+		field string
+		value []interface{}
+	}{
+		{"createdAt", m.CreatedAt},
+		{"updatedAt", m.UpdatedAt},
+	} {
+		if len(timestamp.value) > len(timestampFields) {
+			return fmt.Errorf("%s must have at most %d elements, got: %d",
+				timestamp.field, len(timestampFields), len(timestamp.value))
+		}
+		if len(timestamp.value) > 0 && len(timestamp.value) < minTimestampElements {
+			return fmt.Errorf("%s must have at least %d elements, got: %d",
+				timestamp.field, minTimestampElements, len(timestamp.value))
+		}
+	}
+	return nil
+}
+
+// validateTransactionID checks that id, from the message or its key, is set
+// and fits the transaction_id column
+func validateTransactionID(id string) error {
+	if strings.TrimSpace(id) == "" {
+		return errors.New("transactionId is required")
+	}
+	if length := utf8.RuneCountInString(id); length > maxTransactionIDLength {
+		return fmt.Errorf("transactionId must be at most %d characters, got: %d", maxTransactionIDLength, length)
+	}
+	return nil
+}
+
+// validateMessage fails msg permanently when it does not pass Validate
+func validateMessage(msg *KafkaTransactionMessage) error {
+	if err := msg.Validate(); err != nil {
+		return invalidMessage(err)
+	}
+	return nil
+}
+
+// invalidMessage fails a message permanently with err found validating it
+func invalidMessage(err error) error {
+	metrics.ParseErrors.WithLabelValues(ParseErrorInvalidMessage).Inc()
+	return consumer.NewPermanentError(ParseErrorInvalidMessage, fmt.Errorf("invalid message: %w", err))
+}
+
+// HandleMessage handles a raw transaction message without Kafka metadata
 func (h *TransactionHandler) HandleMessage(ctx context.Context, message []byte) error {
-	h.logger.Debug("Received message", "message", string(message))
+	return h.Handle(ctx, consumer.ConsumedMessage{Value: message})
+}
+
+// Handle handles an incoming transaction message
+func (h *TransactionHandler) Handle(ctx context.Context, msg consumer.ConsumedMessage) (err error) {
+	receivedAt := h.clock.Now().UTC()
+	message := msg.Value
+	var transactionID string
 
-	// Parse message
-	var kafkaMsg KafkaTransactionMessage
-	if err := json.Unmarshal(message, &kafkaMsg); err != nil {
-		return fmt.Errorf("failed to unmarshal message: %w", err)
+	ctx, span := h.tracer.Start(ctx, "kafka.process", trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.Int("partition", msg.Partition),
+			attribute.Int64("offset", msg.Offset),
+		))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	// Failures are logged at Debug only, as the consumer logs every failed
+	// attempt at Error
+	log := logger.FromContext(ctx, h.logger)
+	defer func() {
+		if err != nil {
+			log.Debug("Failed to handle message",
+				"partition", msg.Partition, "offset", msg.Offset, "transactionID", transactionID, "error", err)
+		}
+	}()
+
+	// Only the attempt settling the message is recorded, not the failed
+	// attempts the consumer retries
+	if h.processingLog != nil {
+		defer func() {
+			if settles(msg, err) {
+				h.recordOutcome(ctx, transactionID, receivedAt, err)
+			}
+		}()
 	}
 
-	h.logger.Debug("Unmarshalled message", "message", kafkaMsg)
+	// Registered last so the recovered error is seen by the deferred logging
+	// and processing log above
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("Recovered from panic while handling message",
+				"partition", msg.Partition, "offset", msg.Offset, "panic", r,
+				"message", redact(message, h.redactFields), "stack", string(debug.Stack()))
+			err = consumer.NewPermanentError(ReasonPanic, fmt.Errorf("panic while handling message: %v", r))
+		}
+	}()
 
-	// Convert to domain entities
-	transaction, err := h.kafkaMessageToEntity(&kafkaMsg)
+	log.Debug("Received message", "message", redact(message, h.redactFields))
+
+	// Compacted topics delete a key with a null value; there is nothing to
+	// store, so the tombstone is committed past like a handled message
+	if len(message) == 0 {
+		log.Debug("Skipping tombstone message", "key", string(msg.Key),
+			"partition", msg.Partition, "offset", msg.Offset)
+		return nil
+	}
+
+	// Refuse oversized payloads before decoding allocates for them
+	if h.maxMessageSize > 0 && len(message) > h.maxMessageSize {
+		metrics.ParseErrors.WithLabelValues(ParseErrorOversized).Inc()
+		return consumer.NewPermanentError(ParseErrorOversized,
+			fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", len(message), h.maxMessageSize))
+	}
+
+	if err := h.checkRequiredHeaders(msg); err != nil {
+		return err
+	}
+
+	// Decode message according to its format and schema version
+	transaction, err := h.decode(ctx, message)
 	if err != nil {
-		return fmt.Errorf("failed to convert message to entities: %w", err)
+		return err
+	}
+	if h.tenantHeader != "" {
+		transaction.TenantID, _ = msg.Header(h.tenantHeader)
+	}
+	if h.storeRawPayload {
+		transaction.RawPayload = rawPayload(message)
+	}
+
+	log.Debug("Decoded message", "transaction", redactValue(transaction, h.redactFields))
+
+	// The message key is a dedup hint for producers that omit the payload id
+	if transaction.TransactionID == "" && len(msg.Key) > 0 {
+		transaction.TransactionID = string(msg.Key)
+		log.Debug("Using message key as transaction ID", "key", transaction.TransactionID)
+	}
+	transactionID = transaction.TransactionID
+	span.SetAttributes(attribute.String("transactionId", transactionID))
+	if err := validateTransactionID(transactionID); err != nil {
+		return invalidMessage(err)
+	}
+
+	if !h.isAllowedType(transaction.TransactionType) {
+		metrics.FilteredMessages.WithLabelValues(string(transaction.TransactionType)).Inc()
+		log.Debug("Skipping transaction of filtered type",
+			"transactionID", transactionID, "type", transaction.TransactionType)
+		return nil
+	}
+
+	// Scope every downstream log line to this transaction
+	ctx = h.withTransactionLogger(ctx, transactionID)
+
+	// Let the use case persist the message position with the transaction
+	if msg.Topic != "" {
+		ctx = usecases.ContextWithOffset(ctx, &entities.ProcessedOffset{
+			Topic:     msg.Topic,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+		})
+	}
+
+	if h.reprocessing {
+		return h.reprocess(ctx, transaction)
 	}
 
 	// Process transaction through use case
-	if err := h.transactionUseCase.ProcessTransaction(ctx, transaction); err != nil {
+	result, err := h.transactionUseCase.ProcessTransaction(ctx, transaction)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecases.ErrDuplicateTransaction):
+			// Another consumer stored it first, which is what we wanted
+			log.Info("Transaction stored concurrently, skipping", "transactionID", transactionID)
+			metrics.ProcessResults.WithLabelValues(string(usecases.ProcessResultSkipped)).Inc()
+			return nil
+		case errors.Is(err, usecases.ErrInvalidTransaction):
+			return consumer.NewPermanentError(ReasonInvalidTransaction,
+				fmt.Errorf("failed to process transaction: %w", err))
+		case errors.Is(err, usecases.ErrCircuitOpen):
+			// Waiting for the database must not use up the retries
+			return consumer.NewUnavailableError(fmt.Errorf("failed to process transaction: %w", err))
+		}
 		return fmt.Errorf("failed to process transaction: %w", err)
 	}
 
+	observeTimeInQueue(msg, transaction, h.clock.Now())
+	metrics.ProcessResults.WithLabelValues(string(result)).Inc()
+	switch result {
+	case usecases.ProcessResultSkipped:
+		log.Debug("Transaction skipped", "transactionID", transactionID)
+		return nil
+	case usecases.ProcessResultSpilled:
+		// Not stored yet; the spill drain stores it once the database recovers
+		return nil
+	}
+	metrics.TransactionsProcessed.WithLabelValues(strconv.Itoa(msg.Partition)).Inc()
+	log.Debug("Transaction stored", "transactionID", transactionID, "result", result)
+	return nil
+}
+
+// reprocess overwrites the stored transaction with the replayed one
+func (h *TransactionHandler) reprocess(ctx context.Context, transaction *entities.Transaction) error {
+	if err := h.transactionUseCase.ReprocessTransaction(ctx, transaction); err != nil {
+		switch {
+		case errors.Is(err, usecases.ErrInvalidTransaction):
+			return consumer.NewPermanentError(ReasonInvalidTransaction,
+				fmt.Errorf("failed to reprocess transaction: %w", err))
+		case errors.Is(err, usecases.ErrCircuitOpen):
+			return consumer.NewUnavailableError(fmt.Errorf("failed to reprocess transaction: %w", err))
+		}
+		return fmt.Errorf("failed to reprocess transaction: %w", err)
+	}
+	return nil
+}
+
+// observeTimeInQueue records how long the event of transaction waited until
+// processedAt, measured from the message timestamp when the producer or broker
+// set one and from the transaction createdAt otherwise
+func observeTimeInQueue(msg consumer.ConsumedMessage, transaction *entities.Transaction, processedAt time.Time) {
+	source, occurredAt := timeInQueueMessage, msg.Timestamp
+	if occurredAt.IsZero() {
+		source, occurredAt = timeInQueueCreatedAt, transaction.CreatedAt
+	}
+	if occurredAt.IsZero() {
+		return
+	}
+	// Clock skew may put the event time slightly ahead of ours
+	latency := max(processedAt.Sub(occurredAt), 0)
+	metrics.TimeInQueue.WithLabelValues(source).Observe(latency.Seconds())
+}
+
+// rawPayload returns message as a JSON document for storage, encoding
+// payloads that are not JSON as a base64 string
+func rawPayload(message []byte) *string {
+	if json.Valid(message) {
+		payload := string(message)
+		return &payload
+	}
+	encoded, _ := json.Marshal(message)
+	payload := string(encoded)
+	return &payload
+}
+
+// checkRequiredHeaders fails permanently when msg lacks a required header;
+// an empty value counts as missing
+func (h *TransactionHandler) checkRequiredHeaders(msg consumer.ConsumedMessage) error {
+	for _, name := range h.requiredHeaders {
+		if value, ok := msg.Header(name); !ok || value == "" {
+			return consumer.NewPermanentError(ReasonMissingHeader,
+				fmt.Errorf("message lacks required header %q", name))
+		}
+	}
 	return nil
 }
 
+// isAllowedType reports whether transactions of transactionType are processed
+func (h *TransactionHandler) isAllowedType(transactionType entities.TransactionType) bool {
+	if h.allowedTypes == nil {
+		return true
+	}
+	_, ok := h.allowedTypes[entities.TransactionType(strings.ToUpper(string(transactionType)))]
+	return ok
+}
+
+// StatusPriority returns a consumer.PriorityFunc ranking raw messages by
+// their transaction status; unknown statuses and unparsable messages rank 0
+func StatusPriority(priorities map[string]int) consumer.PriorityFunc {
+	normalized := make(map[string]int, len(priorities))
+	for status, priority := range priorities {
+		normalized[strings.ToUpper(strings.TrimSpace(status))] = priority
+	}
+
+	return func(value []byte) int {
+		var peek struct {
+			TransactionStatus string `json:"transactionStatus"`
+		}
+		if err := json.Unmarshal(value, &peek); err != nil {
+			return 0
+		}
+		return normalized[strings.ToUpper(peek.TransactionStatus)]
+	}
+}
+
+// isTruncated reports whether a JSON decoding error was caused by the
+// payload ending prematurely, e.g. when the producer crashed mid-write
+func isTruncated(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.Error() == "unexpected end of JSON input"
+}
+
+// settles reports whether handling msg with the result err settles it, as
+// the consumer neither retries successes and permanent failures nor other
+// failures once no retries are left, except those of an unavailable database
+func settles(msg consumer.ConsumedMessage, err error) bool {
+	if err == nil {
+		return true
+	}
+	if _, permanent := consumer.IsPermanent(err); permanent {
+		return true
+	}
+	return msg.RetriesLeft == 0 && !consumer.IsUnavailable(err)
+}
+
+// recordOutcome persists the processing outcome of a message; failures are
+// only logged so they never affect transaction processing
+func (h *TransactionHandler) recordOutcome(ctx context.Context, transactionID string, receivedAt time.Time, processErr error) {
+	processedAt := h.clock.Now().UTC()
+	entry := &entities.ProcessingLog{
+		TransactionID: transactionID,
+		Outcome:       entities.ProcessingOutcomeSuccess,
+		ReceivedAt:    receivedAt,
+		ProcessedAt:   processedAt,
+		Latency:       processedAt.Sub(receivedAt),
+	}
+	if processErr != nil {
+		errMsg := processErr.Error()
+		entry.Outcome = entities.ProcessingOutcomeFailed
+		entry.Error = &errMsg
+	}
+
+	if err := h.processingLog.Record(ctx, entry); err != nil {
+		logger.FromContext(ctx, h.logger).Warn("Failed to record processing outcome", "error", err)
+	}
+}
+
+// withTransactionLogger scopes the logger carried by ctx to transactionID;
+// an empty ID, which the message key may still fill in, leaves it unscoped
+func (h *TransactionHandler) withTransactionLogger(ctx context.Context, transactionID string) context.Context {
+	if transactionID == "" {
+		return ctx
+	}
+	return logger.NewContext(ctx, logger.FromContext(ctx, h.logger).With("transactionId", transactionID))
+}
+
 // kafkaMessageToEntity converts Kafka message to domain entities
-func (h *TransactionHandler) kafkaMessageToEntity(msg *KafkaTransactionMessage) (*entities.Transaction, error) {
-	// Parse timestamps
-	createdAt, err := h.parseTimestamp(msg.CreatedAt)
+func (h *TransactionHandler) kafkaMessageToEntity(ctx context.Context, msg *KafkaTransactionMessage) (*entities.Transaction, error) {
+	createdAt, err := h.messageTimestamp(ctx, msg.CreatedAt, "createdAt")
 	if err != nil {
-		h.logger.Warn("Failed to parse createdAt, using current time", "error", err)
-		createdAt = time.Now().UTC()
+		return nil, err
 	}
 
-	updatedAt, err := h.parseTimestamp(msg.UpdatedAt)
+	updatedAt, err := h.messageTimestamp(ctx, msg.UpdatedAt, "updatedAt")
+	if err != nil {
+		return nil, err
+	}
+
+	return newTransaction(msg, createdAt, updatedAt), nil
+}
+
+// messageTimestamp parses the array timestamp of field. Missing or
+// incomplete timestamps fall back to the current time, while corrupt ones
+// fail the message permanently rather than being stored
+func (h *TransactionHandler) messageTimestamp(ctx context.Context, timestampArray []interface{}, field string) (time.Time, error) {
+	timestamp, err := h.parseTimestamp(timestampArray)
+	if errors.Is(err, errTimestampLength) {
+		logger.FromContext(ctx, h.logger).Warn("Failed to parse timestamp, using current time", "field", field, "reason", err)
+		return h.clock.Now().UTC(), nil
+	}
 	if err != nil {
-		h.logger.Warn("Failed to parse updatedAt, using current time", "error", err)
-		updatedAt = time.Now().UTC()
+		metrics.ParseErrors.WithLabelValues(ParseErrorInvalidTimestamp).Inc()
+		return time.Time{}, consumer.NewPermanentError(ParseErrorInvalidTimestamp,
+			fmt.Errorf("invalid %s: %w", field, err))
 	}
+	return timestamp, nil
+}
 
+// newTransaction builds the domain transaction from the fields shared by all
+// message versions
+func newTransaction(msg *KafkaTransactionMessage, createdAt, updatedAt time.Time) *entities.Transaction {
 	transaction := &entities.Transaction{
 		ID:                       msg.ID,
 		UserID:                   msg.UserID,
@@ -98,7 +632,6 @@ func (h *TransactionHandler) kafkaMessageToEntity(msg *KafkaTransactionMessage)
 		BalanceAfter:             msg.BalanceAfter,
 		Currency:                 msg.Currency,
 		ExternalReference:        msg.ExternalReference,
-		Metadata:                 msg.Metadata,
 		IsAccessibleFromExternal: msg.IsAccessibleFromExternal,
 		CreatedAt:                createdAt,
 		UpdatedAt:                updatedAt,
@@ -115,26 +648,67 @@ func (h *TransactionHandler) kafkaMessageToEntity(msg *KafkaTransactionMessage)
 		transaction.PaymentMethod = &paymentMethod
 	}
 
-	return transaction, nil
+	// Set metadata if not blank; the jsonb column rejects empty strings
+	if msg.Metadata != nil && strings.TrimSpace(*msg.Metadata) != "" {
+		transaction.Metadata = msg.Metadata
+	}
+
+	return transaction
+}
+
+// errTimestampLength is returned for array timestamps missing elements
+var errTimestampLength = errors.New("invalid timestamp array length")
+
+// minTimestampElements is the length of an array timestamp without its
+// optional nanosecond element
+const minTimestampElements = 6
+
+// timestampFields are the elements of an array timestamp with their valid
+// ranges; the trailing nanosecond element is optional. Years outside the
+// range are corrupt data rather than real transaction times
+var timestampFields = []struct {
+	name     string
+	min, max int
+}{
+	{"year", 1970, 2100},
+	{"month", 1, 12},
+	{"day", 1, 31},
+	{"hour", 0, 23},
+	{"minute", 0, 59},
+	{"second", 0, 59},
+	{"nanosecond", 0, 999_999_999},
 }
 
 // parseTimestamp converts array timestamp to time.Time
 func (h *TransactionHandler) parseTimestamp(timestampArray []interface{}) (time.Time, error) {
-	if len(timestampArray) < 6 {
-		return time.Time{}, fmt.Errorf("invalid timestamp array length: %d", len(timestampArray))
+	if len(timestampArray) < minTimestampElements {
+		return time.Time{}, fmt.Errorf("%w: %d", errTimestampLength, len(timestampArray))
 	}
 
-	year := int(timestampArray[0].(float64))
-	month := int(timestampArray[1].(float64))
-	day := int(timestampArray[2].(float64))
-	hour := int(timestampArray[3].(float64))
-	minute := int(timestampArray[4].(float64))
-	second := int(timestampArray[5].(float64))
+	values := make([]int, len(timestampFields))
+	for i, field := range timestampFields {
+		if i >= len(timestampArray) {
+			break
+		}
+		number, ok := timestampArray[i].(float64)
+		if !ok {
+			return time.Time{}, fmt.Errorf("timestamp %s must be a number, got: %T", field.name, timestampArray[i])
+		}
+		// Range check before converting, as converting a float beyond the
+		// int range is implementation-defined
+		if number != math.Trunc(number) || number < float64(field.min) || number > float64(field.max) {
+			return time.Time{}, fmt.Errorf("timestamp %s must be an integer between %d and %d, got: %v",
+				field.name, field.min, field.max, number)
+		}
+		values[i] = int(number)
+	}
 
-	var nanosecond int
-	if len(timestampArray) > 6 {
-		nanosecond = int(timestampArray[6].(float64))
+	year, month, day := values[0], time.Month(values[1]), values[2]
+	timestamp := time.Date(year, month, day, values[3], values[4], values[5], values[6], time.UTC)
+	// time.Date normalizes overflowing days, e.g. February 30 into March
+	if timestamp.Day() != day {
+		return time.Time{}, fmt.Errorf("timestamp day %d is out of range for %s %d", day, month, year)
 	}
 
-	return time.Date(year, time.Month(month), day, hour, minute, second, nanosecond, time.UTC), nil
+	return timestamp, nil
 }
@@ -0,0 +1,44 @@
+package deliveries
+
+import (
+	"context"
+	"testing"
+	"transaction-consumer/internal/infrastructures/database/memory"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/usecases"
+)
+
+// FuzzHandleMessage throws arbitrary payloads at HandleMessage, backed by the
+// real use case and the in-memory store, which must either handle them or
+// reject them with an error, never panic. The handler recovers panics into
+// ReasonPanic errors, so those fail the fuzz test too
+func FuzzHandleMessage(f *testing.F) {
+	for _, seed := range []string{
+		`{"userId":1,"accountId":"acc-1","transactionId":"trans-1","transactionType":"TOPUP","transactionStatus":"SUCCESS",` +
+			`"amount":100.5,"balanceBefore":0,"balanceAfter":100.5,"currency":"IDR","createdAt":[2024,1,15,10,30,45,500000000],` +
+			`"updatedAt":[2024,1,15,10,30,45]}`,
+		`{"schemaVersion":2,"userId":1,"accountId":"acc-1","transactionId":"trans-2","transactionType":"PAYMENT",` +
+			`"paymentMethod":"GOPAY","amount":50,"createdAt":"2024-01-15T17:30:45+07:00","updatedAt":"2024-01-15T10:31:00Z"}`,
+		`{"user_id":1,"account_id":"acc-1","transaction_id":"trans-3","transaction_type":"REFUND","amount":1,"metadata":"{\"a\":1}"}`,
+		`{"userId":1,"accountId":"acc-1","transactionType":"TOPUP","amount":1,"createdAt":[2024,2,30,0,0,0]}`,
+		`{"userId":1,"accountId":"acc-1","transactionType":"TOPUP","amount":1,"createdAt":[1e300,-1,"x",null,{},[]]}`,
+		`{"schemaVersion":99}`,
+		`{"amount":`,
+		`[]`,
+		`null`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, message []byte) {
+		log := &mockLogger{}
+		uc := usecases.NewTransactionUseCase(memory.NewTransactionRepository(log), log,
+			usecases.WithAmountSignNormalization(true))
+		handler := NewTransactionHandler(uc, log)
+		err := handler.HandleMessage(context.Background(), message)
+		if reason, ok := consumer.IsPermanent(err); ok && reason == ReasonPanic {
+			t.Fatalf("HandleMessage panicked on %q: %v", message, err)
+		}
+	})
+}
@@ -1,28 +1,62 @@
 package deliveries
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/infrastructures/database/postgres"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/infrastructures/metrics"
+	"transaction-consumer/internal/usecases"
+	"transaction-consumer/pkg/logger"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 )
 
 // Mock use case for testing
 type mockTransactionUseCase struct {
 	processError error
+	result       usecases.ProcessResult
 	processed    []*entities.Transaction
+	reprocessed  []*entities.Transaction
 }
 
-func (m *mockTransactionUseCase) ProcessTransaction(ctx context.Context, transaction *entities.Transaction) error {
+func (m *mockTransactionUseCase) ProcessTransaction(ctx context.Context, transaction *entities.Transaction) (usecases.ProcessResult, error) {
 	if m.processError != nil {
-		return m.processError
+		return "", m.processError
 	}
 	if m.processed == nil {
 		m.processed = []*entities.Transaction{}
 	}
 	m.processed = append(m.processed, transaction)
+	if m.result == "" {
+		return usecases.ProcessResultInserted, nil
+	}
+	return m.result, nil
+}
+
+func (m *mockTransactionUseCase) ReprocessTransaction(ctx context.Context, transaction *entities.Transaction) error {
+	if m.processError != nil {
+		return m.processError
+	}
+	m.reprocessed = append(m.reprocessed, transaction)
 	return nil
 }
 
@@ -66,6 +100,19 @@ func (m *mockLogger) Fatal(msg string, args ...interface{}) {
 	m.Error(msg, args...)
 }
 
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
+// fixedClock always tells the same time
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
 func TestNewTransactionHandler(t *testing.T) {
 	mockUseCase := &mockTransactionUseCase{}
 	mockLog := &mockLogger{}
@@ -126,6 +173,37 @@ func TestTransactionHandler_HandleMessage_Success(t *testing.T) {
 	}
 }
 
+func TestTransactionHandler_HandleMessage_Reprocessing(t *testing.T) {
+	message := []byte(`{"transactionId":"trans-456","userId":456,"accountId":"account-456","transactionType":"TOPUP",` +
+		`"transactionStatus":"SUCCESS","amount":250.75,"currency":"IDR",` +
+		`"createdAt":[2024,1,15,10,30,45,0],"updatedAt":[2024,1,15,10,30,45,0]}`)
+
+	t.Run("overwrites stored transactions", func(t *testing.T) {
+		mockUseCase := &mockTransactionUseCase{}
+		handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithReprocessing(true))
+
+		if err := handler.HandleMessage(context.Background(), message); err != nil {
+			t.Fatalf("HandleMessage should not return error, got: %v", err)
+		}
+		if len(mockUseCase.reprocessed) != 1 || mockUseCase.reprocessed[0].TransactionID != "trans-456" {
+			t.Errorf("Expected trans-456 to be reprocessed, got %v", mockUseCase.reprocessed)
+		}
+		if len(mockUseCase.processed) != 0 {
+			t.Errorf("Expected no transaction processed, got %d", len(mockUseCase.processed))
+		}
+	})
+
+	t.Run("invalid transactions fail permanently", func(t *testing.T) {
+		mockUseCase := &mockTransactionUseCase{processError: usecases.ErrInvalidTransaction}
+		handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithReprocessing(true))
+
+		err := handler.HandleMessage(context.Background(), message)
+		if reason, ok := consumer.IsPermanent(err); !ok || reason != ReasonInvalidTransaction {
+			t.Errorf("Expected a permanent %s error, got: %v", ReasonInvalidTransaction, err)
+		}
+	})
+}
+
 func TestTransactionHandler_HandleMessage_InvalidJSON(t *testing.T) {
 	mockUseCase := &mockTransactionUseCase{}
 	mockLog := &mockLogger{}
@@ -145,6 +223,66 @@ func TestTransactionHandler_HandleMessage_InvalidJSON(t *testing.T) {
 	}
 }
 
+// panickingUseCase panics on every call, like a bug deep in processing
+type panickingUseCase struct{}
+
+func (u *panickingUseCase) ProcessTransaction(ctx context.Context, transaction *entities.Transaction) (usecases.ProcessResult, error) {
+	var metadata map[string]string
+	metadata["unexpected"] = transaction.TransactionID
+	return usecases.ProcessResultInserted, nil
+}
+
+func (u *panickingUseCase) ReprocessTransaction(ctx context.Context, transaction *entities.Transaction) error {
+	_, err := u.ProcessTransaction(ctx, transaction)
+	return err
+}
+
+func TestTransactionHandler_HandleMessage_RecoversFromPanic(t *testing.T) {
+	mockLog := &mockLogger{}
+	handler := NewTransactionHandler(&panickingUseCase{}, mockLog)
+
+	message := []byte(`{"id":"trans-id-123","userId":456,"accountId":"account-456","transactionId":"trans-456",` +
+		`"transactionType":"TOPUP","transactionStatus":"SUCCESS","amount":100,"balanceBefore":0,"balanceAfter":100,` +
+		`"createdAt":[2024,1,1,0,0,0],"updatedAt":[2024,1,1,0,0,0]}`)
+
+	err := handler.HandleMessage(context.Background(), message)
+
+	reason, ok := consumer.IsPermanent(err)
+	if !ok || reason != ReasonPanic {
+		t.Fatalf("Expected a permanent error with reason %s, got %v", ReasonPanic, err)
+	}
+
+	found := false
+	for _, msg := range mockLog.errorMsgs {
+		if msg == "Recovered from panic while handling message" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("Recovered panic should be logged")
+	}
+}
+
+func TestTransactionHandler_HandleMessage_StringTimestampElement(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{})
+
+	message := []byte(`{"id":"trans-id-123","userId":456,"accountId":"account-456","transactionId":"trans-456",` +
+		`"transactionType":"TOPUP","transactionStatus":"SUCCESS","amount":100,"balanceBefore":0,"balanceAfter":100,` +
+		`"createdAt":["2024",1,1,0,0,0],"updatedAt":[2024,1,1,0,0,0]}`)
+
+	err := handler.HandleMessage(context.Background(), message)
+
+	reason, ok := consumer.IsPermanent(err)
+	if !ok || reason != ParseErrorInvalidTimestamp {
+		t.Fatalf("Expected a permanent error with reason %s, got %v", ParseErrorInvalidTimestamp, err)
+	}
+	if len(mockUseCase.processed) != 0 {
+		t.Error("No transaction should be processed with a corrupt timestamp")
+	}
+}
+
 func TestTransactionHandler_HandleMessage_ProcessError(t *testing.T) {
 	mockUseCase := &mockTransactionUseCase{
 		processError: errors.New("process error"),
@@ -174,6 +312,139 @@ func TestTransactionHandler_HandleMessage_ProcessError(t *testing.T) {
 	}
 }
 
+func TestTransactionHandler_HandleMessage_ProcessErrorTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		expectErr   bool
+		permanent   bool
+		unavailable bool
+	}{
+		{"invalid transaction", usecases.ErrInvalidTransaction, true, true, false},
+		{"transient failure", fmt.Errorf("failed to create transaction: %w", usecases.ErrTransient), true, false, false},
+		{"circuit open", fmt.Errorf("failed to create transaction: %w", usecases.ErrCircuitOpen), true, false, true},
+		{"concurrent duplicate", fmt.Errorf("failed to create transaction: %w", usecases.ErrDuplicateTransaction), false, false, false},
+	}
+
+	message, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:            1,
+		AccountID:         "acc-1",
+		TransactionID:     "trans-456",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+		Amount:            250.75,
+		CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewTransactionHandler(&mockTransactionUseCase{processError: tt.err}, &mockLogger{})
+
+			err := handler.HandleMessage(context.Background(), message)
+
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("Expected error %v, got: %v", tt.expectErr, err)
+			}
+			reason, permanent := consumer.IsPermanent(err)
+			if permanent != tt.permanent {
+				t.Errorf("Expected permanent %v, got %v", tt.permanent, permanent)
+			}
+			if permanent && reason != ReasonInvalidTransaction {
+				t.Errorf("Expected reason %s, got %s", ReasonInvalidTransaction, reason)
+			}
+			if unavailable := consumer.IsUnavailable(err); unavailable != tt.unavailable {
+				t.Errorf("Expected unavailable %v, got %v", tt.unavailable, unavailable)
+			}
+		})
+	}
+}
+
+func TestKafkaTransactionMessage_Validate(t *testing.T) {
+	valid := func() KafkaTransactionMessage {
+		return KafkaTransactionMessage{
+			UserID:          1,
+			AccountID:       "acc-1",
+			TransactionID:   "trans-1",
+			TransactionType: "TOPUP",
+			Amount:          100,
+			BalanceBefore:   0,
+			BalanceAfter:    100,
+			CreatedAt:       []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*KafkaTransactionMessage)
+		errMsg string
+	}{
+		{"valid", func(*KafkaTransactionMessage) {}, ""},
+		{"missing transaction ID", func(m *KafkaTransactionMessage) { m.TransactionID = "" }, ""},
+		{"longest transaction ID", func(m *KafkaTransactionMessage) { m.TransactionID = strings.Repeat("t", 50) }, ""},
+		{"blank transaction ID", func(m *KafkaTransactionMessage) { m.TransactionID = "  " }, "transactionId is required"},
+		{"long transaction ID", func(m *KafkaTransactionMessage) {
+			m.TransactionID = strings.Repeat("t", 51)
+		}, "transactionId must be at most 50 characters"},
+		{"missing timestamp", func(m *KafkaTransactionMessage) { m.UpdatedAt = nil }, ""},
+		{"short timestamp", func(m *KafkaTransactionMessage) {
+			m.UpdatedAt = []interface{}{2024.0}
+		}, "updatedAt must have at least 6 elements"},
+		{"missing user ID", func(m *KafkaTransactionMessage) { m.UserID = 0 }, "userId must be positive"},
+		{"negative user ID", func(m *KafkaTransactionMessage) { m.UserID = -3 }, "userId must be positive"},
+		{"blank account ID", func(m *KafkaTransactionMessage) { m.AccountID = " " }, "accountId is required"},
+		{"missing type", func(m *KafkaTransactionMessage) { m.TransactionType = "" }, "transactionType is required"},
+		{"negative amount", func(m *KafkaTransactionMessage) { m.Amount = -100 }, "amount must not be negative"},
+		{"negative balance", func(m *KafkaTransactionMessage) { m.BalanceBefore = -1 }, "balanceBefore must not be negative"},
+		{"long timestamp", func(m *KafkaTransactionMessage) {
+			m.CreatedAt = []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0, 0.0, 0.0}
+		}, "createdAt must have at most 7 elements"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := valid()
+			tt.modify(&msg)
+
+			err := msg.Validate()
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Errorf("Validate should not return error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_HandleMessage_InvalidMessage(t *testing.T) {
+	messages := map[string]string{
+		"v1 missing user": `{"accountId":"acc-1","transactionId":"trans-1","transactionType":"TOPUP","amount":100}`,
+		"v1 negative amount": `{"userId":1,"accountId":"acc-1","transactionId":"trans-1","transactionType":"TOPUP","amount":-100,` +
+			`"createdAt":[2024,1,15,10,30,45]}`,
+		"v2 missing type": `{"schemaVersion":2,"userId":1,"accountId":"acc-1","transactionId":"trans-1","amount":100}`,
+	}
+
+	for name, message := range messages {
+		t.Run(name, func(t *testing.T) {
+			mockUseCase := &mockTransactionUseCase{}
+			handler := NewTransactionHandler(mockUseCase, &mockLogger{})
+
+			err := handler.HandleMessage(context.Background(), []byte(message))
+
+			if reason, ok := consumer.IsPermanent(err); !ok || reason != ParseErrorInvalidMessage {
+				t.Fatalf("Expected a permanent error with reason %s, got %v", ParseErrorInvalidMessage, err)
+			}
+			if len(mockUseCase.processed) != 0 {
+				t.Error("Invalid message should not reach the use case")
+			}
+		})
+	}
+}
+
 func TestTransactionHandler_parseTimestamp_Valid(t *testing.T) {
 	mockUseCase := &mockTransactionUseCase{}
 	mockLog := &mockLogger{}
@@ -223,6 +494,52 @@ func TestTransactionHandler_parseTimestamp_Invalid(t *testing.T) {
 	}
 }
 
+func TestTransactionHandler_parseTimestamp_InvalidElements(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	tests := []struct {
+		name      string
+		timestamp []interface{}
+	}{
+		{"string element", []interface{}{"2024", 1.0, 15.0, 10.0, 30.0, 45.0}},
+		{"null element", []interface{}{2024.0, nil, 15.0, 10.0, 30.0, 45.0}},
+		{"string nanoseconds", []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0, "500"}},
+		{"month 13", []interface{}{2024.0, 13.0, 15.0, 10.0, 30.0, 45.0}},
+		{"month 0", []interface{}{2024.0, 0.0, 15.0, 10.0, 30.0, 45.0}},
+		{"day 32", []interface{}{2024.0, 1.0, 32.0, 10.0, 30.0, 45.0}},
+		{"february 30", []interface{}{2024.0, 2.0, 30.0, 10.0, 30.0, 45.0}},
+		{"hour 24", []interface{}{2024.0, 1.0, 15.0, 24.0, 30.0, 45.0}},
+		{"minute 60", []interface{}{2024.0, 1.0, 15.0, 10.0, 60.0, 45.0}},
+		{"negative second", []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, -1.0}},
+		{"fractional day", []interface{}{2024.0, 1.0, 15.5, 10.0, 30.0, 45.0}},
+		{"year 0", []interface{}{0.0, 1.0, 15.0, 10.0, 30.0, 45.0}},
+		{"negative year", []interface{}{-2024.0, 1.0, 15.0, 10.0, 30.0, 45.0}},
+		{"year 9999", []interface{}{9999.0, 1.0, 15.0, 10.0, 30.0, 45.0}},
+		{"year beyond int range", []interface{}{1e300, 1.0, 15.0, 10.0, 30.0, 45.0}},
+		{"nanoseconds beyond int range", []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0, -1e19}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := handler.parseTimestamp(tt.timestamp); err == nil {
+				t.Errorf("parseTimestamp(%v) should return error", tt.timestamp)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_parseTimestamp_LeapDay(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	result, err := handler.parseTimestamp([]interface{}{2024.0, 2.0, 29.0, 0.0, 0.0, 0.0})
+	if err != nil {
+		t.Fatalf("parseTimestamp should accept a leap day, got: %v", err)
+	}
+	if expected := time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC); !result.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
 func TestTransactionHandler_kafkaMessageToEntity_Success(t *testing.T) {
 	mockUseCase := &mockTransactionUseCase{}
 	mockLog := &mockLogger{}
@@ -251,7 +568,7 @@ func TestTransactionHandler_kafkaMessageToEntity_Success(t *testing.T) {
 		UpdatedAt:                []interface{}{2024.0, 2.0, 20.0, 14.0, 15.0, 30.0},
 	}
 
-	result, err := handler.kafkaMessageToEntity(kafkaMsg)
+	result, err := handler.kafkaMessageToEntity(context.Background(), kafkaMsg)
 	if err != nil {
 		t.Errorf("kafkaMessageToEntity should not return error, got: %v", err)
 	}
@@ -297,12 +614,13 @@ func TestTransactionHandler_kafkaMessageToEntity_EmptyOptionalFields(t *testing.
 		Currency:                 "IDR",
 		Description:              "", // Empty description
 		PaymentMethod:            "", // Empty payment method
+		Metadata:                 new(string),
 		IsAccessibleFromExternal: false,
 		CreatedAt:                []interface{}{2024.0, 1.0, 1.0, 12.0, 0.0, 0.0},
 		UpdatedAt:                []interface{}{2024.0, 1.0, 1.0, 12.0, 0.0, 0.0},
 	}
 
-	result, err := handler.kafkaMessageToEntity(kafkaMsg)
+	result, err := handler.kafkaMessageToEntity(context.Background(), kafkaMsg)
 	if err != nil {
 		t.Errorf("kafkaMessageToEntity should not return error, got: %v", err)
 	}
@@ -314,6 +632,9 @@ func TestTransactionHandler_kafkaMessageToEntity_EmptyOptionalFields(t *testing.
 	if result.PaymentMethod != nil {
 		t.Error("PaymentMethod should be nil for empty payment method")
 	}
+	if result.Metadata != nil {
+		t.Error("Metadata should be nil for empty metadata")
+	}
 	if result.IsAccessibleFromExternal != false {
 		t.Error("IsAccessibleFromExternal should be false")
 	}
@@ -337,7 +658,7 @@ func TestTransactionHandler_kafkaMessageToEntity_InvalidTimestamp(t *testing.T)
 		UpdatedAt:                []interface{}{2024.0, 1.0, 1.0, 12.0, 0.0, 0.0},
 	}
 
-	result, err := handler.kafkaMessageToEntity(kafkaMsg)
+	result, err := handler.kafkaMessageToEntity(context.Background(), kafkaMsg)
 	if err != nil {
 		t.Errorf("kafkaMessageToEntity should not return error even with invalid timestamp, got: %v", err)
 	}
@@ -348,6 +669,49 @@ func TestTransactionHandler_kafkaMessageToEntity_InvalidTimestamp(t *testing.T)
 	}
 }
 
+func TestTransactionHandler_kafkaMessageToEntity_FallbackUsesClock(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.FixedZone("WIB", 7*60*60))
+	mockLog := &mockLogger{}
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, mockLog, WithClock(fixedClock{now: now}))
+
+	kafkaMsg := &KafkaTransactionMessage{
+		TransactionID: "trans-456",
+		CreatedAt:     []interface{}{2024.0}, // too short to parse
+		UpdatedAt:     []interface{}{2024.0, 1.0, 1.0, 12.0, 0.0, 0.0},
+	}
+
+	result, err := handler.kafkaMessageToEntity(context.Background(), kafkaMsg)
+	if err != nil {
+		t.Fatalf("kafkaMessageToEntity should not return error, got: %v", err)
+	}
+
+	expected := time.Date(2024, 3, 1, 2, 30, 0, 0, time.UTC)
+	if !result.CreatedAt.Equal(expected) || result.CreatedAt.Location() != time.UTC {
+		t.Errorf("Expected CreatedAt to fall back to the clock time %v, got %v", expected, result.CreatedAt)
+	}
+	if !result.UpdatedAt.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the parsable UpdatedAt to be kept, got %v", result.UpdatedAt)
+	}
+	if len(mockLog.warnMsgs) != 1 {
+		t.Errorf("Expected the fallback to be logged once, got %v", mockLog.warnMsgs)
+	}
+}
+
+func TestTransactionHandler_kafkaMessageToEntity_OutOfRangeYear(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	kafkaMsg := &KafkaTransactionMessage{
+		TransactionID: "trans-456",
+		CreatedAt:     []interface{}{9999.0, 1.0, 1.0, 12.0, 0.0, 0.0},
+		UpdatedAt:     []interface{}{2024.0, 1.0, 1.0, 12.0, 0.0, 0.0},
+	}
+
+	_, err := handler.kafkaMessageToEntity(context.Background(), kafkaMsg)
+	if reason, ok := consumer.IsPermanent(err); !ok || reason != ParseErrorInvalidTimestamp {
+		t.Errorf("Expected a permanent error with reason %s, got %v", ParseErrorInvalidTimestamp, err)
+	}
+}
+
 func TestKafkaTransactionMessage_AllFields(t *testing.T) {
 	// Test that the struct has all expected fields
 	msg := KafkaTransactionMessage{
@@ -479,3 +843,910 @@ func TestTransactionHandler_HandleMessage_AllTransactionStatuses(t *testing.T) {
 		})
 	}
 }
+
+// Mock processing log repository for testing
+type mockProcessingLogRepository struct {
+	recordError error
+	entries     []*entities.ProcessingLog
+}
+
+func (m *mockProcessingLogRepository) Record(ctx context.Context, entry *entities.ProcessingLog) error {
+	if m.recordError != nil {
+		return m.recordError
+	}
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+func (m *mockProcessingLogRepository) GetRecent(ctx context.Context, limit int) ([]*entities.ProcessingLog, error) {
+	return m.entries, nil
+}
+
+func TestTransactionHandler_HandleMessage_RecordsProcessingOutcome(t *testing.T) {
+	kafkaMsg := KafkaTransactionMessage{
+		UserID:            456,
+		AccountID:         "account-456",
+		TransactionID:     "trans-456",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+		Amount:            250.75,
+		CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+	}
+	message, _ := json.Marshal(kafkaMsg)
+
+	t.Run("success", func(t *testing.T) {
+		processingLog := &mockProcessingLogRepository{}
+		handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{}, WithProcessingLog(processingLog))
+
+		if err := handler.HandleMessage(context.Background(), message); err != nil {
+			t.Fatalf("HandleMessage should not return error, got: %v", err)
+		}
+
+		if len(processingLog.entries) != 1 {
+			t.Fatalf("Expected 1 processing log entry, got %d", len(processingLog.entries))
+		}
+		entry := processingLog.entries[0]
+		if entry.TransactionID != "trans-456" || entry.Outcome != entities.ProcessingOutcomeSuccess {
+			t.Errorf("Unexpected entry: %+v", entry)
+		}
+		if entry.ProcessedAt.Before(entry.ReceivedAt) {
+			t.Error("ProcessedAt should not be before ReceivedAt")
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		processingLog := &mockProcessingLogRepository{}
+		useCase := &mockTransactionUseCase{processError: errors.New("process error")}
+		handler := NewTransactionHandler(useCase, &mockLogger{}, WithProcessingLog(processingLog))
+
+		if err := handler.HandleMessage(context.Background(), message); err == nil {
+			t.Fatal("HandleMessage should return error when use case fails")
+		}
+
+		if len(processingLog.entries) != 1 || processingLog.entries[0].Outcome != entities.ProcessingOutcomeFailed {
+			t.Fatalf("Expected a FAILED processing log entry, got %+v", processingLog.entries)
+		}
+		if processingLog.entries[0].Error == nil {
+			t.Error("Failed entry should carry the error message")
+		}
+	})
+
+	t.Run("retried failure is not recorded", func(t *testing.T) {
+		processingLog := &mockProcessingLogRepository{}
+		useCase := &mockTransactionUseCase{processError: errors.New("process error")}
+		handler := NewTransactionHandler(useCase, &mockLogger{}, WithProcessingLog(processingLog))
+
+		msg := consumer.ConsumedMessage{Value: message, RetriesLeft: 2}
+		if err := handler.Handle(context.Background(), msg); err == nil {
+			t.Fatal("Handle should return error when use case fails")
+		}
+		if len(processingLog.entries) != 0 {
+			t.Fatalf("Expected no processing log entry while retries are left, got %+v", processingLog.entries)
+		}
+
+		// The final attempt settles the message
+		msg.RetriesLeft = 0
+		_ = handler.Handle(context.Background(), msg)
+		if len(processingLog.entries) != 1 || processingLog.entries[0].Outcome != entities.ProcessingOutcomeFailed {
+			t.Fatalf("Expected a FAILED processing log entry, got %+v", processingLog.entries)
+		}
+	})
+
+	t.Run("unavailable database is not recorded without retries left", func(t *testing.T) {
+		processingLog := &mockProcessingLogRepository{}
+		useCase := &mockTransactionUseCase{processError: fmt.Errorf("failed to create transaction: %w", usecases.ErrCircuitOpen)}
+		handler := NewTransactionHandler(useCase, &mockLogger{}, WithProcessingLog(processingLog))
+
+		if err := handler.HandleMessage(context.Background(), message); err == nil {
+			t.Fatal("HandleMessage should return error while the circuit breaker is open")
+		}
+		if len(processingLog.entries) != 0 {
+			t.Fatalf("Expected no processing log entry while the database is unavailable, got %+v", processingLog.entries)
+		}
+	})
+
+	t.Run("permanent failure is recorded with retries left", func(t *testing.T) {
+		processingLog := &mockProcessingLogRepository{}
+		handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{}, WithProcessingLog(processingLog))
+
+		msg := consumer.ConsumedMessage{Value: []byte(`{"transactionId":`), RetriesLeft: 2}
+		if err := handler.Handle(context.Background(), msg); err == nil {
+			t.Fatal("Handle should return error for a malformed message")
+		}
+		if len(processingLog.entries) != 1 || processingLog.entries[0].Outcome != entities.ProcessingOutcomeFailed {
+			t.Fatalf("Expected a FAILED processing log entry, got %+v", processingLog.entries)
+		}
+	})
+
+	t.Run("record error does not fail processing", func(t *testing.T) {
+		processingLog := &mockProcessingLogRepository{recordError: errors.New("db down")}
+		useCase := &mockTransactionUseCase{}
+		mockLog := &mockLogger{}
+		handler := NewTransactionHandler(useCase, mockLog, WithProcessingLog(processingLog))
+
+		if err := handler.HandleMessage(context.Background(), message); err != nil {
+			t.Fatalf("HandleMessage should not fail when recording the outcome fails, got: %v", err)
+		}
+		if len(useCase.processed) != 1 {
+			t.Error("Transaction should still be processed")
+		}
+
+		found := false
+		for _, msg := range mockLog.warnMsgs {
+			if msg == "Failed to record processing outcome" {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Record failure should be logged as a warning")
+		}
+	})
+}
+
+func TestTransactionHandler_HandleMessage_TruncatedPayload(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{})
+
+	truncated := []byte(`{"transactionId":"trans-456","userId":456,"amount":25`)
+	before := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorTruncated))
+
+	err := handler.HandleMessage(context.Background(), truncated)
+	if err == nil {
+		t.Fatal("HandleMessage should return error for truncated payload")
+	}
+
+	reason, permanent := consumer.IsPermanent(err)
+	if !permanent || reason != ParseErrorTruncated {
+		t.Errorf("Expected permanent %q error, got permanent=%v reason=%q", ParseErrorTruncated, permanent, reason)
+	}
+	if got := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorTruncated)) - before; got != 1 {
+		t.Errorf("Expected truncated parse error metric to increase by 1, got %v", got)
+	}
+	if len(mockUseCase.processed) != 0 {
+		t.Error("No transaction should be processed for a truncated payload")
+	}
+}
+
+func TestTransactionHandler_HandleMessage_MalformedPayload(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+	before := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorMalformed))
+
+	err := handler.HandleMessage(context.Background(), []byte(`{"invalid": json}`))
+
+	reason, permanent := consumer.IsPermanent(err)
+	if !permanent || reason != ParseErrorMalformed {
+		t.Errorf("Expected permanent %q error, got permanent=%v reason=%q", ParseErrorMalformed, permanent, reason)
+	}
+	if got := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorMalformed)) - before; got != 1 {
+		t.Errorf("Expected malformed parse error metric to increase by 1, got %v", got)
+	}
+}
+
+func TestTransactionHandler_HandleMessage_SpanHierarchy(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock DB: %v", err)
+	}
+	db, err := gorm.Open(gormpostgres.New(gormpostgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create GORM DB: %v", err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	mockLog := &mockLogger{}
+	repo := postgres.NewTransactionRepository(db, mockLog, postgres.WithTracerProvider(tp))
+	useCase := usecases.NewTransactionUseCase(repo, mockLog, usecases.WithTracerProvider(tp))
+	handler := NewTransactionHandler(useCase, mockLog, WithTracerProvider(tp))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-traced").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillReturnError(errors.New("insert failed"))
+	mock.ExpectRollback()
+
+	message, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:            456,
+		AccountID:         "account-456",
+		TransactionID:     "trans-traced",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+		Amount:            100,
+		BalanceBefore:     1000,
+		BalanceAfter:      1100,
+		CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+	})
+
+	if err := handler.HandleMessage(context.Background(), message); err == nil {
+		t.Fatal("HandleMessage should return error when the insert fails")
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	root, ok := spans["kafka.process"]
+	if !ok {
+		t.Fatalf("Expected kafka.process span, got %v", exporter.GetSpans().Snapshots())
+	}
+	process, ok := spans["ProcessTransaction"]
+	if !ok {
+		t.Fatal("Expected ProcessTransaction span")
+	}
+	create, ok := spans["repository.Create"]
+	if !ok {
+		t.Fatal("Expected repository.Create span")
+	}
+
+	if root.Parent.IsValid() {
+		t.Error("kafka.process should be the root span")
+	}
+	if process.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Error("ProcessTransaction should be a child of kafka.process")
+	}
+	if create.Parent.SpanID() != process.SpanContext.SpanID() {
+		t.Error("repository.Create should be a child of ProcessTransaction")
+	}
+
+	for _, span := range []tracetest.SpanStub{root, process, create} {
+		if span.Status.Code != codes.Error {
+			t.Errorf("Span %s should be marked as errored", span.Name)
+		}
+		found := false
+		for _, attr := range span.Attributes {
+			if attr.Key == "transactionId" && attr.Value.AsString() == "trans-traced" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Span %s should carry the transactionId attribute", span.Name)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestStatusPriority(t *testing.T) {
+	priority := StatusPriority(map[string]int{"success": 2, "FAILED": 2, "PENDING": 1})
+
+	tests := []struct {
+		name     string
+		value    []byte
+		expected int
+	}{
+		{"success", []byte(`{"transactionStatus":"SUCCESS"}`), 2},
+		{"failed", []byte(`{"transactionStatus":"FAILED"}`), 2},
+		{"pending", []byte(`{"transactionStatus":"PENDING"}`), 1},
+		{"unknown status", []byte(`{"transactionStatus":"CANCELLED"}`), 0},
+		{"malformed", []byte(`{"transactionStatus":`), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := priority(tt.value); got != tt.expected {
+				t.Errorf("priority = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+// Use case that logs through the context-scoped logger
+type loggingUseCase struct{}
+
+func (u *loggingUseCase) ProcessTransaction(ctx context.Context, transaction *entities.Transaction) (usecases.ProcessResult, error) {
+	logger.FromContext(ctx, nil).Info("Processing in use case")
+	return usecases.ProcessResultInserted, nil
+}
+
+func (u *loggingUseCase) ReprocessTransaction(ctx context.Context, transaction *entities.Transaction) error {
+	_, err := u.ProcessTransaction(ctx, transaction)
+	return err
+}
+
+func TestTransactionHandler_HandleMessage_ScopesLogsToTransaction(t *testing.T) {
+	newMessage := func(createdAt []interface{}) KafkaTransactionMessage {
+		return KafkaTransactionMessage{
+			UserID:            456,
+			AccountID:         "account-456",
+			TransactionID:     "trans-scoped",
+			TransactionType:   "TOPUP",
+			TransactionStatus: "SUCCESS",
+			Amount:            100,
+			CreatedAt:         createdAt,
+			UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		}
+	}
+	valid, _ := json.Marshal(newMessage([]interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0}))
+	missingV1, _ := json.Marshal(newMessage(nil))
+	missingV2, _ := json.Marshal(KafkaTransactionMessageV2{
+		KafkaTransactionMessage: newMessage(nil),
+		UpdatedAt:               time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC),
+	})
+	missingV2 = bytes.Replace(missingV2, []byte("{"), []byte(`{"schemaVersion":2,`), 1)
+
+	tests := []struct {
+		name    string
+		message []byte
+		opts    []Option
+		logMsg  string
+	}{
+		{"use case", valid, nil, "Processing in use case"},
+		{"missing array timestamp", missingV1, nil, "Failed to parse timestamp, using current time"},
+		{"missing v2 timestamp", missingV2, nil, "Missing timestamp, using current time"},
+		{"processing log failure", valid,
+			[]Option{WithProcessingLog(&mockProcessingLogRepository{recordError: errors.New("db down")})},
+			"Failed to record processing outcome"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := logger.NewLoggerWithHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+			handler := NewTransactionHandler(&loggingUseCase{}, log, tt.opts...)
+
+			ctx := logger.NewContext(context.Background(), log.With("partition", 3, "offset", 42))
+			if err := handler.HandleMessage(ctx, tt.message); err != nil {
+				t.Fatalf("HandleMessage should not return error, got: %v", err)
+			}
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			found := false
+			for _, line := range lines {
+				var entry map[string]interface{}
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("Invalid log line %q: %v", line, err)
+				}
+				if entry["msg"] != tt.logMsg {
+					continue
+				}
+				found = true
+				if entry["transactionId"] != "trans-scoped" {
+					t.Errorf("Expected transactionId in log, got %v", entry["transactionId"])
+				}
+				if entry["partition"] != 3.0 || entry["offset"] != 42.0 {
+					t.Errorf("Expected partition/offset in log, got %v/%v", entry["partition"], entry["offset"])
+				}
+			}
+			if !found {
+				t.Fatalf("Log line %q not found in %s", tt.logMsg, buf.String())
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_UsesKeyAsTransactionID(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{})
+
+	value, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:            456,
+		AccountID:         "account-456",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+		CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+	})
+
+	err := handler.Handle(context.Background(), consumer.ConsumedMessage{
+		Key:   []byte("trans-from-key"),
+		Value: value,
+	})
+	if err != nil {
+		t.Fatalf("Handle should not return error, got: %v", err)
+	}
+	if len(mockUseCase.processed) != 1 {
+		t.Fatalf("Expected 1 processed transaction, got %d", len(mockUseCase.processed))
+	}
+	if got := mockUseCase.processed[0].TransactionID; got != "trans-from-key" {
+		t.Errorf("Expected transaction ID from message key, got %s", got)
+	}
+}
+
+func TestTransactionHandler_Handle_InvalidTransactionIDFromKey(t *testing.T) {
+	value, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:          456,
+		AccountID:       "account-456",
+		TransactionType: "TOPUP",
+	})
+
+	tests := []struct {
+		name   string
+		key    []byte
+		errMsg string
+	}{
+		{"no key", nil, "transactionId is required"},
+		{"long key", []byte(strings.Repeat("k", 51)), "transactionId must be at most 50 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := &mockTransactionUseCase{}
+			handler := NewTransactionHandler(mockUseCase, &mockLogger{})
+
+			err := handler.Handle(context.Background(), consumer.ConsumedMessage{Key: tt.key, Value: value})
+			if reason, ok := consumer.IsPermanent(err); !ok || reason != ParseErrorInvalidMessage {
+				t.Fatalf("Expected a permanent %s error, got: %v", ParseErrorInvalidMessage, err)
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+			}
+			if len(mockUseCase.processed) != 0 {
+				t.Errorf("Expected no processed transaction, got %d", len(mockUseCase.processed))
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_PayloadIDTakesPrecedenceOverKey(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{})
+
+	value, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:            1,
+		AccountID:         "acc-1",
+		TransactionID:     "trans-from-payload",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+	})
+
+	err := handler.Handle(context.Background(), consumer.ConsumedMessage{
+		Key:   []byte("trans-from-key"),
+		Value: value,
+	})
+	if err != nil {
+		t.Fatalf("Handle should not return error, got: %v", err)
+	}
+	if got := mockUseCase.processed[0].TransactionID; got != "trans-from-payload" {
+		t.Errorf("Expected transaction ID from payload, got %s", got)
+	}
+}
+
+func TestTransactionHandler_Handle_TenantHeader(t *testing.T) {
+	value, _ := json.Marshal(KafkaTransactionMessage{UserID: 1, AccountID: "acc-1", TransactionID: "trans-456", TransactionType: "TOPUP"})
+
+	tests := []struct {
+		name     string
+		headers  []consumer.Header
+		expected string
+	}{
+		{"header present", []consumer.Header{{Key: "trace", Value: []byte("x")}, {Key: "tenant-id", Value: []byte("tenant-a")}}, "tenant-a"},
+		{"header missing", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := &mockTransactionUseCase{}
+			handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithTenantHeader("tenant-id"))
+
+			err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: value, Headers: tt.headers})
+			if err != nil {
+				t.Fatalf("Handle should not return error, got: %v", err)
+			}
+			if got := mockUseCase.processed[0].TenantID; got != tt.expected {
+				t.Errorf("Expected tenant %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_MissingRequiredHeader(t *testing.T) {
+	value, _ := json.Marshal(KafkaTransactionMessage{TransactionID: "trans-456", TransactionType: "TOPUP"})
+
+	for name, headers := range map[string][]consumer.Header{
+		"absent": {{Key: "trace", Value: []byte("x")}},
+		"empty":  {{Key: "tenant-id"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockUseCase := &mockTransactionUseCase{}
+			handler := NewTransactionHandler(mockUseCase, &mockLogger{},
+				WithTenantHeader("tenant-id"), WithRequiredHeaders("tenant-id"))
+
+			err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: value, Headers: headers})
+
+			reason, ok := consumer.IsPermanent(err)
+			if !ok || reason != ReasonMissingHeader {
+				t.Fatalf("Expected permanent %s error, got: %v", ReasonMissingHeader, err)
+			}
+			if len(mockUseCase.processed) != 0 {
+				t.Error("Message without a required header should not be processed")
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_LogsPositionOnError(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewLoggerWithHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	handler := NewTransactionHandler(&mockTransactionUseCase{processError: errors.New("db down")}, log)
+
+	value, _ := json.Marshal(KafkaTransactionMessage{TransactionID: "trans-456"})
+	err := handler.Handle(context.Background(), consumer.ConsumedMessage{
+		Partition: 3,
+		Offset:    42,
+		Value:     value,
+	})
+	if err == nil {
+		t.Fatal("Handle should return error when processing fails")
+	}
+
+	output := buf.String()
+	// The consumer already logs the failure at Error
+	for _, want := range []string{`"level":"DEBUG","msg":"Failed to handle message"`, `"partition":3`, `"offset":42`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected log output to contain %s, got: %s", want, output)
+		}
+	}
+}
+
+func TestTransactionHandler_HandleMessage_Oversized(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithMaxMessageSize(64))
+
+	// Not even JSON, so any parse attempt would be reported as malformed
+	oversized := bytes.Repeat([]byte("x"), 65)
+	beforeOversized := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorOversized))
+	beforeMalformed := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorMalformed))
+
+	err := handler.HandleMessage(context.Background(), oversized)
+
+	reason, ok := consumer.IsPermanent(err)
+	if !ok || reason != ParseErrorOversized {
+		t.Fatalf("Expected permanent %s error, got: %v", ParseErrorOversized, err)
+	}
+	if err.Error() != "message of 65 bytes exceeds the limit of 64 bytes" {
+		t.Errorf("Expected descriptive error, got %q", err.Error())
+	}
+	if got := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorOversized)) - beforeOversized; got != 1 {
+		t.Errorf("Expected oversized metric to increase by 1, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.ParseErrors.WithLabelValues(ParseErrorMalformed)) - beforeMalformed; got != 0 {
+		t.Errorf("Expected no parse attempt, malformed metric changed by %v", got)
+	}
+	if len(mockUseCase.processed) != 0 {
+		t.Error("Oversized message should not be processed")
+	}
+}
+
+func TestTransactionHandler_HandleMessage_AtMaxSize(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	message := []byte(`{"userId":1,"accountId":"a","transactionId":"t","transactionType":"TOPUP","amount":1}`)
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithMaxMessageSize(len(message)))
+
+	if err := handler.HandleMessage(context.Background(), message); err != nil {
+		t.Errorf("HandleMessage should accept a message at the limit, got: %v", err)
+	}
+	if len(mockUseCase.processed) != 1 {
+		t.Errorf("Expected 1 processed transaction, got %d", len(mockUseCase.processed))
+	}
+}
+
+func TestTransactionHandler_HandleMessage_RedactsSensitiveFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewLoggerWithHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, log,
+		WithRedactedFields("externalReference", "metadata", "accountId"))
+
+	reference := "INV-SECRET-1"
+	metadata := `{"card":"4111"}`
+	message, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:            456,
+		AccountID:         "account-secret",
+		TransactionID:     "trans-redacted",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+		Amount:            100,
+		ExternalReference: &reference,
+		Metadata:          &metadata,
+		CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+	})
+
+	if err := handler.HandleMessage(context.Background(), message); err != nil {
+		t.Fatalf("HandleMessage should not return error, got: %v", err)
+	}
+
+	logged := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		switch entry["msg"] {
+		case "Received message":
+			logged["message"], _ = entry["message"].(string)
+		case "Decoded message":
+			logged["transaction"], _ = entry["transaction"].(string)
+		}
+	}
+
+	for _, key := range []string{"message", "transaction"} {
+		out := logged[key]
+		if out == "" {
+			t.Fatalf("Expected a logged %s in %s", key, buf.String())
+		}
+		for _, secret := range []string{"account-secret", "INV-SECRET-1", "4111"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("Expected %q to be masked in the logged %s, got %s", secret, key, out)
+			}
+		}
+		if !strings.Contains(out, redactedValue) {
+			t.Errorf("Expected masked values in the logged %s, got %s", key, out)
+		}
+		if !strings.Contains(out, "trans-redacted") || !strings.Contains(out, "TOPUP") {
+			t.Errorf("Expected non-sensitive fields to remain in the logged %s, got %s", key, out)
+		}
+	}
+}
+
+func TestTransactionHandler_Handle_SkipsTombstones(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{"nil value", nil},
+		{"empty value", []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := &mockTransactionUseCase{}
+			handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithRequiredHeaders("tenant-id"))
+
+			err := handler.Handle(context.Background(), consumer.ConsumedMessage{Key: []byte("trans-deleted"), Value: tt.value})
+			if err != nil {
+				t.Fatalf("Expected tombstone to be skipped, got: %v", err)
+			}
+			if len(mockUseCase.processed) != 0 {
+				t.Errorf("Expected use case not to be invoked, got %d processed", len(mockUseCase.processed))
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_CountsProcessedByPartition(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{})
+
+	value, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:            456,
+		AccountID:         "account-456",
+		TransactionID:     "trans-partitioned",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+		CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+	})
+
+	before := testutil.ToFloat64(metrics.TransactionsProcessed.WithLabelValues("7"))
+	other := testutil.ToFloat64(metrics.TransactionsProcessed.WithLabelValues("8"))
+
+	err := handler.Handle(context.Background(), consumer.ConsumedMessage{
+		Topic:     "transactions",
+		Partition: 7,
+		Offset:    42,
+		Value:     value,
+	})
+	if err != nil {
+		t.Fatalf("Handle should not return error, got: %v", err)
+	}
+
+	if got := testutil.ToFloat64(metrics.TransactionsProcessed.WithLabelValues("7")) - before; got != 1 {
+		t.Errorf("Expected 1 transaction processed on partition 7, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.TransactionsProcessed.WithLabelValues("8")) - other; got != 0 {
+		t.Errorf("Expected no transaction processed on partition 8, got %v", got)
+	}
+}
+
+// timeInQueueBuckets returns the cumulative count of every time in queue
+// bucket of source by its upper bound
+func timeInQueueBuckets(t *testing.T, source string) map[float64]uint64 {
+	t.Helper()
+	var metric dto.Metric
+	if err := metrics.TimeInQueue.WithLabelValues(source).(prometheus.Metric).Write(&metric); err != nil {
+		t.Fatalf("Failed to read time in queue histogram: %v", err)
+	}
+	buckets := make(map[float64]uint64)
+	for _, bucket := range metric.GetHistogram().GetBucket() {
+		buckets[bucket.GetUpperBound()] = bucket.GetCumulativeCount()
+	}
+	return buckets
+}
+
+func TestTransactionHandler_Handle_ObservesTimeInQueue(t *testing.T) {
+	processedAt := time.Date(2024, 1, 15, 10, 31, 30, 0, time.UTC)
+
+	// createdAt is 45 seconds before processing
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		source    string
+		latency   time.Duration
+	}{
+		{"from createdAt", time.Time{}, timeInQueueCreatedAt, 45 * time.Second},
+		{"from message timestamp", processedAt.Add(-4 * time.Second), timeInQueueMessage, 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{}, WithClock(fixedClock{now: processedAt}))
+			value, _ := json.Marshal(KafkaTransactionMessage{
+				UserID:            456,
+				AccountID:         "account-456",
+				TransactionID:     "trans-queued",
+				TransactionType:   "TOPUP",
+				TransactionStatus: "SUCCESS",
+				CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+				UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+			})
+
+			before := timeInQueueBuckets(t, tt.source)
+			err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: value, Timestamp: tt.timestamp})
+			if err != nil {
+				t.Fatalf("Handle should not return error, got: %v", err)
+			}
+			after := timeInQueueBuckets(t, tt.source)
+
+			// Exactly the buckets at or above the latency counted it
+			for bound, count := range after {
+				expected := before[bound]
+				if bound >= tt.latency.Seconds() {
+					expected++
+				}
+				if count != expected {
+					t.Errorf("Expected bucket le=%v to count %d, got %d", bound, expected, count)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_AllowedTypes(t *testing.T) {
+	tests := []struct {
+		transactionType string
+		processed       bool
+	}{
+		{"PAYMENT", true},
+		{"REFUND", true},
+		{"TOPUP", false},
+		{"TRANSFER", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.transactionType, func(t *testing.T) {
+			mockUseCase := &mockTransactionUseCase{}
+			handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithAllowedTypes("payment", "REFUND"))
+
+			value, _ := json.Marshal(KafkaTransactionMessage{
+				UserID:            456,
+				AccountID:         "account-456",
+				TransactionID:     "trans-filtered",
+				TransactionType:   tt.transactionType,
+				TransactionStatus: "SUCCESS",
+				Amount:            100,
+				CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+				UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+			})
+
+			before := testutil.ToFloat64(metrics.FilteredMessages.WithLabelValues(tt.transactionType))
+			if err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: value}); err != nil {
+				t.Fatalf("Handle should not return error, got: %v", err)
+			}
+
+			if processed := len(mockUseCase.processed) == 1; processed != tt.processed {
+				t.Errorf("Expected processed %v, got %v", tt.processed, processed)
+			}
+			filtered := testutil.ToFloat64(metrics.FilteredMessages.WithLabelValues(tt.transactionType)) - before
+			if (filtered == 1) == tt.processed {
+				t.Errorf("Expected filtered count to increase only for skipped types, got %v", filtered)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_NoAllowedTypesAllowsAll(t *testing.T) {
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithAllowedTypes())
+
+	value, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:            456,
+		AccountID:         "account-456",
+		TransactionID:     "trans-unfiltered",
+		TransactionType:   "TOPUP",
+		TransactionStatus: "SUCCESS",
+		Amount:            100,
+		CreatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+		UpdatedAt:         []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0},
+	})
+	if err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: value}); err != nil {
+		t.Fatalf("Handle should not return error, got: %v", err)
+	}
+	if len(mockUseCase.processed) != 1 {
+		t.Errorf("Expected the transaction to be processed, got %d", len(mockUseCase.processed))
+	}
+}
+
+func TestTransactionHandler_Handle_RawPayload(t *testing.T) {
+	value, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:          1,
+		AccountID:       "acc-1",
+		TransactionID:   "trans-456",
+		TransactionType: "TOPUP",
+		Amount:          100,
+	})
+
+	payload := string(value)
+	tests := []struct {
+		name     string
+		store    bool
+		expected *string
+	}{
+		{"enabled", true, &payload},
+		{"disabled", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUseCase := &mockTransactionUseCase{}
+			handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithRawPayload(tt.store))
+
+			if err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: value}); err != nil {
+				t.Fatalf("Handle should not return error, got: %v", err)
+			}
+
+			got := mockUseCase.processed[0].RawPayload
+			switch {
+			case tt.expected == nil && got != nil:
+				t.Errorf("Expected no raw payload, got %s", *got)
+			case tt.expected != nil && (got == nil || *got != *tt.expected):
+				t.Errorf("Expected raw payload %s, got %v", *tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTransactionHandler_Handle_ProcessResultMetrics(t *testing.T) {
+	value, _ := json.Marshal(KafkaTransactionMessage{
+		UserID:          456,
+		AccountID:       "account-456",
+		TransactionID:   "trans-result",
+		TransactionType: "TOPUP",
+	})
+
+	for _, result := range []usecases.ProcessResult{
+		usecases.ProcessResultInserted,
+		usecases.ProcessResultUpdated,
+		usecases.ProcessResultSkipped,
+	} {
+		t.Run(string(result), func(t *testing.T) {
+			handler := NewTransactionHandler(&mockTransactionUseCase{result: result}, &mockLogger{})
+			counted := testutil.ToFloat64(metrics.ProcessResults.WithLabelValues(string(result)))
+			stored := testutil.ToFloat64(metrics.TransactionsProcessed.WithLabelValues("9"))
+
+			err := handler.Handle(context.Background(), consumer.ConsumedMessage{Partition: 9, Value: value})
+			if err != nil {
+				t.Fatalf("Handle should not return error, got: %v", err)
+			}
+
+			if got := testutil.ToFloat64(metrics.ProcessResults.WithLabelValues(string(result))) - counted; got != 1 {
+				t.Errorf("Expected 1 %s result counted, got %v", result, got)
+			}
+			expectedStored := 1.0
+			if result == usecases.ProcessResultSkipped {
+				expectedStored = 0
+			}
+			if got := testutil.ToFloat64(metrics.TransactionsProcessed.WithLabelValues("9")) - stored; got != expectedStored {
+				t.Errorf("Expected %v transactions processed, got %v", expectedStored, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package deliveries
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"transaction-consumer/internal/deliveries/transactionpb"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+	"transaction-consumer/internal/infrastructures/metrics"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WithProtobuf decodes messages as transactionpb.Transaction instead of JSON
+func WithProtobuf() Option {
+	return func(h *TransactionHandler) {
+		h.protobuf = true
+	}
+}
+
+// decodeProtobuf decodes a protobuf-encoded transaction message
+func (h *TransactionHandler) decodeProtobuf(ctx context.Context, message []byte) (*entities.Transaction, error) {
+	var pbMsg transactionpb.Transaction
+	if err := proto.Unmarshal(message, &pbMsg); err != nil {
+		metrics.ParseErrors.WithLabelValues(ParseErrorMalformed).Inc()
+		return nil, consumer.NewPermanentError(ParseErrorMalformed, fmt.Errorf("failed to decode protobuf message: %w", err))
+	}
+
+	kafkaMsg := KafkaTransactionMessage{
+		ID:                       pbMsg.GetId(),
+		UserID:                   pbMsg.GetUserId(),
+		AccountID:                pbMsg.GetAccountId(),
+		TransactionID:            pbMsg.GetTransactionId(),
+		TransactionType:          pbMsg.GetTransactionType(),
+		TransactionStatus:        pbMsg.GetTransactionStatus(),
+		Amount:                   pbMsg.GetAmount(),
+		BalanceBefore:            pbMsg.GetBalanceBefore(),
+		BalanceAfter:             pbMsg.GetBalanceAfter(),
+		Currency:                 pbMsg.GetCurrency(),
+		Description:              pbMsg.GetDescription(),
+		ExternalReference:        pbMsg.ExternalReference,
+		PaymentMethod:            pbMsg.GetPaymentMethod(),
+		Metadata:                 pbMsg.Metadata,
+		IsAccessibleFromExternal: pbMsg.GetIsAccessibleFromExternal(),
+	}
+
+	if err := validateMessage(&kafkaMsg); err != nil {
+		return nil, err
+	}
+
+	ctx = h.withTransactionLogger(ctx, kafkaMsg.TransactionID)
+	return newTransaction(&kafkaMsg,
+		h.timestampOrNow(ctx, protoTime(pbMsg.GetCreatedAt()), "createdAt"),
+		h.timestampOrNow(ctx, protoTime(pbMsg.GetUpdatedAt()), "updatedAt")), nil
+}
+
+// protoTime converts ts to time.Time, mapping an unset timestamp to the zero
+// time rather than the Unix epoch
+func protoTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
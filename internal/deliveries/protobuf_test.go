@@ -0,0 +1,135 @@
+package deliveries
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+	"transaction-consumer/internal/deliveries/transactionpb"
+	"transaction-consumer/internal/infrastructures/kafka/consumer"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestTransactionHandler_Handle_ProtobufMatchesJSON(t *testing.T) {
+	externalRef := "ext-ref-789"
+	createdAt := time.Date(2024, 1, 15, 10, 30, 45, 123000000, time.UTC)
+
+	jsonValue, _ := json.Marshal(KafkaTransactionMessage{
+		ID:                       "trans-id-123",
+		UserID:                   456,
+		AccountID:                "account-456",
+		TransactionID:            "trans-456",
+		TransactionType:          "PAYMENT",
+		TransactionStatus:        "SUCCESS",
+		Amount:                   250.75,
+		BalanceBefore:            1000.00,
+		BalanceAfter:             749.25,
+		Currency:                 "IDR",
+		Description:              "Test transaction",
+		ExternalReference:        &externalRef,
+		PaymentMethod:            "GOPAY",
+		IsAccessibleFromExternal: true,
+		CreatedAt:                []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0, 123000000.0},
+		UpdatedAt:                []interface{}{2024.0, 1.0, 15.0, 10.0, 30.0, 45.0, 123000000.0},
+	})
+	pbValue, err := proto.Marshal(&transactionpb.Transaction{
+		Id:                       "trans-id-123",
+		UserId:                   456,
+		AccountId:                "account-456",
+		TransactionId:            "trans-456",
+		TransactionType:          "PAYMENT",
+		TransactionStatus:        "SUCCESS",
+		Amount:                   250.75,
+		BalanceBefore:            1000.00,
+		BalanceAfter:             749.25,
+		Currency:                 "IDR",
+		Description:              "Test transaction",
+		ExternalReference:        &externalRef,
+		PaymentMethod:            "GOPAY",
+		IsAccessibleFromExternal: true,
+		CreatedAt:                timestamppb.New(createdAt),
+		UpdatedAt:                timestamppb.New(createdAt),
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal protobuf message: %v", err)
+	}
+
+	jsonUseCase := &mockTransactionUseCase{}
+	if err := NewTransactionHandler(jsonUseCase, &mockLogger{}).HandleMessage(context.Background(), jsonValue); err != nil {
+		t.Fatalf("JSON HandleMessage should not return error, got: %v", err)
+	}
+	pbUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(pbUseCase, &mockLogger{}, WithProtobuf())
+	if err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: pbValue}); err != nil {
+		t.Fatalf("Protobuf Handle should not return error, got: %v", err)
+	}
+
+	if len(pbUseCase.processed) != 1 {
+		t.Fatalf("Expected 1 processed transaction, got %d", len(pbUseCase.processed))
+	}
+	if !reflect.DeepEqual(pbUseCase.processed[0], jsonUseCase.processed[0]) {
+		t.Errorf("Expected protobuf transaction %+v to match JSON transaction %+v",
+			pbUseCase.processed[0], jsonUseCase.processed[0])
+	}
+}
+
+func TestTransactionHandler_Handle_ProtobufMalformed(t *testing.T) {
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, &mockLogger{}, WithProtobuf())
+
+	err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: []byte{0xff, 0xff, 0xff}})
+
+	if reason, ok := consumer.IsPermanent(err); !ok || reason != ParseErrorMalformed {
+		t.Errorf("Expected permanent %q error, got %v", ParseErrorMalformed, err)
+	}
+}
+
+func TestTransactionHandler_decodeProtobuf_MissingTimestamps(t *testing.T) {
+	mockLog := &mockLogger{}
+	handler := NewTransactionHandler(&mockTransactionUseCase{}, mockLog, WithProtobuf())
+	value, _ := proto.Marshal(&transactionpb.Transaction{UserId: 1, AccountId: "acc-1", TransactionId: "trans-456", TransactionType: "TOPUP"})
+
+	before := time.Now().UTC()
+	transaction, err := handler.decodeProtobuf(context.Background(), value)
+	if err != nil {
+		t.Fatalf("decodeProtobuf should not return error, got: %v", err)
+	}
+
+	if transaction.CreatedAt.Before(before) {
+		t.Errorf("Expected missing createdAt to default to now, got %v", transaction.CreatedAt)
+	}
+	if len(mockLog.warnMsgs) != 2 {
+		t.Errorf("Expected 2 warnings for missing timestamps, got %d", len(mockLog.warnMsgs))
+	}
+}
+
+func TestTransactionHandler_Handle_RawPayloadBinary(t *testing.T) {
+	value, _ := proto.Marshal(&transactionpb.Transaction{
+		UserId:          1,
+		AccountId:       "acc-1",
+		TransactionId:   "trans-456",
+		TransactionType: "TOPUP",
+		Amount:          100,
+	})
+	mockUseCase := &mockTransactionUseCase{}
+	handler := NewTransactionHandler(mockUseCase, &mockLogger{}, WithProtobuf(), WithRawPayload(true))
+
+	if err := handler.Handle(context.Background(), consumer.ConsumedMessage{Value: value}); err != nil {
+		t.Fatalf("Handle should not return error, got: %v", err)
+	}
+
+	got := mockUseCase.processed[0].RawPayload
+	if got == nil {
+		t.Fatal("Expected a raw payload")
+	}
+	var decoded []byte
+	if err := json.Unmarshal([]byte(*got), &decoded); err != nil {
+		t.Fatalf("Expected a base64 JSON string, got %s: %v", *got, err)
+	}
+	if !bytes.Equal(decoded, value) {
+		t.Error("Expected the raw payload to decode to the received bytes")
+	}
+}
@@ -0,0 +1,81 @@
+package deliveries
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// redactedValue replaces the value of every sensitive field in logs
+const redactedValue = "[REDACTED]"
+
+// redactFields is a set of field names normalized by normalizeField
+type redactFields map[string]struct{}
+
+func newRedactFields(names []string) redactFields {
+	fields := make(redactFields, len(names))
+	for _, name := range names {
+		if name = normalizeField(name); name != "" {
+			fields[name] = struct{}{}
+		}
+	}
+	return fields
+}
+
+// normalizeField folds case and underscores so "accountId" also matches
+// "account_id" and "AccountID"
+func normalizeField(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", ""))
+}
+
+// redact returns the JSON payload with the values of fields masked at any
+// depth, for logging; payloads that are not JSON, e.g. Avro, cannot be
+// searched for fields and are replaced entirely
+func redact(payload []byte, fields redactFields) string {
+	if len(fields) == 0 {
+		return string(payload)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return fmt.Sprintf("%s (%d bytes)", redactedValue, len(payload))
+	}
+	masked, err := json.Marshal(fields.mask(value))
+	if err != nil {
+		return fmt.Sprintf("%s (%d bytes)", redactedValue, len(payload))
+	}
+	return string(masked)
+}
+
+// redactValue returns v for logging with its sensitive fields masked, using
+// its JSON form; v is returned as is when no fields are redacted
+func redactValue(v interface{}, fields redactFields) interface{} {
+	if len(fields) == 0 {
+		return v
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return redactedValue
+	}
+	return redact(payload, fields)
+}
+
+func (f redactFields) mask(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if _, ok := f[normalizeField(key)]; ok {
+				if field != nil {
+					v[key] = redactedValue
+				}
+				continue
+			}
+			v[key] = f.mask(field)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = f.mask(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,34 @@
+package deliveries
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	fields := newRedactFields([]string{"accountId", "metadata"})
+
+	tests := []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{"camel case", `{"accountId":"acc-1","amount":10}`, `{"accountId":"[REDACTED]","amount":10}`},
+		{"snake case", `{"account_id":"acc-1"}`, `{"account_id":"[REDACTED]"}`},
+		{"nested", `{"items":[{"metadata":{"card":"4111"}}]}`, `{"items":[{"metadata":"[REDACTED]"}]}`},
+		{"null stays null", `{"metadata":null}`, `{"metadata":null}`},
+		{"not json", "\x00\x01avro", "[REDACTED] (6 bytes)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redact([]byte(tt.payload), fields); got != tt.expected {
+				t.Errorf("redact() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRedact_NoFieldsLogsVerbatim(t *testing.T) {
+	payload := `{"accountId":"acc-1"}`
+	if got := redact([]byte(payload), newRedactFields(nil)); got != payload {
+		t.Errorf("redact() = %s, expected the payload unchanged", got)
+	}
+}
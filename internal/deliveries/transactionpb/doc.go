@@ -0,0 +1,4 @@
+// Package transactionpb contains the protobuf encoding of transaction events
+package transactionpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative transaction.proto
@@ -0,0 +1,14 @@
+package entities
+
+import (
+	"time"
+)
+
+// AuditEvent is the append-only compliance record of a stored transaction
+type AuditEvent struct {
+	ID            int64
+	TransactionID string
+	UserID        int64
+	Amount        float64
+	ProcessedAt   time.Time
+}
@@ -0,0 +1,13 @@
+package entities
+
+import (
+	"time"
+)
+
+// PersistedEvent confirms to downstream services that a transaction was
+// stored with a status
+type PersistedEvent struct {
+	TransactionID string            `json:"transactionId"`
+	Status        TransactionStatus `json:"status"`
+	PersistedAt   time.Time         `json:"persistedAt"`
+}
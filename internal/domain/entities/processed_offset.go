@@ -0,0 +1,14 @@
+package entities
+
+import (
+	"time"
+)
+
+// ProcessedOffset is the position of the last Kafka message whose
+// transaction was persisted for a topic partition
+type ProcessedOffset struct {
+	Topic       string
+	Partition   int
+	Offset      int64
+	ProcessedAt time.Time
+}
@@ -0,0 +1,23 @@
+package entities
+
+import (
+	"time"
+)
+
+type ProcessingOutcome string
+
+const (
+	ProcessingOutcomeSuccess ProcessingOutcome = "SUCCESS"
+	ProcessingOutcomeFailed  ProcessingOutcome = "FAILED"
+)
+
+// ProcessingLog records how a single consumed message was processed
+type ProcessingLog struct {
+	ID            int64
+	TransactionID string
+	Outcome       ProcessingOutcome
+	Error         *string
+	ReceivedAt    time.Time
+	ProcessedAt   time.Time
+	Latency       time.Duration
+}
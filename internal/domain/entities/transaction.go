@@ -1,6 +1,10 @@
 package entities
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"time"
 )
 
@@ -22,33 +26,155 @@ const (
 	TransactionStatusCancelled TransactionStatus = "CANCELLED"
 )
 
+// TransactionTypes lists every known transaction type
+var TransactionTypes = []TransactionType{
+	TransactionTypeTopup,
+	TransactionTypePayment,
+	TransactionTypeRefund,
+	TransactionTypeTransfer,
+}
+
+// TransactionStatuses lists every known transaction status
+var TransactionStatuses = []TransactionStatus{
+	TransactionStatusPending,
+	TransactionStatusSuccess,
+	TransactionStatusFailed,
+	TransactionStatusCancelled,
+}
+
+// IsTerminal reports whether a transaction in status s is settled and must
+// not change status anymore
+func (s TransactionStatus) IsTerminal() bool {
+	switch s {
+	case TransactionStatusSuccess, TransactionStatusFailed, TransactionStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a transaction in status s may move to
+// next; transitions only move forward, and repeating a status is allowed
+// so redelivered events stay idempotent
+func (s TransactionStatus) CanTransitionTo(next TransactionStatus) bool {
+	return s == next || !s.IsTerminal()
+}
+
 type PaymentMethod string
 
+// Transaction is a stored wallet transaction; its JSON form, with the
+// camelCase keys of the Kafka messages, is used for exports
 type Transaction struct {
-	ID                       string
-	UserID                   int64
-	AccountID                string
-	TransactionID            string
-	TransactionType          TransactionType
-	TransactionStatus        TransactionStatus
-	Amount                   float64
-	BalanceBefore            float64
-	BalanceAfter             float64
-	Currency                 string
-	Description              *string
-	ExternalReference        *string
-	PaymentMethod            *PaymentMethod
-	Metadata                 *string
-	IsAccessibleFromExternal bool
-	CreatedAt                time.Time
-	UpdatedAt                time.Time
+	ID                       string            `json:"id"`
+	UserID                   int64             `json:"userId"`
+	AccountID                string            `json:"accountId"`
+	TenantID                 string            `json:"tenantId,omitempty"`
+	TransactionID            string            `json:"transactionId"`
+	TransactionType          TransactionType   `json:"transactionType"`
+	TransactionStatus        TransactionStatus `json:"transactionStatus"`
+	Amount                   float64           `json:"amount"`
+	BalanceBefore            float64           `json:"balanceBefore"`
+	BalanceAfter             float64           `json:"balanceAfter"`
+	Currency                 string            `json:"currency"`
+	Description              *string           `json:"description,omitempty"`
+	ExternalReference        *string           `json:"externalReference,omitempty"`
+	PaymentMethod            *PaymentMethod    `json:"paymentMethod,omitempty"`
+	Metadata                 *string           `json:"metadata,omitempty"`
+	IsAccessibleFromExternal bool              `json:"isAccessibleFromExternal"`
+	CreatedAt                time.Time         `json:"createdAt"`
+	UpdatedAt                time.Time         `json:"updatedAt"`
+	ReversedAt               *time.Time        `json:"reversedAt,omitempty"`
+	ReversalReason           *string           `json:"reversalReason,omitempty"`
+
+	// RawPayload is the Kafka message the transaction was decoded from, kept
+	// for auditing and reprocessing when enabled
+	RawPayload *string `json:"rawPayload,omitempty"`
+}
+
+// IsReversed reports whether the transaction was reversed
+func (t *Transaction) IsReversed() bool {
+	return t.ReversedAt != nil
 }
 
+// MaxAmount is the largest amount or balance the decimal(15,2) columns hold
+const MaxAmount = 9_999_999_999_999.99
+
 // IsValid validates the transaction entity
 func (t *Transaction) IsValid() bool {
-	return t.UserID > 0 &&
-		t.AccountID != "" &&
-		t.TransactionID != "" &&
-		t.TransactionType != "" &&
-		t.Amount > 0
+	return t.Validate() == nil
+}
+
+// Validate validates the transaction entity, describing the first problem
+func (t *Transaction) Validate() error {
+	if err := t.ValidateRequired(); err != nil {
+		return err
+	}
+	if err := t.ValidateAmounts(); err != nil {
+		return err
+	}
+	return t.ValidateMetadata()
+}
+
+// ValidateRequired checks that the identifying fields are set
+func (t *Transaction) ValidateRequired() error {
+	switch {
+	case t.UserID <= 0:
+		return errors.New("userId must be positive")
+	case t.AccountID == "":
+		return errors.New("accountId is required")
+	case t.TransactionID == "":
+		return errors.New("transactionId is required")
+	case t.TransactionType == "":
+		return errors.New("transactionType is required")
+	}
+	return nil
+}
+
+// ValidateAmounts checks that the amount is positive and that the amount and
+// balances fit the decimal(15,2) columns
+func (t *Transaction) ValidateAmounts() error {
+	return t.validateAmounts(false)
+}
+
+// ValidateAmountsAllowZero is ValidateAmounts accepting a zero amount, e.g.
+// for balance adjustments or fee-free transfers
+func (t *Transaction) ValidateAmountsAllowZero() error {
+	return t.validateAmounts(true)
+}
+
+func (t *Transaction) validateAmounts(allowZero bool) error {
+	if err := validateAmount("amount", t.Amount); err != nil {
+		return err
+	}
+	if t.Amount == 0 && !allowZero {
+		return errors.New("amount must be positive")
+	}
+	if err := validateAmount("balanceBefore", t.BalanceBefore); err != nil {
+		return err
+	}
+	if err := validateAmount("balanceAfter", t.BalanceAfter); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateMetadata checks that the metadata, if any, is valid JSON
+func (t *Transaction) ValidateMetadata() error {
+	if t.Metadata != nil && !json.Valid([]byte(*t.Metadata)) {
+		return errors.New("metadata must be valid JSON")
+	}
+	return nil
+}
+
+// validateAmount checks that value is a finite, non-negative amount that
+// fits the decimal(15,2) columns
+func validateAmount(field string, value float64) error {
+	switch {
+	case math.IsNaN(value) || math.IsInf(value, 0):
+		return fmt.Errorf("%s must be a finite number, got: %v", field, value)
+	case value < 0:
+		return fmt.Errorf("%s must not be negative, got: %.2f", field, value)
+	case value > MaxAmount:
+		return fmt.Errorf("%s must not exceed %.2f, got: %.2f", field, MaxAmount, value)
+	}
+	return nil
 }
@@ -1,6 +1,7 @@
 package entities
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -159,3 +160,137 @@ func TestTransactionStruct(t *testing.T) {
 		t.Errorf("Expected PaymentMethod '%s', got %s", paymentMethod, *transaction.PaymentMethod)
 	}
 }
+
+func TestTransaction_IsReversed(t *testing.T) {
+	transaction := &Transaction{TransactionID: "trans-123"}
+	if transaction.IsReversed() {
+		t.Error("Transaction without ReversedAt should not be reversed")
+	}
+
+	reversedAt := time.Now()
+	transaction.ReversedAt = &reversedAt
+	if !transaction.IsReversed() {
+		t.Error("Transaction with ReversedAt should be reversed")
+	}
+}
+
+func TestTransaction_Validate_Amounts(t *testing.T) {
+	tests := []struct {
+		name          string
+		amount        float64
+		balanceBefore float64
+		balanceAfter  float64
+		expectedErr   string
+	}{
+		{"valid", 100.50, 1000, 1100.50, ""},
+		{"zero balances", 100.50, 0, 0, ""},
+		{"maximum amount", MaxAmount, 0, 0, ""},
+		{"zero amount", 0, 0, 0, "amount must be positive"},
+		{"negative amount", -1, 0, 0, "amount must not be negative, got: -1.00"},
+		{"NaN amount", math.NaN(), 0, 0, "amount must be a finite number, got: NaN"},
+		{"infinite amount", math.Inf(1), 0, 0, "amount must be a finite number, got: +Inf"},
+		{"negative infinite amount", math.Inf(-1), 0, 0, "amount must be a finite number, got: -Inf"},
+		{"excessive amount", 1e15, 0, 0, "amount must not exceed 9999999999999.99, got: 1000000000000000.00"},
+		{"NaN balance before", 100, math.NaN(), 0, "balanceBefore must be a finite number, got: NaN"},
+		{"negative balance before", 100, -50, 0, "balanceBefore must not be negative, got: -50.00"},
+		{"infinite balance after", 100, 0, math.Inf(1), "balanceAfter must be a finite number, got: +Inf"},
+		{"negative balance after", 100, 0, -0.01, "balanceAfter must not be negative, got: -0.01"},
+		{"excessive balance after", 100, 0, 1e14, "balanceAfter must not exceed 9999999999999.99, got: 100000000000000.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := Transaction{
+				UserID:          123,
+				AccountID:       "account-123",
+				TransactionID:   "trans-123",
+				TransactionType: TransactionTypeTopup,
+				Amount:          tt.amount,
+				BalanceBefore:   tt.balanceBefore,
+				BalanceAfter:    tt.balanceAfter,
+			}
+
+			err := transaction.Validate()
+
+			if tt.expectedErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Errorf("Expected error %q, got: %v", tt.expectedErr, err)
+			}
+			if transaction.IsValid() {
+				t.Error("Expected IsValid() to be false")
+			}
+		})
+	}
+}
+
+func TestTransactionStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from     TransactionStatus
+		to       TransactionStatus
+		expected bool
+	}{
+		{TransactionStatusPending, TransactionStatusPending, true},
+		{TransactionStatusPending, TransactionStatusSuccess, true},
+		{TransactionStatusPending, TransactionStatusFailed, true},
+		{TransactionStatusPending, TransactionStatusCancelled, true},
+		{TransactionStatusSuccess, TransactionStatusSuccess, true},
+		{TransactionStatusSuccess, TransactionStatusPending, false},
+		{TransactionStatusSuccess, TransactionStatusFailed, false},
+		{TransactionStatusFailed, TransactionStatusPending, false},
+		{TransactionStatusCancelled, TransactionStatusSuccess, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+" to "+string(tt.to), func(t *testing.T) {
+			if result := tt.from.CanTransitionTo(tt.to); result != tt.expected {
+				t.Errorf("CanTransitionTo() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTransaction_Validate_Metadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  *string
+		expectErr bool
+	}{
+		{"null metadata", nil, false},
+		{"object", stringPtr(`{"channel":"mobile","promo":{"code":"NEWYEAR"}}`), false},
+		{"array", stringPtr(`["a","b"]`), false},
+		{"JSON null", stringPtr(`null`), false},
+		{"truncated object", stringPtr(`{"channel":"mobile"`), true},
+		{"plain text", stringPtr(`channel=mobile`), true},
+		{"empty string", stringPtr(``), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := Transaction{
+				UserID:          123,
+				AccountID:       "account-123",
+				TransactionID:   "trans-123",
+				TransactionType: TransactionTypeTopup,
+				Amount:          100.50,
+				Metadata:        tt.metadata,
+			}
+
+			err := transaction.Validate()
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Validate() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr && err.Error() != "metadata must be valid JSON" {
+				t.Errorf("Expected metadata error, got: %v", err)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
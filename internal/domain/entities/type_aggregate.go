@@ -0,0 +1,10 @@
+package entities
+
+// TypeAggregate is the number and summed amount of the transactions sharing
+// a type and status, as shown on reporting dashboards
+type TypeAggregate struct {
+	TransactionType   TransactionType
+	TransactionStatus TransactionStatus
+	Count             int64
+	TotalAmount       float64
+}
@@ -0,0 +1,11 @@
+package repositories
+
+import (
+	"context"
+	"transaction-consumer/internal/domain/entities"
+)
+
+// AuditSink receives an audit event for every stored transaction
+type AuditSink interface {
+	Emit(ctx context.Context, event *entities.AuditEvent) error
+}
@@ -0,0 +1,12 @@
+package repositories
+
+import (
+	"context"
+	"transaction-consumer/internal/domain/entities"
+)
+
+// PersistedEventPublisher announces every stored transaction status to
+// downstream services
+type PersistedEventPublisher interface {
+	PublishPersisted(ctx context.Context, event *entities.PersistedEvent) error
+}
@@ -0,0 +1,9 @@
+package repositories
+
+import (
+	"context"
+)
+
+type ProcessedOffsetRepository interface {
+	GetLastOffsets(ctx context.Context, topic string) (map[int]int64, error)
+}
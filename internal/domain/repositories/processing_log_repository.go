@@ -0,0 +1,11 @@
+package repositories
+
+import (
+	"context"
+	"transaction-consumer/internal/domain/entities"
+)
+
+type ProcessingLogRepository interface {
+	Record(ctx context.Context, entry *entities.ProcessingLog) error
+	GetRecent(ctx context.Context, limit int) ([]*entities.ProcessingLog, error)
+}
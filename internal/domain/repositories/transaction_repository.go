@@ -2,11 +2,96 @@ package repositories
 
 import (
 	"context"
+	"errors"
+	"io"
+	"time"
 	"transaction-consumer/internal/domain/entities"
 )
 
-type TransactionRepository interface {
-	Create(ctx context.Context, transaction *entities.Transaction) error
-	GetByTransactionID(ctx context.Context, transactionID string) (*entities.Transaction, error)
+// ErrDuplicateTransaction is returned when a transaction with the same
+// transaction ID is already stored
+var ErrDuplicateTransaction = errors.New("transaction already exists")
+
+// ErrTransactionNotFound is returned when an update matches no stored
+// transaction
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// ErrOutOfOrderUpdate is returned when a status update would move a stored
+// transaction backwards, e.g. from SUCCESS to PENDING
+var ErrOutOfOrderUpdate = errors.New("status update is out of order")
+
+// TransactionReader looks up stored transactions, for callers that never
+// write them
+type TransactionReader interface {
+	GetByTransactionID(ctx context.Context, transactionID string, opts ...QueryOption) (*entities.Transaction, error)
 	Exists(ctx context.Context, transactionID string) (bool, error)
+	ExistsWithStatus(ctx context.Context, transactionID string, status entities.TransactionStatus) (bool, error)
+	GetByAccountAndDateRange(ctx context.Context, accountID string, from, to time.Time) ([]*entities.Transaction, error)
+	GetLatestByAccount(ctx context.Context, accountID string) (*entities.Transaction, error)
+	AggregateByType(ctx context.Context, from, to time.Time) ([]entities.TypeAggregate, error)
+
+	// ExportAll streams the transactions matching opts to w as
+	// newline-delimited JSON, oldest first, without loading them all at once
+	ExportAll(ctx context.Context, w io.Writer, opts ...QueryOption) error
+}
+
+// TransactionWriter stores and updates transactions
+type TransactionWriter interface {
+	Create(ctx context.Context, transaction *entities.Transaction) error
+	Upsert(ctx context.Context, transaction *entities.Transaction) error
+	MarkReversed(ctx context.Context, transactionID string, reason string) error
+	UpdateStatus(ctx context.Context, transactionID string, status entities.TransactionStatus, balanceAfter float64) error
+
+	// SaveOffset records offset as the last processed offset of its
+	// partition; on a repository bound by WithTx it commits together with
+	// the transactions stored there
+	SaveOffset(ctx context.Context, offset *entities.ProcessedOffset) error
+}
+
+// TransactionRepository reads and writes transactions
+type TransactionRepository interface {
+	TransactionReader
+	TransactionWriter
+
+	// WithTx runs fn with a repository whose calls share a single database
+	// transaction, committed when fn succeeds and rolled back when it fails
+	WithTx(ctx context.Context, fn func(repo TransactionRepository) error) error
+}
+
+// QueryOptions holds optional behaviour of transaction lookups
+type QueryOptions struct {
+	IncludeReversed bool
+
+	// CreatedFrom and CreatedTo bound the creation time of exported
+	// transactions, inclusively; zero leaves that side open
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// QueryOption configures a transaction lookup
+type QueryOption func(*QueryOptions)
+
+// IncludeReversed makes lookups return reversed transactions too
+func IncludeReversed() QueryOption {
+	return func(o *QueryOptions) {
+		o.IncludeReversed = true
+	}
+}
+
+// CreatedBetween limits exports to transactions created from from to to,
+// inclusively; a zero time leaves that side open
+func CreatedBetween(from, to time.Time) QueryOption {
+	return func(o *QueryOptions) {
+		o.CreatedFrom = from
+		o.CreatedTo = to
+	}
+}
+
+// NewQueryOptions applies opts to the default query options
+func NewQueryOptions(opts ...QueryOption) QueryOptions {
+	var o QueryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"transaction-consumer/internal/domain/entities"
+)
+
+// ErrSpillFull is returned when the spill reached its size cap
+var ErrSpillFull = errors.New("transaction spill is full")
+
+// TransactionSpill durably buffers transactions that could not be stored
+// while the database is unavailable, until they are drained back into it
+type TransactionSpill interface {
+	Append(ctx context.Context, transaction *entities.Transaction) error
+}
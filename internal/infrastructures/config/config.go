@@ -4,10 +4,29 @@ import (
 	"fmt"
 	"github.com/caarlos0/env/v11"
 	"log"
+	"net/url"
+	"regexp"
 	"strings"
 	"time"
 )
 
+// redactedSecret replaces secrets in a sanitized configuration
+const redactedSecret = "[REDACTED]"
+
+// enumValuePattern matches a configured transaction type or status
+var enumValuePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// defaultTransactionTypes and defaultTransactionStatuses are accepted by the
+// enum validator unless APP_TRANSACTION_TYPES or APP_TRANSACTION_STATUSES
+// list others
+var (
+	defaultTransactionTypes    = []string{"TOPUP", "PAYMENT", "REFUND", "TRANSFER"}
+	defaultTransactionStatuses = []string{"PENDING", "SUCCESS", "FAILED", "CANCELLED"}
+)
+
+// tableNamePattern matches plain or schema-qualified SQL identifiers
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
 type Config struct {
 	Kafka    KafkaConfig    `envPrefix:"KAFKA_"`
 	Database DatabaseConfig `envPrefix:"DB_"`
@@ -16,15 +35,154 @@ type Config struct {
 
 // KafkaConfig holds Kafka configuration
 type KafkaConfig struct {
+	// Brokers are host:port literals, or a single "srv+" entry naming the
+	// DNS SRV record resolved to the broker list at startup, e.g.
+	// "srv+_kafka._tcp.example.com"
 	Brokers        []string      `env:"BROKERS,required" envSeparator:","`
 	Topic          string        `env:"TOPIC,required"`
 	GroupID        string        `env:"GROUP_ID,required"`
 	CommitInterval time.Duration `env:"COMMIT_INTERVAL" envDefault:"2s"`
 	MaxBytes       int           `env:"MAX_BYTES" envDefault:"10485760"`
+
+	// ClientID identifies this instance in broker logs and metrics; empty
+	// derives it from the hostname, e.g. "transaction-consumer-pod-1"
+	ClientID string `env:"CLIENT_ID"`
+
+	// SessionTimeout is how long the group coordinator waits for a heartbeat
+	// before evicting the consumer, RebalanceTimeout how long it waits for
+	// members to rejoin during a rebalance and HeartbeatInterval how often
+	// heartbeats are sent; raise them when slow processing causes evictions
+	SessionTimeout    time.Duration `env:"SESSION_TIMEOUT" envDefault:"30s"`
+	RebalanceTimeout  time.Duration `env:"REBALANCE_TIMEOUT" envDefault:"30s"`
+	HeartbeatInterval time.Duration `env:"HEARTBEAT_INTERVAL" envDefault:"3s"`
+
+	// MaxMessageBytes rejects single messages above this size before they are
+	// decoded, dead-lettering them; zero disables the limit
+	MaxMessageBytes int `env:"MAX_MESSAGE_BYTES" envDefault:"1048576"`
+
+	// CommitStrategy controls offset commits: "interval" commits the latest
+	// processed offset of each partition every CommitInterval, "sync" commits
+	// every message synchronously once it is processed. Both are
+	// at-least-once; with "interval" a crash replays up to CommitInterval
+	// worth of messages, which the idempotent insert skips
+	CommitStrategy string `env:"COMMIT_STRATEGY" envDefault:"interval"`
+
+	// CommitEveryN additionally commits a partition under the "interval"
+	// strategy as soon as N of its messages were processed, bounding the
+	// replay after a crash by count as well as by time; zero disables it
+	CommitEveryN int `env:"COMMIT_EVERY_N" envDefault:"0"`
+
+	// MaxMessages stops consuming cleanly once that many messages were
+	// processed, e.g. for canary runs and end-to-end tests; zero consumes
+	// until interrupted
+	MaxMessages int `env:"MAX_MESSAGES" envDefault:"0"`
+
+	// Workers is the number of messages processed concurrently; values above 1
+	// enable a worker pool that preserves ordering per message key
+	Workers         int `env:"WORKERS" envDefault:"1"`
+	WorkerQueueSize int `env:"WORKER_QUEUE_SIZE" envDefault:"100"`
+
+	// StatusPriorities ranks queued messages by transaction status when the
+	// worker pool is saturated, e.g. "SUCCESS:2,FAILED:2,CANCELLED:2,PENDING:1"
+	StatusPriorities map[string]int `env:"STATUS_PRIORITIES" envSeparator:"," envKeyValSeparator:":"`
+
+	// MaxRetries is how often a message failing with an error that is not
+	// permanent is retried before it is dead-lettered; without DLQTopic, or
+	// when publishing fails, the consumer stops instead and leaves it
+	// uncommitted. RetryBackoff is the first wait between attempts and
+	// doubles on every retry
+	MaxRetries   int           `env:"MAX_RETRIES" envDefault:"3"`
+	RetryBackoff time.Duration `env:"RETRY_BACKOFF" envDefault:"500ms"`
+
+	// ProcessTimeout bounds every processing attempt of a message, so a
+	// handler stuck e.g. on a database call is cancelled and retried instead
+	// of stalling its partition; zero disables the deadline
+	ProcessTimeout time.Duration `env:"PROCESS_TIMEOUT" envDefault:"30s"`
+
+	// SeekOffset rewinds SeekPartition to this offset on startup and SeekTime
+	// rewinds every partition to the first message at or after this RFC 3339
+	// time; a negative offset and an unset time leave the committed position
+	// in place. The offsets are committed for GroupID before joining it, so
+	// every other member of the group must be stopped first
+	SeekPartition int       `env:"SEEK_PARTITION"`
+	SeekOffset    int64     `env:"SEEK_OFFSET" envDefault:"-1"`
+	SeekTime      time.Time `env:"SEEK_TIME"`
+
+	// StrictDecoding rejects JSON messages with fields the consumer does not
+	// know, dead-lettering them instead of dropping the unknown values
+	StrictDecoding bool `env:"STRICT_DECODING" envDefault:"false"`
+
+	// TenantHeader names the header whose value is stored as the tenant of
+	// every transaction; RequiredHeaders, e.g. "tenant-id", dead-letters
+	// messages missing any of them
+	TenantHeader    string   `env:"TENANT_HEADER" envDefault:"tenant-id"`
+	RequiredHeaders []string `env:"REQUIRED_HEADERS" envSeparator:","`
+
+	// DLQTopic receives messages that can never be processed or run out of
+	// retries; empty disables dead-lettering
+	DLQTopic string `env:"DLQ_TOPIC"`
+
+	// PersistedTopic receives a transaction.persisted confirmation with the
+	// transaction ID, status and time of every stored transaction status;
+	// empty disables confirmations. PersistedEventRequired retries the
+	// message when its confirmation cannot be published instead of only
+	// logging the failure
+	PersistedTopic         string `env:"PERSISTED_TOPIC"`
+	PersistedEventRequired bool   `env:"PERSISTED_EVENT_REQUIRED" envDefault:"false"`
+
+	// MessageFormat selects the payload decoder: "json", "avro" or
+	// "protobuf"; avro payloads carry the Confluent wire-format prefix and
+	// their schema is fetched from SchemaRegistryURL
+	MessageFormat     string `env:"MESSAGE_FORMAT" envDefault:"json"`
+	SchemaRegistryURL string `env:"SCHEMA_REGISTRY_URL"`
+
+	// SASLMechanism enables SASL authentication: "PLAIN", "SCRAM-SHA-256"
+	// or "SCRAM-SHA-512"; empty disables it
+	SASLMechanism string `env:"SASL_MECHANISM"`
+	SASLUsername  string `env:"SASL_USERNAME"`
+	SASLPassword  string `env:"SASL_PASSWORD"`
+
+	// TLSEnabled encrypts broker connections; TLSCAPath optionally points to
+	// a PEM bundle used instead of the system roots
+	TLSEnabled bool   `env:"TLS_ENABLED" envDefault:"false"`
+	TLSCAPath  string `env:"TLS_CA_PATH"`
+
+	// UnknownTopicPolicy controls what happens when the topic disappears
+	// while consuming: "backoff" waits UnknownTopicBackoff and retries,
+	// "exit" stops the consumer so the process can be restarted
+	UnknownTopicPolicy  string        `env:"UNKNOWN_TOPIC_POLICY" envDefault:"backoff"`
+	UnknownTopicBackoff time.Duration `env:"UNKNOWN_TOPIC_BACKOFF" envDefault:"30s"`
+
+	// MinBytes is the least data a fetch waits for, and MaxWait bounds how
+	// long it waits before returning with less. Raising MinBytes batches more
+	// messages per fetch for throughput, at the cost of latency while traffic
+	// is low, when fetches wait out MaxWait; the default of 1 returns as soon
+	// as any message arrives. MaxBytes caps the data of a fetch, bounding
+	// memory use, and must not be below MinBytes
+	MinBytes int           `env:"MIN_BYTES" envDefault:"1"`
+	MaxWait  time.Duration `env:"MAX_WAIT" envDefault:"10s"`
+
+	// FetchBackoffInitial is the wait after a failed fetch; it doubles on
+	// every consecutive failure up to FetchBackoffMax and resets on success
+	FetchBackoffInitial time.Duration `env:"FETCH_BACKOFF_INITIAL" envDefault:"1s"`
+	FetchBackoffMax     time.Duration `env:"FETCH_BACKOFF_MAX" envDefault:"30s"`
+
+	// LagReportInterval is how often the lag per partition is logged and
+	// exported as a metric; zero disables reporting
+	LagReportInterval time.Duration `env:"LAG_REPORT_INTERVAL" envDefault:"30s"`
+
+	// StatsLogInterval is how often the reader statistics, such as messages,
+	// bytes, errors and rebalances, are logged; zero disables the log
+	StatsLogInterval time.Duration `env:"STATS_LOG_INTERVAL" envDefault:"0s"`
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
+	// Driver selects the transaction store: "postgres", "sqlite" for small
+	// single-node deployments, with Name as the database file, or "memory"
+	// to keep transactions in process for local smoke tests
+	Driver string `env:"DRIVER" envDefault:"postgres"`
+
 	Host            string        `env:"HOST,required"`
 	Port            int           `env:"PORT" envDefault:"5432"`
 	User            string        `env:"USER,required"`
@@ -34,6 +192,46 @@ type DatabaseConfig struct {
 	MaxIdleConns    int           `env:"MAX_IDLE_CONNS" envDefault:"10"`
 	MaxOpenConns    int           `env:"MAX_OPEN_CONNS" envDefault:"100"`
 	ConnMaxLifetime time.Duration `env:"CONN_MAX_LIFETIME" envDefault:"1h"`
+
+	// ConnectRetries is how often a failed connection on startup is retried,
+	// e.g. while the database container is still starting; ConnectRetryDelay
+	// is the first wait between attempts and doubles on every retry
+	ConnectRetries    int           `env:"CONNECT_RETRIES" envDefault:"5"`
+	ConnectRetryDelay time.Duration `env:"CONNECT_RETRY_DELAY" envDefault:"1s"`
+
+	// TableName is the table transactions are stored in, optionally schema
+	// qualified, e.g. "tenant_a.historical_transactions"
+	TableName string `env:"TABLE_NAME" envDefault:"historical_transactions"`
+
+	// ReplicaHost is a read replica of the postgres database that reporting
+	// queries are routed to, writes and the lookups processing decides on
+	// staying on Host; ReplicaPort defaults to Port and empty ReplicaHost
+	// reads from the primary
+	ReplicaHost string `env:"REPLICA_HOST"`
+	ReplicaPort int    `env:"REPLICA_PORT"`
+
+	// QueryTimeout bounds each repository call; zero disables the bound
+	QueryTimeout time.Duration `env:"QUERY_TIMEOUT" envDefault:"5s"`
+
+	// ReadTimeout bounds lookups and WriteTimeout inserts and updates in
+	// place of QueryTimeout; zero keeps QueryTimeout
+	ReadTimeout  time.Duration `env:"READ_TIMEOUT"`
+	WriteTimeout time.Duration `env:"WRITE_TIMEOUT"`
+
+	// BreakerThreshold is how many consecutive failed repository calls open
+	// the circuit breaker, failing further calls fast for BreakerCooldown
+	// before a single probe is let through; zero disables the breaker
+	BreakerThreshold int           `env:"BREAKER_THRESHOLD" envDefault:"5"`
+	BreakerCooldown  time.Duration `env:"BREAKER_COOLDOWN" envDefault:"30s"`
+
+	// HealthCheckInterval is how often the connection pool is pinged while
+	// consuming; a failed ping closes the idle connections, which may point
+	// at the old primary after a failover. Zero disables the check
+	HealthCheckInterval time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"30s"`
+
+	// AutoMigrate creates the enum types, the transaction table and the feature
+	// tables on startup
+	AutoMigrate bool `env:"AUTO_MIGRATE" envDefault:"false"`
 }
 
 // AppConfig holds application configuration
@@ -42,14 +240,146 @@ type AppConfig struct {
 	Environment string `env:"ENVIRONMENT" envDefault:"production"`
 	Port        int    `env:"PORT" envDefault:"8080"`
 	Debug       bool   `env:"DEBUG" envDefault:"false"`
+
+	// LogTimeFormat is the Go time layout of the UTC time field of log
+	// lines; empty or invalid layouts fall back to RFC3339 with nanoseconds
+	LogTimeFormat string `env:"LOG_TIME_FORMAT"`
+
+	// ConfigFile is an optional YAML file supplying values for any variable
+	// not set in the environment
+	ConfigFile string `env:"CONFIG_FILE"`
+
+	// RejectBalanceMismatch rejects successful transactions whose balance
+	// delta does not match the amount instead of only logging a warning
+	RejectBalanceMismatch bool `env:"REJECT_BALANCE_MISMATCH" envDefault:"false"`
+
+	// RejectBalanceMagnitudeMismatch rejects successful TOPUP and PAYMENT
+	// transactions whose balance change differs from the amount, e.g.
+	// amounts sent in cents, by running the "balance-magnitude" validator
+	// even when Validators does not list it
+	RejectBalanceMagnitudeMismatch bool `env:"REJECT_BALANCE_MAGNITUDE_MISMATCH" envDefault:"false"`
+
+	// BalanceContinuityCheck warns when a new transaction does not start from
+	// the balance after the previous transaction of its account; it costs an
+	// extra read per transaction
+	BalanceContinuityCheck bool `env:"BALANCE_CONTINUITY_CHECK" envDefault:"false"`
+
+	// DuplicateDiffEnabled warns when a skipped duplicate transaction differs
+	// from the stored one; it costs an extra read per duplicate
+	DuplicateDiffEnabled bool `env:"DUPLICATE_DIFF_ENABLED" envDefault:"false"`
+
+	// NormalizeAmountSign stores PAYMENT and TRANSFER amounts as negative
+	// debits and TOPUP and REFUND amounts as positive credits, keeping the
+	// amount as received in the metadata
+	NormalizeAmountSign bool `env:"NORMALIZE_AMOUNT_SIGN" envDefault:"false"`
+
+	// AllowZeroAmount accepts transactions with a zero amount, which are
+	// rejected as invalid otherwise
+	AllowZeroAmount bool `env:"ALLOW_ZERO_AMOUNT" envDefault:"false"`
+
+	// StoreRawPayload stores the received Kafka message with every
+	// transaction for auditing and reprocessing
+	StoreRawPayload bool `env:"STORE_RAW_PAYLOAD" envDefault:"false"`
+
+	// DedupCacheSize is how many recently stored transaction statuses are
+	// kept in memory, skipping redelivered duplicates of them without a
+	// database lookup; the unique index still rejects any duplicate the cache
+	// misses. Zero disables the cache
+	DedupCacheSize int `env:"DEDUP_CACHE_SIZE" envDefault:"0"`
+
+	// SpillDir enables buffering transactions in a local write-ahead log
+	// when the database fails transiently, committing their messages instead
+	// of retrying them; the log is drained every SpillDrainInterval once the
+	// database recovers. SpillMaxBytes caps the log, zero leaving it
+	// unbounded; once full, messages are retried as without a spill. Empty
+	// SpillDir disables spilling
+	SpillDir           string        `env:"SPILL_DIR"`
+	SpillMaxBytes      int64         `env:"SPILL_MAX_BYTES" envDefault:"104857600"`
+	SpillDrainInterval time.Duration `env:"SPILL_DRAIN_INTERVAL" envDefault:"10s"`
+
+	// ProcessingLogEnabled persists a processing_log row per consumed message
+	ProcessingLogEnabled bool `env:"PROCESSING_LOG_ENABLED" envDefault:"false"`
+
+	// TransactionalOffsetsEnabled records each message offset in
+	// processed_offsets within the transaction insert, and skips messages
+	// at or below those offsets on startup
+	TransactionalOffsetsEnabled bool `env:"TRANSACTIONAL_OFFSETS_ENABLED" envDefault:"false"`
+
+	// ReprocessEnabled makes the reprocess command overwrite stored rows with
+	// the replayed transactions instead of skipping those already stored;
+	// normal consumption stays append-only and idempotent
+	ReprocessEnabled bool `env:"REPROCESS_ENABLED" envDefault:"false"`
+
+	// ShutdownGracePeriod is how long the process waits after cancelling the
+	// consumer, letting the in-flight message finish before connections close
+	ShutdownGracePeriod time.Duration `env:"SHUTDOWN_GRACE_PERIOD" envDefault:"2s"`
+
+	// DryRun validates and logs every transaction without writing anything,
+	// e.g. to vet the message stream of a new producer
+	DryRun bool `env:"DRY_RUN" envDefault:"false"`
+
+	// AuditLogEnabled appends an audit_log row for every inserted transaction
+	AuditLogEnabled bool `env:"AUDIT_LOG_ENABLED" envDefault:"false"`
+
+	// OnInvalidMessage decides what happens to a message that can never be
+	// processed: "skip" commits past it, "dlq" dead-letters it first, which
+	// requires KAFKA_DLQ_TOPIC, and "fail" stops the consumer so the process
+	// shuts down. Empty dead-letters when KAFKA_DLQ_TOPIC is set and skips
+	// otherwise
+	OnInvalidMessage string `env:"ON_INVALID_MESSAGE"`
+
+	// TransactionTypes and TransactionStatuses are accepted by the "enum"
+	// validator, so a new type, e.g. WITHDRAWAL, needs a configuration
+	// change rather than a release; the database enums still need a
+	// migration. Changing them requires "enum" in Validators
+	TransactionTypes    []string `env:"TRANSACTION_TYPES" envSeparator:"," envDefault:"TOPUP,PAYMENT,REFUND,TRANSFER"`
+	TransactionStatuses []string `env:"TRANSACTION_STATUSES" envSeparator:"," envDefault:"PENDING,SUCCESS,FAILED,CANCELLED"`
+
+	// AllowedTransactionTypes lists the transaction types stored, e.g.
+	// "PAYMENT,REFUND"; messages of other types are committed without
+	// touching the database. Empty allows all types
+	AllowedTransactionTypes []string `env:"ALLOWED_TRANSACTION_TYPES" envSeparator:","`
+
+	// ProcessingOrder is the ordering guarantee of the worker pool enabled by
+	// KAFKA_WORKERS: "keyed" keeps messages with the same key, or of the same
+	// partition when unkeyed, in order, "strict" keeps every partition in
+	// order and "best-effort" may reorder any messages for full concurrency
+	ProcessingOrder string `env:"PROCESSING_ORDER" envDefault:"keyed"`
+
+	// LogSampleEvery writes only one of every N identical consumer log lines
+	// per LogSampleInterval, so incident storms do not flood the logging
+	// pipeline; values below 2 disable sampling
+	LogSampleEvery    int           `env:"LOG_SAMPLE_EVERY" envDefault:"0"`
+	LogSampleInterval time.Duration `env:"LOG_SAMPLE_INTERVAL" envDefault:"1s"`
+
+	// LogRedactFields lists the message fields, e.g. "accountId", whose
+	// values are masked when messages are logged; empty logs them verbatim
+	LogRedactFields []string `env:"LOG_REDACT_FIELDS" envSeparator:"," envDefault:"externalReference,metadata,accountId"`
+
+	// DefaultCurrency is the ISO 4217 code stored for transactions whose
+	// message omits the currency; empty leaves the currency as received
+	DefaultCurrency string `env:"DEFAULT_CURRENCY" envDefault:"IDR"`
+
+	// Validators lists, in order, the checks a transaction must pass before
+	// it is stored: "required-fields", "enum", "currency", "balance-math",
+	// "balance-magnitude", "amount-bounds" and "metadata"; ValidateAll
+	// reports every failing check instead of only the first
+	Validators  []string `env:"VALIDATORS" envSeparator:"," envDefault:"required-fields,amount-bounds,metadata"`
+	ValidateAll bool     `env:"VALIDATE_ALL" envDefault:"false"`
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{}
 
+	// Values from the optional config file sit under the environment
+	vars, err := environment()
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse environment variables into the struct
-	if err := env.Parse(cfg); err != nil {
+	if err := env.ParseWithOptions(cfg, env.Options{Environment: vars}); err != nil {
 		return nil, fmt.Errorf("failed to parse environment variables: %w", err)
 	}
 
@@ -76,6 +406,175 @@ func (c *Config) Validate() error {
 		if c.Kafka.Brokers[i] == "" {
 			return fmt.Errorf("KAFKA_BROKERS contains empty broker at index %d", i)
 		}
+		if strings.HasPrefix(c.Kafka.Brokers[i], "srv+") {
+			if len(c.Kafka.Brokers) > 1 {
+				return fmt.Errorf("KAFKA_BROKERS SRV entry must be the only broker, got: %d brokers", len(c.Kafka.Brokers))
+			}
+			if c.Kafka.Brokers[i] == "srv+" {
+				return fmt.Errorf("KAFKA_BROKERS SRV entry requires a record name, got: %s", c.Kafka.Brokers[i])
+			}
+		}
+	}
+
+	validCommitStrategies := []string{"interval", "sync"}
+	if c.Kafka.CommitStrategy != "" && !contains(validCommitStrategies, c.Kafka.CommitStrategy) {
+		return fmt.Errorf("KAFKA_COMMIT_STRATEGY must be one of: %s, got: %s",
+			strings.Join(validCommitStrategies, ", "), c.Kafka.CommitStrategy)
+	}
+
+	if c.Kafka.CommitInterval < 0 {
+		return fmt.Errorf("KAFKA_COMMIT_INTERVAL must not be negative, got: %s", c.Kafka.CommitInterval)
+	}
+
+	if c.Kafka.CommitEveryN < 0 {
+		return fmt.Errorf("KAFKA_COMMIT_EVERY_N must not be negative, got: %d", c.Kafka.CommitEveryN)
+	}
+
+	if c.Kafka.MaxMessages < 0 {
+		return fmt.Errorf("KAFKA_MAX_MESSAGES must not be negative, got: %d", c.Kafka.MaxMessages)
+	}
+
+	if c.Kafka.MaxMessageBytes < 0 {
+		return fmt.Errorf("KAFKA_MAX_MESSAGE_BYTES must not be negative, got: %d", c.Kafka.MaxMessageBytes)
+	}
+
+	if c.Kafka.SessionTimeout < 0 {
+		return fmt.Errorf("KAFKA_SESSION_TIMEOUT must not be negative, got: %s", c.Kafka.SessionTimeout)
+	}
+
+	if c.Kafka.RebalanceTimeout < 0 {
+		return fmt.Errorf("KAFKA_REBALANCE_TIMEOUT must not be negative, got: %s", c.Kafka.RebalanceTimeout)
+	}
+
+	if c.Kafka.HeartbeatInterval < 0 {
+		return fmt.Errorf("KAFKA_HEARTBEAT_INTERVAL must not be negative, got: %s", c.Kafka.HeartbeatInterval)
+	}
+
+	if c.Kafka.HeartbeatInterval > 0 && c.Kafka.SessionTimeout > 0 && c.Kafka.HeartbeatInterval >= c.Kafka.SessionTimeout {
+		return fmt.Errorf("KAFKA_HEARTBEAT_INTERVAL must be less than KAFKA_SESSION_TIMEOUT, got: %s >= %s",
+			c.Kafka.HeartbeatInterval, c.Kafka.SessionTimeout)
+	}
+
+	if c.Kafka.SeekPartition < 0 {
+		return fmt.Errorf("KAFKA_SEEK_PARTITION must not be negative, got: %d", c.Kafka.SeekPartition)
+	}
+
+	if c.Kafka.SeekOffset >= 0 && !c.Kafka.SeekTime.IsZero() {
+		return fmt.Errorf("KAFKA_SEEK_OFFSET and KAFKA_SEEK_TIME are mutually exclusive")
+	}
+
+	if c.Kafka.MaxRetries < 0 {
+		return fmt.Errorf("KAFKA_MAX_RETRIES must not be negative, got: %d", c.Kafka.MaxRetries)
+	}
+
+	if c.Kafka.RetryBackoff < 0 {
+		return fmt.Errorf("KAFKA_RETRY_BACKOFF must not be negative, got: %s", c.Kafka.RetryBackoff)
+	}
+
+	for _, header := range c.Kafka.RequiredHeaders {
+		if strings.TrimSpace(header) == "" {
+			return fmt.Errorf("KAFKA_REQUIRED_HEADERS must not contain empty header names, got: %q",
+				strings.Join(c.Kafka.RequiredHeaders, ","))
+		}
+	}
+
+	if c.Kafka.ProcessTimeout < 0 {
+		return fmt.Errorf("KAFKA_PROCESS_TIMEOUT must not be negative, got: %s", c.Kafka.ProcessTimeout)
+	}
+
+	if c.Kafka.Workers < 0 {
+		return fmt.Errorf("KAFKA_WORKERS must not be negative, got: %d", c.Kafka.Workers)
+	}
+
+	if c.Kafka.WorkerQueueSize < 0 {
+		return fmt.Errorf("KAFKA_WORKER_QUEUE_SIZE must not be negative, got: %d", c.Kafka.WorkerQueueSize)
+	}
+
+	validTopicPolicies := []string{"backoff", "exit"}
+	if c.Kafka.UnknownTopicPolicy != "" && !contains(validTopicPolicies, c.Kafka.UnknownTopicPolicy) {
+		return fmt.Errorf("KAFKA_UNKNOWN_TOPIC_POLICY must be one of: %s, got: %s",
+			strings.Join(validTopicPolicies, ", "), c.Kafka.UnknownTopicPolicy)
+	}
+
+	validMessageFormats := []string{"json", "avro", "protobuf"}
+	if c.Kafka.MessageFormat != "" && !contains(validMessageFormats, c.Kafka.MessageFormat) {
+		return fmt.Errorf("KAFKA_MESSAGE_FORMAT must be one of: %s, got: %s",
+			strings.Join(validMessageFormats, ", "), c.Kafka.MessageFormat)
+	}
+
+	if c.Kafka.IsAvro() && c.Kafka.SchemaRegistryURL == "" {
+		return fmt.Errorf("KAFKA_SCHEMA_REGISTRY_URL is required when KAFKA_MESSAGE_FORMAT is avro")
+	}
+
+	validSASLMechanisms := []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"}
+	if c.Kafka.SASLMechanism != "" {
+		if !contains(validSASLMechanisms, c.Kafka.SASLMechanism) {
+			return fmt.Errorf("KAFKA_SASL_MECHANISM must be one of: %s, got: %s",
+				strings.Join(validSASLMechanisms, ", "), c.Kafka.SASLMechanism)
+		}
+		if c.Kafka.SASLUsername == "" {
+			return fmt.Errorf("KAFKA_SASL_USERNAME is required when KAFKA_SASL_MECHANISM is set")
+		}
+		if c.Kafka.SASLPassword == "" {
+			return fmt.Errorf("KAFKA_SASL_PASSWORD is required when KAFKA_SASL_MECHANISM is set")
+		}
+	}
+
+	if c.Kafka.TLSCAPath != "" && !c.Kafka.TLSEnabled {
+		return fmt.Errorf("KAFKA_TLS_CA_PATH requires KAFKA_TLS_ENABLED to be true")
+	}
+
+	if c.Kafka.PersistedEventRequired && c.Kafka.PersistedTopic == "" {
+		return fmt.Errorf("KAFKA_PERSISTED_EVENT_REQUIRED requires KAFKA_PERSISTED_TOPIC to be set")
+	}
+
+	if c.Kafka.PersistedTopic != "" && c.Kafka.PersistedTopic == c.Kafka.Topic {
+		return fmt.Errorf("KAFKA_PERSISTED_TOPIC must differ from KAFKA_TOPIC, got: %s", c.Kafka.PersistedTopic)
+	}
+
+	if c.Kafka.UnknownTopicBackoff < 0 {
+		return fmt.Errorf("KAFKA_UNKNOWN_TOPIC_BACKOFF must not be negative, got: %s", c.Kafka.UnknownTopicBackoff)
+	}
+
+	if c.Kafka.MinBytes < 0 {
+		return fmt.Errorf("KAFKA_MIN_BYTES must not be negative, got: %d", c.Kafka.MinBytes)
+	}
+
+	if c.Kafka.MaxBytes < 0 {
+		return fmt.Errorf("KAFKA_MAX_BYTES must not be negative, got: %d", c.Kafka.MaxBytes)
+	}
+
+	if c.Kafka.MinBytes > c.Kafka.MaxBytes {
+		return fmt.Errorf("KAFKA_MIN_BYTES must not exceed KAFKA_MAX_BYTES, got: %d > %d", c.Kafka.MinBytes, c.Kafka.MaxBytes)
+	}
+
+	if c.Kafka.MaxWait < 0 {
+		return fmt.Errorf("KAFKA_MAX_WAIT must not be negative, got: %s", c.Kafka.MaxWait)
+	}
+
+	if c.Kafka.FetchBackoffInitial < 0 {
+		return fmt.Errorf("KAFKA_FETCH_BACKOFF_INITIAL must not be negative, got: %s", c.Kafka.FetchBackoffInitial)
+	}
+
+	if c.Kafka.FetchBackoffMax < 0 {
+		return fmt.Errorf("KAFKA_FETCH_BACKOFF_MAX must not be negative, got: %s", c.Kafka.FetchBackoffMax)
+	}
+
+	if c.Kafka.FetchBackoffMax > 0 && c.Kafka.FetchBackoffMax < c.Kafka.FetchBackoffInitial {
+		return fmt.Errorf("KAFKA_FETCH_BACKOFF_MAX must not be less than KAFKA_FETCH_BACKOFF_INITIAL, got: %s < %s",
+			c.Kafka.FetchBackoffMax, c.Kafka.FetchBackoffInitial)
+	}
+
+	if c.Kafka.LagReportInterval < 0 {
+		return fmt.Errorf("KAFKA_LAG_REPORT_INTERVAL must not be negative, got: %s", c.Kafka.LagReportInterval)
+	}
+
+	if c.Kafka.StatsLogInterval < 0 {
+		return fmt.Errorf("KAFKA_STATS_LOG_INTERVAL must not be negative, got: %s", c.Kafka.StatsLogInterval)
+	}
+
+	if c.App.TransactionalOffsetsEnabled && c.Kafka.Workers > 1 {
+		return fmt.Errorf("APP_TRANSACTIONAL_OFFSETS_ENABLED requires KAFKA_WORKERS <= 1, got: %d", c.Kafka.Workers)
 	}
 
 	// Database validation
@@ -83,6 +582,68 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("DB_PORT must be between 1 and 65535, got: %d", c.Database.Port)
 	}
 
+	if c.Database.ReplicaPort < 0 || c.Database.ReplicaPort > 65535 {
+		return fmt.Errorf("DB_REPLICA_PORT must be between 1 and 65535, got: %d", c.Database.ReplicaPort)
+	}
+
+	if c.Database.ReplicaHost != "" && (c.Database.IsSQLite() || c.Database.IsMemory()) {
+		return fmt.Errorf("DB_REPLICA_HOST requires the postgres driver, got: %s", c.Database.Driver)
+	}
+
+	if c.Database.ConnectRetries < 0 {
+		return fmt.Errorf("DB_CONNECT_RETRIES must not be negative, got: %d", c.Database.ConnectRetries)
+	}
+
+	if c.Database.ConnectRetryDelay < 0 {
+		return fmt.Errorf("DB_CONNECT_RETRY_DELAY must not be negative, got: %s", c.Database.ConnectRetryDelay)
+	}
+
+	if c.Database.TableName != "" && !tableNamePattern.MatchString(c.Database.TableName) {
+		return fmt.Errorf("DB_TABLE_NAME must be a table name optionally qualified by a schema, got: %s", c.Database.TableName)
+	}
+
+	if c.Database.QueryTimeout < 0 {
+		return fmt.Errorf("DB_QUERY_TIMEOUT must not be negative, got: %v", c.Database.QueryTimeout)
+	}
+
+	if c.Database.ReadTimeout < 0 {
+		return fmt.Errorf("DB_READ_TIMEOUT must not be negative, got: %v", c.Database.ReadTimeout)
+	}
+
+	if c.Database.WriteTimeout < 0 {
+		return fmt.Errorf("DB_WRITE_TIMEOUT must not be negative, got: %v", c.Database.WriteTimeout)
+	}
+
+	if c.Database.BreakerThreshold < 0 {
+		return fmt.Errorf("DB_BREAKER_THRESHOLD must not be negative, got: %d", c.Database.BreakerThreshold)
+	}
+
+	if c.Database.BreakerCooldown < 0 {
+		return fmt.Errorf("DB_BREAKER_COOLDOWN must not be negative, got: %s", c.Database.BreakerCooldown)
+	}
+
+	if c.Database.HealthCheckInterval < 0 {
+		return fmt.Errorf("DB_HEALTH_CHECK_INTERVAL must not be negative, got: %s", c.Database.HealthCheckInterval)
+	}
+
+	validDrivers := []string{"postgres", "sqlite", "memory"}
+	if c.Database.Driver != "" && !contains(validDrivers, c.Database.Driver) {
+		return fmt.Errorf("DB_DRIVER must be one of: %s, got: %s",
+			strings.Join(validDrivers, ", "), c.Database.Driver)
+	}
+
+	if c.Database.IsMemory() {
+		// These features persist to their own tables next to the transactions
+		switch {
+		case c.App.ProcessingLogEnabled:
+			return fmt.Errorf("DB_DRIVER=memory does not support APP_PROCESSING_LOG_ENABLED")
+		case c.App.TransactionalOffsetsEnabled:
+			return fmt.Errorf("DB_DRIVER=memory does not support APP_TRANSACTIONAL_OFFSETS_ENABLED")
+		case c.App.AuditLogEnabled:
+			return fmt.Errorf("DB_DRIVER=memory does not support APP_AUDIT_LOG_ENABLED")
+		}
+	}
+
 	validSSLModes := []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
 	if !contains(validSSLModes, c.Database.SSLMode) {
 		return fmt.Errorf("DB_SSLMODE must be one of: %s, got: %s",
@@ -95,25 +656,259 @@ func (c *Config) Validate() error {
 			strings.Join(validLogLevels, ", "), c.App.LogLevel)
 	}
 
+	if c.App.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("APP_SHUTDOWN_GRACE_PERIOD must not be negative, got: %s", c.App.ShutdownGracePeriod)
+	}
+
+	if c.App.DedupCacheSize < 0 {
+		return fmt.Errorf("APP_DEDUP_CACHE_SIZE must not be negative, got: %d", c.App.DedupCacheSize)
+	}
+
+	if c.App.SpillMaxBytes < 0 {
+		return fmt.Errorf("APP_SPILL_MAX_BYTES must not be negative, got: %d", c.App.SpillMaxBytes)
+	}
+
+	if c.App.SpillDir != "" && c.App.SpillDrainInterval <= 0 {
+		return fmt.Errorf("APP_SPILL_DRAIN_INTERVAL must be positive when APP_SPILL_DIR is set, got: %s", c.App.SpillDrainInterval)
+	}
+
+	if c.App.LogSampleEvery < 0 {
+		return fmt.Errorf("APP_LOG_SAMPLE_EVERY must not be negative, got: %d", c.App.LogSampleEvery)
+	}
+
+	if c.App.LogSampleInterval < 0 {
+		return fmt.Errorf("APP_LOG_SAMPLE_INTERVAL must not be negative, got: %s", c.App.LogSampleInterval)
+	}
+
+	validInvalidMessagePolicies := []string{"skip", "dlq", "fail"}
+	if c.App.OnInvalidMessage != "" && !contains(validInvalidMessagePolicies, strings.ToLower(c.App.OnInvalidMessage)) {
+		return fmt.Errorf("APP_ON_INVALID_MESSAGE must be one of: %s, got: %s",
+			strings.Join(validInvalidMessagePolicies, ", "), c.App.OnInvalidMessage)
+	}
+	if strings.ToLower(c.App.OnInvalidMessage) == "dlq" && c.Kafka.DLQTopic == "" {
+		return fmt.Errorf("APP_ON_INVALID_MESSAGE=dlq requires KAFKA_DLQ_TOPIC")
+	}
+
+	for _, transactionType := range c.App.TransactionTypes {
+		if !enumValuePattern.MatchString(strings.TrimSpace(transactionType)) {
+			return fmt.Errorf("APP_TRANSACTION_TYPES must only contain letters, digits and underscores, got: %q", transactionType)
+		}
+	}
+
+	for _, status := range c.App.TransactionStatuses {
+		if !enumValuePattern.MatchString(strings.TrimSpace(status)) {
+			return fmt.Errorf("APP_TRANSACTION_STATUSES must only contain letters, digits and underscores, got: %q", status)
+		}
+	}
+
+	// Only the enum validator checks transactions against the configured
+	// types and statuses
+	if !containsTrimmed(c.App.Validators, "enum") {
+		if isCustomized(c.App.TransactionTypes, defaultTransactionTypes) {
+			return fmt.Errorf("APP_TRANSACTION_TYPES requires the enum validator in APP_VALIDATORS")
+		}
+		if isCustomized(c.App.TransactionStatuses, defaultTransactionStatuses) {
+			return fmt.Errorf("APP_TRANSACTION_STATUSES requires the enum validator in APP_VALIDATORS")
+		}
+	}
+
+	validTransactionTypes := c.App.TransactionTypes
+	if len(validTransactionTypes) == 0 {
+		validTransactionTypes = defaultTransactionTypes
+	}
+	for _, transactionType := range c.App.AllowedTransactionTypes {
+		if !contains(validTransactionTypes, strings.TrimSpace(transactionType)) {
+			return fmt.Errorf("APP_ALLOWED_TRANSACTION_TYPES must only contain: %s, got: %s",
+				strings.Join(validTransactionTypes, ", "), transactionType)
+		}
+	}
+
+	validProcessingOrders := []string{"keyed", "strict", "best-effort"}
+	if c.App.ProcessingOrder != "" && !contains(validProcessingOrders, c.App.ProcessingOrder) {
+		return fmt.Errorf("APP_PROCESSING_ORDER must be one of: %s, got: %s",
+			strings.Join(validProcessingOrders, ", "), c.App.ProcessingOrder)
+	}
+
+	if c.App.DefaultCurrency != "" && !isCurrencyCode(c.App.DefaultCurrency) {
+		return fmt.Errorf("APP_DEFAULT_CURRENCY must be a three-letter currency code, got: %s", c.App.DefaultCurrency)
+	}
+
+	validValidators := []string{"required-fields", "enum", "currency", "balance-math", "balance-magnitude", "amount-bounds", "metadata"}
+	for _, validator := range c.App.Validators {
+		if !contains(validValidators, strings.TrimSpace(validator)) {
+			return fmt.Errorf("APP_VALIDATORS must only contain: %s, got: %s",
+				strings.Join(validValidators, ", "), validator)
+		}
+	}
+
 	return nil
 }
 
+// isCurrencyCode reports whether code has the shape of an ISO 4217 code,
+// e.g. "IDR", in either case
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range strings.ToUpper(code) {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 // LogConfig logs the current configuration (without sensitive data)
 func (c *Config) LogConfig() {
+	sanitized := c.Sanitized()
 	log.Printf("Configuration loaded:")
 	log.Printf("  Environment: %s", c.App.Environment)
 	log.Printf("  Log Level: %s", c.App.LogLevel)
+	if c.App.LogTimeFormat != "" {
+		log.Printf("  Log Time Format: %s", c.App.LogTimeFormat)
+	}
 	log.Printf("  Port: %d", c.App.Port)
 	log.Printf("  Debug: %t", c.App.Debug)
+	if c.App.ConfigFile != "" {
+		log.Printf("  Config File: %s", c.App.ConfigFile)
+	}
+	log.Printf("  Reject Balance Mismatch: %t", c.App.RejectBalanceMismatch)
+	log.Printf("  Reject Balance Magnitude Mismatch: %t", c.App.RejectBalanceMagnitudeMismatch)
+	log.Printf("  Balance Continuity Check: %t", c.App.BalanceContinuityCheck)
+	log.Printf("  Duplicate Diff Enabled: %t", c.App.DuplicateDiffEnabled)
+	log.Printf("  Normalize Amount Sign: %t", c.App.NormalizeAmountSign)
+	log.Printf("  Allow Zero Amount: %t", c.App.AllowZeroAmount)
+	log.Printf("  Store Raw Payload: %t", c.App.StoreRawPayload)
+	log.Printf("  Dedup Cache Size: %d", c.App.DedupCacheSize)
+	if c.App.SpillDir != "" {
+		log.Printf("  Spill Dir: %s", c.App.SpillDir)
+		log.Printf("  Spill Max Bytes: %d", c.App.SpillMaxBytes)
+		log.Printf("  Spill Drain Interval: %s", c.App.SpillDrainInterval)
+	}
+	log.Printf("  Processing Log Enabled: %t", c.App.ProcessingLogEnabled)
+	log.Printf("  Transactional Offsets Enabled: %t", c.App.TransactionalOffsetsEnabled)
+	log.Printf("  Reprocess Enabled: %t", c.App.ReprocessEnabled)
+	log.Printf("  Shutdown Grace Period: %s", c.App.ShutdownGracePeriod)
+	log.Printf("  Dry Run: %t", c.App.DryRun)
+	log.Printf("  Audit Log Enabled: %t", c.App.AuditLogEnabled)
+	log.Printf("  On Invalid Message: %s", c.InvalidMessagePolicy())
+	log.Printf("  Processing Order: %s", c.App.ProcessingOrder)
+	log.Printf("  Transaction Types: %s", strings.Join(c.App.TransactionTypes, ", "))
+	log.Printf("  Transaction Statuses: %s", strings.Join(c.App.TransactionStatuses, ", "))
+	log.Printf("  Allowed Transaction Types: %s", strings.Join(c.App.AllowedTransactionTypes, ", "))
+	log.Printf("  Log Sample Every: %d", c.App.LogSampleEvery)
+	log.Printf("  Log Sample Interval: %s", c.App.LogSampleInterval)
+	log.Printf("  Validators: %s", strings.Join(c.App.Validators, ", "))
+	log.Printf("  Validate All: %t", c.App.ValidateAll)
+	log.Printf("  Log Redact Fields: %s", strings.Join(c.App.LogRedactFields, ", "))
+	log.Printf("  Default Currency: %s", c.App.DefaultCurrency)
 	log.Printf("  Kafka Brokers: %s", strings.Join(c.Kafka.Brokers, ", "))
 	log.Printf("  Kafka Topic: %s", c.Kafka.Topic)
 	log.Printf("  Kafka Group ID: %s", c.Kafka.GroupID)
+	log.Printf("  Kafka Client ID: %s", c.Kafka.ClientID)
+	log.Printf("  Kafka Commit Strategy: %s", c.Kafka.CommitStrategy)
+	log.Printf("  Kafka Commit Interval: %s", c.Kafka.CommitInterval)
+	log.Printf("  Kafka Commit Every N: %d", c.Kafka.CommitEveryN)
+	log.Printf("  Kafka Max Messages: %d", c.Kafka.MaxMessages)
+	log.Printf("  Kafka Max Message Bytes: %d", c.Kafka.MaxMessageBytes)
+	log.Printf("  Kafka Strict Decoding: %t", c.Kafka.StrictDecoding)
+	log.Printf("  Kafka Tenant Header: %s", c.Kafka.TenantHeader)
+	log.Printf("  Kafka Required Headers: %s", strings.Join(c.Kafka.RequiredHeaders, ", "))
+	log.Printf("  Kafka Session Timeout: %s", c.Kafka.SessionTimeout)
+	log.Printf("  Kafka Rebalance Timeout: %s", c.Kafka.RebalanceTimeout)
+	log.Printf("  Kafka Heartbeat Interval: %s", c.Kafka.HeartbeatInterval)
+	if c.Kafka.SeekOffset >= 0 {
+		log.Printf("  Kafka Seek: partition %d offset %d", c.Kafka.SeekPartition, c.Kafka.SeekOffset)
+	}
+	if !c.Kafka.SeekTime.IsZero() {
+		log.Printf("  Kafka Seek Time: %s", c.Kafka.SeekTime.Format(time.RFC3339))
+	}
+	log.Printf("  Kafka Workers: %d", c.Kafka.Workers)
+	log.Printf("  Kafka Max Retries: %d", c.Kafka.MaxRetries)
+	log.Printf("  Kafka Retry Backoff: %s", c.Kafka.RetryBackoff)
+	log.Printf("  Kafka Process Timeout: %s", c.Kafka.ProcessTimeout)
+	log.Printf("  Kafka DLQ Topic: %s", c.Kafka.DLQTopic)
+	if c.Kafka.PersistedTopic != "" {
+		log.Printf("  Kafka Persisted Topic: %s", c.Kafka.PersistedTopic)
+		log.Printf("  Kafka Persisted Event Required: %t", c.Kafka.PersistedEventRequired)
+	}
+	log.Printf("  Kafka Message Format: %s", c.Kafka.MessageFormat)
+	log.Printf("  Kafka Schema Registry URL: %s", sanitized.Kafka.SchemaRegistryURL)
+	log.Printf("  Kafka Unknown Topic Policy: %s", c.Kafka.UnknownTopicPolicy)
+	log.Printf("  Kafka Fetch Bytes: %d to %d", c.Kafka.MinBytes, c.Kafka.MaxBytes)
+	log.Printf("  Kafka Max Wait: %s", c.Kafka.MaxWait)
+	log.Printf("  Kafka Fetch Backoff: %s to %s", c.Kafka.FetchBackoffInitial, c.Kafka.FetchBackoffMax)
+	log.Printf("  Kafka Lag Report Interval: %s", c.Kafka.LagReportInterval)
+	log.Printf("  Kafka Stats Log Interval: %s", c.Kafka.StatsLogInterval)
+	log.Printf("  Kafka SASL Mechanism: %s", c.Kafka.SASLMechanism)
+	log.Printf("  Kafka TLS Enabled: %t", c.Kafka.TLSEnabled)
+	log.Printf("  Database Driver: %s", c.Database.Driver)
 	log.Printf("  Database Host: %s", c.Database.Host)
 	log.Printf("  Database Port: %d", c.Database.Port)
 	log.Printf("  Database Name: %s", c.Database.Name)
+	if c.Database.HasReplica() {
+		log.Printf("  Database Replica Host: %s", c.Database.ReplicaHost)
+		log.Printf("  Database Replica Port: %d", c.Database.ReplicaPortOrDefault())
+	}
+	log.Printf("  Database Table Name: %s", c.Database.TableName)
+	log.Printf("  Database Query Timeout: %s", c.Database.QueryTimeout)
+	log.Printf("  Database Read Timeout: %s", c.Database.ReadTimeout)
+	log.Printf("  Database Write Timeout: %s", c.Database.WriteTimeout)
+	log.Printf("  Database Breaker Threshold: %d", c.Database.BreakerThreshold)
+	log.Printf("  Database Breaker Cooldown: %s", c.Database.BreakerCooldown)
+	log.Printf("  Database Health Check Interval: %s", c.Database.HealthCheckInterval)
+	log.Printf("  Database Connect Retries: %d", c.Database.ConnectRetries)
+	log.Printf("  Database Connect Retry Delay: %s", c.Database.ConnectRetryDelay)
+	log.Printf("  Database Auto Migrate: %t", c.Database.AutoMigrate)
 	log.Printf("  Database SSL Mode: %s", c.Database.SSLMode)
 }
 
+// IsAvro returns true if messages are Avro encoded
+func (k KafkaConfig) IsAvro() bool {
+	return strings.EqualFold(k.MessageFormat, "avro")
+}
+
+// IsProtobuf returns true if messages are protobuf encoded
+func (k KafkaConfig) IsProtobuf() bool {
+	return strings.EqualFold(k.MessageFormat, "protobuf")
+}
+
+// IsSQLite returns true if transactions are stored in a SQLite database
+func (d DatabaseConfig) IsSQLite() bool {
+	return d.Driver == "sqlite"
+}
+
+// HasReplica returns true if queries are routed to a postgres read replica
+func (d DatabaseConfig) HasReplica() bool {
+	return d.ReplicaHost != "" && !d.IsSQLite() && !d.IsMemory()
+}
+
+// ReplicaPortOrDefault returns the port of the read replica, the primary's
+// unless set
+func (d DatabaseConfig) ReplicaPortOrDefault() int {
+	if d.ReplicaPort > 0 {
+		return d.ReplicaPort
+	}
+	return d.Port
+}
+
+// IsMemory returns true if transactions are kept in memory instead of a database
+func (d DatabaseConfig) IsMemory() bool {
+	return d.Driver == "memory"
+}
+
+// InvalidMessagePolicy returns APP_ON_INVALID_MESSAGE, defaulting to "dlq"
+// when a dead letter topic is set and to "skip" otherwise
+func (c *Config) InvalidMessagePolicy() string {
+	if c.App.OnInvalidMessage != "" {
+		return strings.ToLower(c.App.OnInvalidMessage)
+	}
+	if c.Kafka.DLQTopic != "" {
+		return "dlq"
+	}
+	return "skip"
+}
+
 // IsDevelopment returns true if running in development mode
 func (c *Config) IsDevelopment() bool {
 	return strings.ToLower(c.App.Environment) == "development"
@@ -124,6 +919,24 @@ func (c *Config) IsProduction() bool {
 	return strings.ToLower(c.App.Environment) == "production"
 }
 
+// Sanitized returns a copy of the configuration safe to expose, with the
+// database and SASL passwords and the credentials of the schema registry URL
+// redacted
+func (c *Config) Sanitized() Config {
+	sanitized := *c
+	if sanitized.Database.Password != "" {
+		sanitized.Database.Password = redactedSecret
+	}
+	if sanitized.Kafka.SASLPassword != "" {
+		sanitized.Kafka.SASLPassword = redactedSecret
+	}
+	if u, err := url.Parse(sanitized.Kafka.SchemaRegistryURL); err == nil && u.User != nil {
+		u.User = url.UserPassword(u.User.Username(), redactedSecret)
+		sanitized.Kafka.SchemaRegistryURL = u.String()
+	}
+	return sanitized
+}
+
 // GetDSN returns the database connection string
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=UTC",
@@ -131,6 +944,36 @@ func (c *Config) GetDSN() string {
 		c.Database.Name, c.Database.Port, c.Database.SSLMode)
 }
 
+// containsTrimmed reports whether slice contains item, ignoring case and
+// surrounding spaces
+func containsTrimmed(slice []string, item string) bool {
+	for _, s := range slice {
+		if strings.EqualFold(strings.TrimSpace(s), item) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCustomized reports whether values list other values than defaults, in
+// any order; no values keep the defaults
+func isCustomized(values, defaults []string) bool {
+	if len(values) == 0 {
+		return false
+	}
+	for _, value := range values {
+		if !containsTrimmed(defaults, value) {
+			return true
+		}
+	}
+	for _, value := range defaults {
+		if !containsTrimmed(values, value) {
+			return true
+		}
+	}
+	return false
+}
+
 // helper function to check if slice contains string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileEnv names the environment variable pointing at the config file
+const configFileEnv = "APP_CONFIG_FILE"
+
+// fileSectionPrefixes maps the sections of a config file to the prefix of
+// the environment variables they stand for
+var fileSectionPrefixes = map[string]string{
+	"kafka":    "KAFKA_",
+	"database": "DB_",
+	"app":      "APP_",
+}
+
+// environment returns the variables Load parses: the values of the config
+// file named by APP_CONFIG_FILE, if any, overridden by the process environment
+func environment() (map[string]string, error) {
+	vars := env.ToMap(os.Environ())
+	path := vars[configFileEnv]
+	if path == "" {
+		return vars, nil
+	}
+
+	merged, err := loadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range vars {
+		merged[key] = value
+	}
+	return merged, nil
+}
+
+// loadConfigFile reads a YAML config file into environment variables; each
+// section key is the snake case name of a variable without its prefix, so
+// brokers under kafka sets KAFKA_BROKERS, lists are joined with commas and
+// maps become comma separated key:value pairs
+func loadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var sections map[string]map[string]interface{}
+	if err := yaml.Unmarshal(data, &sections); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	vars := make(map[string]string)
+	for section, values := range sections {
+		prefix, ok := fileSectionPrefixes[section]
+		if !ok {
+			return nil, fmt.Errorf("config file %s has unknown section: %s", path, section)
+		}
+		for key, value := range values {
+			name := prefix + strings.ToUpper(key)
+			formatted, err := formatFileValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("config file %s: %s: %w", path, name, err)
+			}
+			vars[name] = formatted
+		}
+	}
+	return vars, nil
+}
+
+// formatFileValue renders a YAML value the way it would be written in the
+// corresponding environment variable
+func formatFileValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			formatted, err := formatFileScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, formatted)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(v))
+		for key, item := range v {
+			formatted, err := formatFileScalar(item)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, key+":"+formatted)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+	default:
+		return formatFileScalar(v)
+	}
+}
+
+func formatFileScalar(value interface{}) (string, error) {
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+		return "", fmt.Errorf("nested values are not supported")
+	}
+	return fmt.Sprint(value), nil
+}
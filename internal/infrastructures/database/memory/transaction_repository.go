@@ -0,0 +1,320 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
+
+	"github.com/google/uuid"
+)
+
+// transactionRepository keeps transactions in a map keyed by transaction ID,
+// for local runs and tests without a database
+type transactionRepository struct {
+	mu           sync.RWMutex
+	transactions map[string]*entities.Transaction
+	logger       logger.Logger
+}
+
+// NewTransactionRepository creates an empty in-memory transaction repository
+func NewTransactionRepository(log logger.Logger) repositories.TransactionRepository {
+	return &transactionRepository{
+		transactions: make(map[string]*entities.Transaction),
+		logger:       log,
+	}
+}
+
+// Create creates a new transaction, rejecting duplicate transaction IDs like
+// the unique index of the postgres table
+func (r *transactionRepository) Create(ctx context.Context, transaction *entities.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.insert(transaction); err != nil {
+		return fmt.Errorf("failed to create transaction: %w", err)
+	}
+
+	logger.FromContext(ctx, r.logger).Debug("Transaction inserted", "id", transaction.ID)
+	return nil
+}
+
+// SaveOffset does not keep offset, as nothing stored in memory survives the
+// restart it would be resumed from
+func (r *transactionRepository) SaveOffset(ctx context.Context, offset *entities.ProcessedOffset) error {
+	return nil
+}
+
+// WithTx runs fn with the repository itself; unlike a database transaction,
+// the changes fn made before failing are kept
+func (r *transactionRepository) WithTx(ctx context.Context, fn func(repo repositories.TransactionRepository) error) error {
+	return fn(r)
+}
+
+// Upsert creates a transaction or, when one with the same transaction ID
+// already exists, overwrites its fields
+func (r *transactionRepository) Upsert(ctx context.Context, transaction *entities.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.transactions[transaction.TransactionID]
+	if !ok {
+		if err := r.insert(transaction); err != nil {
+			return fmt.Errorf("failed to upsert transaction: %w", err)
+		}
+		logger.FromContext(ctx, r.logger).Debug("Transaction upserted", "id", transaction.ID)
+		return nil
+	}
+
+	stored := *transaction
+	stored.ID = existing.ID
+	stored.ReversedAt = existing.ReversedAt
+	stored.ReversalReason = existing.ReversalReason
+	r.transactions[transaction.TransactionID] = &stored
+
+	transaction.ID = existing.ID
+	logger.FromContext(ctx, r.logger).Debug("Transaction upserted", "id", transaction.ID)
+	return nil
+}
+
+// GetByTransactionID retrieves a transaction by transaction ID; reversed
+// transactions are only returned with repositories.IncludeReversed
+func (r *transactionRepository) GetByTransactionID(ctx context.Context, transactionID string, opts ...repositories.QueryOption) (*entities.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, ok := r.transactions[transactionID]
+	if !ok {
+		return nil, nil
+	}
+	if stored.ReversedAt != nil && !repositories.NewQueryOptions(opts...).IncludeReversed {
+		return nil, nil
+	}
+
+	transaction := *stored
+	return &transaction, nil
+}
+
+// Exists checks if a transaction exists by transaction ID
+func (r *transactionRepository) Exists(ctx context.Context, transactionID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.transactions[transactionID]
+	return ok, nil
+}
+
+// ExistsWithStatus checks if a transaction exists by transaction ID with
+// the given status
+func (r *transactionRepository) ExistsWithStatus(ctx context.Context, transactionID string, status entities.TransactionStatus) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, ok := r.transactions[transactionID]
+	return ok && stored.TransactionStatus == status, nil
+}
+
+// GetByAccountAndDateRange retrieves the transactions of an account created
+// within the given time window, oldest first
+func (r *transactionRepository) GetByAccountAndDateRange(ctx context.Context, accountID string, from, to time.Time) ([]*entities.Transaction, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid date range: from (%s) must be before to (%s)",
+			from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transactions := make([]*entities.Transaction, 0)
+	for _, stored := range r.transactions {
+		if stored.AccountID != accountID || stored.CreatedAt.Before(from) || stored.CreatedAt.After(to) {
+			continue
+		}
+		transaction := *stored
+		transactions = append(transactions, &transaction)
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].CreatedAt.Before(transactions[j].CreatedAt)
+	})
+
+	return transactions, nil
+}
+
+// GetLatestByAccount retrieves the most recently created transaction of an
+// account, the highest ID among those created at the same time like the
+// postgres repository, or nil if it has none
+func (r *transactionRepository) GetLatestByAccount(ctx context.Context, accountID string) (*entities.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var latest *entities.Transaction
+	for _, stored := range r.transactions {
+		if stored.AccountID != accountID {
+			continue
+		}
+		if latest == nil || stored.CreatedAt.After(latest.CreatedAt) ||
+			(stored.CreatedAt.Equal(latest.CreatedAt) && stored.ID > latest.ID) {
+			latest = stored
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	transaction := *latest
+	return &transaction, nil
+}
+
+// AggregateByType counts and sums the amounts of the transactions created
+// within the given time window per type and status; reversed transactions
+// are left out
+func (r *transactionRepository) AggregateByType(ctx context.Context, from, to time.Time) ([]entities.TypeAggregate, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid date range: from (%s) must be before to (%s)",
+			from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type group struct {
+		transactionType   entities.TransactionType
+		transactionStatus entities.TransactionStatus
+	}
+	totals := make(map[group]*entities.TypeAggregate)
+	for _, stored := range r.transactions {
+		if stored.ReversedAt != nil || stored.CreatedAt.Before(from) || stored.CreatedAt.After(to) {
+			continue
+		}
+		key := group{stored.TransactionType, stored.TransactionStatus}
+		aggregate, ok := totals[key]
+		if !ok {
+			aggregate = &entities.TypeAggregate{TransactionType: key.transactionType, TransactionStatus: key.transactionStatus}
+			totals[key] = aggregate
+		}
+		aggregate.Count++
+		aggregate.TotalAmount += stored.Amount
+	}
+
+	aggregates := make([]entities.TypeAggregate, 0, len(totals))
+	for _, aggregate := range totals {
+		aggregates = append(aggregates, *aggregate)
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		if aggregates[i].TransactionType != aggregates[j].TransactionType {
+			return aggregates[i].TransactionType < aggregates[j].TransactionType
+		}
+		return aggregates[i].TransactionStatus < aggregates[j].TransactionStatus
+	})
+
+	return aggregates, nil
+}
+
+// MarkReversed marks a transaction as reversed with reason, keeping it stored
+func (r *transactionRepository) MarkReversed(ctx context.Context, transactionID string, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.transactions[transactionID]
+	if !ok || stored.ReversedAt != nil {
+		return fmt.Errorf("transaction %s not found or already reversed", transactionID)
+	}
+
+	now := time.Now().UTC()
+	stored.ReversedAt = &now
+	stored.ReversalReason = &reason
+	stored.UpdatedAt = now
+
+	logger.FromContext(ctx, r.logger).Info("Transaction reversed", "transactionID", transactionID, "reason", reason)
+	return nil
+}
+
+// UpdateStatus moves a stored transaction to status with its resulting
+// balance, unless its stored status may not transition to status
+func (r *transactionRepository) UpdateStatus(ctx context.Context, transactionID string, status entities.TransactionStatus, balanceAfter float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.transactions[transactionID]
+	if !ok {
+		return fmt.Errorf("failed to update transaction %s: %w", transactionID, repositories.ErrTransactionNotFound)
+	}
+	if !stored.TransactionStatus.CanTransitionTo(status) {
+		return fmt.Errorf("failed to update transaction %s to %s: %w", transactionID, status, repositories.ErrOutOfOrderUpdate)
+	}
+
+	stored.TransactionStatus = status
+	stored.BalanceAfter = balanceAfter
+	stored.UpdatedAt = time.Now().UTC()
+
+	logger.FromContext(ctx, r.logger).Debug("Transaction status updated", "transactionID", transactionID, "status", status)
+	return nil
+}
+
+// ExportAll writes the transactions matching opts to w as newline-delimited
+// JSON, oldest first and the lowest ID first among those created at the same
+// time like the postgres repository; the lock is only held for the snapshot
+func (r *transactionRepository) ExportAll(ctx context.Context, w io.Writer, opts ...repositories.QueryOption) error {
+	options := repositories.NewQueryOptions(opts...)
+
+	r.mu.RLock()
+	transactions := make([]entities.Transaction, 0, len(r.transactions))
+	for _, stored := range r.transactions {
+		if stored.ReversedAt != nil && !options.IncludeReversed ||
+			!options.CreatedFrom.IsZero() && stored.CreatedAt.Before(options.CreatedFrom) ||
+			!options.CreatedTo.IsZero() && stored.CreatedAt.After(options.CreatedTo) {
+			continue
+		}
+		transactions = append(transactions, *stored)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(transactions, func(i, j int) bool {
+		if !transactions[i].CreatedAt.Equal(transactions[j].CreatedAt) {
+			return transactions[i].CreatedAt.Before(transactions[j].CreatedAt)
+		}
+		return transactions[i].ID < transactions[j].ID
+	})
+
+	encoder := json.NewEncoder(w)
+	for i := range transactions {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("failed to export transactions: %w", err)
+		}
+		if err := encoder.Encode(&transactions[i]); err != nil {
+			return fmt.Errorf("failed to export transaction %s: %w", transactions[i].TransactionID, err)
+		}
+	}
+	return nil
+}
+
+// insert stores a copy of transaction under a new ID, filling in the
+// defaults the postgres table would; callers must hold mu
+func (r *transactionRepository) insert(transaction *entities.Transaction) error {
+	if _, ok := r.transactions[transaction.TransactionID]; ok {
+		return repositories.ErrDuplicateTransaction
+	}
+
+	now := time.Now().UTC()
+	stored := *transaction
+	stored.ID = uuid.NewString()
+	if stored.Currency == "" {
+		stored.Currency = "IDR"
+	}
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = now
+	}
+	if stored.UpdatedAt.IsZero() {
+		stored.UpdatedAt = now
+	}
+	r.transactions[transaction.TransactionID] = &stored
+
+	transaction.ID = stored.ID
+	return nil
+}
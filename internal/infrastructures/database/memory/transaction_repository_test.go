@@ -0,0 +1,326 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
+)
+
+// Mock logger for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, args ...interface{}) {}
+func (m *mockLogger) Info(msg string, args ...interface{})  {}
+func (m *mockLogger) Warn(msg string, args ...interface{})  {}
+func (m *mockLogger) Error(msg string, args ...interface{}) {}
+func (m *mockLogger) Fatal(msg string, args ...interface{}) {}
+
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
+func newTestTransaction(transactionID string) *entities.Transaction {
+	return &entities.Transaction{
+		UserID:            1,
+		AccountID:         "account-1",
+		TransactionID:     transactionID,
+		TransactionType:   entities.TransactionTypePayment,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100,
+		BalanceBefore:     1000,
+		BalanceAfter:      1000,
+		Currency:          "IDR",
+	}
+}
+
+func TestTransactionRepository_Create_Success(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	transaction := newTestTransaction("TXN-1")
+
+	if err := repo.Create(context.Background(), transaction); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if transaction.ID == "" {
+		t.Error("Create should assign an ID")
+	}
+
+	stored, err := repo.GetByTransactionID(context.Background(), "TXN-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stored == nil || stored.ID != transaction.ID || stored.Amount != 100 {
+		t.Errorf("Unexpected stored transaction: %+v", stored)
+	}
+	if stored.CreatedAt.IsZero() {
+		t.Error("Create should default CreatedAt")
+	}
+}
+
+func TestTransactionRepository_Create_Duplicate(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+
+	if err := repo.Create(context.Background(), newTestTransaction("TXN-1")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err := repo.Create(context.Background(), newTestTransaction("TXN-1"))
+	if !errors.Is(err, repositories.ErrDuplicateTransaction) {
+		t.Errorf("Expected ErrDuplicateTransaction, got %v", err)
+	}
+}
+
+func TestTransactionRepository_Exists(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	_ = repo.Create(context.Background(), newTestTransaction("TXN-1"))
+
+	exists, err := repo.Exists(context.Background(), "TXN-1")
+	if err != nil || !exists {
+		t.Errorf("Exists(TXN-1) = %t, %v; expected true", exists, err)
+	}
+
+	exists, err = repo.Exists(context.Background(), "TXN-2")
+	if err != nil || exists {
+		t.Errorf("Exists(TXN-2) = %t, %v; expected false", exists, err)
+	}
+}
+
+func TestTransactionRepository_ExistsWithStatus(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	_ = repo.Create(context.Background(), newTestTransaction("TXN-1"))
+
+	if exists, _ := repo.ExistsWithStatus(context.Background(), "TXN-1", entities.TransactionStatusPending); !exists {
+		t.Error("ExistsWithStatus(PENDING) should be true for a pending transaction")
+	}
+	if exists, _ := repo.ExistsWithStatus(context.Background(), "TXN-1", entities.TransactionStatusSuccess); exists {
+		t.Error("ExistsWithStatus(SUCCESS) should be false for a pending transaction")
+	}
+}
+
+func TestTransactionRepository_GetByTransactionID_NotFound(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+
+	transaction, err := repo.GetByTransactionID(context.Background(), "TXN-1")
+	if err != nil || transaction != nil {
+		t.Errorf("Expected nil transaction and error, got %+v, %v", transaction, err)
+	}
+}
+
+func TestTransactionRepository_GetByTransactionID_ReturnsCopy(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	_ = repo.Create(context.Background(), newTestTransaction("TXN-1"))
+
+	first, _ := repo.GetByTransactionID(context.Background(), "TXN-1")
+	first.Amount = 999
+
+	second, _ := repo.GetByTransactionID(context.Background(), "TXN-1")
+	if second.Amount != 100 {
+		t.Errorf("Stored transaction was modified through a returned copy: amount %v", second.Amount)
+	}
+}
+
+func TestTransactionRepository_GetByTransactionID_IncludeReversed(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	_ = repo.Create(context.Background(), newTestTransaction("TXN-1"))
+
+	if err := repo.MarkReversed(context.Background(), "TXN-1", "chargeback"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if transaction, _ := repo.GetByTransactionID(context.Background(), "TXN-1"); transaction != nil {
+		t.Error("Reversed transactions should be hidden by default")
+	}
+	transaction, _ := repo.GetByTransactionID(context.Background(), "TXN-1", repositories.IncludeReversed())
+	if transaction == nil || transaction.ReversalReason == nil || *transaction.ReversalReason != "chargeback" {
+		t.Errorf("Expected reversed transaction, got %+v", transaction)
+	}
+
+	if err := repo.MarkReversed(context.Background(), "TXN-1", "chargeback"); err == nil {
+		t.Error("MarkReversed should fail for an already reversed transaction")
+	}
+}
+
+func TestTransactionRepository_Upsert_UpdatesExisting(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	original := newTestTransaction("TXN-1")
+	_ = repo.Create(context.Background(), original)
+
+	replay := newTestTransaction("TXN-1")
+	replay.Amount = 250
+	if err := repo.Upsert(context.Background(), replay); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stored, _ := repo.GetByTransactionID(context.Background(), "TXN-1")
+	if stored.ID != original.ID || stored.Amount != 250 {
+		t.Errorf("Expected upsert to keep ID %s and update amount, got %+v", original.ID, stored)
+	}
+}
+
+func TestTransactionRepository_UpdateStatus(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	_ = repo.Create(context.Background(), newTestTransaction("TXN-1"))
+
+	if err := repo.UpdateStatus(context.Background(), "TXN-1", entities.TransactionStatusSuccess, 900); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stored, _ := repo.GetByTransactionID(context.Background(), "TXN-1")
+	if stored.TransactionStatus != entities.TransactionStatusSuccess || stored.BalanceAfter != 900 {
+		t.Errorf("Unexpected transaction after update: %+v", stored)
+	}
+
+	err := repo.UpdateStatus(context.Background(), "TXN-1", entities.TransactionStatusPending, 1000)
+	if !errors.Is(err, repositories.ErrOutOfOrderUpdate) {
+		t.Errorf("Expected ErrOutOfOrderUpdate, got %v", err)
+	}
+
+	err = repo.UpdateStatus(context.Background(), "TXN-2", entities.TransactionStatusSuccess, 900)
+	if !errors.Is(err, repositories.ErrTransactionNotFound) {
+		t.Errorf("Expected ErrTransactionNotFound, got %v", err)
+	}
+}
+
+func TestTransactionRepository_GetByAccountAndDateRange(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"TXN-3", "TXN-1", "TXN-2"} {
+		transaction := newTestTransaction(id)
+		transaction.CreatedAt = base.Add(time.Duration(3-i) * time.Hour)
+		_ = repo.Create(context.Background(), transaction)
+	}
+	other := newTestTransaction("TXN-4")
+	other.AccountID = "account-2"
+	other.CreatedAt = base.Add(time.Hour)
+	_ = repo.Create(context.Background(), other)
+
+	transactions, err := repo.GetByAccountAndDateRange(context.Background(), "account-1", base, base.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(transactions) != 2 || transactions[0].TransactionID != "TXN-2" || transactions[1].TransactionID != "TXN-1" {
+		t.Errorf("Expected TXN-2 and TXN-1 oldest first, got %+v", transactions)
+	}
+
+	if _, err := repo.GetByAccountAndDateRange(context.Background(), "account-1", base, base); err == nil {
+		t.Error("Expected an error for an empty date range")
+	}
+}
+
+func TestTransactionRepository_GetLatestByAccount(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"TXN-1", "TXN-3", "TXN-2"} {
+		transaction := newTestTransaction(id)
+		transaction.CreatedAt = base.Add(time.Duration([]int{1, 3, 2}[i]) * time.Hour)
+		_ = repo.Create(context.Background(), transaction)
+	}
+	other := newTestTransaction("TXN-4")
+	other.AccountID = "account-2"
+	other.CreatedAt = base.Add(4 * time.Hour)
+	_ = repo.Create(context.Background(), other)
+
+	latest, err := repo.GetLatestByAccount(context.Background(), "account-1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if latest == nil || latest.TransactionID != "TXN-3" {
+		t.Errorf("Expected TXN-3, got %+v", latest)
+	}
+
+	if latest, err := repo.GetLatestByAccount(context.Background(), "account-3"); err != nil || latest != nil {
+		t.Errorf("Expected nil transaction and error, got %+v, %v", latest, err)
+	}
+}
+
+func TestTransactionRepository_GetLatestByAccount_TieBreaksByID(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var highest *entities.Transaction
+	for _, id := range []string{"TXN-1", "TXN-2", "TXN-3"} {
+		transaction := newTestTransaction(id)
+		transaction.CreatedAt = createdAt
+		_ = repo.Create(context.Background(), transaction)
+		if highest == nil || transaction.ID > highest.ID {
+			highest = transaction
+		}
+	}
+
+	latest, _ := repo.GetLatestByAccount(context.Background(), "account-1")
+	if latest == nil || latest.ID != highest.ID {
+		t.Errorf("Expected %s with the highest ID, got %+v", highest.TransactionID, latest)
+	}
+}
+
+func TestTransactionRepository_AggregateByType(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, amount := range []float64{100, 50, 25} {
+		transaction := newTestTransaction("PAY-" + string(rune('A'+i)))
+		transaction.Amount = amount
+		transaction.CreatedAt = base.Add(time.Hour)
+		_ = repo.Create(context.Background(), transaction)
+	}
+	topUp := newTestTransaction("TOP-A")
+	topUp.TransactionType = entities.TransactionTypeTopup
+	topUp.CreatedAt = base.Add(time.Hour)
+	_ = repo.Create(context.Background(), topUp)
+	_ = repo.MarkReversed(context.Background(), "PAY-C", "chargeback")
+
+	aggregates, err := repo.AggregateByType(context.Background(), base, base.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []entities.TypeAggregate{
+		{TransactionType: entities.TransactionTypePayment, TransactionStatus: entities.TransactionStatusPending, Count: 2, TotalAmount: 150},
+		{TransactionType: entities.TransactionTypeTopup, TransactionStatus: entities.TransactionStatusPending, Count: 1, TotalAmount: 100},
+	}
+	if len(aggregates) != len(expected) {
+		t.Fatalf("Expected %d aggregates, got %+v", len(expected), aggregates)
+	}
+	for i := range expected {
+		if aggregates[i] != expected[i] {
+			t.Errorf("Aggregate %d = %+v, expected %+v", i, aggregates[i], expected[i])
+		}
+	}
+}
+
+func TestTransactionRepository_ExportAll(t *testing.T) {
+	repo := NewTransactionRepository(&mockLogger{})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for id, hours := range map[string]int{"PAY-B": 0, "PAY-A": 1, "PAY-C": 2, "PAY-D": 2} {
+		transaction := newTestTransaction(id)
+		transaction.CreatedAt = base.Add(time.Duration(hours) * time.Hour)
+		_ = repo.Create(context.Background(), transaction)
+	}
+	_ = repo.MarkReversed(context.Background(), "PAY-D", "chargeback")
+
+	var out bytes.Buffer
+	err := repo.ExportAll(context.Background(), &out, repositories.CreatedBetween(base.Add(time.Hour), time.Time{}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var exported []string
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var transaction entities.Transaction
+		if err := decoder.Decode(&transaction); err != nil {
+			t.Fatalf("Expected newline-delimited JSON, got: %v", err)
+		}
+		exported = append(exported, transaction.TransactionID)
+	}
+	if len(exported) != 2 || exported[0] != "PAY-A" || exported[1] != "PAY-C" {
+		t.Errorf("Expected PAY-A and PAY-C oldest first without the reversed PAY-D, got %v", exported)
+	}
+}
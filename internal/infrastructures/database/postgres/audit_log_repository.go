@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
+)
+
+// AuditLogModel represents an append-only audit record
+type AuditLogModel struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement"`
+	TransactionID string    `gorm:"not null;index;type:varchar(50)"`
+	UserID        int64     `gorm:"not null"`
+	Amount        float64   `gorm:"not null;type:decimal(15,2)"`
+	ProcessedAt   time.Time `gorm:"not null;index"`
+}
+
+// TableName returns the table name
+func (AuditLogModel) TableName() string {
+	return "audit_log"
+}
+
+// auditLogRepository implements the repositories interface
+type auditLogRepository struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewAuditLogRepository creates an audit sink writing to the audit_log table
+func NewAuditLogRepository(db *gorm.DB, log logger.Logger) repositories.AuditSink {
+	return &auditLogRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+// Emit appends event to the audit log
+func (r *auditLogRepository) Emit(ctx context.Context, event *entities.AuditEvent) error {
+	model := &AuditLogModel{
+		TransactionID: event.TransactionID,
+		UserID:        event.UserID,
+		Amount:        event.Amount,
+		ProcessedAt:   event.ProcessedAt,
+	}
+
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	event.ID = model.ID
+	return nil
+}
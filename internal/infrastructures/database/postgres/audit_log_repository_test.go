@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAuditLogRepository_Emit_Success(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewAuditLogRepository(db, &mockLogger{})
+
+	event := &entities.AuditEvent{
+		TransactionID: "trans-123",
+		UserID:        123,
+		Amount:        100.50,
+		ProcessedAt:   time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_log" ("transaction_id","user_id","amount","processed_at") VALUES ($1,$2,$3,$4) RETURNING "id"`)).
+		WithArgs("trans-123", int64(123), 100.50, event.ProcessedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	if err := repo.Emit(context.Background(), event); err != nil {
+		t.Errorf("Emit should not return error, got: %v", err)
+	}
+	if event.ID != 7 {
+		t.Errorf("Event ID should be set to generated ID, got: %d", event.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestAuditLogRepository_Emit_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewAuditLogRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "audit_log"`)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	if err := repo.Emit(context.Background(), &entities.AuditEvent{TransactionID: "trans-123"}); err == nil {
+		t.Error("Emit should return error when database operation fails")
+	}
+}
@@ -1,19 +1,80 @@
 package postgres
 
 import (
+	"context"
 	"fmt"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+	"math/rand/v2"
 	"time"
 	"transaction-consumer/internal/infrastructures/config"
 )
 
-// NewConnection creates a new database connection
-func NewConnection(cfg config.DatabaseConfig, appConfig config.AppConfig) (*gorm.DB, error) {
-	// Use the config's DSN method
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=UTC",
-		cfg.Host, cfg.User, cfg.Password, cfg.Name, cfg.Port, cfg.SSLMode)
+// maxConnectRetryDelay caps the wait between connection attempts
+const maxConnectRetryDelay = 30 * time.Second
+
+// NewConnection creates a new database connection; with the sqlite driver
+// cfg.Name is the database file, or ":memory:". A failing connection is
+// retried cfg.ConnectRetries times with jittered exponential backoff, e.g.
+// while the database container is still starting, until ctx is done
+func NewConnection(ctx context.Context, cfg config.DatabaseConfig, appConfig config.AppConfig) (*gorm.DB, error) {
+	return connectWithRetry(ctx, cfg.ConnectRetries, cfg.ConnectRetryDelay, func() (*gorm.DB, error) {
+		return open(cfg, appConfig)
+	})
+}
+
+// connectWithRetry calls connect until it succeeds, retries are exhausted
+// or ctx is done
+func connectWithRetry(ctx context.Context, retries int, delay time.Duration, connect func() (*gorm.DB, error)) (*gorm.DB, error) {
+	for attempt := 0; ; attempt++ {
+		db, err := connect()
+		if err == nil {
+			return db, nil
+		}
+		if attempt >= retries {
+			if retries > 0 {
+				return nil, fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return nil, err
+		}
+
+		timer := time.NewTimer(connectRetryDelay(delay, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("gave up connecting to database: %w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// connectRetryDelay returns the wait before retry attempt+1: delay doubled
+// per attempt, capped at maxConnectRetryDelay and jittered to between half
+// and all of it so replicas starting together do not retry in lockstep
+func connectRetryDelay(delay time.Duration, attempt int) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+	backoff := delay
+	for i := 0; i < attempt && backoff < maxConnectRetryDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxConnectRetryDelay)
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// open opens and pings a database connection once
+func open(cfg config.DatabaseConfig, appConfig config.AppConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	if cfg.IsSQLite() {
+		dialector = sqlite.Open(cfg.Name)
+	} else {
+		dialector = postgres.Open(fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=UTC",
+			cfg.Host, cfg.User, cfg.Password, cfg.Name, cfg.Port, cfg.SSLMode))
+	}
 
 	// Configure GORM logger level based on app environment and log level
 	var gormLogLevel logger.LogLevel
@@ -30,13 +91,20 @@ func NewConnection(cfg config.DatabaseConfig, appConfig config.AppConfig) (*gorm
 		gormLogLevel = logger.Error // Production: only errors
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: logger.Default.LogMode(gormLogLevel),
+		// SQLite reports unique violations only as text, so let GORM map
+		// them to gorm.ErrDuplicatedKey
+		TranslateError: cfg.IsSQLite(),
 		NowFunc: func() time.Time {
 			return time.Now().UTC()
 		},
 	})
 	if err != nil {
+		// gorm.Open pings the opened pool and returns it even when that fails
+		if db != nil {
+			_ = CloseConnection(db)
+		}
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
@@ -48,16 +116,44 @@ func NewConnection(cfg config.DatabaseConfig, appConfig config.AppConfig) (*gorm
 
 	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.IsSQLite() {
+		// SQLite allows a single writer, and every connection to ":memory:"
+		// opens a database of its own that is gone once it is closed
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+	}
 	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	// Test connection
 	if err := sqlDB.Ping(); err != nil {
+		_ = sqlDB.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
+	if cfg.HasReplica() {
+		replica := postgres.Open(fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=UTC",
+			cfg.ReplicaHost, cfg.User, cfg.Password, cfg.Name, cfg.ReplicaPortOrDefault(), cfg.SSLMode))
+		if err := useReplica(db, replica, cfg); err != nil {
+			_ = sqlDB.Close()
+			return nil, fmt.Errorf("failed to connect to read replica: %w", err)
+		}
+	}
+
 	return db, nil
 }
 
+// useReplica routes the queries of db to replica, keeping writes, everything
+// inside a transaction and queries with the dbresolver.Write clause on the
+// primary; the replica pool is sized like the primary's
+func useReplica(db *gorm.DB, replica gorm.Dialector, cfg config.DatabaseConfig) error {
+	return db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{replica},
+	}).
+		SetMaxIdleConns(cfg.MaxIdleConns).
+		SetMaxOpenConns(cfg.MaxOpenConns).
+		SetConnMaxLifetime(cfg.ConnMaxLifetime))
+}
+
 // CloseConnection closes the database connection
 func CloseConnection(db *gorm.DB) error {
 	sqlDB, err := db.DB()
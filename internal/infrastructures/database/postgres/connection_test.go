@@ -0,0 +1,229 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/internal/infrastructures/config"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestNewConnection_SQLiteRoundTrip(t *testing.T) {
+	cfg := config.DatabaseConfig{
+		Driver:      "sqlite",
+		Name:        ":memory:",
+		AutoMigrate: true,
+	}
+
+	db, err := NewConnection(context.Background(), cfg, config.AppConfig{})
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	defer func() {
+		_ = CloseConnection(db)
+	}()
+
+	if err := AutoMigrate(db, cfg); err != nil {
+		t.Fatalf("Failed to migrate SQLite database: %v", err)
+	}
+	// Migrating again must leave the existing table in place
+	if err := AutoMigrate(db, cfg); err != nil {
+		t.Fatalf("Failed to migrate SQLite database twice: %v", err)
+	}
+
+	repo := NewTransactionRepository(db, &mockLogger{})
+	method := entities.PaymentMethod("GOPAY")
+	metadata := `{"channel":"app"}`
+	transaction := &entities.Transaction{
+		UserID:                   1,
+		AccountID:                "account-1",
+		TransactionID:            "TXN-1",
+		TransactionType:          entities.TransactionTypePayment,
+		TransactionStatus:        entities.TransactionStatusPending,
+		Amount:                   100.5,
+		BalanceBefore:            1000,
+		BalanceAfter:             1000,
+		Currency:                 "IDR",
+		PaymentMethod:            &method,
+		Metadata:                 &metadata,
+		IsAccessibleFromExternal: true,
+		TenantID:                 "tenant-a",
+	}
+
+	ctx := context.Background()
+	if err := repo.Create(ctx, transaction); err != nil {
+		t.Fatalf("Failed to create transaction: %v", err)
+	}
+	if transaction.ID == "" {
+		t.Error("Create should assign the generated ID")
+	}
+
+	stored, err := repo.GetByTransactionID(ctx, "TXN-1")
+	if err != nil {
+		t.Fatalf("Failed to get transaction: %v", err)
+	}
+	if stored == nil {
+		t.Fatal("Expected the created transaction to be found")
+	}
+	if stored.ID != transaction.ID || stored.Amount != 100.5 || *stored.PaymentMethod != method || *stored.Metadata != metadata || stored.TenantID != "tenant-a" {
+		t.Errorf("Unexpected stored transaction: %+v", stored)
+	}
+
+	if err := repo.UpdateStatus(ctx, "TXN-1", entities.TransactionStatusSuccess, 899.5); err != nil {
+		t.Fatalf("Failed to update transaction status: %v", err)
+	}
+
+	duplicate := *transaction
+	duplicate.ID = ""
+	if err := repo.Create(ctx, &duplicate); !errors.Is(err, repositories.ErrDuplicateTransaction) {
+		t.Errorf("Expected ErrDuplicateTransaction, got %v", err)
+	}
+
+	invalid := *transaction
+	invalid.ID = ""
+	invalid.TransactionID = "TXN-2"
+	invalid.TransactionType = "UNKNOWN"
+	if err := repo.Create(ctx, &invalid); err == nil {
+		t.Error("Expected the CHECK constraint to reject an unknown transaction type")
+	}
+}
+
+func TestConnectWithRetry_SucceedsAfterFailures(t *testing.T) {
+	expected := &gorm.DB{}
+	attempts := 0
+	db, err := connectWithRetry(context.Background(), 5, time.Millisecond, func() (*gorm.DB, error) {
+		attempts++
+		if attempts <= 3 {
+			return nil, errors.New("failed to ping database: connection refused")
+		}
+		return expected, nil
+	})
+
+	if err != nil {
+		t.Fatalf("connectWithRetry should not return error, got: %v", err)
+	}
+	if db != expected {
+		t.Error("connectWithRetry should return the connection of the successful attempt")
+	}
+	if attempts != 4 {
+		t.Errorf("Expected 4 attempts, got %d", attempts)
+	}
+}
+
+func TestConnectWithRetry_RetriesExhausted(t *testing.T) {
+	pingErr := errors.New("failed to ping database: connection refused")
+	attempts := 0
+	_, err := connectWithRetry(context.Background(), 2, time.Millisecond, func() (*gorm.DB, error) {
+		attempts++
+		return nil, pingErr
+	})
+
+	if !errors.Is(err, pingErr) {
+		t.Errorf("Expected the last connection error, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestConnectWithRetry_StopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	_, err := connectWithRetry(ctx, 10, time.Hour, func() (*gorm.DB, error) {
+		attempts++
+		cancel()
+		return nil, errors.New("failed to ping database: connection refused")
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected no attempt after cancellation, got %d", attempts)
+	}
+}
+
+func TestConnectRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{0, 500 * time.Millisecond, time.Second},
+		{1, time.Second, 2 * time.Second},
+		{3, 4 * time.Second, 8 * time.Second},
+		{10, maxConnectRetryDelay / 2, maxConnectRetryDelay},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := connectRetryDelay(time.Second, tt.attempt); got < tt.min || got > tt.max {
+				t.Errorf("connectRetryDelay(1s, %d) = %s, expected between %s and %s", tt.attempt, got, tt.min, tt.max)
+			}
+		}
+	}
+
+	if got := connectRetryDelay(0, 3); got != 0 {
+		t.Errorf("connectRetryDelay(0, 3) = %s, expected 0", got)
+	}
+}
+
+func TestUseReplica_RoutesReportingReadsToReplica(t *testing.T) {
+	db, primary := setupTestDB(t)
+
+	replicaDB, replica, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create replica mock DB: %v", err)
+	}
+	if err := useReplica(db, postgres.New(postgres.Config{Conn: replicaDB}), config.DatabaseConfig{MaxIdleConns: 2}); err != nil {
+		t.Fatalf("useReplica should not return error, got: %v", err)
+	}
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+	replica.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE account_id = $1 AND created_at BETWEEN $2 AND $3 ORDER BY created_at ASC`)).
+		WithArgs("account-456", from, to).
+		WillReturnRows(sqlmock.NewRows(transactionColumns))
+	// The lookups processing decides on must not see a lagging replica
+	primary.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-123").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	primary.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1 AND transaction_status = $2`)).
+		WithArgs("trans-123", "SUCCESS").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	primary.ExpectBegin()
+	primary.ExpectExec(regexp.QuoteMeta(`UPDATE "historical_transactions" SET "reversal_reason"=$1,"reversed_at"=$2,"updated_at"=$3 WHERE transaction_id = $4 AND reversed_at IS NULL`)).
+		WithArgs("customer refund", sqlmock.AnyArg(), sqlmock.AnyArg(), "trans-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	primary.ExpectCommit()
+
+	if _, err := repo.GetByAccountAndDateRange(context.Background(), "account-456", from, to); err != nil {
+		t.Errorf("GetByAccountAndDateRange should not return error, got: %v", err)
+	}
+	exists, err := repo.Exists(context.Background(), "trans-123")
+	if err != nil || !exists {
+		t.Errorf("Exists = %v, %v, want true from the primary", exists, err)
+	}
+	exists, err = repo.ExistsWithStatus(context.Background(), "trans-123", entities.TransactionStatusSuccess)
+	if err != nil || !exists {
+		t.Errorf("ExistsWithStatus = %v, %v, want true from the primary", exists, err)
+	}
+	if err := repo.MarkReversed(context.Background(), "trans-123", "customer refund"); err != nil {
+		t.Errorf("MarkReversed should not return error, got: %v", err)
+	}
+
+	if err := replica.ExpectationsWereMet(); err != nil {
+		t.Errorf("Replica expectations were not met: %v", err)
+	}
+	if err := primary.ExpectationsWereMet(); err != nil {
+		t.Errorf("Primary expectations were not met: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"transaction-consumer/internal/infrastructures/config"
+)
+
+// enumType is a Postgres enum type the transaction table depends on
+type enumType struct {
+	name   string
+	values []string
+}
+
+var (
+	transactionTypeEnum   = enumType{name: "transaction_type_enum", values: []string{"TOPUP", "PAYMENT", "REFUND", "TRANSFER"}}
+	transactionStatusEnum = enumType{name: "transaction_status_enum", values: []string{"PENDING", "SUCCESS", "FAILED", "CANCELLED"}}
+	paymentMethodEnum     = enumType{name: "payment_method_enum", values: []string{"GOPAY", "SHOPEE_PAY", "BANK_TRANSFER"}}
+)
+
+// enumTypes are created before the transaction table, since GORM cannot
+// create Postgres enum types itself
+var enumTypes = []enumType{transactionTypeEnum, transactionStatusEnum, paymentMethodEnum}
+
+// featureModels are the tables written by optional features, whose names
+// are fixed by their TableName methods
+var featureModels = []any{&ProcessedOffsetModel{}, &ProcessingLogModel{}, &AuditLogModel{}}
+
+// AutoMigrate creates the enum types, the transaction table and the feature
+// tables when cfg.AutoMigrate is set, leaving existing ones in place
+func AutoMigrate(db *gorm.DB, cfg config.DatabaseConfig) error {
+	if !cfg.AutoMigrate {
+		return nil
+	}
+
+	tableName := cfg.TableName
+	if tableName == "" {
+		tableName = DefaultTransactionTable
+	}
+	if cfg.IsSQLite() {
+		if err := migrateSQLite(db, tableName); err != nil {
+			return err
+		}
+		return migrateFeatureTables(db)
+	}
+
+	for _, enum := range enumTypes {
+		if err := db.Exec(createEnumStatement(enum)).Error; err != nil {
+			return fmt.Errorf("failed to create enum type %s: %w", enum.name, err)
+		}
+	}
+
+	if err := db.Table(tableName).AutoMigrate(&TransactionModel{}); err != nil {
+		return fmt.Errorf("failed to migrate table %s: %w", tableName, err)
+	}
+
+	return migrateFeatureTables(db)
+}
+
+// migrateFeatureTables creates the feature tables, which use only portable
+// column types and so migrate the same way on Postgres and SQLite
+func migrateFeatureTables(db *gorm.DB) error {
+	for _, model := range featureModels {
+		if err := db.AutoMigrate(model); err != nil {
+			return fmt.Errorf("failed to migrate feature table: %w", err)
+		}
+	}
+	return nil
+}
+
+// createEnumStatement returns a DO block creating enum unless it exists,
+// as Postgres has no CREATE TYPE IF NOT EXISTS
+func createEnumStatement(enum enumType) string {
+	return fmt.Sprintf(
+		"DO $$ BEGIN CREATE TYPE %s AS ENUM (%s); EXCEPTION WHEN duplicate_object THEN NULL; END $$;",
+		enum.name, enum.quotedValues())
+}
+
+// quotedValues returns the values of enum as a list of SQL string literals
+func (e enumType) quotedValues() string {
+	quoted := make([]string, len(e.values))
+	for i, value := range e.values {
+		quoted[i] = "'" + value + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// migrateSQLite creates the transaction table in SQLite, which has neither
+// enum types nor the Postgres functions used as column defaults, so enums
+// become TEXT columns with CHECK constraints
+func migrateSQLite(db *gorm.DB, tableName string) error {
+	statements := []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+		user_id INTEGER NOT NULL,
+		account_id TEXT NOT NULL,
+		transaction_id TEXT NOT NULL UNIQUE,
+		transaction_type TEXT NOT NULL CHECK (%s),
+		transaction_status TEXT NOT NULL CHECK (%s),
+		amount NUMERIC NOT NULL,
+		balance_before NUMERIC NOT NULL,
+		balance_after NUMERIC NOT NULL,
+		currency TEXT NOT NULL DEFAULT 'IDR',
+		description TEXT,
+		external_reference TEXT,
+		payment_method TEXT CHECK (%s),
+		metadata TEXT CHECK (metadata IS NULL OR json_valid(metadata)),
+		is_accessible_external BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		tenant_id TEXT,
+		reversed_at DATETIME,
+		reversal_reason TEXT,
+		raw_payload TEXT CHECK (raw_payload IS NULL OR json_valid(raw_payload))
+	)`, tableName,
+		checkEnum("transaction_type", transactionTypeEnum),
+		checkEnum("transaction_status", transactionStatusEnum),
+		checkEnum("payment_method", paymentMethodEnum),
+	)}
+
+	// Tables created before multi-tenancy or raw payloads lack those columns,
+	// which CREATE TABLE IF NOT EXISTS does not add
+	if db.Migrator().HasTable(tableName) {
+		if !db.Migrator().HasColumn(tableName, "tenant_id") {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN tenant_id TEXT", tableName))
+		}
+		if !db.Migrator().HasColumn(tableName, "raw_payload") {
+			statements = append(statements, fmt.Sprintf(
+				"ALTER TABLE %s ADD COLUMN raw_payload TEXT CHECK (raw_payload IS NULL OR json_valid(raw_payload))", tableName))
+		}
+	}
+
+	indexPrefix := "idx_" + strings.ReplaceAll(tableName, ".", "_")
+	for _, column := range []string{"user_id", "account_id", "transaction_status", "reversed_at", "tenant_id"} {
+		statements = append(statements, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_%s ON %s (%s)",
+			indexPrefix, column, tableName, column))
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to migrate table %s: %w", tableName, err)
+		}
+	}
+	return nil
+}
+
+// checkEnum returns a CHECK expression limiting column to the values of enum
+func checkEnum(column string, enum enumType) string {
+	return fmt.Sprintf("%s IN (%s)", column, enum.quotedValues())
+}
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"transaction-consumer/internal/infrastructures/config"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAutoMigrate_Disabled(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	if err := AutoMigrate(db, config.DatabaseConfig{AutoMigrate: false}); err != nil {
+		t.Errorf("AutoMigrate should not return error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected no statements, got: %v", err)
+	}
+}
+
+func TestAutoMigrate_Enabled(t *testing.T) {
+	db, mock := setupTestDB(t)
+	mock.MatchExpectationsInOrder(true)
+
+	mock.ExpectExec(regexp.QuoteMeta("DO $$ BEGIN CREATE TYPE transaction_type_enum AS ENUM ('TOPUP', 'PAYMENT', 'REFUND', 'TRANSFER'); EXCEPTION WHEN duplicate_object THEN NULL; END $$;")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TYPE transaction_status_enum")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TYPE payment_method_enum")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1")).
+		WithArgs("historical_transactions", "BASE TABLE").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "historical_transactions"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE (UNIQUE )?INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE (UNIQUE )?INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE (UNIQUE )?INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE (UNIQUE )?INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE (UNIQUE )?INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE (UNIQUE )?INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1")).
+		WithArgs("processed_offsets", "BASE TABLE").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "processed_offsets"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1")).
+		WithArgs("processing_log", "BASE TABLE").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "processing_log"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = $1")).
+		WithArgs("audit_log", "BASE TABLE").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE "audit_log"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := AutoMigrate(db, config.DatabaseConfig{AutoMigrate: true}); err != nil {
+		t.Errorf("AutoMigrate should not return error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestAutoMigrate_EnumError(t *testing.T) {
+	db, mock := setupTestDB(t)
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TYPE transaction_type_enum")).
+		WillReturnError(errors.New("permission denied"))
+
+	err := AutoMigrate(db, config.DatabaseConfig{AutoMigrate: true})
+
+	if err == nil {
+		t.Fatal("AutoMigrate should return error when creating an enum type fails")
+	}
+	if !strings.Contains(err.Error(), "transaction_type_enum") {
+		t.Errorf("Expected error to name the enum type, got: %v", err)
+	}
+}
+
+func TestAutoMigrate_SQLiteAddsTenantColumn(t *testing.T) {
+	cfg := config.DatabaseConfig{Driver: "sqlite", Name: ":memory:", AutoMigrate: true}
+	db, err := NewConnection(context.Background(), cfg, config.AppConfig{})
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	defer func() {
+		_ = CloseConnection(db)
+	}()
+
+	// A table created before transactions carried a tenant
+	if err := db.Exec("CREATE TABLE historical_transactions (id TEXT PRIMARY KEY, user_id INTEGER, account_id TEXT, transaction_id TEXT NOT NULL UNIQUE, transaction_status TEXT, reversed_at DATETIME)").Error; err != nil {
+		t.Fatalf("Failed to create legacy table: %v", err)
+	}
+
+	if err := AutoMigrate(db, cfg); err != nil {
+		t.Fatalf("AutoMigrate should not return error, got: %v", err)
+	}
+	if !db.Migrator().HasColumn("historical_transactions", "tenant_id") {
+		t.Error("Expected AutoMigrate to add the tenant_id column")
+	}
+	if !db.Migrator().HasColumn("historical_transactions", "raw_payload") {
+		t.Error("Expected AutoMigrate to add the raw_payload column")
+	}
+}
+
+func TestAutoMigrate_SQLiteCreatesFeatureTables(t *testing.T) {
+	cfg := config.DatabaseConfig{Driver: "sqlite", Name: ":memory:", AutoMigrate: true}
+	db, err := NewConnection(context.Background(), cfg, config.AppConfig{})
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	defer func() {
+		_ = CloseConnection(db)
+	}()
+
+	if err := AutoMigrate(db, cfg); err != nil {
+		t.Fatalf("AutoMigrate should not return error, got: %v", err)
+	}
+	for _, table := range []string{"processed_offsets", "processing_log", "audit_log"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("Expected AutoMigrate to create the %s table", table)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"transaction-consumer/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// PoolHealthCheck pings the connection pool periodically and recycles its
+// idle connections when a ping fails. After a database failover the pool may
+// still hold connections to the old primary, failing the first query made
+// with each of them; closing them makes the pool dial fresh connections
+type PoolHealthCheck struct {
+	pool         *sql.DB
+	maxIdleConns int
+	logger       logger.Logger
+}
+
+// NewPoolHealthCheck returns a health check of the pool of db, which keeps
+// up to maxIdleConns idle connections once recycled
+func NewPoolHealthCheck(db *gorm.DB, maxIdleConns int, log logger.Logger) (*PoolHealthCheck, error) {
+	pool, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database instance: %w", err)
+	}
+	return &PoolHealthCheck{pool: pool, maxIdleConns: maxIdleConns, logger: log}, nil
+}
+
+// Run checks the pool every interval until ctx is done; each ping is bounded
+// by the interval
+func (h *PoolHealthCheck) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		_ = h.check(ctx, interval)
+	}
+}
+
+// check pings the pool and recycles its idle connections when that fails
+func (h *PoolHealthCheck) check(ctx context.Context, timeout time.Duration) error {
+	pingCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := h.pool.PingContext(pingCtx)
+	if err == nil || ctx.Err() != nil {
+		return nil
+	}
+
+	h.logger.Warn("Database ping failed, recycling idle connections", "error", err,
+		"idleConnections", h.pool.Stats().Idle)
+	// Lowering the idle limit closes the idle connections right away
+	h.pool.SetMaxIdleConns(0)
+	h.pool.SetMaxIdleConns(h.maxIdleConns)
+	return err
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// setupPingTestDB returns a mocked database whose pings are expectations
+func setupPingTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Failed to create mock DB: %v", err)
+	}
+	// gorm.Open pings the pool
+	mock.ExpectPing()
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{
+		Conn: sqlDB,
+	}), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create GORM DB: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return gormDB, mock
+}
+
+func TestPoolHealthCheck_PingFailureRecyclesIdleConnections(t *testing.T) {
+	db, mock := setupPingTestDB(t)
+	mock.ExpectPing()
+	mock.ExpectPing().WillReturnError(errors.New("server closed the connection unexpectedly"))
+
+	check, err := NewPoolHealthCheck(db, 10, &mockLogger{})
+	if err != nil {
+		t.Fatalf("NewPoolHealthCheck() error: %v", err)
+	}
+
+	if err := check.check(context.Background(), time.Second); err != nil {
+		t.Fatalf("Expected healthy ping, got: %v", err)
+	}
+	if closed := check.pool.Stats().MaxIdleClosed; closed != 0 {
+		t.Errorf("Expected no connections recycled after a healthy ping, got %d", closed)
+	}
+
+	if err := check.check(context.Background(), time.Second); err == nil {
+		t.Fatal("Expected the failed ping to be reported")
+	}
+	stats := check.pool.Stats()
+	if stats.MaxIdleClosed != 1 {
+		t.Errorf("Expected the idle connection to be recycled, got %d closed", stats.MaxIdleClosed)
+	}
+	if stats.Idle != 0 {
+		t.Errorf("Expected no idle connections after recycling, got %d", stats.Idle)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet expectations: %v", err)
+	}
+}
+
+func TestPoolHealthCheck_Run(t *testing.T) {
+	db, mock := setupPingTestDB(t)
+	mock.ExpectPing().WillReturnError(errors.New("server closed the connection unexpectedly"))
+
+	check, err := NewPoolHealthCheck(db, 10, &mockLogger{})
+	if err != nil {
+		t.Fatalf("NewPoolHealthCheck() error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		check.Run(ctx, 10*time.Millisecond)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for check.pool.Stats().MaxIdleClosed == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if check.pool.Stats().MaxIdleClosed == 0 {
+		t.Error("Expected Run to recycle the pool after a failed ping")
+	}
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
+)
+
+// ProcessedOffsetModel represents the last processed offset of a partition
+type ProcessedOffsetModel struct {
+	Topic       string    `gorm:"primaryKey;type:varchar(255)"`
+	Partition   int       `gorm:"primaryKey"`
+	Offset      int64     `gorm:"not null"`
+	ProcessedAt time.Time `gorm:"not null"`
+}
+
+// TableName returns the table name
+func (ProcessedOffsetModel) TableName() string {
+	return "processed_offsets"
+}
+
+// processedOffsetRepository implements the repositories interface
+type processedOffsetRepository struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewProcessedOffsetRepository creates a new processed offset repositories
+func NewProcessedOffsetRepository(db *gorm.DB, log logger.Logger) repositories.ProcessedOffsetRepository {
+	return &processedOffsetRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+// GetLastOffsets retrieves the last processed offset of every partition of topic
+func (r *processedOffsetRepository) GetLastOffsets(ctx context.Context, topic string) (map[int]int64, error) {
+	var models []ProcessedOffsetModel
+
+	if err := r.db.WithContext(ctx).Where("topic = ?", topic).Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to get processed offsets: %w", err)
+	}
+
+	offsets := make(map[int]int64, len(models))
+	for _, model := range models {
+		offsets[model.Partition] = model.Offset
+	}
+	return offsets, nil
+}
+
+// saveProcessedOffset upserts offset as the last processed offset of its
+// partition using tx
+func saveProcessedOffset(tx *gorm.DB, offset *entities.ProcessedOffset) error {
+	processedAt := offset.ProcessedAt
+	if processedAt.IsZero() {
+		processedAt = time.Now().UTC()
+	}
+
+	model := &ProcessedOffsetModel{
+		Topic:       offset.Topic,
+		Partition:   offset.Partition,
+		Offset:      offset.Offset,
+		ProcessedAt: processedAt,
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "topic"}, {Name: "partition"}},
+		DoUpdates: clause.AssignmentColumns([]string{"offset", "processed_at"}),
+	}).Create(model).Error
+	if err != nil {
+		return fmt.Errorf("failed to record processed offset: %w", err)
+	}
+	return nil
+}
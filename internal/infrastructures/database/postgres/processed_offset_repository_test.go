@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestProcessedOffsetRepository_GetLastOffsets(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewProcessedOffsetRepository(db, &mockLogger{})
+
+	rows := sqlmock.NewRows([]string{"topic", "partition", "offset", "processed_at"}).
+		AddRow("transactions", 0, 17, time.Now()).
+		AddRow("transactions", 1, 42, time.Now())
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "processed_offsets" WHERE topic = $1`)).
+		WithArgs("transactions").
+		WillReturnRows(rows)
+
+	offsets, err := repo.GetLastOffsets(context.Background(), "transactions")
+	if err != nil {
+		t.Fatalf("GetLastOffsets should not return error, got: %v", err)
+	}
+	if len(offsets) != 2 || offsets[0] != 17 || offsets[1] != 42 {
+		t.Errorf("Unexpected offsets: %v", offsets)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestProcessedOffsetRepository_GetLastOffsets_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewProcessedOffsetRepository(db, &mockLogger{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "processed_offsets"`)).
+		WillReturnError(sql.ErrConnDone)
+
+	if _, err := repo.GetLastOffsets(context.Background(), "transactions"); err == nil {
+		t.Error("GetLastOffsets should return error when database operation fails")
+	}
+}
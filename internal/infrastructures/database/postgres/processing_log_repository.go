@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
+)
+
+// ProcessingLogModel represents a per-message processing outcome
+type ProcessingLogModel struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement"`
+	TransactionID string    `gorm:"index;type:varchar(50)"`
+	Outcome       string    `gorm:"not null;index;type:varchar(20)"`
+	Error         *string   `gorm:"type:text"`
+	ReceivedAt    time.Time `gorm:"not null"`
+	ProcessedAt   time.Time `gorm:"not null;index"`
+	LatencyMs     int64     `gorm:"not null"`
+}
+
+// TableName returns the table name
+func (ProcessingLogModel) TableName() string {
+	return "processing_log"
+}
+
+// processingLogRepository implements the repositories interface
+type processingLogRepository struct {
+	db     *gorm.DB
+	logger logger.Logger
+}
+
+// NewProcessingLogRepository creates a new processing log repositories
+func NewProcessingLogRepository(db *gorm.DB, log logger.Logger) repositories.ProcessingLogRepository {
+	return &processingLogRepository{
+		db:     db,
+		logger: log,
+	}
+}
+
+// Record stores a processing outcome
+func (r *processingLogRepository) Record(ctx context.Context, entry *entities.ProcessingLog) error {
+	model := &ProcessingLogModel{
+		TransactionID: entry.TransactionID,
+		Outcome:       string(entry.Outcome),
+		Error:         entry.Error,
+		ReceivedAt:    entry.ReceivedAt,
+		ProcessedAt:   entry.ProcessedAt,
+		LatencyMs:     entry.Latency.Milliseconds(),
+	}
+
+	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to record processing outcome: %w", err)
+	}
+
+	entry.ID = model.ID
+	return nil
+}
+
+// GetRecent retrieves the most recently processed outcomes
+func (r *processingLogRepository) GetRecent(ctx context.Context, limit int) ([]*entities.ProcessingLog, error) {
+	var models []ProcessingLogModel
+
+	if err := r.db.WithContext(ctx).Order("processed_at DESC").Limit(limit).Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to get recent processing outcomes: %w", err)
+	}
+
+	entries := make([]*entities.ProcessingLog, 0, len(models))
+	for _, model := range models {
+		entries = append(entries, &entities.ProcessingLog{
+			ID:            model.ID,
+			TransactionID: model.TransactionID,
+			Outcome:       entities.ProcessingOutcome(model.Outcome),
+			Error:         model.Error,
+			ReceivedAt:    model.ReceivedAt,
+			ProcessedAt:   model.ProcessedAt,
+			Latency:       time.Duration(model.LatencyMs) * time.Millisecond,
+		})
+	}
+
+	return entries, nil
+}
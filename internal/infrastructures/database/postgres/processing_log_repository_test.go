@@ -0,0 +1,101 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestProcessingLogRepository_Record_Success(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewProcessingLogRepository(db, &mockLogger{})
+
+	receivedAt := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	entry := &entities.ProcessingLog{
+		TransactionID: "trans-123",
+		Outcome:       entities.ProcessingOutcomeSuccess,
+		ReceivedAt:    receivedAt,
+		ProcessedAt:   receivedAt.Add(250 * time.Millisecond),
+		Latency:       250 * time.Millisecond,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "processing_log"`)).
+		WithArgs("trans-123", "SUCCESS", nil, entry.ReceivedAt, entry.ProcessedAt, int64(250)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
+
+	if err := repo.Record(context.Background(), entry); err != nil {
+		t.Errorf("Record should not return error, got: %v", err)
+	}
+	if entry.ID != 42 {
+		t.Errorf("Entry ID should be set to generated ID, got: %d", entry.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestProcessingLogRepository_Record_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewProcessingLogRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "processing_log"`)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	err := repo.Record(context.Background(), &entities.ProcessingLog{Outcome: entities.ProcessingOutcomeFailed})
+	if err == nil {
+		t.Error("Record should return error when database operation fails")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestProcessingLogRepository_GetRecent(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewProcessingLogRepository(db, &mockLogger{})
+
+	now := time.Now().UTC()
+	errMsg := "failed to process transaction"
+	rows := sqlmock.NewRows([]string{
+		"id", "transaction_id", "outcome", "error", "received_at", "processed_at", "latency_ms",
+	}).
+		AddRow(2, "trans-2", "FAILED", errMsg, now.Add(-time.Second), now, 1000).
+		AddRow(1, "trans-1", "SUCCESS", nil, now.Add(-2*time.Second), now.Add(-time.Second), 15)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "processing_log" ORDER BY processed_at DESC LIMIT $1`)).
+		WithArgs(10).
+		WillReturnRows(rows)
+
+	entries, err := repo.GetRecent(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("GetRecent should not return error, got: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Outcome != entities.ProcessingOutcomeFailed || entries[0].Error == nil || *entries[0].Error != errMsg {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if entries[0].Latency != time.Second {
+		t.Errorf("Expected latency 1s, got %v", entries[0].Latency)
+	}
+	if entries[1].TransactionID != "trans-1" || entries[1].Error != nil {
+		t.Errorf("Unexpected second entry: %+v", entries[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
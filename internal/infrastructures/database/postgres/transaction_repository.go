@@ -2,92 +2,556 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+	"io"
 	"time"
 	"transaction-consumer/internal/domain/entities"
 	"transaction-consumer/internal/domain/repositories"
 	"transaction-consumer/pkg/logger"
+	"transaction-consumer/pkg/tracing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TransactionModel represents the database model
 type TransactionModel struct {
-	ID                       string    `gorm:"primaryKey;type:varchar(36);default:gen_random_uuid()"`
-	UserID                   int64     `gorm:"not null;index"`
-	AccountID                string    `gorm:"not null;index;type:varchar(36)"`
-	TransactionID            string    `gorm:"not null;uniqueIndex;type:varchar(50)"`
-	TransactionType          string    `gorm:"not null;type:transaction_type_enum"`
-	TransactionStatus        string    `gorm:"not null;index;type:transaction_status_enum"`
-	Amount                   float64   `gorm:"not null;type:decimal(15,2)"`
-	BalanceBefore            float64   `gorm:"not null;type:decimal(15,2)"`
-	BalanceAfter             float64   `gorm:"not null;type:decimal(15,2)"`
-	Currency                 string    `gorm:"not null;default:IDR;type:varchar(3)"`
-	Description              *string   `gorm:"type:text"`
-	ExternalReference        *string   `gorm:"type:varchar(255)"`
-	PaymentMethod            *string   `gorm:"type:payment_method_enum"`
-	Metadata                 *string   `gorm:"type:text"`
-	IsAccessibleFromExternal bool      `gorm:"not null;default:true;column:is_accessible_external"`
-	CreatedAt                time.Time `gorm:"not null;default:now()"`
-	UpdatedAt                time.Time `gorm:"not null;default:now()"`
+	ID                       string     `gorm:"primaryKey;type:varchar(36);default:gen_random_uuid()"`
+	UserID                   int64      `gorm:"not null;index"`
+	AccountID                string     `gorm:"not null;index;type:varchar(36)"`
+	TransactionID            string     `gorm:"not null;uniqueIndex;type:varchar(50)"`
+	TransactionType          string     `gorm:"not null;type:transaction_type_enum"`
+	TransactionStatus        string     `gorm:"not null;index;type:transaction_status_enum"`
+	Amount                   float64    `gorm:"not null;type:decimal(15,2)"`
+	BalanceBefore            float64    `gorm:"not null;type:decimal(15,2)"`
+	BalanceAfter             float64    `gorm:"not null;type:decimal(15,2)"`
+	Currency                 string     `gorm:"not null;default:IDR;type:varchar(3)"`
+	Description              *string    `gorm:"type:text"`
+	ExternalReference        *string    `gorm:"type:varchar(255)"`
+	PaymentMethod            *string    `gorm:"type:payment_method_enum"`
+	Metadata                 *string    `gorm:"type:jsonb"`
+	IsAccessibleFromExternal bool       `gorm:"not null;default:true;column:is_accessible_external"`
+	CreatedAt                time.Time  `gorm:"not null;default:now()"`
+	UpdatedAt                time.Time  `gorm:"not null;default:now()"`
+	TenantID                 *string    `gorm:"index;type:varchar(64)"`
+	RawPayload               *string    `gorm:"type:jsonb"`
+	ReversedAt               *time.Time `gorm:"<-:update;index"`
+	ReversalReason           *string    `gorm:"<-:update;type:text"`
 }
 
+// DefaultTransactionTable is the table transactions are stored in unless
+// configured otherwise
+const DefaultTransactionTable = "historical_transactions"
+
 // TableName returns the table name
 func (TransactionModel) TableName() string {
-	return "historical_transactions"
+	return DefaultTransactionTable
 }
 
 // transactionRepository implements the repositories interface
 type transactionRepository struct {
-	db     *gorm.DB
-	logger logger.Logger
+	db        *gorm.DB
+	logger    logger.Logger
+	tracer    trace.Tracer
+	tableName string
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// Option configures optional behaviour of the transaction repository
+type Option func(*transactionRepository)
+
+// WithTracerProvider traces repository writes with tp
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(r *transactionRepository) {
+		r.tracer = tracing.Tracer(tp)
+	}
+}
+
+// WithTableName stores transactions in table instead of
+// DefaultTransactionTable; empty keeps the default
+func WithTableName(table string) Option {
+	return func(r *transactionRepository) {
+		if table != "" {
+			r.tableName = table
+		}
+	}
+}
+
+// WithQueryTimeout bounds every repository call to timeout; zero leaves calls
+// bounded only by the incoming context
+func WithQueryTimeout(timeout time.Duration) Option {
+	return func(r *transactionRepository) {
+		r.readTimeout = timeout
+		r.writeTimeout = timeout
+	}
+}
+
+// WithReadTimeout bounds the lookups, e.g. Exists and the Get methods, to
+// timeout instead of the query timeout; zero keeps the query timeout
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(r *transactionRepository) {
+		if timeout > 0 {
+			r.readTimeout = timeout
+		}
+	}
+}
+
+// WithWriteTimeout bounds the inserts and updates, e.g. Create and Upsert, to
+// timeout instead of the query timeout; zero keeps the query timeout
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(r *transactionRepository) {
+		if timeout > 0 {
+			r.writeTimeout = timeout
+		}
+	}
 }
 
 // NewTransactionRepository creates a new transaction repositories
-func NewTransactionRepository(db *gorm.DB, log logger.Logger) repositories.TransactionRepository {
-	return &transactionRepository{
-		db:     db,
-		logger: log,
+func NewTransactionRepository(db *gorm.DB, log logger.Logger, opts ...Option) repositories.TransactionRepository {
+	r := &transactionRepository{
+		db:        db,
+		logger:    log,
+		tracer:    tracing.Tracer(nil),
+		tableName: DefaultTransactionTable,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Create creates a new transaction
-func (r *transactionRepository) Create(ctx context.Context, transaction *entities.Transaction) error {
+func (r *transactionRepository) Create(ctx context.Context, transaction *entities.Transaction) (err error) {
+	ctx, span := r.tracer.Start(ctx, "repository.Create",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("transactionId", transaction.TransactionID)))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	ctx, cancel := r.withWriteTimeout(ctx)
+	defer cancel()
+
 	model := r.entityToModel(transaction)
 
-	if err := r.db.WithContext(ctx).Create(model).Error; err != nil {
-		return fmt.Errorf("failed to create transaction: %w", err)
+	if err := r.table(ctx).Create(model).Error; err != nil {
+		return fmt.Errorf("failed to create transaction: %w", timeoutError(ctx, duplicateError(err)))
 	}
 
 	// Update entities with generated ID
 	transaction.ID = model.ID
+	logger.FromContext(ctx, r.logger).Debug("Transaction inserted", "id", model.ID)
+	return nil
+}
+
+// SaveOffset records offset as the last processed offset of its partition
+func (r *transactionRepository) SaveOffset(ctx context.Context, offset *entities.ProcessedOffset) (err error) {
+	ctx, span := r.tracer.Start(ctx, "repository.SaveOffset",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.Int("partition", offset.Partition),
+			attribute.Int64("offset", offset.Offset),
+		))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	ctx, cancel := r.withWriteTimeout(ctx)
+	defer cancel()
+
+	if err := saveProcessedOffset(r.db.WithContext(ctx), offset); err != nil {
+		return timeoutError(ctx, err)
+	}
+
+	logger.FromContext(ctx, r.logger).Debug("Processed offset saved",
+		"partition", offset.Partition, "offset", offset.Offset)
+	return nil
+}
+
+// upsertColumns are overwritten when an existing transaction is upserted
+var upsertColumns = []string{
+	"user_id", "account_id", "transaction_type", "transaction_status",
+	"amount", "balance_before", "balance_after", "currency",
+	"description", "external_reference", "payment_method", "metadata",
+	"is_accessible_external", "created_at", "updated_at", "tenant_id",
+	"raw_payload",
+}
+
+// Upsert creates a transaction or, when one with the same transaction ID
+// already exists, overwrites its fields
+func (r *transactionRepository) Upsert(ctx context.Context, transaction *entities.Transaction) (err error) {
+	ctx, span := r.tracer.Start(ctx, "repository.Upsert",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("transactionId", transaction.TransactionID)))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	ctx, cancel := r.withWriteTimeout(ctx)
+	defer cancel()
+
+	model := r.entityToModel(transaction)
+
+	err = r.table(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "transaction_id"}},
+		DoUpdates: clause.AssignmentColumns(upsertColumns),
+	}).Create(model).Error
+	if err != nil {
+		return fmt.Errorf("failed to upsert transaction: %w", timeoutError(ctx, err))
+	}
+
+	transaction.ID = model.ID
+	logger.FromContext(ctx, r.logger).Debug("Transaction upserted", "id", model.ID)
 	return nil
 }
 
-// GetByTransactionID retrieves a transaction by transaction ID
-func (r *transactionRepository) GetByTransactionID(ctx context.Context, transactionID string) (*entities.Transaction, error) {
+// GetByTransactionID retrieves a transaction by transaction ID; reversed
+// transactions are only returned with repositories.IncludeReversed
+func (r *transactionRepository) GetByTransactionID(ctx context.Context, transactionID string, opts ...repositories.QueryOption) (*entities.Transaction, error) {
+	ctx, cancel := r.withReadTimeout(ctx)
+	defer cancel()
+
 	var model TransactionModel
 
-	if err := r.db.WithContext(ctx).Where("transaction_id = ?", transactionID).First(&model).Error; err != nil {
+	query := r.primary(ctx).Where("transaction_id = ?", transactionID)
+	if !repositories.NewQueryOptions(opts...).IncludeReversed {
+		query = query.Where("reversed_at IS NULL")
+	}
+
+	if err := query.First(&model).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to get transaction: %w", err)
+		return nil, fmt.Errorf("failed to get transaction: %w", timeoutError(ctx, err))
 	}
 
 	return r.modelToEntity(&model), nil
 }
 
+// MarkReversed marks a transaction as reversed with reason, keeping the row
+func (r *transactionRepository) MarkReversed(ctx context.Context, transactionID string, reason string) error {
+	ctx, cancel := r.withWriteTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().UTC()
+
+	result := r.table(ctx).
+		Where("transaction_id = ? AND reversed_at IS NULL", transactionID).
+		Updates(map[string]interface{}{
+			"reversed_at":     now,
+			"reversal_reason": reason,
+			"updated_at":      now,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark transaction reversed: %w", timeoutError(ctx, result.Error))
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("transaction %s not found or already reversed", transactionID)
+	}
+
+	logger.FromContext(ctx, r.logger).Info("Transaction reversed", "transactionID", transactionID, "reason", reason)
+	return nil
+}
+
+// UpdateStatus moves a stored transaction to status with its resulting
+// balance, e.g. when a PENDING transaction settles. The update only applies
+// when the stored status may transition to status, so a stale event never
+// overwrites a settled transaction
+func (r *transactionRepository) UpdateStatus(ctx context.Context, transactionID string, status entities.TransactionStatus, balanceAfter float64) (err error) {
+	ctx, span := r.tracer.Start(ctx, "repository.UpdateStatus",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("transactionId", transactionID),
+			attribute.String("status", string(status)),
+		))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	ctx, cancel := r.withWriteTimeout(ctx)
+	defer cancel()
+
+	result := r.table(ctx).
+		Where("transaction_id = ? AND transaction_status IN ?", transactionID, statusesTransitioningTo(status)).
+		Updates(map[string]interface{}{
+			"transaction_status": string(status),
+			"balance_after":      balanceAfter,
+			"updated_at":         time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update transaction status: %w", timeoutError(ctx, result.Error))
+	}
+
+	if result.RowsAffected == 0 {
+		// Nothing matched: either the transaction is unknown or its stored
+		// status is ahead of this update
+		var count int64
+		if err := r.primary(ctx).Where("transaction_id = ?", transactionID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check transaction existence: %w", timeoutError(ctx, err))
+		}
+		if count > 0 {
+			return fmt.Errorf("failed to update transaction %s to %s: %w", transactionID, status, repositories.ErrOutOfOrderUpdate)
+		}
+		return fmt.Errorf("failed to update transaction %s: %w", transactionID, repositories.ErrTransactionNotFound)
+	}
+
+	logger.FromContext(ctx, r.logger).Debug("Transaction status updated", "transactionID", transactionID, "status", status)
+	return nil
+}
+
+// statusesTransitioningTo returns the stored statuses that may move to next
+func statusesTransitioningTo(next entities.TransactionStatus) []string {
+	statuses := make([]string, 0, len(entities.TransactionStatuses))
+	for _, status := range entities.TransactionStatuses {
+		if status.CanTransitionTo(next) {
+			statuses = append(statuses, string(status))
+		}
+	}
+	return statuses
+}
+
 // Exists checks if a transaction exists by transaction ID
 func (r *transactionRepository) Exists(ctx context.Context, transactionID string) (bool, error) {
+	ctx, cancel := r.withReadTimeout(ctx)
+	defer cancel()
+
+	var count int64
+
+	if err := r.primary(ctx).Where("transaction_id = ?", transactionID).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check transaction existence: %w", timeoutError(ctx, err))
+	}
+
+	return count > 0, nil
+}
+
+// ExistsWithStatus checks if a transaction exists by transaction ID with
+// the given status
+func (r *transactionRepository) ExistsWithStatus(ctx context.Context, transactionID string, status entities.TransactionStatus) (bool, error) {
+	ctx, cancel := r.withReadTimeout(ctx)
+	defer cancel()
+
 	var count int64
 
-	if err := r.db.WithContext(ctx).Model(&TransactionModel{}).Where("transaction_id = ?", transactionID).Count(&count).Error; err != nil {
-		return false, fmt.Errorf("failed to check transaction existence: %w", err)
+	if err := r.primary(ctx).
+		Where("transaction_id = ? AND transaction_status = ?", transactionID, string(status)).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check transaction existence: %w", timeoutError(ctx, err))
 	}
 
 	return count > 0, nil
 }
 
+// GetByAccountAndDateRange retrieves the transactions of an account created
+// within the given time window, oldest first
+func (r *transactionRepository) GetByAccountAndDateRange(ctx context.Context, accountID string, from, to time.Time) ([]*entities.Transaction, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid date range: from (%s) must be before to (%s)",
+			from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	ctx, cancel := r.withReadTimeout(ctx)
+	defer cancel()
+
+	var models []TransactionModel
+
+	if err := r.table(ctx).
+		Where("account_id = ? AND created_at BETWEEN ? AND ?", accountID, from, to).
+		Order("created_at ASC").
+		Find(&models).Error; err != nil {
+		return nil, fmt.Errorf("failed to get transactions by account and date range: %w", timeoutError(ctx, err))
+	}
+
+	transactions := make([]*entities.Transaction, 0, len(models))
+	for i := range models {
+		transactions = append(transactions, r.modelToEntity(&models[i]))
+	}
+
+	return transactions, nil
+}
+
+// typeAggregateRow is a row of the AggregateByType query
+type typeAggregateRow struct {
+	TransactionType   string
+	TransactionStatus string
+	Count             int64
+	TotalAmount       float64
+}
+
+// GetLatestByAccount retrieves the most recently created transaction of an
+// account, the highest ID among those created at the same time, or nil if it
+// has none
+func (r *transactionRepository) GetLatestByAccount(ctx context.Context, accountID string) (*entities.Transaction, error) {
+	ctx, cancel := r.withReadTimeout(ctx)
+	defer cancel()
+
+	var model TransactionModel
+
+	if err := r.primary(ctx).
+		Where("account_id = ?", accountID).
+		Order("created_at DESC, id DESC").
+		Take(&model).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get latest transaction of account: %w", timeoutError(ctx, err))
+	}
+
+	return r.modelToEntity(&model), nil
+}
+
+// AggregateByType counts and sums the amounts of the transactions created
+// within the given time window per type and status; reversed transactions
+// are left out
+func (r *transactionRepository) AggregateByType(ctx context.Context, from, to time.Time) ([]entities.TypeAggregate, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid date range: from (%s) must be before to (%s)",
+			from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	ctx, cancel := r.withReadTimeout(ctx)
+	defer cancel()
+
+	var rows []typeAggregateRow
+
+	if err := r.table(ctx).
+		Select("transaction_type, transaction_status, COUNT(*) AS count, COALESCE(SUM(amount), 0) AS total_amount").
+		Where("created_at BETWEEN ? AND ? AND reversed_at IS NULL", from, to).
+		Group("transaction_type, transaction_status").
+		Order("transaction_type, transaction_status").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to aggregate transactions by type: %w", timeoutError(ctx, err))
+	}
+
+	aggregates := make([]entities.TypeAggregate, 0, len(rows))
+	for _, row := range rows {
+		aggregates = append(aggregates, entities.TypeAggregate{
+			TransactionType:   entities.TransactionType(row.TransactionType),
+			TransactionStatus: entities.TransactionStatus(row.TransactionStatus),
+			Count:             row.Count,
+			TotalAmount:       row.TotalAmount,
+		})
+	}
+
+	return aggregates, nil
+}
+
+// ExportAll streams the transactions matching opts to w as newline-delimited
+// JSON, oldest first, reading one row at a time. The read timeout does not
+// apply, as a full export may take longer than any single lookup
+func (r *transactionRepository) ExportAll(ctx context.Context, w io.Writer, opts ...repositories.QueryOption) (err error) {
+	options := repositories.NewQueryOptions(opts...)
+
+	query := r.table(ctx)
+	if !options.IncludeReversed {
+		query = query.Where("reversed_at IS NULL")
+	}
+	if !options.CreatedFrom.IsZero() {
+		query = query.Where("created_at >= ?", options.CreatedFrom)
+	}
+	if !options.CreatedTo.IsZero() {
+		query = query.Where("created_at <= ?", options.CreatedTo)
+	}
+
+	rows, err := query.Order("created_at, id").Rows()
+	if err != nil {
+		return fmt.Errorf("failed to export transactions: %w", err)
+	}
+	defer func() {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close exported rows: %w", closeErr)
+		}
+	}()
+
+	encoder := json.NewEncoder(w)
+	exported := 0
+	for rows.Next() {
+		var model TransactionModel
+		if err := r.db.ScanRows(rows, &model); err != nil {
+			return fmt.Errorf("failed to scan exported transaction: %w", err)
+		}
+		if err := encoder.Encode(r.modelToEntity(&model)); err != nil {
+			return fmt.Errorf("failed to export transaction %s: %w", model.TransactionID, err)
+		}
+		exported++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export transactions: %w", err)
+	}
+
+	logger.FromContext(ctx, r.logger).Debug("Transactions exported", "count", exported)
+	return nil
+}
+
+// WithTx runs fn with a copy of the repository bound to a database
+// transaction, committing it when fn succeeds and rolling it back otherwise
+func (r *transactionRepository) WithTx(ctx context.Context, fn func(repo repositories.TransactionRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		bound := *r
+		bound.db = tx
+		return fn(&bound)
+	})
+}
+
+// table scopes a query to the configured transaction table
+func (r *transactionRepository) table(ctx context.Context) *gorm.DB {
+	return r.db.WithContext(ctx).Table(r.tableName)
+}
+
+// primary scopes a query to the configured transaction table on the primary
+// even when a read replica is configured. Processing decides between insert,
+// update and skip from these lookups, which a lagging replica would get wrong
+func (r *transactionRepository) primary(ctx context.Context) *gorm.DB {
+	return r.table(ctx).Clauses(dbresolver.Write)
+}
+
+// withReadTimeout derives a context bounded by the configured read timeout
+func (r *transactionRepository) withReadTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, r.readTimeout)
+}
+
+// withWriteTimeout derives a context bounded by the configured write timeout
+func (r *transactionRepository) withWriteTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, r.writeTimeout)
+}
+
+// withTimeout derives a context bounded by timeout, unless zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError makes err match context.DeadlineExceeded when ctx expired,
+// since drivers often report a cancelled query with their own error
+func timeoutError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// uniqueViolation is the Postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// duplicateError makes err match repositories.ErrDuplicateTransaction when
+// it reports a unique constraint violation
+func duplicateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.Is(err, gorm.ErrDuplicatedKey) || (errors.As(err, &pgErr) && pgErr.Code == uniqueViolation) {
+		return fmt.Errorf("%w: %w", repositories.ErrDuplicateTransaction, err)
+	}
+	return err
+}
+
 // entityToModel converts entities to database model
 func (r *transactionRepository) entityToModel(transaction *entities.Transaction) *TransactionModel {
 	model := &TransactionModel{
@@ -107,6 +571,7 @@ func (r *transactionRepository) entityToModel(transaction *entities.Transaction)
 		IsAccessibleFromExternal: transaction.IsAccessibleFromExternal,
 		CreatedAt:                transaction.CreatedAt,
 		UpdatedAt:                transaction.UpdatedAt,
+		RawPayload:               transaction.RawPayload,
 	}
 
 	if transaction.PaymentMethod != nil {
@@ -114,6 +579,13 @@ func (r *transactionRepository) entityToModel(transaction *entities.Transaction)
 		model.PaymentMethod = &paymentMethod
 	}
 
+	// Transactions without a tenant keep the column NULL, like rows stored
+	// before multi-tenancy
+	if transaction.TenantID != "" {
+		tenantID := transaction.TenantID
+		model.TenantID = &tenantID
+	}
+
 	return model
 }
 
@@ -136,6 +608,9 @@ func (r *transactionRepository) modelToEntity(model *TransactionModel) *entities
 		IsAccessibleFromExternal: model.IsAccessibleFromExternal,
 		CreatedAt:                model.CreatedAt,
 		UpdatedAt:                model.UpdatedAt,
+		ReversedAt:               model.ReversedAt,
+		ReversalReason:           model.ReversalReason,
+		RawPayload:               model.RawPayload,
 	}
 
 	if model.PaymentMethod != nil {
@@ -143,5 +618,9 @@ func (r *transactionRepository) modelToEntity(model *TransactionModel) *entities
 		transaction.PaymentMethod = &paymentMethod
 	}
 
+	if model.TenantID != nil {
+		transaction.TenantID = *model.TenantID
+	}
+
 	return transaction
 }
@@ -1,14 +1,21 @@
 package postgres
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
+	"io"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
@@ -54,6 +61,10 @@ func (m *mockLogger) Fatal(msg string, args ...interface{}) {
 	m.Error(msg, args...)
 }
 
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
 func setupTestDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
 	sqlDB, mock, err := sqlmock.New()
 	if err != nil {
@@ -82,6 +93,23 @@ func TestNewTransactionRepository(t *testing.T) {
 	}
 }
 
+func TestTransactionRepository_ImplementsFocusedInterfaces(t *testing.T) {
+	db, _ := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	var reader repositories.TransactionReader = repo
+	var writer repositories.TransactionWriter = repo
+	if reader == nil || writer == nil {
+		t.Error("Expected the repository to serve as both reader and writer")
+	}
+	if _, ok := interface{}(&transactionRepository{}).(repositories.TransactionReader); !ok {
+		t.Error("Expected transactionRepository to implement TransactionReader")
+	}
+	if _, ok := interface{}(&transactionRepository{}).(repositories.TransactionWriter); !ok {
+		t.Error("Expected transactionRepository to implement TransactionWriter")
+	}
+}
+
 func TestTransactionRepository_Create_Success(t *testing.T) {
 	db, mock := setupTestDB(t)
 	mockLog := &mockLogger{}
@@ -119,6 +147,8 @@ func TestTransactionRepository_Create_Success(t *testing.T) {
 			nil,              // payment_method
 			nil,              // metadata
 			sqlmock.AnyArg(), // is_accessible_external - use AnyArg to avoid mismatch
+			nil,              // tenant_id
+			nil,              // raw_payload
 			sqlmock.AnyArg(), // created_at
 			sqlmock.AnyArg(), // updated_at
 		).
@@ -181,6 +211,8 @@ func TestTransactionRepository_Create_WithAccessibleFlag(t *testing.T) {
 			nil,              // payment_method
 			nil,              // metadata
 			true,             // is_accessible_external - explicitly true
+			nil,              // tenant_id
+			nil,              // raw_payload
 			sqlmock.AnyArg(), // created_at
 			sqlmock.AnyArg(), // updated_at
 		).
@@ -213,6 +245,7 @@ func TestTransactionRepository_Create_WithOptionalFields(t *testing.T) {
 	externalRef := "ext-123"
 	paymentMethod := entities.PaymentMethod("GOPAY")
 	metadata := `{"key": "value"}`
+	rawPayload := `{"transactionId":"trans-123"}`
 
 	transaction := &entities.Transaction{
 		UserID:                   123,
@@ -231,6 +264,7 @@ func TestTransactionRepository_Create_WithOptionalFields(t *testing.T) {
 		IsAccessibleFromExternal: true,
 		CreatedAt:                time.Now(),
 		UpdatedAt:                time.Now(),
+		RawPayload:               &rawPayload,
 	}
 
 	mock.ExpectBegin()
@@ -250,6 +284,8 @@ func TestTransactionRepository_Create_WithOptionalFields(t *testing.T) {
 			string(paymentMethod),
 			metadata,
 			true,
+			nil,
+			rawPayload,
 			sqlmock.AnyArg(),
 			sqlmock.AnyArg(),
 		).
@@ -269,6 +305,25 @@ func TestTransactionRepository_Create_WithOptionalFields(t *testing.T) {
 	}
 }
 
+func TestTransactionRepository_Create_Duplicate(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillReturnError(&pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"})
+	mock.ExpectRollback()
+
+	err := repo.Create(context.Background(), &entities.Transaction{TransactionID: "trans-123"})
+
+	if !errors.Is(err, repositories.ErrDuplicateTransaction) {
+		t.Errorf("Expected repositories.ErrDuplicateTransaction, got: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
 func TestTransactionRepository_Create_Error(t *testing.T) {
 	db, mock := setupTestDB(t)
 	mockLog := &mockLogger{}
@@ -320,7 +375,7 @@ func TestTransactionRepository_GetByTransactionID_Found(t *testing.T) {
 	)
 
 	// GORM adds ORDER BY and LIMIT to SELECT queries
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1 ORDER BY "historical_transactions"."id" LIMIT $2`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1 AND reversed_at IS NULL ORDER BY "historical_transactions"."id" LIMIT $2`)).
 		WithArgs(transactionID, 1).
 		WillReturnRows(rows)
 
@@ -356,7 +411,7 @@ func TestTransactionRepository_GetByTransactionID_NotFound(t *testing.T) {
 	transactionID := "nonexistent-trans"
 
 	// GORM adds ORDER BY and LIMIT to SELECT queries, and returns ErrRecordNotFound for First()
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1 ORDER BY "historical_transactions"."id" LIMIT $2`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1 AND reversed_at IS NULL ORDER BY "historical_transactions"."id" LIMIT $2`)).
 		WithArgs(transactionID, 1).
 		WillReturnError(gorm.ErrRecordNotFound)
 
@@ -384,7 +439,7 @@ func TestTransactionRepository_GetByTransactionID_Error(t *testing.T) {
 	transactionID := "trans-123"
 
 	// GORM adds ORDER BY and LIMIT to SELECT queries
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1 ORDER BY "historical_transactions"."id" LIMIT $2`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1 AND reversed_at IS NULL ORDER BY "historical_transactions"."id" LIMIT $2`)).
 		WithArgs(transactionID, 1).
 		WillReturnError(sql.ErrConnDone)
 
@@ -458,6 +513,27 @@ func TestTransactionRepository_Exists_False(t *testing.T) {
 	}
 }
 
+func TestTransactionRepository_ExistsWithStatus(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1 AND transaction_status = $2`)).
+		WithArgs("trans-123", "SUCCESS").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	exists, err := repo.ExistsWithStatus(context.Background(), "trans-123", entities.TransactionStatusSuccess)
+	if err != nil {
+		t.Errorf("ExistsWithStatus should not return error, got: %v", err)
+	}
+	if !exists {
+		t.Error("ExistsWithStatus should return true when the transaction has the status")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
 func TestTransactionRepository_Exists_Error(t *testing.T) {
 	db, mock := setupTestDB(t)
 	mockLog := &mockLogger{}
@@ -576,6 +652,26 @@ func TestTransactionRepository_modelToEntity(t *testing.T) {
 	}
 }
 
+func TestTransactionRepository_TenantIDRoundTrip(t *testing.T) {
+	repo := &transactionRepository{logger: &mockLogger{}}
+
+	for _, tenantID := range []string{"tenant-a", ""} {
+		entity := &entities.Transaction{TransactionID: "trans-456", TenantID: tenantID}
+
+		model := repo.entityToModel(entity)
+		if tenantID == "" && model.TenantID != nil {
+			t.Errorf("Expected no tenant to be stored as NULL, got %q", *model.TenantID)
+		}
+		if tenantID != "" && (model.TenantID == nil || *model.TenantID != tenantID) {
+			t.Errorf("Expected model tenant %q, got %v", tenantID, model.TenantID)
+		}
+
+		if got := repo.modelToEntity(model).TenantID; got != tenantID {
+			t.Errorf("Expected tenant %q after the round trip, got %q", tenantID, got)
+		}
+	}
+}
+
 func TestTransactionRepository_entityToModel_NilOptionalFields(t *testing.T) {
 	mockLog := &mockLogger{}
 	repo := &transactionRepository{logger: mockLog}
@@ -647,3 +743,822 @@ func TestTransactionRepository_modelToEntity_NilOptionalFields(t *testing.T) {
 		t.Error("Metadata should be nil when not set in model")
 	}
 }
+
+var transactionColumns = []string{
+	"id", "user_id", "account_id", "transaction_id", "transaction_type",
+	"transaction_status", "amount", "balance_before", "balance_after",
+	"currency", "description", "external_reference", "payment_method",
+	"metadata", "is_accessible_external", "created_at", "updated_at",
+}
+
+func TestTransactionRepository_GetByAccountAndDateRange_Success(t *testing.T) {
+	db, mock := setupTestDB(t)
+	mockLog := &mockLogger{}
+	repo := NewTransactionRepository(db, mockLog)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+
+	rows := sqlmock.NewRows(transactionColumns).
+		AddRow("id-1", 456, "account-456", "trans-1", "TOPUP", "SUCCESS", 100.00, 1000.00, 1100.00,
+			"IDR", nil, nil, nil, nil, true, from.Add(time.Hour), from.Add(time.Hour)).
+		AddRow("id-2", 456, "account-456", "trans-2", "PAYMENT", "SUCCESS", 50.00, 1100.00, 1050.00,
+			"IDR", nil, nil, nil, nil, true, from.Add(2*time.Hour), from.Add(2*time.Hour))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE account_id = $1 AND created_at BETWEEN $2 AND $3 ORDER BY created_at ASC`)).
+		WithArgs("account-456", from, to).
+		WillReturnRows(rows)
+
+	result, err := repo.GetByAccountAndDateRange(context.Background(), "account-456", from, to)
+	if err != nil {
+		t.Fatalf("GetByAccountAndDateRange should not return error, got: %v", err)
+	}
+
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 transactions, got %d", len(result))
+	}
+	if result[0].TransactionID != "trans-1" || result[1].TransactionID != "trans-2" {
+		t.Errorf("Transactions should be returned oldest first, got %s, %s", result[0].TransactionID, result[1].TransactionID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_GetByAccountAndDateRange_InvertedRange(t *testing.T) {
+	db, mock := setupTestDB(t)
+	mockLog := &mockLogger{}
+	repo := NewTransactionRepository(db, mockLog)
+
+	from := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := repo.GetByAccountAndDateRange(context.Background(), "account-456", from, to)
+	if err == nil {
+		t.Fatal("GetByAccountAndDateRange should return error for inverted range")
+	}
+	if !strings.Contains(err.Error(), "invalid date range") {
+		t.Errorf("Expected invalid date range error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("No query should be executed for an invalid range: %v", err)
+	}
+}
+
+func TestTransactionRepository_GetByAccountAndDateRange_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	mockLog := &mockLogger{}
+	repo := NewTransactionRepository(db, mockLog)
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions"`)).
+		WillReturnError(sql.ErrConnDone)
+
+	if _, err := repo.GetByAccountAndDateRange(context.Background(), "account-456", from, to); err == nil {
+		t.Error("GetByAccountAndDateRange should return error when database operation fails")
+	}
+}
+
+func TestTransactionRepository_Upsert_UpdatesExisting(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	description := "corrected amount"
+	transaction := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusSuccess,
+		Amount:            150.00,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      1150.00,
+		Currency:          "IDR",
+		Description:       &description,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)+
+		`.*`+regexp.QuoteMeta(`ON CONFLICT ("transaction_id") DO UPDATE SET "user_id"="excluded"."user_id"`)+
+		`.*`+regexp.QuoteMeta(`"amount"="excluded"."amount"`)+
+		`.*`+regexp.QuoteMeta(`"description"="excluded"."description"`)+
+		`.*`+regexp.QuoteMeta(`"updated_at"="excluded"."updated_at","tenant_id"="excluded"."tenant_id","raw_payload"="excluded"."raw_payload" RETURNING "id"`)).
+		WithArgs(
+			transaction.UserID,
+			transaction.AccountID,
+			transaction.TransactionID,
+			string(transaction.TransactionType),
+			string(transaction.TransactionStatus),
+			transaction.Amount,
+			transaction.BalanceBefore,
+			transaction.BalanceAfter,
+			transaction.Currency,
+			description,
+			nil,
+			nil,
+			nil,
+			sqlmock.AnyArg(),
+			nil,
+			nil,
+			sqlmock.AnyArg(),
+			sqlmock.AnyArg(),
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+			AddRow("existing-id", time.Now(), time.Now()))
+	mock.ExpectCommit()
+
+	if err := repo.Upsert(context.Background(), transaction); err != nil {
+		t.Errorf("Upsert should not return error, got: %v", err)
+	}
+	if transaction.ID != "existing-id" {
+		t.Errorf("Transaction ID should be set to the existing row ID, got: %s", transaction.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_Upsert_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	if err := repo.Upsert(context.Background(), &entities.Transaction{TransactionID: "trans-123"}); err == nil {
+		t.Error("Upsert should return error when database operation fails")
+	}
+}
+
+func TestTransactionRepository_GetByTransactionID_IncludeReversed(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	reversedAt := time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows(append(transactionColumns, "reversed_at", "reversal_reason")).
+		AddRow("id-123", 456, "account-456", "trans-123", "PAYMENT", "SUCCESS", 100.50, 1000.00, 899.50,
+			"IDR", nil, nil, nil, nil, true, time.Now(), time.Now(), reversedAt, "customer refund")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1 ORDER BY "historical_transactions"."id" LIMIT $2`)).
+		WithArgs("trans-123", 1).
+		WillReturnRows(rows)
+
+	result, err := repo.GetByTransactionID(context.Background(), "trans-123", repositories.IncludeReversed())
+	if err != nil {
+		t.Fatalf("GetByTransactionID should not return error, got: %v", err)
+	}
+	if result == nil || !result.IsReversed() {
+		t.Fatalf("Expected reversed transaction, got %+v", result)
+	}
+	if !result.ReversedAt.Equal(reversedAt) || *result.ReversalReason != "customer refund" {
+		t.Errorf("Unexpected reversal fields: %v %v", result.ReversedAt, *result.ReversalReason)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_MarkReversed_Success(t *testing.T) {
+	db, mock := setupTestDB(t)
+	mockLog := &mockLogger{}
+	repo := NewTransactionRepository(db, mockLog)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "historical_transactions" SET "reversal_reason"=$1,"reversed_at"=$2,"updated_at"=$3 WHERE transaction_id = $4 AND reversed_at IS NULL`)).
+		WithArgs("customer refund", sqlmock.AnyArg(), sqlmock.AnyArg(), "trans-123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.MarkReversed(context.Background(), "trans-123", "customer refund"); err != nil {
+		t.Errorf("MarkReversed should not return error, got: %v", err)
+	}
+	if len(mockLog.infoMsgs) != 1 {
+		t.Errorf("Expected reversal to be logged, got %v", mockLog.infoMsgs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_MarkReversed_NotFound(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "historical_transactions"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err := repo.MarkReversed(context.Background(), "trans-missing", "customer refund")
+	if err == nil || !strings.Contains(err.Error(), "not found or already reversed") {
+		t.Errorf("Expected not found error, got: %v", err)
+	}
+}
+
+func TestTransactionRepository_MarkReversed_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "historical_transactions"`)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	if err := repo.MarkReversed(context.Background(), "trans-123", "customer refund"); err == nil {
+		t.Error("MarkReversed should return error when database operation fails")
+	}
+}
+
+func TestTransactionRepository_UpdateStatus_Success(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "historical_transactions" SET "balance_after"=$1,"transaction_status"=$2,"updated_at"=$3 WHERE transaction_id = $4 AND transaction_status IN ($5,$6)`)).
+		WithArgs(1100.50, "SUCCESS", sqlmock.AnyArg(), "trans-123", "PENDING", "SUCCESS").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.UpdateStatus(context.Background(), "trans-123", entities.TransactionStatusSuccess, 1100.50); err != nil {
+		t.Errorf("UpdateStatus should not return error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_UpdateStatus_NotFound(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "historical_transactions"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-missing").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	err := repo.UpdateStatus(context.Background(), "trans-missing", entities.TransactionStatusSuccess, 1100.50)
+	if !errors.Is(err, repositories.ErrTransactionNotFound) {
+		t.Errorf("Expected repositories.ErrTransactionNotFound, got: %v", err)
+	}
+}
+
+func TestTransactionRepository_UpdateStatus_BackwardTransition(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	// A stale PENDING may only overwrite a PENDING row
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`WHERE transaction_id = $4 AND transaction_status IN ($5)`)).
+		WithArgs(1000.00, "PENDING", sqlmock.AnyArg(), "trans-123", "PENDING").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-123").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	err := repo.UpdateStatus(context.Background(), "trans-123", entities.TransactionStatusPending, 1000.00)
+	if !errors.Is(err, repositories.ErrOutOfOrderUpdate) {
+		t.Errorf("Expected repositories.ErrOutOfOrderUpdate, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_UpdateStatus_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "historical_transactions"`)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	if err := repo.UpdateStatus(context.Background(), "trans-123", entities.TransactionStatusSuccess, 1100.50); err == nil {
+		t.Error("UpdateStatus should return error when database operation fails")
+	}
+}
+
+func TestTransactionRepository_WithTableName(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{}, WithTableName("tenant_transactions"))
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tenant_transactions"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+			AddRow("generated-id", time.Now(), time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tenant_transactions" WHERE transaction_id = $1 AND reversed_at IS NULL ORDER BY "tenant_transactions"."id" LIMIT $2`)).
+		WithArgs("trans-123", 1).
+		WillReturnRows(sqlmock.NewRows(transactionColumns))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "tenant_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-123").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tenant_transactions" WHERE account_id = $1`)).
+		WillReturnRows(sqlmock.NewRows(transactionColumns))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "tenant_transactions" SET`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := repo.Create(ctx, &entities.Transaction{TransactionID: "trans-123"}); err != nil {
+		t.Errorf("Create should not return error, got: %v", err)
+	}
+	if _, err := repo.GetByTransactionID(ctx, "trans-123"); err != nil {
+		t.Errorf("GetByTransactionID should not return error, got: %v", err)
+	}
+	if _, err := repo.Exists(ctx, "trans-123"); err != nil {
+		t.Errorf("Exists should not return error, got: %v", err)
+	}
+	if _, err := repo.GetByAccountAndDateRange(ctx, "account-123", time.Now().Add(-time.Hour), time.Now()); err != nil {
+		t.Errorf("GetByAccountAndDateRange should not return error, got: %v", err)
+	}
+	if err := repo.MarkReversed(ctx, "trans-123", "refund"); err != nil {
+		t.Errorf("MarkReversed should not return error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_WithTableName_EmptyKeepsDefault(t *testing.T) {
+	db, _ := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{}, WithTableName("")).(*transactionRepository)
+
+	if repo.tableName != DefaultTransactionTable {
+		t.Errorf("Expected default table %s, got %s", DefaultTransactionTable, repo.tableName)
+	}
+}
+
+func TestTransactionRepository_QueryTimeout(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{}, WithQueryTimeout(20*time.Millisecond))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-123").
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	start := time.Now()
+	_, err := repo.Exists(context.Background(), "trans-123")
+
+	if err == nil {
+		t.Fatal("Exists should return error when the query outlives the timeout")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected the query to be cut short, took %v", elapsed)
+	}
+}
+
+func TestTransactionRepository_QueryTimeout_Disabled(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{}, WithQueryTimeout(0))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-123").
+		WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	exists, err := repo.Exists(context.Background(), "trans-123")
+
+	if err != nil {
+		t.Errorf("Exists should not return error, got: %v", err)
+	}
+	if !exists {
+		t.Error("Expected transaction to exist")
+	}
+}
+
+func TestTransactionRepository_ReadTimeout(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{},
+		WithQueryTimeout(time.Second),
+		WithReadTimeout(20*time.Millisecond),
+	)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WithArgs("trans-123").
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+			AddRow("generated-id", time.Now(), time.Now()))
+	mock.ExpectCommit()
+
+	if _, err := repo.Exists(context.Background(), "trans-123"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Exists to hit the read timeout, got: %v", err)
+	}
+	if err := repo.Create(context.Background(), &entities.Transaction{TransactionID: "trans-123"}); err != nil {
+		t.Errorf("Expected Create to be bound by the query timeout, got: %v", err)
+	}
+}
+
+func TestTransactionRepository_WriteTimeout(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{},
+		WithQueryTimeout(time.Second),
+		WithWriteTimeout(20*time.Millisecond),
+	)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE transaction_id = $1`)).
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "transaction_id"}).AddRow("1", "trans-123"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("generated-id"))
+
+	if _, err := repo.GetByTransactionID(context.Background(), "trans-123"); err != nil {
+		t.Errorf("Expected GetByTransactionID to be bound by the query timeout, got: %v", err)
+	}
+	err := repo.Upsert(context.Background(), &entities.Transaction{TransactionID: "trans-123"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Upsert to hit the write timeout, got: %v", err)
+	}
+}
+
+func TestTransactionRepository_AggregateByType_Success(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+
+	rows := sqlmock.NewRows([]string{"transaction_type", "transaction_status", "count", "total_amount"}).
+		AddRow("PAYMENT", "FAILED", 2, 75.50).
+		AddRow("PAYMENT", "SUCCESS", 10, 1250.00).
+		AddRow("TOPUP", "SUCCESS", 3, 3000.00)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT transaction_type, transaction_status, COUNT(*) AS count, COALESCE(SUM(amount), 0) AS total_amount FROM "historical_transactions" WHERE created_at BETWEEN $1 AND $2 AND reversed_at IS NULL GROUP BY transaction_type, transaction_status ORDER BY transaction_type, transaction_status`)).
+		WithArgs(from, to).
+		WillReturnRows(rows)
+
+	result, err := repo.AggregateByType(context.Background(), from, to)
+	if err != nil {
+		t.Fatalf("AggregateByType should not return error, got: %v", err)
+	}
+
+	expected := []entities.TypeAggregate{
+		{TransactionType: entities.TransactionTypePayment, TransactionStatus: entities.TransactionStatusFailed, Count: 2, TotalAmount: 75.50},
+		{TransactionType: entities.TransactionTypePayment, TransactionStatus: entities.TransactionStatusSuccess, Count: 10, TotalAmount: 1250.00},
+		{TransactionType: entities.TransactionTypeTopup, TransactionStatus: entities.TransactionStatusSuccess, Count: 3, TotalAmount: 3000.00},
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("Expected %d aggregates, got %d", len(expected), len(result))
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Errorf("Aggregate %d = %+v, expected %+v", i, result[i], expected[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_AggregateByType_InvertedRange(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	from := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := repo.AggregateByType(context.Background(), from, to); err == nil {
+		t.Fatal("AggregateByType should return error for inverted range")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("No query should be executed for an invalid range: %v", err)
+	}
+}
+
+func TestTransactionRepository_AggregateByType_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT transaction_type, transaction_status`)).
+		WillReturnError(sql.ErrConnDone)
+
+	if _, err := repo.AggregateByType(context.Background(), from, to); err == nil {
+		t.Error("AggregateByType should return error when database operation fails")
+	}
+}
+
+func TestTransactionRepository_GetLatestByAccount_Found(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	createdAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{
+		"id", "user_id", "account_id", "transaction_id", "transaction_type",
+		"transaction_status", "amount", "balance_before", "balance_after",
+		"currency", "created_at", "updated_at",
+	}).AddRow(
+		"id-2", 456, "account-456", "trans-2", "PAYMENT",
+		"SUCCESS", 100.00, 1000.00, 900.00,
+		"IDR", createdAt, createdAt,
+	)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE account_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`)).
+		WithArgs("account-456", 1).
+		WillReturnRows(rows)
+
+	result, err := repo.GetLatestByAccount(context.Background(), "account-456")
+	if err != nil {
+		t.Fatalf("GetLatestByAccount should not return error, got: %v", err)
+	}
+	if result == nil {
+		t.Fatal("GetLatestByAccount should return the latest transaction")
+	}
+	if result.TransactionID != "trans-2" || result.BalanceAfter != 900.00 || !result.CreatedAt.Equal(createdAt) {
+		t.Errorf("Unexpected transaction: %+v", result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransactionRepository_GetLatestByAccount_SameCreatedAt(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	// Rows come back in the requested order, the highest ID first among
+	// those created at the same time
+	createdAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"id", "account_id", "transaction_id", "balance_after", "created_at"}).
+		AddRow("id-2", "account-456", "trans-2", 900.00, createdAt).
+		AddRow("id-1", "account-456", "trans-1", 1000.00, createdAt)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE account_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`)).
+		WithArgs("account-456", 1).
+		WillReturnRows(rows)
+
+	result, err := repo.GetLatestByAccount(context.Background(), "account-456")
+	if err != nil {
+		t.Fatalf("GetLatestByAccount should not return error, got: %v", err)
+	}
+	if result == nil || result.TransactionID != "trans-2" {
+		t.Errorf("Expected trans-2 with the highest ID, got %+v", result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransactionRepository_GetLatestByAccount_NotFound(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE account_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`)).
+		WithArgs("account-456", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	result, err := repo.GetLatestByAccount(context.Background(), "account-456")
+	if err != nil {
+		t.Errorf("GetLatestByAccount should not return error when none is found, got: %v", err)
+	}
+	if result != nil {
+		t.Errorf("GetLatestByAccount should return nil when none is found, got %+v", result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestTransactionRepository_GetLatestByAccount_Error(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE account_id = $1`)).
+		WillReturnError(errors.New("connection reset"))
+
+	if _, err := repo.GetLatestByAccount(context.Background(), "account-456"); err == nil {
+		t.Error("GetLatestByAccount should return the query error")
+	}
+}
+
+func TestTransactionRepository_ExportAll(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows(append(transactionColumns, "tenant_id")).
+		AddRow("id-1", 456, "account-456", "trans-1", "TOPUP", "SUCCESS", 100.00, 1000.00, 1100.00,
+			"IDR", nil, nil, nil, nil, true, createdAt, createdAt, "tenant-a").
+		AddRow("id-2", 456, "account-456", "trans-2", "PAYMENT", "SUCCESS", 50.00, 1100.00, 1050.00,
+			"IDR", "coffee", nil, "GOPAY", nil, false, createdAt.Add(time.Hour), createdAt.Add(time.Hour), nil)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE reversed_at IS NULL ORDER BY created_at, id`)).
+		WillReturnRows(rows).
+		RowsWillBeClosed()
+
+	var out bytes.Buffer
+	if err := repo.ExportAll(context.Background(), &out); err != nil {
+		t.Fatalf("ExportAll should not return error, got: %v", err)
+	}
+
+	expected := `{"id":"id-1","userId":456,"accountId":"account-456","tenantId":"tenant-a","transactionId":"trans-1","transactionType":"TOPUP","transactionStatus":"SUCCESS","amount":100,"balanceBefore":1000,"balanceAfter":1100,"currency":"IDR","isAccessibleFromExternal":true,"createdAt":"2024-01-01T12:00:00Z","updatedAt":"2024-01-01T12:00:00Z"}
+{"id":"id-2","userId":456,"accountId":"account-456","transactionId":"trans-2","transactionType":"PAYMENT","transactionStatus":"SUCCESS","amount":50,"balanceBefore":1100,"balanceAfter":1050,"currency":"IDR","description":"coffee","paymentMethod":"GOPAY","isAccessibleFromExternal":false,"createdAt":"2024-01-01T13:00:00Z","updatedAt":"2024-01-01T13:00:00Z"}
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected export:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_ExportAll_DateFilter(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions" WHERE created_at >= $1 AND created_at <= $2 ORDER BY created_at, id`)).
+		WithArgs(from, to).
+		WillReturnRows(sqlmock.NewRows(transactionColumns))
+
+	var out bytes.Buffer
+	err := repo.ExportAll(context.Background(), &out, repositories.IncludeReversed(), repositories.CreatedBetween(from, to))
+	if err != nil {
+		t.Fatalf("ExportAll should not return error, got: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("Expected an empty export, got %q", out.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_ExportAll_RowError(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	createdAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows(transactionColumns).
+		AddRow("id-1", 456, "account-456", "trans-1", "TOPUP", "SUCCESS", 100.00, 1000.00, 1100.00,
+			"IDR", nil, nil, nil, nil, true, createdAt, createdAt).
+		AddRow("id-2", 456, "account-456", "trans-2", "TOPUP", "SUCCESS", 100.00, 1100.00, 1200.00,
+			"IDR", nil, nil, nil, nil, true, createdAt, createdAt).
+		RowError(1, errors.New("connection reset"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions"`)).
+		WillReturnRows(rows).
+		RowsWillBeClosed()
+
+	var out bytes.Buffer
+	err := repo.ExportAll(context.Background(), &out)
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("Expected the row error to be returned, got: %v", err)
+	}
+	if strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("Expected the rows before the error to be exported, got %q", out.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_ExportAll_QueryError(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "historical_transactions"`)).
+		WillReturnError(errors.New("connection refused"))
+
+	if err := repo.ExportAll(context.Background(), io.Discard); err == nil {
+		t.Error("ExportAll should return the query error")
+	}
+}
+
+func newTxTestTransaction() *entities.Transaction {
+	return &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusSuccess,
+		Amount:            100.50,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      1100.50,
+		Currency:          "IDR",
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+}
+
+// createWithOffset stores transaction and offset through a repository bound
+// to a single database transaction, the way the use case does
+func createWithOffset(repo repositories.TransactionRepository, transaction *entities.Transaction, offset *entities.ProcessedOffset) error {
+	return repo.WithTx(context.Background(), func(tx repositories.TransactionRepository) error {
+		if err := tx.Create(context.Background(), transaction); err != nil {
+			return err
+		}
+		return tx.SaveOffset(context.Background(), offset)
+	})
+}
+
+func TestTransactionRepository_WithTx_Commit(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+	mock.MatchExpectationsInOrder(true)
+
+	transaction := newTxTestTransaction()
+	processedAt := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	offset := &entities.ProcessedOffset{Topic: "transactions", Partition: 2, Offset: 42, ProcessedAt: processedAt}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+			AddRow("generated-id", time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "processed_offsets" ("topic","partition","offset","processed_at") VALUES ($1,$2,$3,$4) ON CONFLICT ("topic","partition") DO UPDATE SET "offset"="excluded"."offset","processed_at"="excluded"."processed_at"`)).
+		WithArgs("transactions", 2, int64(42), processedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := createWithOffset(repo, transaction, offset); err != nil {
+		t.Errorf("WithTx should not return error, got: %v", err)
+	}
+	if transaction.ID != "generated-id" {
+		t.Errorf("Transaction ID should be set to generated ID, got: %s", transaction.ID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_WithTx_RollsBackOnOffsetError(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	offset := &entities.ProcessedOffset{Topic: "transactions", Partition: 2, Offset: 42}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
+			AddRow("generated-id", time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "processed_offsets"`)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	if err := createWithOffset(repo, newTxTestTransaction(), offset); !errors.Is(err, sql.ErrConnDone) {
+		t.Errorf("Expected offset error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
+
+func TestTransactionRepository_WithTx_RollsBackOnInsertError(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := NewTransactionRepository(db, &mockLogger{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "historical_transactions"`)).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mock.ExpectRollback()
+
+	offset := &entities.ProcessedOffset{Topic: "transactions", Partition: 2, Offset: 42}
+	err := createWithOffset(repo, newTxTestTransaction(), offset)
+	if !errors.Is(err, repositories.ErrDuplicateTransaction) {
+		t.Errorf("Expected ErrDuplicateTransaction, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Mock expectations were not met: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"transaction-consumer/pkg/logger"
+)
+
+// ReadinessFunc reports whether the application is ready to serve traffic
+type ReadinessFunc func() bool
+
+// Server exposes liveness and readiness endpoints over HTTP
+type Server struct {
+	httpServer *http.Server
+	mux        *http.ServeMux
+	logger     logger.Logger
+}
+
+// NewServer creates a new health server listening on the given port
+func NewServer(port int, log logger.Logger, ready ReadinessFunc) *Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("not ready"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready"))
+	})
+
+	return &Server{
+		httpServer: &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		mux:    mux,
+		logger: log,
+	}
+}
+
+// Handle registers an additional handler for pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleDebugConfig exposes GET /debug/config replying with config as JSON;
+// config must already be sanitized, as it is served as is
+func (s *Server) HandleDebugConfig(config interface{}) {
+	s.mux.HandleFunc("/debug/config", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(config); err != nil {
+			s.logger.Error("Failed to encode debug config", "error", err)
+		}
+	})
+}
+
+// Pauser can stop and restart message consumption
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+// HandlePause exposes POST /pause and POST /resume controlling pauser
+func (s *Server) HandlePause(pauser Pauser) {
+	s.mux.HandleFunc("/pause", s.pauseHandler("paused", pauser.Pause))
+	s.mux.HandleFunc("/resume", s.pauseHandler("resumed", pauser.Resume))
+}
+
+// pauseHandler runs action on POST requests and replies with state
+func (s *Server) pauseHandler(state string, action func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		action()
+		s.logger.Info("Consumption "+state+" over HTTP", "remoteAddr", r.RemoteAddr)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(state))
+	}
+}
+
+// Handler returns the HTTP handler serving the health endpoints
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Start starts serving and blocks until the server is shut down
+func (s *Server) Start() error {
+	s.logger.Info("Starting health server", "addr", s.httpServer.Addr)
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("health server failed: %w", err)
+	}
+	return nil
+}
+
+// Shutdown gracefully stops the server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
@@ -0,0 +1,139 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"transaction-consumer/internal/infrastructures/config"
+	"transaction-consumer/pkg/logger"
+)
+
+// Mock logger for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, args ...interface{}) {}
+func (m *mockLogger) Info(msg string, args ...interface{})  {}
+func (m *mockLogger) Warn(msg string, args ...interface{})  {}
+func (m *mockLogger) Error(msg string, args ...interface{}) {}
+func (m *mockLogger) Fatal(msg string, args ...interface{}) {}
+
+func TestServer_Healthz(t *testing.T) {
+	server := NewServer(0, &mockLogger{}, func() bool { return false })
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
+
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
+func TestServer_Readyz(t *testing.T) {
+	tests := []struct {
+		name     string
+		ready    bool
+		expected int
+	}{
+		{"ready", true, http.StatusOK},
+		{"not ready", false, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(0, &mockLogger{}, func() bool { return tt.ready })
+
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
+
+type mockPauser struct {
+	paused bool
+}
+
+func (m *mockPauser) Pause()  { m.paused = true }
+func (m *mockPauser) Resume() { m.paused = false }
+
+func TestServer_HandlePause(t *testing.T) {
+	pauser := &mockPauser{}
+	server := NewServer(0, &mockLogger{}, func() bool { return true })
+	server.HandlePause(pauser)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pause", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if !pauser.paused {
+		t.Error("Expected POST /pause to pause")
+	}
+
+	rec = httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/resume", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+	if pauser.paused {
+		t.Error("Expected POST /resume to resume")
+	}
+}
+
+func TestServer_HandlePause_RequiresPost(t *testing.T) {
+	pauser := &mockPauser{}
+	server := NewServer(0, &mockLogger{}, func() bool { return true })
+	server.HandlePause(pauser)
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pause", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+	if pauser.paused {
+		t.Error("Expected GET /pause not to pause")
+	}
+}
+
+func TestServer_HandleDebugConfig(t *testing.T) {
+	cfg := &config.Config{
+		Kafka:    config.KafkaConfig{Topic: "transactions", SASLPassword: "sasl-secret"},
+		Database: config.DatabaseConfig{User: "testuser", Password: "testpass"},
+	}
+	server := NewServer(0, &mockLogger{}, func() bool { return true })
+	server.HandleDebugConfig(cfg.Sanitized())
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "testpass") || strings.Contains(body, "sasl-secret") {
+		t.Errorf("Expected passwords to be masked, got: %s", body)
+	}
+	if !strings.Contains(body, "[REDACTED]") || !strings.Contains(body, "transactions") {
+		t.Errorf("Expected the sanitized configuration, got: %s", body)
+	}
+}
+
+func TestServer_HandleDebugConfig_NotRegistered(t *testing.T) {
+	server := NewServer(0, &mockLogger{}, func() bool { return true })
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 unless registered, got %d", rec.Code)
+	}
+}
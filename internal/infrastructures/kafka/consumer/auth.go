@@ -0,0 +1,117 @@
+package consumer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"os"
+	"strings"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+)
+
+// SASL mechanisms supported for broker authentication
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismScramSHA256 = "SCRAM-SHA-256"
+	SASLMechanismScramSHA512 = "SCRAM-SHA-512"
+)
+
+// defaultClientID prefixes the hostname in client IDs derived from it
+const defaultClientID = "transaction-consumer"
+
+// clientID returns the configured client ID, or one derived from the
+// hostname so every instance is told apart in broker metrics
+func clientID(cfg config.KafkaConfig) string {
+	if cfg.ClientID != "" {
+		return cfg.ClientID
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return defaultClientID
+	}
+	return defaultClientID + "-" + hostname
+}
+
+// newDialer builds the dialer used by the reader to reach the brokers
+func newDialer(cfg config.KafkaConfig) (*kafka.Dialer, error) {
+	mechanism, err := saslMechanism(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		ClientID:      clientID(cfg),
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		SASLMechanism: mechanism,
+		TLS:           tlsCfg,
+	}, nil
+}
+
+// newTransport builds the transport used by writers to reach the brokers
+func newTransport(cfg config.KafkaConfig) (*kafka.Transport, error) {
+	mechanism, err := saslMechanism(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		ClientID: clientID(cfg),
+		SASL:     mechanism,
+		TLS:      tlsCfg,
+	}, nil
+}
+
+// saslMechanism returns the configured SASL mechanism, or nil when SASL is
+// disabled
+func saslMechanism(cfg config.KafkaConfig) (sasl.Mechanism, error) {
+	switch strings.ToUpper(cfg.SASLMechanism) {
+	case "":
+		return nil, nil
+	case SASLMechanismPlain:
+		return plain.Mechanism{Username: cfg.SASLUsername, Password: cfg.SASLPassword}, nil
+	case SASLMechanismScramSHA256:
+		return scram.Mechanism(scram.SHA256, cfg.SASLUsername, cfg.SASLPassword)
+	case SASLMechanismScramSHA512:
+		return scram.Mechanism(scram.SHA512, cfg.SASLUsername, cfg.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", cfg.SASLMechanism)
+	}
+}
+
+// tlsConfig returns the TLS configuration for broker connections, or nil when
+// TLS is disabled; an optional CA file replaces the system roots
+func tlsConfig(cfg config.KafkaConfig) (*tls.Config, error) {
+	if !cfg.TLSEnabled {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSCAPath == "" {
+		return tlsCfg, nil
+	}
+
+	caPEM, err := os.ReadFile(cfg.TLSCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kafka CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in Kafka CA file %s", cfg.TLSCAPath)
+	}
+	tlsCfg.RootCAs = pool
+	return tlsCfg, nil
+}
@@ -0,0 +1,153 @@
+package consumer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+)
+
+func TestNewDialer_SASLMechanisms(t *testing.T) {
+	tests := []struct {
+		mechanism string
+		expected  string
+	}{
+		{"", ""},
+		{"PLAIN", SASLMechanismPlain},
+		{"SCRAM-SHA-256", SASLMechanismScramSHA256},
+		{"scram-sha-512", SASLMechanismScramSHA512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mechanism, func(t *testing.T) {
+			dialer, err := newDialer(config.KafkaConfig{
+				SASLMechanism: tt.mechanism,
+				SASLUsername:  "consumer",
+				SASLPassword:  "secret",
+			})
+			if err != nil {
+				t.Fatalf("newDialer should not return error, got: %v", err)
+			}
+
+			if tt.expected == "" {
+				if dialer.SASLMechanism != nil {
+					t.Errorf("Expected no SASL mechanism, got %s", dialer.SASLMechanism.Name())
+				}
+				return
+			}
+			if dialer.SASLMechanism == nil || dialer.SASLMechanism.Name() != tt.expected {
+				t.Errorf("Expected SASL mechanism %s, got %v", tt.expected, dialer.SASLMechanism)
+			}
+		})
+	}
+}
+
+func TestNewDialer_UnsupportedMechanism(t *testing.T) {
+	if _, err := newDialer(config.KafkaConfig{SASLMechanism: "GSSAPI"}); err == nil {
+		t.Error("newDialer should reject unsupported SASL mechanisms")
+	}
+}
+
+func TestNewDialer_TLS(t *testing.T) {
+	dialer, err := newDialer(config.KafkaConfig{})
+	if err != nil {
+		t.Fatalf("newDialer should not return error, got: %v", err)
+	}
+	if dialer.TLS != nil {
+		t.Error("TLS should be disabled by default")
+	}
+
+	dialer, err = newDialer(config.KafkaConfig{TLSEnabled: true})
+	if err != nil {
+		t.Fatalf("newDialer should not return error, got: %v", err)
+	}
+	if dialer.TLS == nil || dialer.TLS.RootCAs != nil {
+		t.Error("Expected TLS with system roots")
+	}
+
+	dialer, err = newDialer(config.KafkaConfig{TLSEnabled: true, TLSCAPath: writeTestCA(t)})
+	if err != nil {
+		t.Fatalf("newDialer should not return error, got: %v", err)
+	}
+	if dialer.TLS == nil || dialer.TLS.RootCAs == nil {
+		t.Error("Expected TLS with the configured CA")
+	}
+}
+
+func TestNewDialer_InvalidCA(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+	if _, err := newDialer(config.KafkaConfig{TLSEnabled: true, TLSCAPath: missing}); err == nil {
+		t.Error("newDialer should fail when the CA file is missing")
+	}
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	if err := os.WriteFile(invalid, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	if _, err := newDialer(config.KafkaConfig{TLSEnabled: true, TLSCAPath: invalid}); err == nil {
+		t.Error("newDialer should fail when the CA file has no certificates")
+	}
+}
+
+func TestNewTransport_UsesAuthentication(t *testing.T) {
+	transport, err := newTransport(config.KafkaConfig{
+		SASLMechanism: "SCRAM-SHA-512",
+		SASLUsername:  "consumer",
+		SASLPassword:  "secret",
+		TLSEnabled:    true,
+	})
+	if err != nil {
+		t.Fatalf("newTransport should not return error, got: %v", err)
+	}
+	if transport.SASL == nil || transport.SASL.Name() != SASLMechanismScramSHA512 {
+		t.Errorf("Expected SCRAM-SHA-512 transport, got %v", transport.SASL)
+	}
+	if transport.TLS == nil {
+		t.Error("Expected TLS transport")
+	}
+}
+
+func TestNewTransport_ClientID(t *testing.T) {
+	transport, err := newTransport(config.KafkaConfig{ClientID: "consumer-a"})
+	if err != nil {
+		t.Fatalf("newTransport should not return error, got: %v", err)
+	}
+	if transport.ClientID != "consumer-a" {
+		t.Errorf("Expected client ID consumer-a, got %q", transport.ClientID)
+	}
+}
+
+// writeTestCA writes a self-signed CA certificate and returns its path
+func writeTestCA(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SRVPrefix marks a KAFKA_BROKERS entry naming the DNS SRV record the brokers
+// are discovered from, e.g. "srv+_kafka._tcp.example.com"
+const SRVPrefix = "srv+"
+
+// SRVResolver looks up DNS SRV records; net.DefaultResolver satisfies it
+type SRVResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// ResolveBrokers expands brokers made of a single SRVPrefix entry into the
+// host:port of every target of that SRV record, in the order the resolver
+// returns them; any other brokers are host:port literals returned as is
+func ResolveBrokers(ctx context.Context, brokers []string, resolver SRVResolver) ([]string, error) {
+	if len(brokers) != 1 || !strings.HasPrefix(brokers[0], SRVPrefix) {
+		return brokers, nil
+	}
+
+	name := strings.TrimPrefix(brokers[0], SRVPrefix)
+	_, records, err := resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up SRV record %s: %w", name, err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("SRV record %s has no targets", name)
+	}
+
+	resolved := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		resolved = append(resolved, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	return resolved, nil
+}
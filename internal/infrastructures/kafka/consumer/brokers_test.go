@@ -0,0 +1,101 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// stubResolver answers SRV lookups from records keyed by name
+type stubResolver struct {
+	records map[string][]*net.SRV
+	lookups []string
+}
+
+func (r *stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups = append(r.lookups, name)
+	records, ok := r.records[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, records, nil
+}
+
+func TestResolveBrokers(t *testing.T) {
+	resolver := &stubResolver{records: map[string][]*net.SRV{
+		"_kafka._tcp.example.com": {
+			{Target: "broker-1.example.com.", Port: 9092},
+			{Target: "broker-2.example.com.", Port: 9093},
+		},
+		"_empty._tcp.example.com": {},
+	}}
+
+	tests := []struct {
+		name        string
+		brokers     []string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "srv record",
+			brokers:  []string{"srv+_kafka._tcp.example.com"},
+			expected: []string{"broker-1.example.com:9092", "broker-2.example.com:9093"},
+		},
+		{
+			name:     "host:port literals",
+			brokers:  []string{"broker-1:9092", "broker-2:9092"},
+			expected: []string{"broker-1:9092", "broker-2:9092"},
+		},
+		{
+			name:        "unknown srv record",
+			brokers:     []string{"srv+_kafka._tcp.unknown.com"},
+			expectError: true,
+		},
+		{
+			name:        "srv record without targets",
+			brokers:     []string{"srv+_empty._tcp.example.com"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brokers, err := ResolveBrokers(context.Background(), tt.brokers, resolver)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got brokers %v", brokers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveBrokers() error: %v", err)
+			}
+			if !reflect.DeepEqual(brokers, tt.expected) {
+				t.Errorf("Expected brokers %v, got %v", tt.expected, brokers)
+			}
+		})
+	}
+}
+
+func TestResolveBrokers_LiteralsSkipLookup(t *testing.T) {
+	resolver := &stubResolver{}
+
+	if _, err := ResolveBrokers(context.Background(), []string{"localhost:9092"}, resolver); err != nil {
+		t.Fatalf("ResolveBrokers() error: %v", err)
+	}
+	if len(resolver.lookups) != 0 {
+		t.Errorf("Expected no SRV lookup for host:port literals, got %v", resolver.lookups)
+	}
+}
+
+func TestResolveBrokers_WrapsLookupError(t *testing.T) {
+	resolver := &stubResolver{}
+
+	_, err := ResolveBrokers(context.Background(), []string{"srv+_kafka._tcp.example.com"}, resolver)
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		t.Errorf("Expected the DNS error to be wrapped, got: %v", err)
+	}
+}
@@ -3,74 +3,960 @@ package consumer
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"transaction-consumer/internal/infrastructures/config"
+	"transaction-consumer/internal/infrastructures/metrics"
 	"transaction-consumer/pkg/logger"
 )
 
+// messageReader is the subset of kafka.Reader used by the consumer
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Config() kafka.ReaderConfig
+	Stats() kafka.ReaderStats
+	Close() error
+}
+
+// defaultFetchBackoff is the wait after a failed fetch when none is configured
+const defaultFetchBackoff = time.Second
+
+// maxRetryBackoff caps the wait between retries of a failing message
+const maxRetryBackoff = 30 * time.Second
+
+// Policies for messages the handler rejects with a permanent error
+const (
+	InvalidMessageSkip       = "skip"
+	InvalidMessageDeadLetter = "dlq"
+	InvalidMessageFail       = "fail"
+)
+
+// Processing orders of the worker pool: OrderingKeyed never processes two
+// messages with the same key, or of the same partition when unkeyed, at once,
+// OrderingStrict serializes every partition and OrderingBestEffort processes
+// any queued message concurrently, possibly out of order
+const (
+	OrderingKeyed      = "keyed"
+	OrderingStrict     = "strict"
+	OrderingBestEffort = "best-effort"
+)
+
+// ReasonRetriesExhausted marks dead-lettered messages that kept failing with
+// errors that are not permanent
+const ReasonRetriesExhausted = "retries_exhausted"
+
 // Consumer represents Kafka consumer
 type Consumer struct {
-	reader *kafka.Reader
-	logger logger.Logger
+	reader     messageReader
+	clientID   string
+	logger     logger.Logger
+	ready      atomic.Bool
+	deadLetter DeadLetterPublisher
+	propagator propagation.TextMapPropagator
+
+	exitOnUnknownTopic  bool
+	unknownTopicBackoff time.Duration
+	fetchBackoffInitial time.Duration
+	fetchBackoffMax     time.Duration
+	sleep               func(ctx context.Context, d time.Duration) bool
+
+	maxRetries          int
+	retryBackoffInitial time.Duration
+	invalidPolicy       string
+
+	// processTimeout cancels the handler context of an attempt running
+	// longer when positive, failing it with a retryable error
+	processTimeout time.Duration
+
+	workers   int
+	queueSize int
+	priority  PriorityFunc
+	ordering  string
+
+	// inFlight bounds the messages fetched but not yet processed when set;
+	// fetching blocks while all of its slots are taken
+	inFlight chan struct{}
+
+	offsetStore OffsetStore
+	processed   map[int]int64
+
+	// commitInterval batches commits per partition when positive; otherwise
+	// every message is committed synchronously
+	commitInterval time.Duration
+	pendingMu      sync.Mutex
+	pending        map[int]kafka.Message
+
+	// commitEveryN also batches commits when positive, committing a
+	// partition as soon as N of its messages are stashed; pendingCount holds
+	// the stashed messages per partition, guarded by pendingMu
+	commitEveryN int
+	pendingCount map[int]int
+
+	// revoked holds the partitions a rebalance took away, guarded by
+	// pendingMu; their commits are dropped until they are fetched from again
+	revoked map[int]struct{}
+
+	// lagInterval reports lagSource periodically when positive
+	lagInterval time.Duration
+	lagSource   lagSource
+	lag         *partitionLag
+
+	// maxMessages stops consumption once that many messages were handed to
+	// the handler when positive
+	maxMessages int
+
+	// statsInterval logs the reader statistics periodically when positive
+	statsInterval time.Duration
+
+	// sessionProcessed counts the messages handled successfully since
+	// Consume started
+	sessionProcessed atomic.Int64
+
+	// paused stops the consume loop before its next fetch; resumed is
+	// broadcast when it is cleared or the consume context ends
+	paused    atomic.Bool
+	pauseMu   sync.Mutex
+	pauseOnce sync.Once
+	resumed   *sync.Cond
+}
+
+// OffsetStore provides the offsets already processed per partition, as
+// persisted alongside the processed transactions
+type OffsetStore interface {
+	GetLastOffsets(ctx context.Context, topic string) (map[int]int64, error)
 }
 
 // MessageHandler defines the function signature for message handling
-type MessageHandler func(ctx context.Context, message []byte) error
+type MessageHandler func(ctx context.Context, message ConsumedMessage) error
+
+// Option configures optional behaviour of the consumer
+type Option func(*Consumer)
+
+// WithDeadLetterPublisher routes permanently failing messages to publisher
+func WithDeadLetterPublisher(publisher DeadLetterPublisher) Option {
+	return func(c *Consumer) {
+		c.deadLetter = publisher
+	}
+}
+
+// WithPropagator sets the propagator used to extract trace context from
+// message headers
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *Consumer) {
+		c.propagator = propagator
+	}
+}
+
+// WithPriority dispatches queued messages to workers by priority
+func WithPriority(priority PriorityFunc) Option {
+	return func(c *Consumer) {
+		c.priority = priority
+	}
+}
+
+// WithMaxInFlight caps the messages being processed at once to limit, such
+// as the size of the database connection pool, so concurrent workers wait
+// for a slot before fetching instead of queueing on connections; a limit
+// below 1 disables the cap
+func WithMaxInFlight(limit int) Option {
+	return func(c *Consumer) {
+		if limit < 1 {
+			c.inFlight = nil
+			return
+		}
+		c.inFlight = make(chan struct{}, limit)
+	}
+}
+
+// WithOffsetStore skips messages at or below the offsets recorded in store,
+// so messages persisted just before a crash are not processed again
+func WithOffsetStore(store OffsetStore) Option {
+	return func(c *Consumer) {
+		c.offsetStore = store
+	}
+}
+
+// WithInvalidMessagePolicy sets what happens to messages rejected with a
+// permanent error: InvalidMessageSkip commits them, InvalidMessageDeadLetter
+// dead-letters them first and InvalidMessageFail stops Consume with the error.
+// An empty policy dead-letters them when a dead letter publisher is set and
+// skips them otherwise
+func WithInvalidMessagePolicy(policy string) Option {
+	return func(c *Consumer) {
+		c.invalidPolicy = strings.ToLower(policy)
+	}
+}
+
+// WithOrdering sets the processing order of the worker pool, OrderingKeyed
+// unless changed; it has no effect with a single worker, which processes
+// messages in fetch order
+func WithOrdering(ordering string) Option {
+	return func(c *Consumer) {
+		c.ordering = strings.ToLower(ordering)
+	}
+}
 
 // NewConsumer creates a new Kafka consumer
-func NewConsumer(cfg config.KafkaConfig, log logger.Logger) (*Consumer, error) {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        cfg.Brokers,
-		GroupID:        cfg.GroupID,
-		Topic:          cfg.Topic,
-		MaxBytes:       cfg.MaxBytes,
-		CommitInterval: cfg.CommitInterval,
+func NewConsumer(cfg config.KafkaConfig, log logger.Logger, opts ...Option) (*Consumer, error) {
+	dialer, err := newDialer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kafka authentication: %w", err)
+	}
+
+	readerCfg := kafka.ReaderConfig{
+		Brokers:  cfg.Brokers,
+		Dialer:   dialer,
+		GroupID:  cfg.GroupID,
+		Topic:    cfg.Topic,
+		MinBytes: cfg.MinBytes,
+		MaxBytes: cfg.MaxBytes,
+		MaxWait:  cfg.MaxWait,
+		// Zero values keep the kafka-go defaults
+		SessionTimeout:    cfg.SessionTimeout,
+		RebalanceTimeout:  cfg.RebalanceTimeout,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		// Commits are batched by the consumer itself, so the reader commits
+		// synchronously whenever asked
+		CommitInterval: 0,
 		StartOffset:    kafka.LastOffset,
 		ErrorLogger:    kafka.LoggerFunc(log.Error),
-	})
+	}
+	// NewReader panics on an invalid configuration, e.g. MinBytes above
+	// MaxBytes
+	if err := readerCfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid Kafka reader configuration: %w", err)
+	}
+	reader := kafka.NewReader(readerCfg)
 
-	return &Consumer{
-		reader: reader,
-		logger: log,
-	}, nil
+	c := &Consumer{
+		reader:              reader,
+		clientID:            dialer.ClientID,
+		logger:              log,
+		exitOnUnknownTopic:  strings.EqualFold(cfg.UnknownTopicPolicy, "exit"),
+		unknownTopicBackoff: cfg.UnknownTopicBackoff,
+		fetchBackoffInitial: cfg.FetchBackoffInitial,
+		fetchBackoffMax:     cfg.FetchBackoffMax,
+		sleep:               sleepContext,
+		propagator:          propagation.TraceContext{},
+		workers:             cfg.Workers,
+		queueSize:           cfg.WorkerQueueSize,
+		lagInterval:         cfg.LagReportInterval,
+		statsInterval:       cfg.StatsLogInterval,
+		maxRetries:          cfg.MaxRetries,
+		retryBackoffInitial: cfg.RetryBackoff,
+		processTimeout:      cfg.ProcessTimeout,
+		maxMessages:         cfg.MaxMessages,
+	}
+	if !strings.EqualFold(cfg.CommitStrategy, "sync") {
+		c.commitInterval = cfg.CommitInterval
+		c.commitEveryN = cfg.CommitEveryN
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
 // Consume starts consuming messages
-func (c *Consumer) Consume(ctx context.Context, handler MessageHandler) error {
-	c.logger.Info("Starting Kafka consumer", "topic", c.reader.Config().Topic)
+func (c *Consumer) Consume(parent context.Context, handler MessageHandler) (err error) {
+	// An invalid message under the fail policy stops consumption through the
+	// cancellation cause of ctx
+	ctx, stop := context.WithCancelCause(parent)
+	defer stop(nil)
+	defer func() {
+		if cause := context.Cause(ctx); parent.Err() == nil && cause != nil && !errors.Is(cause, context.Canceled) {
+			err = cause
+		}
+	}()
+
+	topic := c.reader.Config().Topic
+	c.logger.Info("Starting Kafka consumer", "topic", topic, "clientID", c.clientID)
+
+	// Registered first so the workers have stopped and the count is final
+	started := time.Now()
+	c.sessionProcessed.Store(0)
+	defer func() {
+		c.logger.Info("Kafka consumer stopped", "topic", topic,
+			"processed", c.sessionProcessed.Load(),
+			"uptime", time.Since(started).Round(time.Millisecond))
+	}()
+
+	// Consumer groups cannot seek explicitly, so resume from the persisted
+	// offsets by skipping everything at or below them
+	if c.offsetStore != nil {
+		processed, err := c.offsetStore.GetLastOffsets(ctx, topic)
+		if err != nil {
+			return fmt.Errorf("failed to load processed offsets: %w", err)
+		}
+		c.processed = processed
+		c.logger.Info("Loaded processed offsets", "topic", topic, "partitions", len(processed))
+	}
 
+	c.ready.Store(true)
+	defer c.ready.Store(false)
+
+	if c.lagInterval > 0 {
+		if c.lagSource == nil {
+			c.lag = newPartitionLag()
+			c.lagSource = c.lag
+		}
+		c.startLagReporter(ctx)
+	}
+
+	if c.statsInterval > 0 {
+		stopStats := c.startStatsLogger(ctx)
+		defer stopStats()
+	}
+
+	stopWaking := context.AfterFunc(ctx, c.wakePaused)
+	defer stopWaking()
+
+	if c.batchesCommits() {
+		stopFlusher := c.startCommitFlusher(ctx)
+		defer stopFlusher()
+	}
+
+	dispatch := func(message kafka.Message) {
+		defer c.releaseSlot()
+		settled, err := c.processMessage(ctx, handler, message)
+		if err != nil {
+			stop(err)
+			return
+		}
+		if settled {
+			c.commit(ctx, message)
+		}
+	}
+	// finish lets the dispatched messages complete before consumption ends
+	// on its own
+	finish := func() {}
+	if c.workers > 1 {
+		pool := c.startWorkerPool(ctx, handler, stop)
+		defer pool.stop()
+		dispatch = func(message kafka.Message) {
+			if !pool.submit(message) {
+				c.releaseSlot()
+			}
+		}
+		finish = pool.drain
+	}
+
+	var fetchBackoff time.Duration
+	dispatched := 0
 	for {
 		select {
 		case <-ctx.Done():
 			c.logger.Info("Consumer context cancelled, stopping...")
 			return ctx.Err()
 		default:
+			if !c.waitWhilePaused(ctx) {
+				c.logger.Info("Consumer context cancelled while paused, stopping...")
+				return ctx.Err()
+			}
+			if !c.acquireSlot(ctx) {
+				c.logger.Info("Consumer context cancelled while waiting for an in-flight slot, stopping...")
+				return ctx.Err()
+			}
+
 			message, err := c.reader.FetchMessage(ctx)
 			if err != nil {
+				c.releaseSlot()
 				if errors.Is(err, context.Canceled) {
 					return nil
 				}
-				c.logger.Error("Failed to fetch message", "error", err)
-				time.Sleep(time.Second) // Backoff
+				if isReaderClosed(err) {
+					c.logger.Info("Kafka reader closed, stopping consumer", "error", err)
+					return nil
+				}
+				if errors.Is(err, kafka.UnknownTopicOrPartition) {
+					c.ready.Store(false)
+					if c.exitOnUnknownTopic {
+						c.logger.Error("Kafka topic does not exist, stopping consumer", "topic", topic, "error", err)
+						return fmt.Errorf("topic %s is unavailable: %w", topic, err)
+					}
+					c.logger.Error("Kafka topic does not exist, backing off",
+						"topic", topic, "backoff", c.unknownTopicBackoff, "error", err)
+					if !c.sleep(ctx, c.unknownTopicBackoff) {
+						return nil
+					}
+					continue
+				}
+				fetchBackoff = c.nextFetchBackoff(fetchBackoff)
+				if isRebalance(err) {
+					c.logger.Warn("Consumer group rebalance in progress, refetching after backoff",
+						"backoff", fetchBackoff, "error", err)
+				} else {
+					c.logger.Error("Failed to fetch message, backing off", "backoff", fetchBackoff, "error", err)
+				}
+				if !c.sleep(ctx, fetchBackoff) {
+					return nil
+				}
+				continue
+			}
+			fetchBackoff = 0
+			c.ready.Store(true)
+			c.reassign(message.Partition)
+
+			if c.alreadyProcessed(message) {
+				c.logger.Debug("Skipping already processed message",
+					"partition", message.Partition, "offset", message.Offset)
+				c.commit(ctx, message)
+				c.releaseSlot()
 				continue
 			}
 
-			// Process message
-			if err := handler(ctx, message.Value); err != nil {
-				c.logger.Error("Failed to process message", "error", err)
-				// Continue processing other messages
+			dispatch(message)
+
+			dispatched++
+			if c.maxMessages > 0 && dispatched >= c.maxMessages {
+				finish()
+				c.logger.Info("Processed the maximum number of messages, stopping consumer",
+					"maxMessages", c.maxMessages)
+				return nil
+			}
+		}
+	}
+}
+
+// nextFetchBackoff returns the wait after a failed fetch given the previous
+// one, doubling it up to the configured maximum
+func (c *Consumer) nextFetchBackoff(previous time.Duration) time.Duration {
+	initial, maximum := c.fetchBackoffInitial, c.fetchBackoffMax
+	if initial <= 0 {
+		initial = defaultFetchBackoff
+	}
+	if maximum < initial {
+		maximum = initial
+	}
+
+	if previous <= 0 {
+		return initial
+	}
+	if next := previous * 2; next < maximum {
+		return next
+	}
+	return maximum
+}
+
+// processMessage runs handler for a single message, retrying failures that
+// are not permanent, and dead-letters it when it fails permanently or runs out
+// of retries; failures of an unavailable dependency are retried without
+// using up retries. It reports whether the message is settled and may be
+// committed, which is not the case when ctx ends before it succeeds or it
+// cannot be dead-lettered, and returns an error when the message must stop
+// consumption
+func (c *Consumer) processMessage(ctx context.Context, handler MessageHandler, message kafka.Message) (bool, error) {
+	// Process message within the producer's trace, if any, and scope its
+	// logs to the message position
+	msgLogger := c.logger.With("partition", message.Partition, "offset", message.Offset)
+	msgCtx := c.propagator.Extract(ctx, headerCarrier(message.Headers))
+	msgCtx = logger.NewContext(msgCtx, msgLogger)
+
+	retries := 0
+	for attempt := 0; ; attempt++ {
+		err := c.handle(msgCtx, handler, message, c.maxRetries-retries)
+		if err == nil {
+			c.sessionProcessed.Add(1)
+			return true, nil
+		}
+		msgLogger.Error("Failed to process message", "error", err, "attempt", attempt+1)
+
+		if reason, ok := IsPermanent(err); ok {
+			return c.rejectMessage(msgCtx, message, reason, err, attempt+1)
+		}
+		if ctx.Err() != nil {
+			return false, nil
+		}
+		if !IsUnavailable(err) {
+			if retries >= c.maxRetries {
+				return c.deadLetterMessage(msgCtx, message, ReasonRetriesExhausted, err, attempt+1)
+			}
+			retries++
+		}
+
+		backoff := c.retryBackoff(attempt)
+		metrics.ProcessingRetries.Inc()
+		msgLogger.Warn("Retrying message", "attempt", attempt+2, "backoff", backoff)
+		if !c.sleep(ctx, backoff) {
+			return false, nil
+		}
+	}
+}
+
+// handle runs a single processing attempt of message with retriesLeft
+// retries after it, cancelling it once it exceeds the processing timeout
+func (c *Consumer) handle(ctx context.Context, handler MessageHandler, message kafka.Message, retriesLeft int) error {
+	consumed := newConsumedMessage(message)
+	consumed.RetriesLeft = max(retriesLeft, 0)
+	if c.processTimeout <= 0 {
+		return handler(ctx, consumed)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, c.processTimeout)
+	defer cancel()
+
+	err := handler(attemptCtx, consumed)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		metrics.ProcessingTimeouts.Inc()
+		logger.FromContext(ctx, c.logger).Warn("Message processing timed out", "timeout", c.processTimeout)
+		return fmt.Errorf("processing timed out after %s: %w", c.processTimeout, err)
+	}
+	return err
+}
+
+// rejectMessage applies the invalid message policy to a message that failed
+// permanently after attempts, with the same results as processMessage; ctx
+// carries the logger scoped to the message
+func (c *Consumer) rejectMessage(ctx context.Context, message kafka.Message, reason string, cause error, attempts int) (bool, error) {
+	policy := c.invalidPolicy
+	if policy == "" && c.deadLetter != nil {
+		policy = InvalidMessageDeadLetter
+	}
+
+	switch policy {
+	case InvalidMessageDeadLetter:
+		return c.deadLetterMessage(ctx, message, reason, cause, attempts)
+	case InvalidMessageFail:
+		return false, fmt.Errorf("invalid message at partition %d offset %d: %w",
+			message.Partition, message.Offset, cause)
+	default:
+		logger.FromContext(ctx, c.logger).Warn("Skipping invalid message", "reason", reason)
+		return true, nil
+	}
+}
+
+// retryBackoff returns the wait before retrying a message that failed
+// attempt+1 times, doubling from the configured backoff
+func (c *Consumer) retryBackoff(attempt int) time.Duration {
+	backoff := c.retryBackoffInitial
+	for i := 0; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
+
+// alreadyProcessed reports whether message was persisted according to the
+// offsets loaded from the offset store
+func (c *Consumer) alreadyProcessed(message kafka.Message) bool {
+	last, ok := c.processed[message.Partition]
+	return ok && message.Offset <= last
+}
+
+// batchesCommits reports whether commits are stashed and flushed later
+// instead of committing every message synchronously
+func (c *Consumer) batchesCommits() bool {
+	return c.commitInterval > 0 || c.commitEveryN > 0
+}
+
+// commit commits the offset of message, either immediately or, when commits
+// are batched, on the next flush
+func (c *Consumer) commit(ctx context.Context, message kafka.Message) {
+	if c.lag != nil {
+		c.lag.record(message)
+	}
+
+	if c.isRevoked(message.Partition) {
+		c.logger.Debug("Skipping commit for revoked partition",
+			"partition", message.Partition, "offset", message.Offset)
+		return
+	}
+
+	if c.batchesCommits() {
+		if c.stashCommit(message) {
+			c.flushPartition(ctx, message.Partition)
+		}
+		return
+	}
+
+	if err := c.reader.CommitMessages(ctx, message); err != nil {
+		if isRebalance(err) {
+			c.revoke(err, message)
+			return
+		}
+		c.logger.Error("Failed to commit message", "error", err)
+	}
+}
+
+// stashCommit records message as the latest processed message of its
+// partition; it reports whether the partition stashed commitEveryN messages
+// and is due to be flushed
+func (c *Consumer) stashCommit(message kafka.Message) bool {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if _, ok := c.revoked[message.Partition]; ok {
+		return false
+	}
+	if c.pending == nil {
+		c.pending = make(map[int]kafka.Message)
+	}
+	if last, ok := c.pending[message.Partition]; !ok || message.Offset > last.Offset {
+		c.pending[message.Partition] = message
+	}
+
+	if c.commitEveryN <= 0 {
+		return false
+	}
+	if c.pendingCount == nil {
+		c.pendingCount = make(map[int]int)
+	}
+	c.pendingCount[message.Partition]++
+	return c.pendingCount[message.Partition] >= c.commitEveryN
+}
+
+// flushCommits commits the stashed offset of every partition
+func (c *Consumer) flushCommits(ctx context.Context) {
+	c.pendingMu.Lock()
+	messages := make([]kafka.Message, 0, len(c.pending))
+	for _, message := range c.pending {
+		messages = append(messages, message)
+	}
+	c.pending = nil
+	c.pendingCount = nil
+	c.pendingMu.Unlock()
+
+	c.commitStashed(ctx, messages...)
+}
+
+// flushPartition commits the stashed offset of partition only
+func (c *Consumer) flushPartition(ctx context.Context, partition int) {
+	c.pendingMu.Lock()
+	message, ok := c.pending[partition]
+	delete(c.pending, partition)
+	delete(c.pendingCount, partition)
+	c.pendingMu.Unlock()
+
+	if ok {
+		c.commitStashed(ctx, message)
+	}
+}
+
+// commitStashed commits messages taken from the stash
+func (c *Consumer) commitStashed(ctx context.Context, messages ...kafka.Message) {
+	if len(messages) == 0 {
+		return
+	}
+	if err := c.reader.CommitMessages(ctx, messages...); err != nil {
+		if isRebalance(err) {
+			c.revoke(err, messages...)
+			return
+		}
+		c.logger.Error("Failed to commit messages", "error", err, "partitions", len(messages))
+	}
+}
+
+// isReaderClosed reports whether err means the reader was closed, e.g. by
+// Close during shutdown, so no fetch can succeed anymore
+func isReaderClosed(err error) bool {
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// isRebalance reports whether err means the consumer group generation ended,
+// so the partitions being committed may have been assigned elsewhere
+func isRebalance(err error) bool {
+	return errors.Is(err, kafka.RebalanceInProgress) ||
+		errors.Is(err, kafka.IllegalGeneration) ||
+		errors.Is(err, kafka.UnknownMemberId)
+}
+
+// revoke stops committing the partitions of messages, whose commit failed
+// with the rebalance error err, and drops their stashed commits; the new
+// owner resumes from the last offset committed before the rebalance
+func (c *Consumer) revoke(err error, messages ...kafka.Message) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if c.revoked == nil {
+		c.revoked = make(map[int]struct{})
+	}
+	for _, message := range messages {
+		c.revoked[message.Partition] = struct{}{}
+		delete(c.pending, message.Partition)
+		delete(c.pendingCount, message.Partition)
+		c.logger.Warn("Consumer group rebalance revoked partition, dropping its commits",
+			"partition", message.Partition, "offset", message.Offset, "error", err)
+	}
+}
+
+// reassign resumes committing partition once a message was fetched from it
+// after a rebalance, which the reader does from its committed offset
+func (c *Consumer) reassign(partition int) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	if _, ok := c.revoked[partition]; !ok {
+		return
+	}
+	delete(c.revoked, partition)
+	c.logger.Info("Consumer group rebalance reassigned partition, resuming its commits", "partition", partition)
+}
+
+// isRevoked reports whether partition was revoked and not fetched from since
+func (c *Consumer) isRevoked(partition int) bool {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+
+	_, ok := c.revoked[partition]
+	return ok
+}
+
+// startCommitFlusher flushes stashed commits every commit interval, if any,
+// until the returned stop function is called, which performs a final flush
+func (c *Consumer) startCommitFlusher(ctx context.Context) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		if c.commitInterval <= 0 {
+			<-done
+			return
+		}
+		ticker := time.NewTicker(c.commitInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.flushCommits(ctx)
 			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+
+		// ctx is usually cancelled by now, so the final flush gets its own
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.flushCommits(flushCtx)
+	}
+}
+
+// workerPool processes messages concurrently, committing each partition only
+// up to the highest offset below which every message has completed
+type workerPool struct {
+	ctx        context.Context
+	dispatcher *dispatcher
+	tracker    *offsetTracker
+	wg         sync.WaitGroup
+}
+
+// startWorkerPool starts c.workers workers feeding from a priority dispatcher;
+// a message that must stop consumption is passed to fail
+func (c *Consumer) startWorkerPool(ctx context.Context, handler MessageHandler, fail context.CancelCauseFunc) *workerPool {
+	queueSize := c.queueSize
+	if queueSize <= 0 {
+		queueSize = c.workers
+	}
 
-			// Commit message
-			if err := c.reader.CommitMessages(ctx, message); err != nil {
-				c.logger.Error("Failed to commit message", "error", err)
+	pool := &workerPool{
+		ctx:        ctx,
+		dispatcher: newDispatcher(queueSize, c.priority, c.ordering),
+		tracker:    newOffsetTracker(),
+	}
+	for i := 0; i < c.workers; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for {
+				j := pool.dispatcher.next()
+				if j == nil {
+					return
+				}
+				settled, err := c.processMessage(ctx, handler, j.message)
+				pool.dispatcher.done(j)
+				c.releaseSlot()
+				if err != nil {
+					fail(err)
+					continue
+				}
+				if !settled {
+					// Leave the offset uncommitted so the message is redelivered
+					continue
+				}
+				if commit, ok := pool.tracker.complete(j.message); ok {
+					c.commit(ctx, commit)
+				}
 			}
+		}()
+	}
+	return pool
+}
+
+// submit hands message to the workers, blocking while the queue is saturated;
+// it reports false when the message was dropped as the pool is stopping
+func (p *workerPool) submit(message kafka.Message) bool {
+	p.tracker.track(message)
+	return p.dispatcher.submit(p.ctx, message)
+}
+
+// drain stops the workers after every queued message completes
+func (p *workerPool) drain() {
+	p.dispatcher.drain()
+	p.wg.Wait()
+}
+
+// stop stops the workers after their in-flight messages complete
+func (p *workerPool) stop() {
+	p.dispatcher.close()
+	p.wg.Wait()
+}
+
+// acquireSlot takes an in-flight slot, blocking while all are taken; it
+// reports false when ctx is done first
+func (c *Consumer) acquireSlot(ctx context.Context) bool {
+	if c.inFlight == nil {
+		return true
+	}
+	select {
+	case c.inFlight <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseSlot frees the in-flight slot of a settled or dropped message
+func (c *Consumer) releaseSlot() {
+	if c.inFlight == nil {
+		return
+	}
+	<-c.inFlight
+}
+
+// deadLetterMessage dead-letters a message failing after attempts, with the
+// same results as processMessage. The message is only settled once
+// published; committing any later offset would skip it otherwise, so
+// consumption stops for it to be redelivered, unless ctx already ended
+func (c *Consumer) deadLetterMessage(ctx context.Context, message kafka.Message, reason string, cause error, attempts int) (bool, error) {
+	if err := c.publishDeadLetter(ctx, message, reason, cause, attempts); err != nil {
+		if ctx.Err() != nil {
+			return false, nil
 		}
+		return false, fmt.Errorf("failed to dead-letter message at partition %d offset %d: %w",
+			message.Partition, message.Offset, err)
+	}
+	return true, nil
+}
+
+// publishDeadLetter routes a message failing permanently after attempts to
+// the dead letter topic, failing when none is configured
+func (c *Consumer) publishDeadLetter(ctx context.Context, message kafka.Message, reason string, cause error, attempts int) error {
+	if c.deadLetter == nil {
+		return ErrNoDeadLetterTopic
+	}
+
+	letter := DeadLetter{
+		Message:  message,
+		Reason:   reason,
+		Cause:    cause,
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	log := logger.FromContext(ctx, c.logger)
+	if err := c.deadLetter.Publish(ctx, letter); err != nil {
+		log.Error("Failed to publish message to dead letter topic", "error", err, "reason", reason)
+		return err
+	}
+
+	metrics.DeadLetterMessages.WithLabelValues(reason).Inc()
+	log.Warn("Message routed to dead letter topic", "reason", reason)
+	return nil
+}
+
+// Pause stops fetching new messages once the message currently being
+// dispatched has been handed off; group membership is kept
+func (c *Consumer) Pause() {
+	if !c.paused.Swap(true) {
+		c.logger.Info("Consumer paused")
+	}
+}
+
+// Resume restarts fetching after Pause
+func (c *Consumer) Resume() {
+	if c.paused.Swap(false) {
+		c.logger.Info("Consumer resumed")
+		c.wakePaused()
 	}
 }
 
+// IsPaused reports whether the consumer is paused
+func (c *Consumer) IsPaused() bool {
+	return c.paused.Load()
+}
+
+// pauseCond returns the condition the consume loop waits on while paused
+func (c *Consumer) pauseCond() *sync.Cond {
+	c.pauseOnce.Do(func() {
+		c.resumed = sync.NewCond(&c.pauseMu)
+	})
+	return c.resumed
+}
+
+// wakePaused wakes the consume loop if it is waiting while paused
+func (c *Consumer) wakePaused() {
+	cond := c.pauseCond()
+	cond.L.Lock()
+	defer cond.L.Unlock()
+	cond.Broadcast()
+}
+
+// waitWhilePaused blocks while the consumer is paused, reporting false when
+// ctx ends first
+func (c *Consumer) waitWhilePaused(ctx context.Context) bool {
+	cond := c.pauseCond()
+	cond.L.Lock()
+	defer cond.L.Unlock()
+
+	for c.paused.Load() && ctx.Err() == nil {
+		cond.Wait()
+	}
+	return ctx.Err() == nil
+}
+
+// Processed returns the number of messages handled successfully since
+// Consume last started
+func (c *Consumer) Processed() int64 {
+	return c.sessionProcessed.Load()
+}
+
+// IsReady reports whether the consumer is actively able to fetch messages
+func (c *Consumer) IsReady() bool {
+	return c.ready.Load()
+}
+
 // Close closes the consumer
 func (c *Consumer) Close() error {
 	return c.reader.Close()
 }
+
+// sleepContext waits for d or until ctx is done, reporting whether the full
+// duration elapsed
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
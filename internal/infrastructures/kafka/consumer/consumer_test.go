@@ -0,0 +1,1942 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+	"transaction-consumer/internal/infrastructures/metrics"
+	"transaction-consumer/pkg/logger"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Mock reader for testing
+type mockReader struct {
+	mu        sync.Mutex
+	fetches   []fetchResult
+	committed []kafka.Message
+	closed    bool
+
+	// commitErrors fail the next commits in order without committing
+	commitErrors []error
+
+	partition  int
+	statsCalls int
+}
+
+type fetchResult struct {
+	message kafka.Message
+	err     error
+}
+
+func (m *mockReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	m.mu.Lock()
+	if len(m.fetches) > 0 {
+		next := m.fetches[0]
+		m.fetches = m.fetches[1:]
+		m.mu.Unlock()
+		return next.message, next.err
+	}
+	m.mu.Unlock()
+
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (m *mockReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.commitErrors) > 0 {
+		err := m.commitErrors[0]
+		m.commitErrors = m.commitErrors[1:]
+		if err != nil {
+			return err
+		}
+	}
+	m.committed = append(m.committed, msgs...)
+	return nil
+}
+
+func (m *mockReader) Config() kafka.ReaderConfig {
+	return kafka.ReaderConfig{Topic: "test-topic", Partition: m.partition}
+}
+
+func (m *mockReader) Stats() kafka.ReaderStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statsCalls++
+	return kafka.ReaderStats{Topic: "test-topic", Partition: strconv.Itoa(m.partition), Messages: int64(len(m.committed))}
+}
+
+func (m *mockReader) Close() error {
+	m.closed = true
+	return nil
+}
+
+// Mock logger for testing
+type mockLogger struct {
+	mu        sync.Mutex
+	errorMsgs []string
+	infos     []loggedInfo
+}
+
+// loggedInfo is an info log call with its key-value pairs
+type loggedInfo struct {
+	msg  string
+	args []interface{}
+}
+
+func (m *mockLogger) Debug(msg string, args ...interface{}) {}
+func (m *mockLogger) Warn(msg string, args ...interface{})  {}
+
+func (m *mockLogger) Info(msg string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.infos = append(m.infos, loggedInfo{msg: msg, args: args})
+}
+
+func (m *mockLogger) Error(msg string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errorMsgs = append(m.errorMsgs, msg)
+}
+
+func (m *mockLogger) Fatal(msg string, args ...interface{}) {
+	m.Error(msg, args...)
+}
+
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
+func newTestConsumer(reader messageReader) *Consumer {
+	return &Consumer{
+		reader:     reader,
+		logger:     &mockLogger{},
+		sleep:      sleepContext,
+		propagator: propagation.TraceContext{},
+	}
+}
+
+func TestConsumer_Consume_ProcessesAndCommits(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("first"), Offset: 1}},
+			{message: kafka.Message{Value: []byte("second"), Offset: 2}},
+		},
+	}
+	c := newTestConsumer(reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled []string
+	err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		handled = append(handled, string(message.Value))
+		if len(handled) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(handled) != 2 {
+		t.Errorf("Expected 2 handled messages, got %d", len(handled))
+	}
+	if len(reader.committed) != 2 {
+		t.Errorf("Expected 2 committed messages, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_UnknownTopicBacksOff(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{err: kafka.UnknownTopicOrPartition},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.unknownTopicBackoff = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var slept []time.Duration
+	var readyDuringBackoff bool
+	c.sleep = func(ctx context.Context, d time.Duration) bool {
+		slept = append(slept, d)
+		readyDuringBackoff = c.IsReady()
+		cancel()
+		return false
+	}
+
+	err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		t.Error("handler should not be called")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Consume should return nil after cancellation during backoff, got: %v", err)
+	}
+
+	if len(slept) != 1 || slept[0] != time.Minute {
+		t.Errorf("Expected a single backoff of 1m, got %v", slept)
+	}
+	if readyDuringBackoff {
+		t.Error("Consumer should not be ready while the topic is unavailable")
+	}
+}
+
+func TestConsumer_Consume_UnknownTopicRestoresReadiness(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{err: kafka.UnknownTopicOrPartition},
+			{message: kafka.Message{Value: []byte("after-recreate")}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.sleep = func(ctx context.Context, d time.Duration) bool { return true }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var readyWhileHandling bool
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		readyWhileHandling = c.IsReady()
+		cancel()
+		return nil
+	})
+
+	if !readyWhileHandling {
+		t.Error("Consumer should be ready again once fetching succeeds")
+	}
+	if c.IsReady() {
+		t.Error("Consumer should not be ready after Consume returns")
+	}
+}
+
+func TestConsumer_Consume_UnknownTopicExitPolicy(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{err: kafka.UnknownTopicOrPartition},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.exitOnUnknownTopic = true
+	c.sleep = func(ctx context.Context, d time.Duration) bool {
+		t.Error("exit policy should not back off")
+		return true
+	}
+
+	err := c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+		return nil
+	})
+	if !errors.Is(err, kafka.UnknownTopicOrPartition) {
+		t.Errorf("Expected unknown topic error, got: %v", err)
+	}
+	if c.IsReady() {
+		t.Error("Consumer should not be ready after exiting on unknown topic")
+	}
+}
+
+func TestSleepContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if sleepContext(ctx, time.Hour) {
+		t.Error("sleepContext should return false when context is cancelled")
+	}
+}
+
+// Mock dead letter publisher for testing
+type mockDeadLetterPublisher struct {
+	published []kafka.Message
+	reasons   []string
+	letters   []DeadLetter
+	onPublish func()
+	err       error
+}
+
+func (m *mockDeadLetterPublisher) Publish(ctx context.Context, letter DeadLetter) error {
+	m.published = append(m.published, letter.Message)
+	m.reasons = append(m.reasons, letter.Reason)
+	m.letters = append(m.letters, letter)
+	if m.onPublish != nil {
+		m.onPublish()
+	}
+	if m.err != nil {
+		return m.err
+	}
+	return nil
+}
+
+func (m *mockDeadLetterPublisher) Close() error {
+	return nil
+}
+
+func TestConsumer_Consume_RoutesPermanentErrorsToDeadLetter(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte(`{"amount":`), Offset: 1}},
+			{message: kafka.Message{Value: []byte("transient"), Offset: 2}},
+		},
+	}
+	deadLetter := &mockDeadLetterPublisher{}
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(deadLetter)(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		calls++
+		if calls == 2 {
+			cancel()
+			return errors.New("database unavailable")
+		}
+		return NewPermanentError("truncated", errors.New("truncated message"))
+	})
+
+	if len(deadLetter.published) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(deadLetter.published))
+	}
+	if deadLetter.reasons[0] != "truncated" || deadLetter.published[0].Offset != 1 {
+		t.Errorf("Unexpected dead letter: reason=%s offset=%d", deadLetter.reasons[0], deadLetter.published[0].Offset)
+	}
+}
+
+func TestConsumer_Consume_ProcessTimeoutRetriesStuckHandler(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("stuck"), Offset: 1}},
+		},
+	}
+	deadLetter := &mockDeadLetterPublisher{}
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(deadLetter)(c)
+	c.maxRetries = 1
+	c.processTimeout = 10 * time.Millisecond
+	c.sleep = func(ctx context.Context, d time.Duration) bool { return true }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	before := testutil.ToFloat64(metrics.ProcessingTimeouts)
+	calls := 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		calls++
+		if calls == 1 {
+			// Hang past the deadline, like a database call without a timeout
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				t.Error("Expected the processing timeout to cancel the handler")
+				return nil
+			}
+		}
+		cancel()
+		return nil
+	})
+
+	if calls != 2 {
+		t.Errorf("Expected the timed out attempt to be retried, got %d attempts", calls)
+	}
+	if got := testutil.ToFloat64(metrics.ProcessingTimeouts) - before; got != 1 {
+		t.Errorf("Expected 1 processing timeout to be counted, got %v", got)
+	}
+	if len(deadLetter.published) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(deadLetter.published))
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected the message to be committed after the retry, got %d commits", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_RetriesTransientErrors(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("flaky"), Offset: 1}},
+		},
+	}
+	deadLetter := &mockDeadLetterPublisher{}
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(deadLetter)(c)
+	c.maxRetries = 3
+	c.retryBackoffInitial = 10 * time.Millisecond
+
+	var waits []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) bool {
+		waits = append(waits, d)
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		calls++
+		if calls < 3 {
+			return errors.New("database unavailable")
+		}
+		cancel()
+		return nil
+	})
+
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}
+	if len(waits) != len(expected) || waits[0] != expected[0] || waits[1] != expected[1] {
+		t.Errorf("Expected retry backoffs %v, got %v", expected, waits)
+	}
+	if len(deadLetter.published) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(deadLetter.published))
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected 1 committed message, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_DeadLettersAfterRetriesExhausted(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("broken"), Offset: 1}},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deadLetter := &mockDeadLetterPublisher{onPublish: cancel}
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(deadLetter)(c)
+	c.maxRetries = 2
+	c.sleep = func(ctx context.Context, d time.Duration) bool { return true }
+
+	var retriesLeft []int
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		retriesLeft = append(retriesLeft, message.RetriesLeft)
+		return errors.New("database unavailable")
+	})
+
+	if !slices.Equal(retriesLeft, []int{2, 1, 0}) {
+		t.Errorf("Expected 3 attempts with 2, 1 and 0 retries left, got %v", retriesLeft)
+	}
+	if len(deadLetter.published) != 1 || deadLetter.reasons[0] != ReasonRetriesExhausted {
+		t.Fatalf("Expected 1 dead letter with reason %s, got %v", ReasonRetriesExhausted, deadLetter.reasons)
+	}
+}
+
+func TestConsumer_Consume_UnavailableDoesNotUseUpRetries(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("waiting"), Offset: 1}},
+		},
+	}
+	deadLetter := &mockDeadLetterPublisher{}
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(deadLetter)(c)
+	c.maxRetries = 3
+	c.retryBackoffInitial = 500 * time.Millisecond
+
+	var waited time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) bool {
+		waited += d
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The circuit breaker stays open for longer than the retry budget
+	const cooldown = 30 * time.Second
+	var retriesLeft []int
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		retriesLeft = append(retriesLeft, message.RetriesLeft)
+		if waited < cooldown {
+			return NewUnavailableError(errors.New("circuit breaker is open"))
+		}
+		cancel()
+		return nil
+	})
+
+	if len(retriesLeft) <= c.maxRetries+1 {
+		t.Errorf("Expected more than %d attempts while unavailable, got %d", c.maxRetries+1, len(retriesLeft))
+	}
+	for _, left := range retriesLeft {
+		if left != c.maxRetries {
+			t.Fatalf("Expected unavailable attempts to leave all %d retries, got %v", c.maxRetries, retriesLeft)
+		}
+	}
+	if len(deadLetter.published) != 0 {
+		t.Errorf("Expected no dead letters, got %v", deadLetter.reasons)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected 1 committed message, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_RetriesExhaustedWithoutDeadLetter(t *testing.T) {
+	publishErr := errors.New("broker unavailable")
+	tests := []struct {
+		name       string
+		deadLetter DeadLetterPublisher
+		expected   error
+	}{
+		{
+			name:     "no dead letter topic",
+			expected: ErrNoDeadLetterTopic,
+		},
+		{
+			name:       "publish fails",
+			deadLetter: &mockDeadLetterPublisher{err: publishErr},
+			expected:   publishErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &mockReader{
+				fetches: []fetchResult{
+					{message: kafka.Message{Value: []byte("broken"), Offset: 1}},
+					{message: kafka.Message{Value: []byte("next"), Offset: 2}},
+				},
+			}
+			c := newTestConsumer(reader)
+			if tt.deadLetter != nil {
+				WithDeadLetterPublisher(tt.deadLetter)(c)
+			}
+			c.maxRetries = 1
+			c.sleep = func(ctx context.Context, d time.Duration) bool { return true }
+
+			calls := 0
+			err := c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+				calls++
+				return errors.New("database unavailable")
+			})
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected consumption to stop with %v, got: %v", tt.expected, err)
+			}
+			// The message is left for redelivery and nothing past it is
+			// processed or committed
+			if calls != 2 {
+				t.Errorf("Expected 2 attempts of the first message only, got %d", calls)
+			}
+			if len(reader.committed) != 0 {
+				t.Errorf("Expected no committed message, got %d", len(reader.committed))
+			}
+		})
+	}
+}
+
+func TestConsumer_Consume_DeadLetterFailsOnShutdown(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("broken"), Offset: 1}},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deadLetter := &mockDeadLetterPublisher{onPublish: cancel, err: context.Canceled}
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(deadLetter)(c)
+	c.maxRetries = 0
+
+	err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		return errors.New("database unavailable")
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected consumption to end with the shutdown, got: %v", err)
+	}
+	if len(reader.committed) != 0 {
+		t.Errorf("Expected the message not dead-lettered to stay uncommitted, got %d commits", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_PermanentErrorsAreNotRetried(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte(`{"amount":`), Offset: 1}},
+		},
+	}
+	deadLetter := &mockDeadLetterPublisher{}
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(deadLetter)(c)
+	c.maxRetries = 3
+	c.sleep = func(ctx context.Context, d time.Duration) bool {
+		t.Error("Permanent errors must not be retried")
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		calls++
+		cancel()
+		return NewPermanentError("truncated", errors.New("truncated message"))
+	})
+
+	if calls != 1 {
+		t.Errorf("Expected 1 attempt, got %d", calls)
+	}
+	if len(deadLetter.published) != 1 || deadLetter.reasons[0] != "truncated" {
+		t.Fatalf("Expected 1 dead letter with reason truncated, got %v", deadLetter.reasons)
+	}
+}
+
+func TestConsumer_Consume_InvalidMessagePolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          string
+		expectErr       bool
+		expectDLQ       int
+		expectCommitted int
+	}{
+		{"skip commits without dead-lettering", InvalidMessageSkip, false, 0, 1},
+		{"empty policy dead-letters with a publisher", "", false, 1, 1},
+		{"dlq dead-letters and commits", InvalidMessageDeadLetter, false, 1, 1},
+		{"fail stops consuming without committing", InvalidMessageFail, true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &mockReader{
+				fetches: []fetchResult{
+					{message: kafka.Message{Value: []byte(`{"amount":`), Offset: 1}},
+					{message: kafka.Message{Value: []byte("valid"), Offset: 2}},
+				},
+			}
+			deadLetter := &mockDeadLetterPublisher{}
+			c := newTestConsumer(reader)
+			WithDeadLetterPublisher(deadLetter)(c)
+			WithInvalidMessagePolicy(tt.policy)(c)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+				if string(message.Value) == "valid" {
+					// Only reached when the invalid message did not stop consuming
+					cancel()
+					return errors.New("database unavailable")
+				}
+				return NewPermanentError("truncated", errors.New("truncated message"))
+			})
+
+			if tt.expectErr {
+				var permanentErr *PermanentError
+				if !errors.As(err, &permanentErr) {
+					t.Errorf("Expected Consume to return the invalid message error, got %v", err)
+				}
+			} else if err != nil && !errors.Is(err, context.Canceled) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if len(deadLetter.published) != tt.expectDLQ {
+				t.Errorf("Expected %d dead letters, got %d", tt.expectDLQ, len(deadLetter.published))
+			}
+			if len(reader.committed) != tt.expectCommitted {
+				t.Errorf("Expected %d committed messages, got %d", tt.expectCommitted, len(reader.committed))
+			}
+		})
+	}
+}
+
+func TestConsumer_Consume_InvalidMessageSkippedWithoutDeadLetter(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte(`{"amount":`), Offset: 1}},
+		},
+	}
+	c := newTestConsumer(reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		cancel()
+		return NewPermanentError("truncated", errors.New("truncated message"))
+	})
+
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the invalid message to be skipped, got: %v", err)
+	}
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected 1 committed message, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_InvalidMessageLogsAreScoped(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte(`{"amount":`), Partition: 3, Offset: 7}},
+		},
+	}
+	var buf bytes.Buffer
+	c := newTestConsumer(reader)
+	c.logger = logger.NewLoggerWithHandler(slog.NewJSONHandler(&buf, nil))
+	WithInvalidMessagePolicy(InvalidMessageSkip)(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		cancel()
+		return NewPermanentError("truncated", errors.New("truncated message"))
+	})
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.Contains(line, `"msg":"Skipping invalid message"`) {
+			continue
+		}
+		if !strings.Contains(line, `"partition":3`) || !strings.Contains(line, `"offset":7`) {
+			t.Errorf("Expected the skip to be logged with the message position, got: %s", line)
+		}
+		return
+	}
+	t.Fatalf("Skip log line not found in %s", buf.String())
+}
+
+func TestConsumer_Consume_InvalidMessageDeadLetterFails(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte(`{"amount":`), Offset: 1}},
+			{message: kafka.Message{Value: []byte("valid"), Offset: 2}},
+		},
+	}
+	publishErr := errors.New("broker unavailable")
+	c := newTestConsumer(reader)
+	WithDeadLetterPublisher(&mockDeadLetterPublisher{err: publishErr})(c)
+	WithInvalidMessagePolicy(InvalidMessageDeadLetter)(c)
+
+	err := c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+		if string(message.Value) == "valid" {
+			t.Error("Messages after one that was not dead-lettered must not be processed")
+			return nil
+		}
+		return NewPermanentError("truncated", errors.New("truncated message"))
+	})
+
+	if !errors.Is(err, publishErr) {
+		t.Errorf("Expected Consume to return the publish error, got %v", err)
+	}
+	if len(reader.committed) != 0 {
+		t.Errorf("Expected no committed message, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_InvalidMessageFailStopsWorkerPool(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Key: []byte("a"), Value: []byte(`{"amount":`), Offset: 1}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.workers = 2
+	WithInvalidMessagePolicy(InvalidMessageFail)(c)
+
+	err := c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+		return NewPermanentError("truncated", errors.New("truncated message"))
+	})
+
+	if _, ok := IsPermanent(err); !ok {
+		t.Errorf("Expected Consume to return the invalid message error, got %v", err)
+	}
+}
+
+func TestDeadLetterMessage_Headers(t *testing.T) {
+	original := kafka.Message{
+		Topic:     "transactions",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("account-1"),
+		Value:     []byte(`{"amount":`),
+		Headers:   []kafka.Header{{Key: "trace-id", Value: []byte("abc")}},
+	}
+
+	dead, err := deadLetterMessage(DeadLetter{
+		Message: original,
+		Reason:  "truncated",
+		Cause:   errors.New("unexpected end of JSON input"),
+	})
+	if err != nil {
+		t.Fatalf("deadLetterMessage should not return error, got: %v", err)
+	}
+
+	headers := make(map[string]string)
+	for _, h := range dead.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+
+	expected := map[string]string{
+		"trace-id":              "abc",
+		HeaderDLQReason:         "truncated",
+		HeaderDLQError:          "unexpected end of JSON input",
+		HeaderOriginalTopic:     "transactions",
+		HeaderOriginalPartition: "3",
+		HeaderOriginalOffset:    "42",
+	}
+	for key, value := range expected {
+		if headers[key] != value {
+			t.Errorf("Header %s = %q, expected %q", key, headers[key], value)
+		}
+	}
+	if string(dead.Key) != "account-1" {
+		t.Error("Dead letter should keep the original key")
+	}
+}
+
+func TestDeadLetterMessage_Envelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		handle   func(ctx context.Context, message ConsumedMessage) error
+		reason   string
+		errorMsg string
+		attempts int
+	}{
+		{
+			name: "validation failure",
+			handle: func(ctx context.Context, message ConsumedMessage) error {
+				return NewPermanentError("invalid_transaction", errors.New("amount must be positive"))
+			},
+			reason:   "invalid_transaction",
+			errorMsg: "amount must be positive",
+			attempts: 1,
+		},
+		{
+			name: "transient failure",
+			handle: func(ctx context.Context, message ConsumedMessage) error {
+				return errors.New("database unavailable")
+			},
+			reason:   ReasonRetriesExhausted,
+			errorMsg: "database unavailable",
+			attempts: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value := []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0xff}
+			reader := &mockReader{
+				fetches: []fetchResult{
+					{message: kafka.Message{Topic: "transactions", Partition: 2, Offset: 17, Value: value}},
+				},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			deadLetter := &mockDeadLetterPublisher{onPublish: cancel}
+			c := newTestConsumer(reader)
+			WithDeadLetterPublisher(deadLetter)(c)
+			c.maxRetries = 2
+			c.sleep = func(ctx context.Context, d time.Duration) bool { return true }
+
+			before := time.Now().UTC()
+			_ = c.Consume(ctx, tt.handle)
+			if len(deadLetter.letters) != 1 {
+				t.Fatalf("Expected 1 dead letter, got %d", len(deadLetter.letters))
+			}
+
+			dead, err := deadLetterMessage(deadLetter.letters[0])
+			if err != nil {
+				t.Fatalf("deadLetterMessage should not return error, got: %v", err)
+			}
+			var envelope DeadLetterEnvelope
+			if err := json.Unmarshal(dead.Value, &envelope); err != nil {
+				t.Fatalf("Dead letter value should be a JSON envelope, got %q: %v", dead.Value, err)
+			}
+
+			if !bytes.Equal(envelope.OriginalValue, value) {
+				t.Errorf("Expected the original value to survive, got %v", envelope.OriginalValue)
+			}
+			if envelope.ErrorType != tt.reason || envelope.ErrorMessage != tt.errorMsg {
+				t.Errorf("Unexpected error %s: %s", envelope.ErrorType, envelope.ErrorMessage)
+			}
+			if envelope.Attempts != tt.attempts {
+				t.Errorf("Expected %d attempts, got %d", tt.attempts, envelope.Attempts)
+			}
+			if envelope.Topic != "transactions" || envelope.Partition != 2 || envelope.Offset != 17 {
+				t.Errorf("Unexpected position %s/%d/%d", envelope.Topic, envelope.Partition, envelope.Offset)
+			}
+			if envelope.FailedAt.Before(before) {
+				t.Errorf("Expected failedAt to be set, got %v", envelope.FailedAt)
+			}
+		})
+	}
+}
+
+func TestConsumer_Consume_ExtractsTraceContextFromHeaders(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{
+				Value:   []byte("traced"),
+				Headers: []kafka.Header{{Key: "traceparent", Value: []byte(traceparent)}},
+			}},
+		},
+	}
+	c := newTestConsumer(reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var spanContext trace.SpanContext
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		spanContext = trace.SpanContextFromContext(ctx)
+		cancel()
+		return nil
+	})
+
+	if !spanContext.IsRemote() {
+		t.Fatal("Handler context should carry the remote span context")
+	}
+	if spanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Unexpected trace ID: %s", spanContext.TraceID())
+	}
+}
+
+func TestConsumer_Consume_WorkerPoolCommitsAllMessages(t *testing.T) {
+	reader := &mockReader{}
+	for i := 0; i < 10; i++ {
+		reader.fetches = append(reader.fetches, fetchResult{
+			message: kafka.Message{Key: []byte{byte('a' + i%3)}, Value: []byte("PENDING"), Offset: int64(i)},
+		})
+	}
+	c := newTestConsumer(reader)
+	c.workers = 3
+	c.queueSize = 4
+	c.priority = testPriority
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	handled := 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled++
+		if handled == 10 {
+			go func() {
+				// Let the final commit land before stopping
+				time.Sleep(20 * time.Millisecond)
+				cancel()
+			}()
+		}
+		return nil
+	})
+
+	if handled != 10 {
+		t.Errorf("Expected 10 handled messages, got %d", handled)
+	}
+
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	var highest int64 = -1
+	for _, m := range reader.committed {
+		if m.Offset > highest {
+			highest = m.Offset
+		}
+	}
+	if highest != 9 {
+		t.Errorf("Expected offsets committed up to 9, got %d", highest)
+	}
+}
+
+func TestConsumer_Consume_WorkerPoolPreservesPerAccountOrder(t *testing.T) {
+	reader := &mockReader{}
+	for i := 0; i < 8; i++ {
+		account := []string{"account-1", "account-2"}[i%2]
+		reader.fetches = append(reader.fetches, fetchResult{
+			message: kafka.Message{Key: []byte(account), Value: []byte(strconv.Itoa(i)), Offset: int64(i)},
+		})
+	}
+	c := newTestConsumer(reader)
+	c.workers = 4
+	c.queueSize = 8
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	order := make(map[string][]string)
+	inFlight := make(map[string]int)
+	running, maxRunning, handled := 0, 0, 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		key := string(message.Key)
+		mu.Lock()
+		inFlight[key]++
+		if inFlight[key] > 1 {
+			t.Errorf("Messages of %s processed concurrently", key)
+		}
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight[key]--
+		running--
+		order[key] = append(order[key], string(message.Value))
+		handled++
+		if handled == 8 {
+			cancel()
+		}
+		return nil
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string][]string{
+		"account-1": {"0", "2", "4", "6"},
+		"account-2": {"1", "3", "5", "7"},
+	}
+	for key, want := range expected {
+		if strings.Join(order[key], ",") != strings.Join(want, ",") {
+			t.Errorf("Order of %s = %v, expected %v", key, order[key], want)
+		}
+	}
+	if maxRunning < 2 {
+		t.Errorf("Expected accounts to be processed in parallel, max concurrency was %d", maxRunning)
+	}
+}
+
+func TestConsumer_Consume_MaxInFlightBlocksFetching(t *testing.T) {
+	reader := &mockReader{}
+	for i := 0; i < 6; i++ {
+		reader.fetches = append(reader.fetches, fetchResult{
+			message: kafka.Message{Key: []byte("account-" + strconv.Itoa(i)), Offset: int64(i)},
+		})
+	}
+	c := newTestConsumer(reader)
+	c.workers = 4
+	c.queueSize = 8
+	WithMaxInFlight(2)(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	running, maxRunning, handled := 0, 0, 0
+	entered := make(chan struct{}, 6)
+	unblock := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+			entered <- struct{}{}
+
+			<-unblock
+
+			mu.Lock()
+			defer mu.Unlock()
+			running--
+			handled++
+			if handled == 6 {
+				cancel()
+			}
+			return nil
+		})
+	}()
+
+	<-entered
+	<-entered
+	time.Sleep(20 * time.Millisecond)
+
+	reader.mu.Lock()
+	remaining := len(reader.fetches)
+	reader.mu.Unlock()
+	if remaining != 4 {
+		t.Errorf("Expected fetching to block with 2 messages in flight, %d of 6 messages left unfetched", remaining)
+	}
+
+	close(unblock)
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 6 {
+		t.Errorf("Expected 6 messages handled, got %d", handled)
+	}
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 messages in flight, got %d", maxRunning)
+	}
+}
+
+// Mock offset store for testing
+type mockOffsetStore struct {
+	offsets map[int]int64
+	err     error
+}
+
+func (m *mockOffsetStore) GetLastOffsets(ctx context.Context, topic string) (map[int]int64, error) {
+	return m.offsets, m.err
+}
+
+func TestConsumer_Consume_SkipsPersistedOffsets(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Partition: 0, Offset: 4, Value: []byte("p0-4")}},
+			{message: kafka.Message{Partition: 0, Offset: 5, Value: []byte("p0-5")}},
+			{message: kafka.Message{Partition: 0, Offset: 6, Value: []byte("p0-6")}},
+			{message: kafka.Message{Partition: 1, Offset: 2, Value: []byte("p1-2")}},
+		},
+	}
+	c := newTestConsumer(reader)
+	WithOffsetStore(&mockOffsetStore{offsets: map[int]int64{0: 5}})(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled []string
+	err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		handled = append(handled, string(message.Value))
+		if len(handled) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(handled) != 2 || handled[0] != "p0-6" || handled[1] != "p1-2" {
+		t.Errorf("Expected only unprocessed messages to be handled, got %v", handled)
+	}
+	if len(reader.committed) != 4 {
+		t.Errorf("Expected skipped messages to be committed too, got %d commits", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_OffsetStoreError(t *testing.T) {
+	c := newTestConsumer(&mockReader{})
+	WithOffsetStore(&mockOffsetStore{err: errors.New("db down")})(c)
+
+	err := c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+		t.Error("No message should be handled when offsets cannot be loaded")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Consume should return error when offsets cannot be loaded")
+	}
+}
+
+func TestConsumer_Consume_SyncCommitStrategy(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Partition: 0, Offset: 1}},
+			{message: kafka.Message{Partition: 0, Offset: 2}},
+			{message: kafka.Message{Partition: 1, Offset: 7}},
+		},
+	}
+	c := newTestConsumer(reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled int
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		handled++
+		reader.mu.Lock()
+		committed := len(reader.committed)
+		reader.mu.Unlock()
+		if committed != handled-1 {
+			t.Errorf("Expected previous messages to be committed before handling the next, got %d commits", committed)
+		}
+		if handled == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	if len(reader.committed) != 3 {
+		t.Errorf("Expected every message to be committed, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_Consume_IntervalCommitStrategy(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Partition: 0, Offset: 1}},
+			{message: kafka.Message{Partition: 0, Offset: 2}},
+			{message: kafka.Message{Partition: 1, Offset: 7}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.commitInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled int
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		handled++
+		reader.mu.Lock()
+		committed := len(reader.committed)
+		reader.mu.Unlock()
+		if committed != 0 {
+			t.Errorf("Expected no commits before the interval elapses, got %d", committed)
+		}
+		if handled == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	committed := make(map[int]int64)
+	for _, message := range reader.committed {
+		committed[message.Partition] = message.Offset
+	}
+	if len(reader.committed) != 2 || committed[0] != 2 || committed[1] != 7 {
+		t.Errorf("Expected final flush to commit the latest offset per partition, got %v", reader.committed)
+	}
+}
+
+func TestConsumer_Consume_IntervalCommitFlushesPeriodically(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Partition: 0, Offset: 1}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.commitInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error { return nil })
+	}()
+
+	deadline := time.After(time.Second)
+	for {
+		reader.mu.Lock()
+		committed := len(reader.committed)
+		reader.mu.Unlock()
+		if committed == 1 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("Expected the stashed offset to be flushed while consuming")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-done
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected no duplicate commit on shutdown, got %d", len(reader.committed))
+	}
+}
+
+func TestConsumer_Commit_RebalanceRevokesPartition(t *testing.T) {
+	reader := &mockReader{commitErrors: []error{kafka.RebalanceInProgress}}
+	c := newTestConsumer(reader)
+	ctx := context.Background()
+
+	// The failed commit revokes partition 1, whose in-flight messages must not
+	// commit over the offsets of its new owner
+	c.commit(ctx, kafka.Message{Partition: 1, Offset: 5})
+	c.commit(ctx, kafka.Message{Partition: 1, Offset: 6})
+	c.commit(ctx, kafka.Message{Partition: 0, Offset: 3})
+
+	if len(reader.committed) != 1 || reader.committed[0].Partition != 0 {
+		t.Fatalf("Expected only partition 0 to be committed, got %v", reader.committed)
+	}
+	if errs := c.logger.(*mockLogger).errorMsgs; len(errs) != 0 {
+		t.Errorf("Expected a rebalance not to be logged as an error, got %v", errs)
+	}
+
+	// Fetching from the partition again means it was reassigned
+	c.reassign(1)
+	c.commit(ctx, kafka.Message{Partition: 1, Offset: 5})
+	if len(reader.committed) != 2 || reader.committed[1].Partition != 1 {
+		t.Errorf("Expected partition 1 to be committed after reassignment, got %v", reader.committed)
+	}
+}
+
+func TestConsumer_FlushCommits_RebalanceDropsStashedCommits(t *testing.T) {
+	reader := &mockReader{commitErrors: []error{kafka.IllegalGeneration}}
+	c := newTestConsumer(reader)
+	c.commitInterval = time.Hour
+	ctx := context.Background()
+
+	c.commit(ctx, kafka.Message{Partition: 0, Offset: 1})
+	c.commit(ctx, kafka.Message{Partition: 1, Offset: 7})
+
+	// A rebalance fails the flush of both partitions, so neither stashes the
+	// messages completing afterwards
+	c.flushCommits(ctx)
+	c.commit(ctx, kafka.Message{Partition: 1, Offset: 8})
+	c.flushCommits(ctx)
+
+	if len(reader.committed) != 0 {
+		t.Errorf("Expected no commit for revoked partitions, got %v", reader.committed)
+	}
+	if !c.isRevoked(0) || !c.isRevoked(1) {
+		t.Error("Expected both partitions of the failed flush to be revoked")
+	}
+}
+
+func TestConsumer_Consume_FetchAfterRebalanceResumesCommits(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{err: kafka.RebalanceInProgress},
+			{message: kafka.Message{Partition: 1, Offset: 5}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.fetchBackoffInitial = time.Millisecond
+	c.revoked = map[int]struct{}{1: {}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		cancel()
+		return nil
+	})
+
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 5 {
+		t.Errorf("Expected the refetched message to be committed, got %v", reader.committed)
+	}
+	if errs := c.logger.(*mockLogger).errorMsgs; len(errs) != 0 {
+		t.Errorf("Expected a rebalance not to be logged as an error, got %v", errs)
+	}
+}
+
+func TestNewConsumer_CommitStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		expected time.Duration
+	}{
+		{"interval", 2 * time.Second},
+		{"", 2 * time.Second},
+		{"sync", 0},
+		{"SYNC", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			c, err := NewConsumer(config.KafkaConfig{
+				Brokers:        []string{"localhost:9092"},
+				Topic:          "test-topic",
+				GroupID:        "test-group",
+				CommitStrategy: tt.strategy,
+				CommitInterval: 2 * time.Second,
+			}, &mockLogger{})
+			if err != nil {
+				t.Fatalf("NewConsumer should not return error, got: %v", err)
+			}
+			defer c.Close()
+
+			if c.commitInterval != tt.expected {
+				t.Errorf("Expected commit interval %v, got %v", tt.expected, c.commitInterval)
+			}
+		})
+	}
+}
+
+func TestConsumer_Pause_StopsFetching(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("first"), Offset: 1}},
+			{message: kafka.Message{Value: []byte("second"), Offset: 2}},
+		},
+	}
+	c := newTestConsumer(reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var handled []string
+	resumed := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled = append(handled, string(message.Value))
+			switch len(handled) {
+			case 1:
+				// Pausing mid-message must not drop the in-flight message
+				c.Pause()
+			case 2:
+				close(resumed)
+			}
+			return nil
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	if len(handled) != 1 {
+		t.Errorf("Expected 1 handled message while paused, got %d", len(handled))
+	}
+	mu.Unlock()
+	reader.mu.Lock()
+	if len(reader.committed) != 1 {
+		t.Errorf("Expected the in-flight message to be committed, got %d commits", len(reader.committed))
+	}
+	reader.mu.Unlock()
+	if !c.IsPaused() {
+		t.Error("Expected consumer to be paused")
+	}
+
+	c.Resume()
+
+	select {
+	case <-resumed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected consumption to continue after Resume")
+	}
+	if c.IsPaused() {
+		t.Error("Expected consumer not to be paused")
+	}
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConsumer_Pause_StopsOnCancel(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("first"), Offset: 1}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+			t.Error("Expected no messages to be handled while paused")
+			return nil
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Consume to return after cancellation while paused")
+	}
+}
+
+func TestConsumer_Consume_FetchErrorBackoffGrows(t *testing.T) {
+	fetchErr := errors.New("broker unavailable")
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{err: fetchErr},
+			{err: fetchErr},
+			{err: fetchErr},
+			{err: fetchErr},
+			{message: kafka.Message{Value: []byte("first"), Offset: 1}},
+			{err: fetchErr},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.fetchBackoffInitial = 100 * time.Millisecond
+	c.fetchBackoffMax = 300 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		300 * time.Millisecond,
+		300 * time.Millisecond,
+		// reset after the successful fetch
+		100 * time.Millisecond,
+	}
+
+	var slept []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) bool {
+		slept = append(slept, d)
+		if len(slept) == len(expected) {
+			cancel()
+			return false
+		}
+		return true
+	}
+
+	err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Consume should return nil after cancellation during backoff, got: %v", err)
+	}
+
+	if len(slept) != len(expected) {
+		t.Fatalf("Expected backoffs %v, got %v", expected, slept)
+	}
+	for i := range expected {
+		if slept[i] != expected[i] {
+			t.Errorf("Expected backoff %d to be %v, got %v", i, expected[i], slept[i])
+		}
+	}
+}
+
+func TestConsumer_Consume_FetchErrorBackoffCancelled(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{err: errors.New("broker unavailable")},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.fetchBackoffInitial = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+			return nil
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Consume should return nil after cancellation during backoff, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Consume to stop promptly during fetch backoff")
+	}
+}
+
+func TestNewConsumer_GroupMembershipSettings(t *testing.T) {
+	c, err := NewConsumer(config.KafkaConfig{
+		Brokers:           []string{"localhost:9092"},
+		Topic:             "test-topic",
+		GroupID:           "test-group",
+		SessionTimeout:    45 * time.Second,
+		RebalanceTimeout:  time.Minute,
+		HeartbeatInterval: 5 * time.Second,
+	}, &mockLogger{})
+	if err != nil {
+		t.Fatalf("NewConsumer should not return error, got: %v", err)
+	}
+	defer c.Close()
+
+	readerConfig := c.reader.Config()
+	if readerConfig.SessionTimeout != 45*time.Second {
+		t.Errorf("Expected session timeout 45s, got %v", readerConfig.SessionTimeout)
+	}
+	if readerConfig.RebalanceTimeout != time.Minute {
+		t.Errorf("Expected rebalance timeout 1m, got %v", readerConfig.RebalanceTimeout)
+	}
+	if readerConfig.HeartbeatInterval != 5*time.Second {
+		t.Errorf("Expected heartbeat interval 5s, got %v", readerConfig.HeartbeatInterval)
+	}
+}
+
+func TestNewConsumer_FetchSettings(t *testing.T) {
+	c, err := NewConsumer(config.KafkaConfig{
+		Brokers:  []string{"localhost:9092"},
+		Topic:    "test-topic",
+		GroupID:  "test-group",
+		MinBytes: 64 * 1024,
+		MaxBytes: 4 * 1024 * 1024,
+		MaxWait:  250 * time.Millisecond,
+	}, &mockLogger{})
+	if err != nil {
+		t.Fatalf("NewConsumer should not return error, got: %v", err)
+	}
+	defer c.Close()
+
+	readerConfig := c.reader.Config()
+	if readerConfig.MinBytes != 64*1024 {
+		t.Errorf("Expected min bytes 65536, got %d", readerConfig.MinBytes)
+	}
+	if readerConfig.MaxBytes != 4*1024*1024 {
+		t.Errorf("Expected max bytes 4194304, got %d", readerConfig.MaxBytes)
+	}
+	if readerConfig.MaxWait != 250*time.Millisecond {
+		t.Errorf("Expected max wait 250ms, got %v", readerConfig.MaxWait)
+	}
+}
+
+func TestNewConsumer_InvalidFetchBytes(t *testing.T) {
+	_, err := NewConsumer(config.KafkaConfig{
+		Brokers:  []string{"localhost:9092"},
+		Topic:    "test-topic",
+		GroupID:  "test-group",
+		MinBytes: 2048,
+		MaxBytes: 1024,
+	}, &mockLogger{})
+	if err == nil {
+		t.Error("NewConsumer should reject min bytes above max bytes")
+	}
+}
+
+func TestNewConsumer_ClientID(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("Hostname unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		clientID string
+		expected string
+	}{
+		{"configured", "consumer-a", "consumer-a"},
+		{"hostname default", "", "transaction-consumer-" + hostname},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewConsumer(config.KafkaConfig{
+				Brokers:  []string{"localhost:9092"},
+				Topic:    "test-topic",
+				GroupID:  "test-group",
+				ClientID: tt.clientID,
+			}, &mockLogger{})
+			if err != nil {
+				t.Fatalf("NewConsumer should not return error, got: %v", err)
+			}
+			defer c.Close()
+
+			if got := c.reader.Config().Dialer.ClientID; got != tt.expected {
+				t.Errorf("Expected reader client ID %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConsumer_Commit_EveryNCommitsAtMultiples(t *testing.T) {
+	reader := &mockReader{}
+	c := newTestConsumer(reader)
+	c.commitEveryN = 3
+	ctx := context.Background()
+
+	for offset := int64(1); offset <= 7; offset++ {
+		c.commit(ctx, kafka.Message{Partition: 0, Offset: offset})
+	}
+	c.commit(ctx, kafka.Message{Partition: 1, Offset: 1})
+	c.commit(ctx, kafka.Message{Partition: 1, Offset: 2})
+
+	var offsets []int64
+	for _, message := range reader.committed {
+		offsets = append(offsets, message.Offset)
+		if message.Partition != 0 {
+			t.Errorf("Expected partition 1 to wait for its own %d messages, got a commit of offset %d", c.commitEveryN, message.Offset)
+		}
+	}
+	if len(offsets) != 2 || offsets[0] != 3 || offsets[1] != 6 {
+		t.Fatalf("Expected commits at offsets 3 and 6, got %v", offsets)
+	}
+
+	// The remainder of every partition is committed on drain
+	c.flushCommits(ctx)
+	if len(reader.committed) != 4 {
+		t.Fatalf("Expected the remaining offsets to be committed on drain, got %v", reader.committed)
+	}
+	for _, message := range reader.committed[2:] {
+		if (message.Partition == 0 && message.Offset != 7) || (message.Partition == 1 && message.Offset != 2) {
+			t.Errorf("Unexpected drained commit %d/%d", message.Partition, message.Offset)
+		}
+	}
+}
+
+func TestConsumer_Consume_EveryNCommitsRemainderOnShutdown(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Partition: 0, Offset: 1}},
+			{message: kafka.Message{Partition: 0, Offset: 2}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.commitEveryN = 5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		if message.Offset == 2 {
+			cancel()
+		}
+		return nil
+	})
+
+	if len(reader.committed) != 1 || reader.committed[0].Offset != 2 {
+		t.Errorf("Expected the latest offset to be committed on shutdown, got %v", reader.committed)
+	}
+}
+
+func TestConsumer_Consume_StrictOrderingSerializesPartitions(t *testing.T) {
+	reader := &mockReader{}
+	for i := 0; i < 8; i++ {
+		// Distinct keys would run concurrently under keyed ordering
+		reader.fetches = append(reader.fetches, fetchResult{
+			message: kafka.Message{Key: []byte("account-" + strconv.Itoa(i)), Partition: i % 2, Offset: int64(i)},
+		})
+	}
+	c := newTestConsumer(reader)
+	WithOrdering(OrderingStrict)(c)
+	c.workers = 4
+	c.queueSize = 8
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	order := make(map[int][]int64)
+	inFlight := make(map[int]int)
+	handled := 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		mu.Lock()
+		inFlight[message.Partition]++
+		if inFlight[message.Partition] > 1 {
+			t.Errorf("Messages of partition %d processed concurrently", message.Partition)
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight[message.Partition]--
+		order[message.Partition] = append(order[message.Partition], message.Offset)
+		handled++
+		if handled == 8 {
+			cancel()
+		}
+		return nil
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for partition, offsets := range order {
+		for i := 1; i < len(offsets); i++ {
+			if offsets[i] < offsets[i-1] {
+				t.Errorf("Partition %d processed out of order: %v", partition, offsets)
+			}
+		}
+	}
+	if handled != 8 {
+		t.Errorf("Expected 8 handled messages, got %d", handled)
+	}
+}
+
+func TestConsumer_Consume_BestEffortOrderingRunsSameKeyInParallel(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Key: []byte("account-1"), Offset: 1}},
+			{message: kafka.Message{Key: []byte("account-1"), Offset: 2}},
+		},
+	}
+	c := newTestConsumer(reader)
+	WithOrdering(OrderingBestEffort)(c)
+	c.workers = 2
+	c.queueSize = 2
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Each handler waits for the other, which only completes when both run
+	// at once
+	var started sync.WaitGroup
+	started.Add(2)
+	var mu sync.Mutex
+	parallel := 0
+	_ = c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		started.Done()
+		waited := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(waited)
+		}()
+
+		select {
+		case <-waited:
+			mu.Lock()
+			defer mu.Unlock()
+			parallel++
+			if parallel == 2 {
+				cancel()
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected messages with the same key to be processed in parallel")
+			cancel()
+		}
+		return nil
+	})
+
+	if parallel != 2 {
+		t.Errorf("Expected both messages to run concurrently, got %d", parallel)
+	}
+}
+
+func TestConsumer_Consume_ReturnsWhenReaderClosed(t *testing.T) {
+	for _, closedErr := range []error{io.EOF, io.ErrClosedPipe, fmt.Errorf("read tcp: %w", net.ErrClosed)} {
+		t.Run(closedErr.Error(), func(t *testing.T) {
+			reader := &mockReader{fetches: []fetchResult{{err: closedErr}}}
+			c := newTestConsumer(reader)
+			c.sleep = func(ctx context.Context, d time.Duration) bool {
+				t.Error("A closed reader must not be retried after a backoff")
+				return false
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+					t.Error("No message should be handled")
+					return nil
+				})
+			}()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("Expected Consume to return nil, got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected Consume to return promptly once the reader is closed")
+			}
+			if errs := c.logger.(*mockLogger).errorMsgs; len(errs) != 0 {
+				t.Errorf("Expected a closed reader not to be logged as an error, got %v", errs)
+			}
+		})
+	}
+}
+
+func TestConsumer_Consume_StopsAfterMaxMessages(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			reader := &mockReader{}
+			for offset := int64(1); offset <= 5; offset++ {
+				reader.fetches = append(reader.fetches, fetchResult{message: kafka.Message{Offset: offset}})
+			}
+			c := newTestConsumer(reader)
+			c.workers = workers
+			c.maxMessages = 3
+
+			var mu sync.Mutex
+			var handled []int64
+			done := make(chan error, 1)
+			go func() {
+				done <- c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+					mu.Lock()
+					defer mu.Unlock()
+					handled = append(handled, message.Offset)
+					return nil
+				})
+			}()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("Expected Consume to return nil, got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("Expected Consume to return after the maximum number of messages")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(handled) != 3 {
+				t.Errorf("Expected exactly 3 messages to be processed, got %v", handled)
+			}
+			if len(reader.fetches) != 2 {
+				t.Errorf("Expected 2 messages to be left unfetched, got %d", len(reader.fetches))
+			}
+			if last := reader.committed[len(reader.committed)-1]; last.Offset != 3 {
+				t.Errorf("Expected offset 3 to be committed last, got %d", last.Offset)
+			}
+		})
+	}
+}
+
+func TestConsumer_Consume_LogsSessionSummary(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Value: []byte("first"), Offset: 1}},
+			{message: kafka.Message{Value: []byte("invalid"), Offset: 2}},
+			{message: kafka.Message{Value: []byte("third"), Offset: 3}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.invalidPolicy = InvalidMessageSkip
+	c.maxMessages = 3
+
+	err := c.Consume(context.Background(), func(ctx context.Context, message ConsumedMessage) error {
+		if string(message.Value) == "invalid" {
+			return NewPermanentError("invalid", errors.New("malformed payload"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if processed := c.Processed(); processed != 2 {
+		t.Errorf("Expected 2 processed messages, got %d", processed)
+	}
+
+	log := c.logger.(*mockLogger)
+	var summary *loggedInfo
+	for i := range log.infos {
+		if log.infos[i].msg == "Kafka consumer stopped" {
+			summary = &log.infos[i]
+		}
+	}
+	if summary == nil {
+		t.Fatal("Expected the consumer to log a session summary when stopping")
+	}
+	fields := make(map[interface{}]interface{})
+	for i := 0; i+1 < len(summary.args); i += 2 {
+		fields[summary.args[i]] = summary.args[i+1]
+	}
+	if processed, ok := fields["processed"]; !ok || processed != int64(2) {
+		t.Errorf("Expected processed=2 in the session summary, got %v", summary.args)
+	}
+	if _, ok := fields["uptime"].(time.Duration); !ok {
+		t.Errorf("Expected the session uptime in the session summary, got %v", summary.args)
+	}
+}
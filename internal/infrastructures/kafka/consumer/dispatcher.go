@@ -0,0 +1,245 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// PriorityFunc ranks a raw message value; higher values are dispatched first
+type PriorityFunc func(value []byte) int
+
+// job is a fetched message waiting for a worker
+type job struct {
+	message  kafka.Message
+	key      string
+	priority int
+}
+
+// dispatcher is a bounded queue handing messages to workers by priority while
+// keeping messages that share an ordering key in fetch order and never in
+// flight together
+type dispatcher struct {
+	mu       sync.Mutex
+	ready    *sync.Cond
+	notFull  *sync.Cond
+	pending  []*job
+	active   map[string]bool
+	capacity int
+	closed   bool
+	draining bool
+	priority PriorityFunc
+	key      func(kafka.Message) string
+}
+
+// newDispatcher creates a dispatcher ordering messages as ordering, one of
+// the Ordering constants, defaulting to OrderingKeyed
+func newDispatcher(capacity int, priority PriorityFunc, ordering string) *dispatcher {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	d := &dispatcher{
+		active:   make(map[string]bool),
+		capacity: capacity,
+		priority: priority,
+		key:      orderingKey(ordering),
+	}
+	d.ready = sync.NewCond(&d.mu)
+	d.notFull = sync.NewCond(&d.mu)
+	return d
+}
+
+// submit queues message, blocking while the queue is saturated; it reports
+// false when ctx is done or the dispatcher is closed or draining before there
+// is room
+func (d *dispatcher) submit(ctx context.Context, message kafka.Message) bool {
+	stop := context.AfterFunc(ctx, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.notFull.Broadcast()
+	})
+	defer stop()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for len(d.pending) >= d.capacity && !d.closed && !d.draining && ctx.Err() == nil {
+		d.notFull.Wait()
+	}
+	if d.closed || d.draining || ctx.Err() != nil {
+		return false
+	}
+
+	j := &job{message: message, key: d.key(message)}
+	if d.priority != nil {
+		j.priority = d.priority(message.Value)
+	}
+	d.pending = append(d.pending, j)
+	d.ready.Broadcast()
+	return true
+}
+
+// next blocks until a job is eligible and returns it, or returns nil once the
+// dispatcher is closed or drained
+func (d *dispatcher) next() *job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for {
+		if d.closed || (d.draining && len(d.pending) == 0) {
+			return nil
+		}
+		if i := d.pick(); i >= 0 {
+			j := d.pending[i]
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			d.active[j.key] = true
+			d.notFull.Signal()
+			if d.draining && len(d.pending) == 0 {
+				// Release the workers waiting for a job that will never come
+				d.ready.Broadcast()
+			}
+			return j
+		}
+		d.ready.Wait()
+	}
+}
+
+// pick returns the index of the highest priority eligible job or -1; a job is
+// eligible when its key is idle and no earlier job with the same key is queued
+func (d *dispatcher) pick() int {
+	best := -1
+	seen := make(map[string]bool, len(d.pending))
+	for i, j := range d.pending {
+		if seen[j.key] {
+			continue
+		}
+		seen[j.key] = true
+		if d.active[j.key] {
+			continue
+		}
+		if best < 0 || j.priority > d.pending[best].priority {
+			best = i
+		}
+	}
+	return best
+}
+
+// done releases the key of a finished job so later messages can proceed
+func (d *dispatcher) done(j *job) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.active, j.key)
+	d.ready.Broadcast()
+}
+
+// drain stops accepting jobs; the queued ones are still handed out, after
+// which next returns nil
+func (d *dispatcher) drain() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.draining = true
+	d.ready.Broadcast()
+	d.notFull.Broadcast()
+}
+
+// close wakes all waiters; queued jobs are dropped and will be redelivered as
+// their offsets were never committed
+func (d *dispatcher) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	d.ready.Broadcast()
+	d.notFull.Broadcast()
+}
+
+// orderingKey returns the function computing the ordering key of messages
+// under ordering; messages sharing a key are processed one at a time
+func orderingKey(ordering string) func(kafka.Message) string {
+	switch ordering {
+	case OrderingStrict:
+		return partitionKey
+	case OrderingBestEffort:
+		return offsetKey
+	default:
+		return messageKey
+	}
+}
+
+// partitionKey orders every message of a partition
+func partitionKey(message kafka.Message) string {
+	return "p:" + strconv.Itoa(message.Partition)
+}
+
+// offsetKey gives every message its own key, leaving messages unordered
+func offsetKey(message kafka.Message) string {
+	return "o:" + strconv.Itoa(message.Partition) + ":" + strconv.FormatInt(message.Offset, 10)
+}
+
+// messageKey returns the ordering key of a message, falling back to its
+// partition for unkeyed messages
+func messageKey(message kafka.Message) string {
+	if len(message.Key) > 0 {
+		return "k:" + string(message.Key)
+	}
+	return partitionKey(message)
+}
+
+// offsetTracker computes which offsets are safe to commit when messages of a
+// partition complete out of order
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	inFlight []int64
+	done     map[int64]kafka.Message
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// track registers a fetched message in fetch order
+func (t *offsetTracker) track(message kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[message.Partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]kafka.Message)}
+		t.partitions[message.Partition] = p
+	}
+	p.inFlight = append(p.inFlight, message.Offset)
+}
+
+// complete marks message as processed and returns the highest message of its
+// partition below which everything has completed, if that advanced
+func (t *offsetTracker) complete(message kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[message.Partition]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[message.Offset] = message
+
+	var commit kafka.Message
+	advanced := false
+	for len(p.inFlight) > 0 {
+		head, ok := p.done[p.inFlight[0]]
+		if !ok {
+			break
+		}
+		delete(p.done, p.inFlight[0])
+		p.inFlight = p.inFlight[1:]
+		commit, advanced = head, true
+	}
+	return commit, advanced
+}
@@ -0,0 +1,191 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var testPriorities = map[string]int{"SUCCESS": 2, "FAILED": 2, "PENDING": 0}
+
+func testPriority(value []byte) int {
+	return testPriorities[string(value)]
+}
+
+func TestDispatcher_HigherPriorityDispatchedFirstWhenSaturated(t *testing.T) {
+	d := newDispatcher(10, testPriority, OrderingKeyed)
+	ctx := context.Background()
+
+	for i, status := range []string{"PENDING", "SUCCESS", "PENDING", "FAILED"} {
+		d.submit(ctx, kafka.Message{Key: []byte{byte('a' + i)}, Value: []byte(status)})
+	}
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		j := d.next()
+		order = append(order, string(j.message.Value))
+		d.done(j)
+	}
+
+	expected := []string{"SUCCESS", "FAILED", "PENDING", "PENDING"}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("Expected dispatch order %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestDispatcher_PreservesPerKeyOrdering(t *testing.T) {
+	d := newDispatcher(10, testPriority, OrderingKeyed)
+	ctx := context.Background()
+
+	d.submit(ctx, kafka.Message{Key: []byte("account-a"), Value: []byte("PENDING"), Offset: 1})
+	d.submit(ctx, kafka.Message{Key: []byte("account-a"), Value: []byte("SUCCESS"), Offset: 2})
+	d.submit(ctx, kafka.Message{Key: []byte("account-b"), Value: []byte("PENDING"), Offset: 3})
+
+	first := d.next()
+	if first.message.Offset != 1 {
+		t.Fatalf("Expected account-a PENDING first, got offset %d", first.message.Offset)
+	}
+
+	// account-a is in flight, so its SUCCESS must wait despite higher priority
+	second := d.next()
+	if second.message.Offset != 3 {
+		t.Fatalf("Expected account-b while account-a is in flight, got offset %d", second.message.Offset)
+	}
+
+	d.done(first)
+	third := d.next()
+	if third.message.Offset != 2 {
+		t.Fatalf("Expected account-a SUCCESS after its PENDING completed, got offset %d", third.message.Offset)
+	}
+}
+
+func TestDispatcher_SubmitBlocksWhenFull(t *testing.T) {
+	d := newDispatcher(1, nil, OrderingKeyed)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if !d.submit(ctx, kafka.Message{Offset: 1}) {
+		t.Fatal("First submit should succeed")
+	}
+
+	result := make(chan bool)
+	go func() {
+		result <- d.submit(ctx, kafka.Message{Offset: 2})
+	}()
+
+	select {
+	case <-result:
+		t.Fatal("Submit should block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case ok := <-result:
+		if ok {
+			t.Error("Submit should report false when cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Submit should return promptly after cancellation")
+	}
+}
+
+func TestDispatcher_CloseReleasesWorkers(t *testing.T) {
+	d := newDispatcher(1, nil, OrderingKeyed)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if j := d.next(); j != nil {
+			t.Error("next should return nil after close")
+		}
+	}()
+
+	d.close()
+	wg.Wait()
+}
+
+func TestDispatcher_DrainHandsOutQueuedJobs(t *testing.T) {
+	d := newDispatcher(2, nil, OrderingKeyed)
+	ctx := context.Background()
+	d.submit(ctx, kafka.Message{Offset: 1})
+	d.submit(ctx, kafka.Message{Offset: 2})
+
+	d.drain()
+	if d.submit(ctx, kafka.Message{Offset: 3}) {
+		t.Error("submit should be refused while draining")
+	}
+
+	for _, want := range []int64{1, 2} {
+		j := d.next()
+		if j == nil || j.message.Offset != want {
+			t.Fatalf("Expected queued offset %d, got %v", want, j)
+		}
+		d.done(j)
+	}
+	if j := d.next(); j != nil {
+		t.Errorf("next should return nil once drained, got offset %d", j.message.Offset)
+	}
+}
+
+func TestOffsetTracker_CommitsContiguousOffsets(t *testing.T) {
+	tracker := newOffsetTracker()
+	messages := []kafka.Message{{Offset: 10}, {Offset: 11}, {Offset: 12}}
+	for _, m := range messages {
+		tracker.track(m)
+	}
+
+	if _, ok := tracker.complete(messages[1]); ok {
+		t.Error("Offset 11 must not be committed before offset 10 completes")
+	}
+	commit, ok := tracker.complete(messages[0])
+	if !ok || commit.Offset != 11 {
+		t.Errorf("Expected commit up to offset 11, got %d (ok=%v)", commit.Offset, ok)
+	}
+	commit, ok = tracker.complete(messages[2])
+	if !ok || commit.Offset != 12 {
+		t.Errorf("Expected commit up to offset 12, got %d (ok=%v)", commit.Offset, ok)
+	}
+}
+
+func TestDispatcher_StrictOrderingSerializesPartition(t *testing.T) {
+	d := newDispatcher(10, nil, OrderingStrict)
+	ctx := context.Background()
+
+	d.submit(ctx, kafka.Message{Key: []byte("account-a"), Partition: 0, Offset: 1})
+	d.submit(ctx, kafka.Message{Key: []byte("account-b"), Partition: 0, Offset: 2})
+	d.submit(ctx, kafka.Message{Key: []byte("account-c"), Partition: 1, Offset: 1})
+
+	first := d.next()
+	second := d.next()
+	if first.message.Partition != 0 || second.message.Partition != 1 {
+		t.Fatalf("Expected partition 0 to wait for its first message, got %d then %d",
+			first.message.Partition, second.message.Partition)
+	}
+
+	d.done(first)
+	if third := d.next(); third.message.Partition != 0 || third.message.Offset != 2 {
+		t.Errorf("Expected partition 0 offset 2 after offset 1 completed, got %d/%d",
+			third.message.Partition, third.message.Offset)
+	}
+}
+
+func TestDispatcher_BestEffortOrderingIgnoresKeys(t *testing.T) {
+	d := newDispatcher(10, nil, OrderingBestEffort)
+	ctx := context.Background()
+
+	d.submit(ctx, kafka.Message{Key: []byte("account-a"), Offset: 1})
+	d.submit(ctx, kafka.Message{Key: []byte("account-a"), Offset: 2})
+
+	first := d.next()
+	second := d.next()
+	if first.message.Offset != 1 || second.message.Offset != 2 {
+		t.Errorf("Expected both messages to be dispatched at once, got offsets %d and %d",
+			first.message.Offset, second.message.Offset)
+	}
+}
@@ -0,0 +1,131 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"strconv"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+)
+
+// Header keys attached to dead-lettered messages
+const (
+	HeaderDLQReason         = "x-dlq-reason"
+	HeaderDLQError          = "x-dlq-error"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+)
+
+// DeadLetter is a message that cannot be processed, with why and when it
+// failed
+type DeadLetter struct {
+	Message  kafka.Message
+	Reason   string
+	Cause    error
+	Attempts int
+	FailedAt time.Time
+}
+
+// DeadLetterEnvelope is the JSON value of a published dead letter, so
+// tooling can triage it without re-deriving its context; OriginalValue is
+// base64-encoded in JSON, which keeps binary formats such as Avro intact
+type DeadLetterEnvelope struct {
+	OriginalValue []byte    `json:"originalValue"`
+	ErrorType     string    `json:"errorType"`
+	ErrorMessage  string    `json:"errorMessage,omitempty"`
+	FailedAt      time.Time `json:"failedAt"`
+	Attempts      int       `json:"attempts"`
+	Topic         string    `json:"topic"`
+	Partition     int       `json:"partition"`
+	Offset        int64     `json:"offset"`
+}
+
+// DeadLetterPublisher publishes messages that cannot be processed
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, letter DeadLetter) error
+	Close() error
+}
+
+// deadLetterWriter publishes dead letters to a Kafka topic
+type deadLetterWriter struct {
+	writer *kafka.Writer
+}
+
+// NewDeadLetterPublisher creates a publisher writing to cfg.DLQTopic
+func NewDeadLetterPublisher(cfg config.KafkaConfig) (DeadLetterPublisher, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kafka authentication: %w", err)
+	}
+
+	return &deadLetterWriter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.DLQTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		},
+	}, nil
+}
+
+// Publish writes the enveloped message to the dead letter topic
+func (w *deadLetterWriter) Publish(ctx context.Context, letter DeadLetter) error {
+	message, err := deadLetterMessage(letter)
+	if err != nil {
+		return err
+	}
+	if err := w.writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying writer
+func (w *deadLetterWriter) Close() error {
+	return w.writer.Close()
+}
+
+// deadLetterMessage builds the message published for letter, keeping the
+// original key and headers, wrapping the original value in a
+// DeadLetterEnvelope and recording why and where it failed in headers too
+func deadLetterMessage(letter DeadLetter) (kafka.Message, error) {
+	message, reason, cause := letter.Message, letter.Reason, letter.Cause
+	envelope := DeadLetterEnvelope{
+		OriginalValue: message.Value,
+		ErrorType:     reason,
+		FailedAt:      letter.FailedAt,
+		Attempts:      letter.Attempts,
+		Topic:         message.Topic,
+		Partition:     message.Partition,
+		Offset:        message.Offset,
+	}
+	if cause != nil {
+		envelope.ErrorMessage = cause.Error()
+	}
+	value, err := json.Marshal(envelope)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to encode dead letter envelope: %w", err)
+	}
+
+	headers := make([]kafka.Header, 0, len(message.Headers)+5)
+	headers = append(headers, message.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQReason, Value: []byte(reason)},
+		kafka.Header{Key: HeaderOriginalTopic, Value: []byte(message.Topic)},
+		kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(message.Partition))},
+		kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(message.Offset, 10))},
+	)
+	if cause != nil {
+		headers = append(headers, kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())})
+	}
+
+	return kafka.Message{
+		Key:     message.Key,
+		Value:   value,
+		Headers: headers,
+	}, nil
+}
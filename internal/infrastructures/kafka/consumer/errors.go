@@ -0,0 +1,64 @@
+package consumer
+
+import (
+	"errors"
+)
+
+// ErrNoDeadLetterTopic is returned when a message must be dead-lettered but
+// no dead letter topic is configured
+var ErrNoDeadLetterTopic = errors.New("no dead letter topic is configured")
+
+// PermanentError marks a message that can never be processed successfully,
+// so retrying is pointless and it should be dead-lettered instead
+type PermanentError struct {
+	Reason string
+	Err    error
+}
+
+// NewPermanentError wraps err as a permanent failure with the given reason
+func NewPermanentError(reason string, err error) error {
+	return &PermanentError{Reason: reason, Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err is a permanent failure and returns its reason
+func IsPermanent(err error) (string, bool) {
+	var permanentErr *PermanentError
+	if errors.As(err, &permanentErr) {
+		return permanentErr.Reason, true
+	}
+	return "", false
+}
+
+// UnavailableError marks a failure caused by a dependency known to be down
+// for a while, such as an open circuit breaker. It does not use up the
+// retries of the message, which is retried with backoff until it recovers
+type UnavailableError struct {
+	Err error
+}
+
+// NewUnavailableError wraps err as a failure of an unavailable dependency
+func NewUnavailableError(err error) error {
+	return &UnavailableError{Err: err}
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnavailable reports whether err is a failure of an unavailable dependency
+func IsUnavailable(err error) bool {
+	var unavailableErr *UnavailableError
+	return errors.As(err, &unavailableErr)
+}
@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+	"transaction-consumer/internal/infrastructures/metrics"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// lagSource reports the number of messages each partition is behind
+type lagSource interface {
+	Lag() map[int]int64
+}
+
+// partitionLag computes lag per partition as the high-water mark seen when a
+// message was fetched minus the offset committed after it
+type partitionLag struct {
+	mu   sync.Mutex
+	lags map[int]int64
+}
+
+func newPartitionLag() *partitionLag {
+	return &partitionLag{lags: make(map[int]int64)}
+}
+
+// record updates the lag of the partition of message, which was just
+// committed; messages without a high-water mark are ignored
+func (p *partitionLag) record(message kafka.Message) {
+	if message.HighWaterMark <= 0 {
+		return
+	}
+
+	lag := message.HighWaterMark - message.Offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lags[message.Partition] = lag
+}
+
+// Lag returns a snapshot of the lag of every partition seen so far
+func (p *partitionLag) Lag() map[int]int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lags := make(map[int]int64, len(p.lags))
+	for partition, lag := range p.lags {
+		lags[partition] = lag
+	}
+	return lags
+}
+
+// startLagReporter reports the lag of c.lagSource every c.lagInterval until
+// ctx is done
+func (c *Consumer) startLagReporter(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(c.lagInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.reportLag()
+			}
+		}
+	}()
+}
+
+// reportLag publishes the current lag per partition as a metric and a log line
+func (c *Consumer) reportLag() {
+	lags := c.lagSource.Lag()
+	if len(lags) == 0 {
+		c.logger.Debug("Consumer lag unavailable")
+		return
+	}
+
+	for partition, lag := range lags {
+		metrics.ConsumerLag.WithLabelValues(strconv.Itoa(partition)).Set(float64(lag))
+		c.logger.Info("Consumer lag", "partition", partition, "lag", lag)
+	}
+}
@@ -0,0 +1,96 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"transaction-consumer/internal/infrastructures/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+)
+
+type fakeLagSource struct {
+	lags map[int]int64
+}
+
+func (f *fakeLagSource) Lag() map[int]int64 {
+	return f.lags
+}
+
+func TestPartitionLag_Record(t *testing.T) {
+	lag := newPartitionLag()
+
+	lag.record(kafka.Message{Partition: 0, Offset: 10, HighWaterMark: 25})
+	lag.record(kafka.Message{Partition: 1, Offset: 99, HighWaterMark: 100})
+	lag.record(kafka.Message{Partition: 2, Offset: 5})
+	lag.record(kafka.Message{Partition: 0, Offset: 20, HighWaterMark: 25})
+
+	lags := lag.Lag()
+	if len(lags) != 2 {
+		t.Fatalf("Expected lag for 2 partitions, got %v", lags)
+	}
+	if lags[0] != 4 {
+		t.Errorf("Expected partition 0 lag 4, got %d", lags[0])
+	}
+	if lags[1] != 0 {
+		t.Errorf("Expected partition 1 lag 0, got %d", lags[1])
+	}
+}
+
+func TestConsumer_ReportLag(t *testing.T) {
+	c := newTestConsumer(&mockReader{})
+	c.lagSource = &fakeLagSource{lags: map[int]int64{7: 42, 8: 0}}
+
+	c.reportLag()
+
+	if got := testutil.ToFloat64(metrics.ConsumerLag.WithLabelValues("7")); got != 42 {
+		t.Errorf("Expected partition 7 lag 42, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.ConsumerLag.WithLabelValues("8")); got != 0 {
+		t.Errorf("Expected partition 8 lag 0, got %v", got)
+	}
+}
+
+func TestConsumer_ReportLag_Unavailable(t *testing.T) {
+	c := newTestConsumer(&mockReader{})
+	c.lagSource = &fakeLagSource{}
+
+	before := testutil.CollectAndCount(metrics.ConsumerLag)
+	c.reportLag()
+
+	if after := testutil.CollectAndCount(metrics.ConsumerLag); after != before {
+		t.Errorf("Expected no lag series to be added, got %d (was %d)", after, before)
+	}
+}
+
+func TestConsumer_Consume_TracksLag(t *testing.T) {
+	reader := &mockReader{
+		fetches: []fetchResult{
+			{message: kafka.Message{Partition: 3, Offset: 1, HighWaterMark: 10}},
+			{message: kafka.Message{Partition: 3, Offset: 2, HighWaterMark: 10}},
+		},
+	}
+	c := newTestConsumer(reader)
+	c.lagInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := 0
+	err := c.Consume(ctx, func(ctx context.Context, message ConsumedMessage) error {
+		handled++
+		if handled == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if lag := c.lagSource.Lag()[3]; lag != 7 {
+		t.Errorf("Expected partition 3 lag 7, got %d", lag)
+	}
+}
@@ -0,0 +1,57 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Header is a single Kafka message header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// ConsumedMessage is a fetched Kafka message together with its metadata
+type ConsumedMessage struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+	Timestamp time.Time
+
+	// RetriesLeft is how many more attempts the consumer makes when this one
+	// fails with an error that is neither permanent nor unavailable; zero
+	// means such a failure settles the message
+	RetriesLeft int
+}
+
+// Header returns the value of the first header with the given key
+func (m ConsumedMessage) Header(key string) (string, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// newConsumedMessage converts a kafka.Message into a ConsumedMessage
+func newConsumedMessage(message kafka.Message) ConsumedMessage {
+	headers := make([]Header, 0, len(message.Headers))
+	for _, h := range message.Headers {
+		headers = append(headers, Header{Key: h.Key, Value: h.Value})
+	}
+
+	return ConsumedMessage{
+		Topic:     message.Topic,
+		Partition: message.Partition,
+		Offset:    message.Offset,
+		Key:       message.Key,
+		Value:     message.Value,
+		Headers:   headers,
+		Timestamp: message.Time,
+	}
+}
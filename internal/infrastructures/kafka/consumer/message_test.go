@@ -0,0 +1,60 @@
+package consumer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestNewConsumedMessage(t *testing.T) {
+	ts := time.Date(2024, 1, 15, 10, 30, 45, 0, time.UTC)
+	message := kafka.Message{
+		Topic:     "transactions",
+		Partition: 2,
+		Offset:    17,
+		Key:       []byte("trans-456"),
+		Value:     []byte(`{"transactionId":"trans-456"}`),
+		Headers:   []kafka.Header{{Key: "traceparent", Value: []byte("00-abc-def-01")}},
+		Time:      ts,
+	}
+
+	consumed := newConsumedMessage(message)
+
+	if consumed.Topic != "transactions" || consumed.Partition != 2 || consumed.Offset != 17 {
+		t.Errorf("Expected transactions/2/17, got %s/%d/%d", consumed.Topic, consumed.Partition, consumed.Offset)
+	}
+	if !bytes.Equal(consumed.Key, message.Key) {
+		t.Errorf("Expected key %s, got %s", message.Key, consumed.Key)
+	}
+	if !bytes.Equal(consumed.Value, message.Value) {
+		t.Errorf("Expected value %s, got %s", message.Value, consumed.Value)
+	}
+	if !consumed.Timestamp.Equal(ts) {
+		t.Errorf("Expected timestamp %v, got %v", ts, consumed.Timestamp)
+	}
+	if len(consumed.Headers) != 1 {
+		t.Fatalf("Expected 1 header, got %d", len(consumed.Headers))
+	}
+}
+
+func TestConsumedMessage_Header(t *testing.T) {
+	message := ConsumedMessage{
+		Headers: []Header{
+			{Key: "source", Value: []byte("payment-service")},
+			{Key: "source", Value: []byte("ignored")},
+			{Key: "empty", Value: nil},
+		},
+	}
+
+	if value, ok := message.Header("source"); !ok || value != "payment-service" {
+		t.Errorf("Expected first source header, got %q (found=%v)", value, ok)
+	}
+	if value, ok := message.Header("empty"); !ok || value != "" {
+		t.Errorf("Expected empty header to be found, got %q (found=%v)", value, ok)
+	}
+	if _, ok := message.Header("missing"); ok {
+		t.Error("Missing header should not be found")
+	}
+}
@@ -0,0 +1,74 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/infrastructures/config"
+)
+
+// HeaderEventType names the type of a published event, e.g.
+// EventTypePersisted
+const HeaderEventType = "x-event-type"
+
+// EventTypePersisted is the type of the confirmation published for every
+// stored transaction status
+const EventTypePersisted = "transaction.persisted"
+
+// PersistedEventWriter publishes persisted events to a Kafka topic, keyed by
+// transaction ID so the confirmations of a transaction stay in order
+type PersistedEventWriter struct {
+	writer *kafka.Writer
+}
+
+// NewPersistedEventPublisher creates a publisher writing to
+// cfg.PersistedTopic
+func NewPersistedEventPublisher(cfg config.KafkaConfig) (*PersistedEventWriter, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kafka authentication: %w", err)
+	}
+
+	return &PersistedEventWriter{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.PersistedTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		},
+	}, nil
+}
+
+// PublishPersisted writes event to the persisted topic
+func (w *PersistedEventWriter) PublishPersisted(ctx context.Context, event *entities.PersistedEvent) error {
+	message, err := persistedMessage(event)
+	if err != nil {
+		return err
+	}
+	if err := w.writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("failed to publish persisted event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying writer
+func (w *PersistedEventWriter) Close() error {
+	return w.writer.Close()
+}
+
+// persistedMessage builds the message published for event
+func persistedMessage(event *entities.PersistedEvent) (kafka.Message, error) {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return kafka.Message{}, fmt.Errorf("failed to encode persisted event: %w", err)
+	}
+
+	return kafka.Message{
+		Key:     []byte(event.TransactionID),
+		Value:   value,
+		Headers: []kafka.Header{{Key: HeaderEventType, Value: []byte(EventTypePersisted)}},
+	}, nil
+}
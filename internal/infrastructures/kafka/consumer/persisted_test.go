@@ -0,0 +1,30 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+)
+
+func TestPersistedMessage(t *testing.T) {
+	message, err := persistedMessage(&entities.PersistedEvent{
+		TransactionID: "TXN-1",
+		Status:        entities.TransactionStatusSuccess,
+		PersistedAt:   time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("persistedMessage should not return error, got: %v", err)
+	}
+
+	expected := `{"transactionId":"TXN-1","status":"SUCCESS","persistedAt":"2024-03-01T10:30:00Z"}`
+	if string(message.Value) != expected {
+		t.Errorf("Expected payload %s, got %s", expected, message.Value)
+	}
+	if string(message.Key) != "TXN-1" {
+		t.Errorf("Expected the transaction ID as key, got %q", message.Key)
+	}
+	if len(message.Headers) != 1 || message.Headers[0].Key != HeaderEventType ||
+		string(message.Headers[0].Value) != EventTypePersisted {
+		t.Errorf("Expected event type header %q, got %v", EventTypePersisted, message.Headers)
+	}
+}
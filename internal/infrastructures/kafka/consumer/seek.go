@@ -0,0 +1,170 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"sort"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+)
+
+// groupOffsetClient is the subset of kafka.Client used to reposition the
+// consumer group
+type groupOffsetClient interface {
+	Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error)
+	ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error)
+	OffsetCommit(ctx context.Context, req *kafka.OffsetCommitRequest) (*kafka.OffsetCommitResponse, error)
+}
+
+// GroupSeeker moves the committed offsets of the consumer group, which its
+// readers resume from when they join. kafka-go readers cannot seek once
+// part of a group, so seeking happens before the consumer is created; the
+// broker only accepts the commits while no member of the group is running
+type GroupSeeker struct {
+	client  groupOffsetClient
+	groupID string
+	topic   string
+}
+
+// NewGroupSeeker creates a seeker of the group cfg.GroupID on cfg.Topic
+func NewGroupSeeker(cfg config.KafkaConfig) (*GroupSeeker, error) {
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kafka authentication: %w", err)
+	}
+
+	return &GroupSeeker{
+		client: &kafka.Client{
+			Addr:      kafka.TCP(cfg.Brokers...),
+			Timeout:   10 * time.Second,
+			Transport: transport,
+		},
+		groupID: cfg.GroupID,
+		topic:   cfg.Topic,
+	}, nil
+}
+
+// Seek makes the group resume partition at offset
+func (s *GroupSeeker) Seek(ctx context.Context, partition int, offset int64) error {
+	return s.commit(ctx, map[int]int64{partition: offset})
+}
+
+// SeekToTime makes the group resume every partition at its first message
+// at or after t, or at its end when it has none
+func (s *GroupSeeker) SeekToTime(ctx context.Context, t time.Time) error {
+	partitions, err := s.partitions(ctx)
+	if err != nil {
+		return err
+	}
+
+	requests := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, partition := range partitions {
+		requests = append(requests, kafka.TimeOffsetOf(partition, t))
+	}
+	offsets, err := s.listOffsets(ctx, requests)
+	if err != nil {
+		return err
+	}
+
+	// Partitions without a message since t report no offset
+	var ends []kafka.OffsetRequest
+	for _, partition := range partitions {
+		if _, ok := offsets[partition]; !ok {
+			ends = append(ends, kafka.LastOffsetOf(partition))
+		}
+	}
+	if len(ends) > 0 {
+		endOffsets, err := s.listOffsets(ctx, ends)
+		if err != nil {
+			return err
+		}
+		for partition, offset := range endOffsets {
+			offsets[partition] = offset
+		}
+	}
+
+	return s.commit(ctx, offsets)
+}
+
+// partitions returns the partitions of the topic in order
+func (s *GroupSeeker) partitions(ctx context.Context) ([]int, error) {
+	metadata, err := s.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{s.topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata of topic %s: %w", s.topic, err)
+	}
+
+	for _, topic := range metadata.Topics {
+		if topic.Name != s.topic {
+			continue
+		}
+		if topic.Error != nil {
+			return nil, fmt.Errorf("failed to get metadata of topic %s: %w", s.topic, topic.Error)
+		}
+		partitions := make([]int, 0, len(topic.Partitions))
+		for _, partition := range topic.Partitions {
+			partitions = append(partitions, partition.ID)
+		}
+		sort.Ints(partitions)
+		return partitions, nil
+	}
+	return nil, fmt.Errorf("topic %s does not exist", s.topic)
+}
+
+// listOffsets resolves requests to an offset per partition, leaving out
+// partitions the broker found no offset for
+func (s *GroupSeeker) listOffsets(ctx context.Context, requests []kafka.OffsetRequest) (map[int]int64, error) {
+	res, err := s.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{s.topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets of topic %s: %w", s.topic, err)
+	}
+
+	offsets := make(map[int]int64, len(requests))
+	for _, partition := range res.Topics[s.topic] {
+		if partition.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets of partition %d: %w", partition.Partition, partition.Error)
+		}
+		if partition.LastOffset >= 0 {
+			offsets[partition.Partition] = partition.LastOffset
+		}
+		for offset := range partition.Offsets {
+			if offset >= 0 {
+				offsets[partition.Partition] = offset
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// commit commits offsets per partition for the group outside of any group
+// generation, as tools resetting offsets do
+func (s *GroupSeeker) commit(ctx context.Context, offsets map[int]int64) error {
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for partition, offset := range offsets {
+		commits = append(commits, kafka.OffsetCommit{Partition: partition, Offset: offset})
+	}
+
+	res, err := s.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      s.groupID,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{s.topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit offsets of group %s: %w", s.groupID, err)
+	}
+
+	for _, partition := range res.Topics[s.topic] {
+		if partition.Error == nil {
+			continue
+		}
+		if errors.Is(partition.Error, kafka.UnknownMemberId) || isRebalance(partition.Error) {
+			return fmt.Errorf("group %s has running members, stop them before seeking: %w", s.groupID, partition.Error)
+		}
+		return fmt.Errorf("failed to commit offset of partition %d for group %s: %w",
+			partition.Partition, s.groupID, partition.Error)
+	}
+	return nil
+}
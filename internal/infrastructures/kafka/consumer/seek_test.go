@@ -0,0 +1,155 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// mockGroupOffsetClient answers like a broker holding partitions of
+// test-topic, with the first offset at or after each time per partition
+type mockGroupOffsetClient struct {
+	partitions  []int
+	timeOffsets map[int]int64
+	endOffsets  map[int]int64
+	commitError error
+
+	commits []*kafka.OffsetCommitRequest
+}
+
+func (m *mockGroupOffsetClient) Metadata(ctx context.Context, req *kafka.MetadataRequest) (*kafka.MetadataResponse, error) {
+	topic := kafka.Topic{Name: "test-topic"}
+	for _, id := range m.partitions {
+		topic.Partitions = append(topic.Partitions, kafka.Partition{Topic: "test-topic", ID: id})
+	}
+	return &kafka.MetadataResponse{Topics: []kafka.Topic{topic}}, nil
+}
+
+func (m *mockGroupOffsetClient) ListOffsets(ctx context.Context, req *kafka.ListOffsetsRequest) (*kafka.ListOffsetsResponse, error) {
+	res := &kafka.ListOffsetsResponse{Topics: map[string][]kafka.PartitionOffsets{}}
+	for topic, requests := range req.Topics {
+		for _, r := range requests {
+			offsets := kafka.PartitionOffsets{Partition: r.Partition, FirstOffset: -1, LastOffset: -1, Offsets: map[int64]time.Time{}}
+			if r.Timestamp == kafka.LastOffset {
+				offsets.LastOffset = m.endOffsets[r.Partition]
+			} else if offset, ok := m.timeOffsets[r.Partition]; ok {
+				offsets.Offsets[offset] = time.UnixMilli(r.Timestamp)
+			} else {
+				offsets.Offsets[-1] = time.UnixMilli(-1)
+			}
+			res.Topics[topic] = append(res.Topics[topic], offsets)
+		}
+	}
+	return res, nil
+}
+
+func (m *mockGroupOffsetClient) OffsetCommit(ctx context.Context, req *kafka.OffsetCommitRequest) (*kafka.OffsetCommitResponse, error) {
+	m.commits = append(m.commits, req)
+	res := &kafka.OffsetCommitResponse{Topics: map[string][]kafka.OffsetCommitPartition{}}
+	for topic, commits := range req.Topics {
+		for _, commit := range commits {
+			res.Topics[topic] = append(res.Topics[topic], kafka.OffsetCommitPartition{Partition: commit.Partition, Error: m.commitError})
+		}
+	}
+	return res, nil
+}
+
+// newTestGroupSeeker returns a seeker of a group-configured consumer that
+// talks to client
+func newTestGroupSeeker(t *testing.T, client groupOffsetClient) *GroupSeeker {
+	t.Helper()
+	seeker, err := NewGroupSeeker(config.KafkaConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "test-group",
+		Topic:   "test-topic",
+	})
+	if err != nil {
+		t.Fatalf("NewGroupSeeker() error: %v", err)
+	}
+	seeker.client = client
+	return seeker
+}
+
+// committedOffsets returns the offsets per partition of a commit request
+func committedOffsets(req *kafka.OffsetCommitRequest) map[int]int64 {
+	offsets := make(map[int]int64)
+	for _, commit := range req.Topics["test-topic"] {
+		offsets[commit.Partition] = commit.Offset
+	}
+	return offsets
+}
+
+func TestGroupSeeker_Seek(t *testing.T) {
+	client := &mockGroupOffsetClient{}
+	seeker := newTestGroupSeeker(t, client)
+
+	if err := seeker.Seek(context.Background(), 2, 42); err != nil {
+		t.Fatalf("Seek() error: %v", err)
+	}
+
+	if len(client.commits) != 1 {
+		t.Fatalf("Expected 1 offset commit, got %d", len(client.commits))
+	}
+	commit := client.commits[0]
+	// A commit outside of any generation is what lets a group reposition
+	// before its members join
+	if commit.GroupID != "test-group" || commit.GenerationID != -1 || commit.MemberID != "" {
+		t.Errorf("Expected a commit for test-group outside of a generation, got %+v", commit)
+	}
+	if offsets := committedOffsets(commit); !reflect.DeepEqual(offsets, map[int]int64{2: 42}) {
+		t.Errorf("Expected partition 2 committed at offset 42, got %v", offsets)
+	}
+}
+
+func TestGroupSeeker_SeekToTime(t *testing.T) {
+	client := &mockGroupOffsetClient{
+		partitions:  []int{1, 0, 2},
+		timeOffsets: map[int]int64{0: 10, 1: 25},
+		endOffsets:  map[int]int64{2: 7},
+	}
+	seeker := newTestGroupSeeker(t, client)
+
+	if err := seeker.SeekToTime(context.Background(), time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("SeekToTime() error: %v", err)
+	}
+
+	if len(client.commits) != 1 {
+		t.Fatalf("Expected 1 offset commit, got %d", len(client.commits))
+	}
+	// Partition 2 has no message since then and resumes at its end
+	expected := map[int]int64{0: 10, 1: 25, 2: 7}
+	if offsets := committedOffsets(client.commits[0]); !reflect.DeepEqual(offsets, expected) {
+		t.Errorf("Expected offsets %v committed, got %v", expected, offsets)
+	}
+}
+
+func TestGroupSeeker_SeekWithRunningMembers(t *testing.T) {
+	for _, commitErr := range []error{kafka.UnknownMemberId, kafka.IllegalGeneration, kafka.RebalanceInProgress} {
+		t.Run(commitErr.Error(), func(t *testing.T) {
+			seeker := newTestGroupSeeker(t, &mockGroupOffsetClient{commitError: commitErr})
+
+			err := seeker.Seek(context.Background(), 0, 5)
+			if !errors.Is(err, commitErr) {
+				t.Errorf("Expected the commit error to be returned, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestGroupSeeker_SeekToTime_UnknownTopic(t *testing.T) {
+	client := &mockGroupOffsetClient{partitions: []int{0}}
+	seeker := newTestGroupSeeker(t, client)
+	seeker.topic = "missing-topic"
+
+	if err := seeker.SeekToTime(context.Background(), time.Now()); err == nil {
+		t.Error("SeekToTime should reject a topic that does not exist")
+	}
+	if len(client.commits) != 0 {
+		t.Errorf("Expected no offset commit, got %d", len(client.commits))
+	}
+}
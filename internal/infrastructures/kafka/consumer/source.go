@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+)
+
+// sourceFetchTimeout bounds reading one message back from its source topic,
+// since fetching past the end of a partition blocks until a message arrives
+const sourceFetchTimeout = 30 * time.Second
+
+// partitionReader is the subset of kafka.Reader used to read one message
+// from a fixed partition
+type partitionReader interface {
+	SetOffset(offset int64) error
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// SourceFetcher reads single messages back from the topic they were
+// consumed from, e.g. to reprocess a dead letter from its source rather
+// than from the copy in the dead letter topic
+type SourceFetcher struct {
+	readerConfig kafka.ReaderConfig
+	timeout      time.Duration
+	newReader    func(kafka.ReaderConfig) partitionReader
+}
+
+// NewSourceFetcher creates a fetcher reading from cfg.Brokers; it reads
+// outside the consumer group, so no offsets are committed
+func NewSourceFetcher(cfg config.KafkaConfig) (*SourceFetcher, error) {
+	dialer, err := newDialer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure Kafka authentication: %w", err)
+	}
+
+	return &SourceFetcher{
+		readerConfig: kafka.ReaderConfig{
+			Brokers:  cfg.Brokers,
+			Dialer:   dialer,
+			Topic:    cfg.Topic,
+			MaxBytes: cfg.MaxBytes,
+			MaxWait:  cfg.MaxWait,
+		},
+		timeout: sourceFetchTimeout,
+		newReader: func(readerCfg kafka.ReaderConfig) partitionReader {
+			return kafka.NewReader(readerCfg)
+		},
+	}, nil
+}
+
+// Fetch returns the value of the message at offset of partition of topic,
+// defaulting to the configured topic. It fails when that offset no longer
+// holds a message, e.g. after retention or compaction removed it
+func (f *SourceFetcher) Fetch(ctx context.Context, topic string, partition int, offset int64) ([]byte, error) {
+	if partition < 0 || offset < 0 {
+		return nil, fmt.Errorf("invalid source position %d/%d", partition, offset)
+	}
+
+	readerCfg := f.readerConfig
+	if topic != "" {
+		readerCfg.Topic = topic
+	}
+	if readerCfg.Topic == "" {
+		return nil, errors.New("source topic is unknown")
+	}
+	readerCfg.Partition = partition
+
+	reader := f.newReader(readerCfg)
+	defer reader.Close()
+
+	if err := reader.SetOffset(offset); err != nil {
+		return nil, fmt.Errorf("failed to seek %s/%d to offset %d: %w", readerCfg.Topic, partition, offset, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	message, err := reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch offset %d of %s/%d: %w", offset, readerCfg.Topic, partition, err)
+	}
+	// Kafka serves the next available message when offset was removed
+	if message.Offset != offset {
+		return nil, fmt.Errorf("offset %d of %s/%d is no longer available, the next message is at offset %d",
+			offset, readerCfg.Topic, partition, message.Offset)
+	}
+	return message.Value, nil
+}
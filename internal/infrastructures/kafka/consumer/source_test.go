@@ -0,0 +1,108 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// mockPartitionReader serves message from any offset it is set to
+type mockPartitionReader struct {
+	message  kafka.Message
+	fetchErr error
+	offset   int64
+	closed   bool
+}
+
+func (m *mockPartitionReader) SetOffset(offset int64) error {
+	m.offset = offset
+	return nil
+}
+
+func (m *mockPartitionReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	return m.message, m.fetchErr
+}
+
+func (m *mockPartitionReader) Close() error {
+	m.closed = true
+	return nil
+}
+
+func newTestSourceFetcher(reader *mockPartitionReader, configs *[]kafka.ReaderConfig) *SourceFetcher {
+	return &SourceFetcher{
+		readerConfig: kafka.ReaderConfig{Brokers: []string{"localhost:9092"}, Topic: "transactions"},
+		timeout:      time.Second,
+		newReader: func(cfg kafka.ReaderConfig) partitionReader {
+			*configs = append(*configs, cfg)
+			return reader
+		},
+	}
+}
+
+func TestSourceFetcher_Fetch_SeeksToOffset(t *testing.T) {
+	tests := []struct {
+		name          string
+		topic         string
+		expectedTopic string
+	}{
+		{"recorded topic", "payments", "payments"},
+		{"configured topic", "", "transactions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &mockPartitionReader{message: kafka.Message{Offset: 42, Value: []byte("original")}}
+			var configs []kafka.ReaderConfig
+			f := newTestSourceFetcher(reader, &configs)
+
+			value, err := f.Fetch(context.Background(), tt.topic, 3, 42)
+			if err != nil {
+				t.Fatalf("Fetch should not return error, got: %v", err)
+			}
+
+			if string(value) != "original" {
+				t.Errorf("Expected the source value, got %q", value)
+			}
+			if len(configs) != 1 || configs[0].Topic != tt.expectedTopic || configs[0].Partition != 3 || configs[0].GroupID != "" {
+				t.Errorf("Expected a reader of partition 3 of %s outside any group, got %+v", tt.expectedTopic, configs)
+			}
+			if reader.offset != 42 {
+				t.Errorf("Expected the reader to seek to offset 42, got %d", reader.offset)
+			}
+			if !reader.closed {
+				t.Error("Expected the reader to be closed")
+			}
+		})
+	}
+}
+
+func TestSourceFetcher_Fetch_Errors(t *testing.T) {
+	tests := []struct {
+		name      string
+		reader    *mockPartitionReader
+		partition int
+		offset    int64
+		errMsg    string
+	}{
+		{"negative offset", &mockPartitionReader{}, 0, -1, "invalid source position"},
+		{"negative partition", &mockPartitionReader{}, -1, 5, "invalid source position"},
+		{"removed offset", &mockPartitionReader{message: kafka.Message{Offset: 50}}, 0, 42, "no longer available"},
+		{"fetch failure", &mockPartitionReader{fetchErr: errors.New("broker down")}, 0, 42, "broker down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var configs []kafka.ReaderConfig
+			f := newTestSourceFetcher(tt.reader, &configs)
+
+			_, err := f.Fetch(context.Background(), "", tt.partition, tt.offset)
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got: %v", tt.errMsg, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Stats returns a snapshot of the reader statistics. Counters such as
+// Messages, Bytes, Errors and Rebalances cover the time since the previous
+// snapshot, including those taken by the periodic stats log
+func (c *Consumer) Stats() kafka.ReaderStats {
+	return c.reader.Stats()
+}
+
+// startStatsLogger logs Stats every c.statsInterval until ctx is done or the
+// returned stop function is called
+func (c *Consumer) startStatsLogger(ctx context.Context) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(c.statsInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				c.logStats()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// logStats logs a snapshot of the reader statistics at info level
+func (c *Consumer) logStats() {
+	stats := c.Stats()
+	c.logger.Info("Consumer stats",
+		"topic", stats.Topic,
+		"partition", stats.Partition,
+		"messages", stats.Messages,
+		"bytes", stats.Bytes,
+		"lag", stats.Lag,
+		"errors", stats.Errors,
+		"rebalances", stats.Rebalances,
+		"fetches", stats.Fetches,
+		"timeouts", stats.Timeouts,
+	)
+}
@@ -0,0 +1,70 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConsumer_Stats(t *testing.T) {
+	c := newTestConsumer(&mockReader{partition: 3})
+
+	stats := c.Stats()
+	if stats.Topic != "test-topic" || stats.Partition != "3" {
+		t.Errorf("Expected the reader statistics, got %+v", stats)
+	}
+}
+
+func TestConsumer_StartStatsLogger(t *testing.T) {
+	reader := &mockReader{}
+	c := newTestConsumer(reader)
+	c.statsInterval = time.Millisecond
+
+	stop := c.startStatsLogger(context.Background())
+
+	deadline := time.After(time.Second)
+	for {
+		reader.mu.Lock()
+		calls := reader.statsCalls
+		reader.mu.Unlock()
+		if calls > 0 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("Expected the stats logger to snapshot the reader statistics")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	stop()
+	reader.mu.Lock()
+	calls := reader.statsCalls
+	reader.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	if reader.statsCalls != calls {
+		t.Errorf("Expected no snapshots after stop, got %d more", reader.statsCalls-calls)
+	}
+}
+
+func TestConsumer_StartStatsLogger_StopsWithContext(t *testing.T) {
+	c := newTestConsumer(&mockReader{})
+	c.statsInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := c.startStatsLogger(ctx)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected stop to return once the context is done")
+	}
+}
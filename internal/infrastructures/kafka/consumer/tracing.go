@@ -0,0 +1,30 @@
+package consumer
+
+import (
+	"github.com/segmentio/kafka-go"
+)
+
+// headerCarrier adapts Kafka message headers to propagation.TextMapCarrier
+type headerCarrier []kafka.Header
+
+// Get returns the value of the first header with the given key
+func (c headerCarrier) Get(key string) string {
+	for _, h := range c {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set is a no-op as consumed headers are never modified
+func (c headerCarrier) Set(key, value string) {}
+
+// Keys returns all header keys
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, h := range c {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds all application metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// TransactionsProcessed counts transactions stored from consumed
+	// messages, by partition, to spot hot partitions
+	TransactionsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "transactions_processed_total",
+		Help: "Number of transactions processed from consumed messages, by partition.",
+	}, []string{"partition"})
+
+	// ProcessResults counts handled transactions by what processing did with
+	// them: inserted, updated, skipped or spilled
+	ProcessResults = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "process_results_total",
+		Help: "Number of handled transactions, by processing result.",
+	}, []string{"result"})
+
+	// FilteredMessages counts messages skipped as their transaction type is
+	// not allowed, by type
+	FilteredMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filtered_total",
+		Help: "Number of messages skipped because their transaction type is not allowed.",
+	}, []string{"type"})
+
+	// ParseErrors counts messages that could not be decoded, by reason
+	ParseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "parse_errors_total",
+		Help: "Number of consumed messages that could not be decoded.",
+	}, []string{"reason"})
+
+	// DeadLetterMessages counts messages routed to the dead letter topic, by reason
+	DeadLetterMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dlq_messages_total",
+		Help: "Number of messages routed to the dead letter topic.",
+	}, []string{"reason"})
+
+	// ProcessingRetries counts retries of messages that failed with an error
+	// that is not permanent
+	ProcessingRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "processing_retries_total",
+		Help: "Number of times a message was retried after a transient processing failure.",
+	})
+
+	// ProcessingTimeouts counts processing attempts cancelled for exceeding
+	// the processing timeout
+	ProcessingTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "processing_timeouts_total",
+		Help: "Number of message processing attempts that exceeded the processing timeout.",
+	})
+
+	// ConsumerLag is the number of messages each partition is behind
+	ConsumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "consumer_lag_messages",
+		Help: "Number of messages between the committed offset and the high-water mark, by partition.",
+	}, []string{"partition"})
+
+	// SpilledTransactions is the number of transactions buffered on disk
+	// while the database is unavailable, waiting to be drained
+	SpilledTransactions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "spilled_transactions",
+		Help: "Number of transactions buffered on disk waiting to be stored.",
+	})
+
+	// TimeInQueue observes the end-to-end latency from a transaction event
+	// occurring to it being processed, by the source of the event time: the
+	// Kafka message timestamp or the transaction createdAt
+	TimeInQueue = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "time_in_queue_seconds",
+		Help:    "Time between a transaction event occurring and it being processed, in seconds.",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"source"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		TransactionsProcessed,
+		ProcessResults,
+		FilteredMessages,
+		ParseErrors,
+		DeadLetterMessages,
+		ProcessingRetries,
+		ProcessingTimeouts,
+		ConsumerLag,
+		SpilledTransactions,
+		TimeInQueue,
+	)
+}
+
+// Handler returns the HTTP handler exposing the registry in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
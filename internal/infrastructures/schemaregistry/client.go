@@ -0,0 +1,105 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hamba/avro/v2"
+)
+
+// ErrSchemaNotFound is returned when the registry has no schema for an ID
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// Client fetches Avro schemas from a Confluent schema registry. Schemas are
+// immutable per ID, so every schema is fetched once and cached
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu      sync.RWMutex
+	schemas map[int]avro.Schema
+}
+
+// Option configures optional behaviour of the client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used to reach the registry
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient creates a new schema registry client for baseURL
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		schemas:    make(map[int]avro.Schema),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Schema returns the parsed schema registered under id
+func (c *Client) Schema(ctx context.Context, id int) (avro.Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	schema, err := c.fetch(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.schemas[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// fetch retrieves and parses the schema registered under id
+func (c *Client) fetch(ctx context.Context, id int) (avro.Schema, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", c.baseURL, id), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema %d: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("schema %d: %w", id, ErrSchemaNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch schema %d: unexpected status %d", id, resp.StatusCode)
+	}
+
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode schema %d response: %w", id, err)
+	}
+
+	schema, err := avro.Parse(body.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %d: %w", id, err)
+	}
+	return schema, nil
+}
@@ -0,0 +1,89 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testSchema = `{"type":"record","name":"Ping","fields":[{"name":"id","type":"string"}]}`
+
+func TestClient_Schema_CachesByID(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/schemas/ids/1" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if accept := r.Header.Get("Accept"); accept != "application/vnd.schemaregistry.v1+json" {
+			t.Errorf("Unexpected Accept header %q", accept)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"schema": testSchema})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL + "/")
+	for i := 0; i < 3; i++ {
+		schema, err := client.Schema(context.Background(), 1)
+		if err != nil {
+			t.Fatalf("Schema should not return error, got: %v", err)
+		}
+		if schema.String() == "" {
+			t.Error("Expected parsed schema")
+		}
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected 1 registry request, got %d", got)
+	}
+}
+
+func TestClient_Schema_NotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewClient(server.URL).Schema(context.Background(), 99)
+	if !errors.Is(err, ErrSchemaNotFound) {
+		t.Errorf("Expected ErrSchemaNotFound, got %v", err)
+	}
+}
+
+func TestClient_Schema_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"server error", http.StatusInternalServerError, "", "unexpected status 500"},
+		{"invalid response", http.StatusOK, "not json", "failed to decode schema 1 response"},
+		{"invalid schema", http.StatusOK, `{"schema":"{\"type\":\"nope\"}"}`, "failed to parse schema 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL)
+			_, err := client.Schema(context.Background(), 1)
+			if err == nil || errors.Is(err, ErrSchemaNotFound) {
+				t.Fatalf("Expected registry error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %q", tt.wantErr, err.Error())
+			}
+			if len(client.schemas) != 0 {
+				t.Error("Failed lookups should not be cached")
+			}
+		})
+	}
+}
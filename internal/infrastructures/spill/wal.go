@@ -0,0 +1,236 @@
+package spill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/internal/infrastructures/metrics"
+	"transaction-consumer/pkg/logger"
+)
+
+// fileName is the name of the log inside the spill directory
+const fileName = "transactions.wal"
+
+// StoreFunc stores a drained transaction; an error stops the drain, keeping
+// that transaction and every later one in the log
+type StoreFunc func(ctx context.Context, transaction *entities.Transaction) error
+
+// WAL is an append-only file of transactions, one JSON document per line,
+// buffering them on local disk while the database is unavailable. Every
+// append is synced before it returns, so the message offset can be committed
+// safely; drains replay the transactions in order
+type WAL struct {
+	path     string
+	maxBytes int64
+	logger   logger.Logger
+
+	// drainMu serializes drains, mu guards the file and its size against
+	// concurrent appends
+	drainMu sync.Mutex
+	mu      sync.Mutex
+	size    int64
+	pending int
+}
+
+// Open opens the log in dir, creating dir when missing; maxBytes caps the
+// size of the log, zero leaving it unbounded. A record cut short by a crash
+// is discarded
+func Open(dir string, maxBytes int64, log logger.Logger) (*WAL, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	w := &WAL{
+		path:     filepath.Join(dir, fileName),
+		maxBytes: maxBytes,
+		logger:   log,
+	}
+
+	data, err := os.ReadFile(w.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	if complete := bytes.LastIndexByte(data, '\n') + 1; complete < len(data) {
+		log.Warn("Discarding partially written spill record", "path", w.path, "bytes", len(data)-complete)
+		data = data[:complete]
+		if err := os.Truncate(w.path, int64(complete)); err != nil {
+			return nil, fmt.Errorf("failed to truncate spill file: %w", err)
+		}
+	}
+
+	w.size = int64(len(data))
+	w.pending = bytes.Count(data, []byte{'\n'})
+	metrics.SpilledTransactions.Set(float64(w.pending))
+	if w.pending > 0 {
+		log.Warn("Found spilled transactions from a previous run", "path", w.path, "count", w.pending)
+	}
+	return w, nil
+}
+
+// Append writes transaction to the end of the log and syncs it to disk; it
+// returns repositories.ErrSpillFull when the record would exceed the size cap
+func (w *WAL) Append(ctx context.Context, transaction *entities.Transaction) error {
+	record, err := json.Marshal(transaction)
+	if err != nil {
+		return fmt.Errorf("failed to encode spilled transaction: %w", err)
+	}
+	record = append(record, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxBytes > 0 && w.size+int64(len(record)) > w.maxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used", repositories.ErrSpillFull, w.size, w.maxBytes)
+	}
+
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	if _, err := f.Write(record); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync spill file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close spill file: %w", err)
+	}
+
+	w.size += int64(len(record))
+	w.pending++
+	metrics.SpilledTransactions.Set(float64(w.pending))
+	return nil
+}
+
+// Len returns the number of transactions waiting in the log
+func (w *WAL) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.pending
+}
+
+// Drain passes the logged transactions in order to store and removes the
+// stored ones from the log; it stops at the first failure, returning how many
+// transactions were drained. Appends may continue while store runs
+func (w *WAL) Drain(ctx context.Context, store StoreFunc) (int, error) {
+	w.drainMu.Lock()
+	defer w.drainMu.Unlock()
+
+	w.mu.Lock()
+	snapshot := w.size
+	data, err := os.ReadFile(w.path)
+	w.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) || snapshot == 0 {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	data = data[:snapshot]
+
+	drained := 0
+	rest := data
+	var storeErr error
+	for len(rest) > 0 && ctx.Err() == nil {
+		line, next, _ := bytes.Cut(rest, []byte{'\n'})
+
+		var transaction entities.Transaction
+		if err := json.Unmarshal(line, &transaction); err != nil {
+			w.logger.Error("Discarding unreadable spill record", "error", err, "path", w.path)
+			rest = next
+			continue
+		}
+		if err := store(ctx, &transaction); err != nil {
+			storeErr = err
+			break
+		}
+		drained++
+		rest = next
+	}
+	if storeErr == nil {
+		storeErr = ctx.Err()
+	}
+
+	if len(rest) == len(data) {
+		return drained, storeErr
+	}
+	if err := w.compact(snapshot, rest); err != nil {
+		return drained, err
+	}
+	return drained, storeErr
+}
+
+// compact replaces the first snapshot bytes of the log by rest, keeping
+// whatever was appended after them
+func (w *WAL) compact(snapshot int64, rest []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return fmt.Errorf("failed to read spill file: %w", err)
+	}
+	remaining := append(rest[:len(rest):len(rest)], data[snapshot:]...)
+
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create spill file: %w", err)
+	}
+	if _, err := f.Write(remaining); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync spill file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close spill file: %w", err)
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		return fmt.Errorf("failed to replace spill file: %w", err)
+	}
+
+	w.size = int64(len(remaining))
+	w.pending = bytes.Count(remaining, []byte{'\n'})
+	metrics.SpilledTransactions.Set(float64(w.pending))
+	return nil
+}
+
+// Run drains the log into store every interval until ctx is done, so spilled
+// transactions reach the database once it recovers
+func (w *WAL) Run(ctx context.Context, interval time.Duration, store StoreFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if w.Len() == 0 {
+			continue
+		}
+		drained, err := w.Drain(ctx, store)
+		if drained > 0 {
+			w.logger.Info("Drained spilled transactions", "count", drained, "remaining", w.Len())
+		}
+		if err != nil && ctx.Err() == nil {
+			w.logger.Warn("Spilled transactions not drained yet", "error", err, "remaining", w.Len())
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package spill
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/internal/infrastructures/database/memory"
+	"transaction-consumer/internal/usecases"
+	"transaction-consumer/pkg/logger"
+)
+
+// Mock logger for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, args ...interface{}) {}
+func (m *mockLogger) Info(msg string, args ...interface{})  {}
+func (m *mockLogger) Warn(msg string, args ...interface{})  {}
+func (m *mockLogger) Error(msg string, args ...interface{}) {}
+func (m *mockLogger) Fatal(msg string, args ...interface{}) {}
+
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
+func newTestTransaction(transactionID string) *entities.Transaction {
+	return &entities.Transaction{
+		UserID:            1,
+		AccountID:         "account-1",
+		TransactionID:     transactionID,
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100,
+		BalanceBefore:     1000,
+		BalanceAfter:      1000,
+		Currency:          "IDR",
+	}
+}
+
+// failingRepository fails every call until recovered, like a database that
+// is down
+type failingRepository struct {
+	repositories.TransactionRepository
+	down bool
+}
+
+func (r *failingRepository) Exists(ctx context.Context, transactionID string) (bool, error) {
+	if r.down {
+		return false, errors.New("connection refused")
+	}
+	return r.TransactionRepository.Exists(ctx, transactionID)
+}
+
+func (r *failingRepository) Create(ctx context.Context, transaction *entities.Transaction) error {
+	if r.down {
+		return errors.New("connection refused")
+	}
+	return r.TransactionRepository.Create(ctx, transaction)
+}
+
+func TestWAL_SpillAndDrainOnRecovery(t *testing.T) {
+	ctx := context.Background()
+	wal, err := Open(t.TempDir(), 0, &mockLogger{})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	repo := &failingRepository{TransactionRepository: memory.NewTransactionRepository(&mockLogger{}), down: true}
+	useCase := usecases.NewTransactionUseCase(repo, &mockLogger{}, usecases.WithSpill(wal))
+	drain := usecases.DrainSpilled(usecases.NewTransactionUseCase(repo, &mockLogger{}), &mockLogger{})
+
+	for _, id := range []string{"trans-1", "trans-2"} {
+		result, err := useCase.ProcessTransaction(ctx, newTestTransaction(id))
+		if err != nil {
+			t.Fatalf("Expected transaction to be spilled, got: %v", err)
+		}
+		if result != usecases.ProcessResultSpilled {
+			t.Errorf("Expected result %q, got %q", usecases.ProcessResultSpilled, result)
+		}
+	}
+
+	drained, err := wal.Drain(ctx, drain)
+	if err == nil || drained != 0 {
+		t.Errorf("Expected drain to fail while the database is down, drained %d, error: %v", drained, err)
+	}
+	if wal.Len() != 2 {
+		t.Fatalf("Expected 2 spilled transactions, got %d", wal.Len())
+	}
+
+	repo.down = false
+	drained, err = wal.Drain(ctx, drain)
+	if err != nil {
+		t.Fatalf("Drain() error: %v", err)
+	}
+	if drained != 2 || wal.Len() != 0 {
+		t.Errorf("Expected 2 transactions drained and none left, drained %d, left %d", drained, wal.Len())
+	}
+	for _, id := range []string{"trans-1", "trans-2"} {
+		if exists, _ := repo.Exists(ctx, id); !exists {
+			t.Errorf("Expected %s to be stored after recovery", id)
+		}
+	}
+}
+
+func TestWAL_DrainStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	wal, err := Open(t.TempDir(), 0, &mockLogger{})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	for _, id := range []string{"trans-1", "trans-2", "trans-3"} {
+		if err := wal.Append(ctx, newTestTransaction(id)); err != nil {
+			t.Fatalf("Append() error: %v", err)
+		}
+	}
+
+	var stored []string
+	drained, err := wal.Drain(ctx, func(ctx context.Context, transaction *entities.Transaction) error {
+		if transaction.TransactionID == "trans-2" {
+			return errors.New("connection refused")
+		}
+		stored = append(stored, transaction.TransactionID)
+		return nil
+	})
+	if err == nil || drained != 1 {
+		t.Errorf("Expected drain to stop after 1 transaction, drained %d, error: %v", drained, err)
+	}
+	if wal.Len() != 2 {
+		t.Errorf("Expected 2 transactions left, got %d", wal.Len())
+	}
+
+	// Appends made after a partial drain stay behind the remaining records
+	if err := wal.Append(ctx, newTestTransaction("trans-4")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	drained, err = wal.Drain(ctx, func(ctx context.Context, transaction *entities.Transaction) error {
+		stored = append(stored, transaction.TransactionID)
+		return nil
+	})
+	if err != nil || drained != 3 {
+		t.Errorf("Expected 3 transactions drained, drained %d, error: %v", drained, err)
+	}
+
+	expected := []string{"trans-1", "trans-2", "trans-3", "trans-4"}
+	if len(stored) != len(expected) {
+		t.Fatalf("Expected %v stored, got %v", expected, stored)
+	}
+	for i := range expected {
+		if stored[i] != expected[i] {
+			t.Errorf("Expected %v stored in order, got %v", expected, stored)
+			break
+		}
+	}
+}
+
+func TestWAL_AppendFull(t *testing.T) {
+	ctx := context.Background()
+	wal, err := Open(t.TempDir(), 400, &mockLogger{})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+
+	if err := wal.Append(ctx, newTestTransaction("trans-1")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+	err = wal.Append(ctx, newTestTransaction("trans-2"))
+	if !errors.Is(err, repositories.ErrSpillFull) {
+		t.Errorf("Expected ErrSpillFull, got: %v", err)
+	}
+	if wal.Len() != 1 {
+		t.Errorf("Expected 1 spilled transaction, got %d", wal.Len())
+	}
+}
+
+func TestOpen_ReplaysPreviousRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	wal, err := Open(dir, 0, &mockLogger{})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if err := wal.Append(ctx, newTestTransaction("trans-1")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+
+	// Simulate a crash in the middle of the next append
+	f, err := os.OpenFile(filepath.Join(dir, fileName), os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		t.Fatalf("Failed to open spill file: %v", err)
+	}
+	if _, err := f.WriteString(`{"transactionId":"trans-2","amo`); err != nil {
+		t.Fatalf("Failed to write spill file: %v", err)
+	}
+	f.Close()
+
+	reopened, err := Open(dir, 0, &mockLogger{})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if reopened.Len() != 1 {
+		t.Fatalf("Expected 1 spilled transaction after reopening, got %d", reopened.Len())
+	}
+
+	var stored []string
+	_, err = reopened.Drain(ctx, func(ctx context.Context, transaction *entities.Transaction) error {
+		stored = append(stored, transaction.TransactionID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Drain() error: %v", err)
+	}
+	if len(stored) != 1 || stored[0] != "trans-1" {
+		t.Errorf("Expected only trans-1 to be drained, got %v", stored)
+	}
+}
+
+func TestWAL_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wal, err := Open(t.TempDir(), 0, &mockLogger{})
+	if err != nil {
+		t.Fatalf("Open() error: %v", err)
+	}
+	if err := wal.Append(ctx, newTestTransaction("trans-1")); err != nil {
+		t.Fatalf("Append() error: %v", err)
+	}
+
+	stored := make(chan string, 1)
+	go wal.Run(ctx, 10*time.Millisecond, func(ctx context.Context, transaction *entities.Transaction) error {
+		stored <- transaction.TransactionID
+		return nil
+	})
+
+	select {
+	case id := <-stored:
+		if id != "trans-1" {
+			t.Errorf("Expected trans-1 to be drained, got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the spill to be drained")
+	}
+}
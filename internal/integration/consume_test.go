@@ -0,0 +1,195 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+	"transaction-consumer/internal/infrastructures/config"
+	"transaction-consumer/internal/infrastructures/database/postgres"
+	"transaction-consumer/internal/usecases"
+	"transaction-consumer/pkg/logger"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/testcontainers/testcontainers-go"
+	tckafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	kafkahandler "transaction-consumer/internal/deliveries"
+	kafkainfra "transaction-consumer/internal/infrastructures/kafka/consumer"
+)
+
+const (
+	testTopic         = "transactions"
+	testTransactionID = "trans-integration-1"
+	testMessage       = `{"userId":123,"accountId":"account-123","transactionId":"` + testTransactionID + `",` +
+		`"transactionType":"TOPUP","transactionStatus":"SUCCESS","amount":100.5,` +
+		`"balanceBefore":1000,"balanceAfter":1100.5,"currency":"IDR",` +
+		`"createdAt":[2024,1,1,0,0,0],"updatedAt":[2024,1,1,0,0,0]}`
+)
+
+func TestConsume_StoresProducedTransaction(t *testing.T) {
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	brokers := startKafka(ctx, t)
+	startPostgres(ctx, t)
+	t.Setenv("KAFKA_BROKERS", brokers[0])
+	t.Setenv("KAFKA_TOPIC", testTopic)
+	t.Setenv("KAFKA_GROUP_ID", "transaction-consumer-integration")
+	t.Setenv("KAFKA_MAX_MESSAGES", "1")
+	t.Setenv("DB_SSLMODE", "disable")
+	t.Setenv("DB_AUTO_MIGRATE", "true")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("Failed to load configuration: %v", err)
+	}
+	log := logger.NewLogger()
+
+	db, err := postgres.NewConnection(ctx, cfg.Database, cfg.App)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer postgres.CloseConnection(db)
+	if err := postgres.AutoMigrate(db, cfg.Database); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	repo := postgres.NewTransactionRepository(db, log, postgres.WithTableName(cfg.Database.TableName))
+	handler := kafkahandler.NewTransactionHandler(usecases.NewTransactionUseCase(repo, log), log)
+
+	kafkaConsumer, err := kafkainfra.NewConsumer(cfg.Kafka, log)
+	if err != nil {
+		t.Fatalf("Failed to create Kafka consumer: %v", err)
+	}
+	defer kafkaConsumer.Close()
+
+	consumed := make(chan error, 1)
+	go func() {
+		consumed <- kafkaConsumer.Consume(ctx, handler.Handle)
+	}()
+
+	// A new consumer group starts at the latest offset once its partitions are
+	// assigned, so the message is produced until it is consumed; redeliveries
+	// are skipped as duplicates
+	writer := &kafka.Writer{Addr: kafka.TCP(brokers...), Topic: testTopic}
+	defer writer.Close()
+	produce := time.NewTicker(time.Second)
+	defer produce.Stop()
+	for done := false; !done; {
+		if err := writer.WriteMessages(ctx, kafka.Message{Key: []byte(testTransactionID), Value: []byte(testMessage)}); err != nil {
+			t.Logf("Failed to produce message, retrying: %v", err)
+		}
+		select {
+		case err := <-consumed:
+			if err != nil {
+				t.Fatalf("Consume should return nil after KAFKA_MAX_MESSAGES, got: %v", err)
+			}
+			done = true
+		case <-produce.C:
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for the message to be consumed")
+		}
+	}
+
+	var stored struct {
+		TransactionType string
+		Amount          float64
+		BalanceAfter    float64
+	}
+	err = db.WithContext(ctx).Table(postgres.DefaultTransactionTable).
+		Select("transaction_type, amount, balance_after").
+		Where("transaction_id = ?", testTransactionID).
+		Take(&stored).Error
+	if err != nil {
+		t.Fatalf("Expected the transaction to be stored in %s: %v", postgres.DefaultTransactionTable, err)
+	}
+	if stored.TransactionType != "TOPUP" || stored.Amount != 100.5 || stored.BalanceAfter != 1100.5 {
+		t.Errorf("Unexpected stored transaction: %+v", stored)
+	}
+}
+
+// startKafka starts a single-node Kafka with the test topic and returns its
+// brokers
+func startKafka(ctx context.Context, t *testing.T) []string {
+	t.Helper()
+
+	container, err := tckafka.Run(ctx, "confluentinc/confluent-local:7.5.0", tckafka.WithClusterID("integration"))
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("Failed to start Kafka: %v", err)
+	}
+	brokers, err := container.Brokers(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get Kafka brokers: %v", err)
+	}
+
+	if err := createTopic(brokers[0], testTopic); err != nil {
+		t.Fatalf("Failed to create topic %s: %v", testTopic, err)
+	}
+	return brokers
+}
+
+// createTopic creates topic with a single partition through the controller
+// of the cluster of broker
+func createTopic(broker, topic string) error {
+	conn, err := kafka.Dial("tcp", broker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	if err != nil {
+		return err
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return err
+	}
+	defer controllerConn.Close()
+
+	err = controllerConn.CreateTopics(kafka.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1})
+	if errors.Is(err, kafka.TopicAlreadyExists) {
+		return nil
+	}
+	return err
+}
+
+// startPostgres starts Postgres and points the DB_ environment of t at it
+func startPostgres(ctx context.Context, t *testing.T) {
+	t.Helper()
+
+	container, err := tcpostgres.Run(ctx, "postgres:16-alpine",
+		tcpostgres.WithDatabase("transactions"),
+		tcpostgres.WithUsername("consumer"),
+		tcpostgres.WithPassword("consumer"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("Failed to start Postgres: %v", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get Postgres host: %v", err)
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		t.Fatalf("Failed to get Postgres port: %v", err)
+	}
+
+	t.Setenv("DB_HOST", host)
+	t.Setenv("DB_PORT", port.Port())
+	t.Setenv("DB_USER", "consumer")
+	t.Setenv("DB_PASSWORD", "consumer")
+	t.Setenv("DB_NAME", "transactions")
+}
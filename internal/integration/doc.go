@@ -0,0 +1,6 @@
+// Package integration holds the end-to-end tests running the consumer
+// against real Kafka and Postgres containers. They are opt-in, as they need
+// Docker:
+//
+//	go test -tags integration ./internal/integration/...
+package integration
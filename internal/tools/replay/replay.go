@@ -0,0 +1,140 @@
+// Package replay feeds dumps of dead-lettered messages back through the
+// transaction handler
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"transaction-consumer/pkg/logger"
+)
+
+// maxLineSize bounds a single line of a dump
+const maxLineSize = 10 * 1024 * 1024
+
+// HandleFunc processes one raw message, such as TransactionHandler.HandleMessage
+type HandleFunc func(ctx context.Context, message []byte) error
+
+// FetchFunc reads the value of the message at offset of partition of topic
+// back from Kafka, such as consumer.SourceFetcher.Fetch; topic is empty when
+// the dead letter did not record it
+type FetchFunc func(ctx context.Context, topic string, partition int, offset int64) ([]byte, error)
+
+// Result tallies the outcome of a replay
+type Result struct {
+	Succeeded int
+	Failed    int
+}
+
+// Replayer feeds newline-delimited raw messages to a HandleFunc
+type Replayer struct {
+	handle          HandleFunc
+	logger          logger.Logger
+	continueOnError bool
+	fetchSource     FetchFunc
+}
+
+// Option configures optional behaviour of the replayer
+type Option func(*Replayer)
+
+// WithContinueOnError keeps replaying after a message fails instead of
+// stopping at the first failure
+func WithContinueOnError(enabled bool) Option {
+	return func(r *Replayer) {
+		r.continueOnError = enabled
+	}
+}
+
+// WithFromSource replays each dead letter from its source topic at the
+// position recorded in its envelope, read with fetch, instead of from the
+// copy of the value in the envelope; lines that are not envelopes fail
+func WithFromSource(fetch FetchFunc) Option {
+	return func(r *Replayer) {
+		r.fetchSource = fetch
+	}
+}
+
+// New creates a replayer feeding messages to handle
+func New(handle HandleFunc, log logger.Logger, opts ...Option) *Replayer {
+	r := &Replayer{handle: handle, logger: log}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run replays every non-blank line of dump as one message, either raw or
+// wrapped in a dead letter envelope as published by the consumer. It stops at
+// the first failing message unless continuing on error, in which case
+// failures are logged and tallied in the returned result
+func (r *Replayer) Run(ctx context.Context, dump io.Reader) (Result, error) {
+	var result Result
+
+	scanner := bufio.NewScanner(dump)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		message := bytes.TrimSpace(scanner.Bytes())
+		if len(message) == 0 {
+			continue
+		}
+		if err := r.replay(ctx, message); err != nil {
+			result.Failed++
+			if !r.continueOnError {
+				return result, fmt.Errorf("failed to replay line %d: %w", line, err)
+			}
+			r.logger.Warn("Failed to replay message, continuing", "line", line, "error", err)
+			continue
+		}
+		result.Succeeded++
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("failed to read dump: %w", err)
+	}
+
+	return result, nil
+}
+
+// replay handles the message of line, read from its source topic when
+// replaying from source
+func (r *Replayer) replay(ctx context.Context, line []byte) error {
+	if r.fetchSource == nil {
+		return r.handle(ctx, originalValue(line))
+	}
+
+	var envelope struct {
+		Topic     string `json:"topic"`
+		Partition *int   `json:"partition"`
+		Offset    *int64 `json:"offset"`
+	}
+	if err := json.Unmarshal(line, &envelope); err != nil || envelope.Partition == nil || envelope.Offset == nil {
+		return errors.New("line is not a dead letter envelope with a source position")
+	}
+
+	value, err := r.fetchSource(ctx, envelope.Topic, *envelope.Partition, *envelope.Offset)
+	if err != nil {
+		return fmt.Errorf("failed to read message from source: %w", err)
+	}
+	return r.handle(ctx, value)
+}
+
+// originalValue returns the original message wrapped in line when it is a
+// dead letter envelope, or line itself when it is a raw message
+func originalValue(line []byte) []byte {
+	var envelope struct {
+		OriginalValue *[]byte `json:"originalValue"`
+	}
+	if err := json.Unmarshal(line, &envelope); err != nil || envelope.OriginalValue == nil {
+		return line
+	}
+	return *envelope.OriginalValue
+}
@@ -0,0 +1,154 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"transaction-consumer/pkg/logger"
+)
+
+// Mock logger for testing
+type mockLogger struct{}
+
+func (m *mockLogger) Debug(msg string, args ...interface{}) {}
+func (m *mockLogger) Info(msg string, args ...interface{})  {}
+func (m *mockLogger) Warn(msg string, args ...interface{})  {}
+func (m *mockLogger) Error(msg string, args ...interface{}) {}
+func (m *mockLogger) Fatal(msg string, args ...interface{}) {}
+
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
+// validJSON fails messages that are not JSON, as the handler rejects them
+func validJSON(handled *[]string) HandleFunc {
+	return func(ctx context.Context, message []byte) error {
+		if !json.Valid(message) {
+			return errors.New("malformed message")
+		}
+		*handled = append(*handled, string(message))
+		return nil
+	}
+}
+
+func openFixture(t *testing.T) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/dlq.jsonl")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestReplayer_Run_ContinueOnError(t *testing.T) {
+	var handled []string
+	r := New(validJSON(&handled), &mockLogger{}, WithContinueOnError(true))
+
+	result, err := r.Run(context.Background(), openFixture(t))
+	if err != nil {
+		t.Fatalf("Run should not return error, got: %v", err)
+	}
+	if result != (Result{Succeeded: 3, Failed: 1}) {
+		t.Errorf("Expected 3 succeeded and 1 failed, got %+v", result)
+	}
+	if len(handled) != 3 || !strings.Contains(handled[2], "TXN-3") {
+		t.Errorf("Expected messages after the failure to be replayed, got %v", handled)
+	}
+}
+
+func TestReplayer_Run_StopsAtFirstFailure(t *testing.T) {
+	var handled []string
+	r := New(validJSON(&handled), &mockLogger{})
+
+	result, err := r.Run(context.Background(), openFixture(t))
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("Expected an error for line 4, got %v", err)
+	}
+	if result != (Result{Succeeded: 2, Failed: 1}) {
+		t.Errorf("Expected 2 succeeded and 1 failed, got %+v", result)
+	}
+}
+
+func TestReplayer_Run_StopsWhenContextCancelled(t *testing.T) {
+	var handled []string
+	r := New(validJSON(&handled), &mockLogger{}, WithContinueOnError(true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := r.Run(ctx, strings.NewReader(`{"transactionId":"TXN-1"}`))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if result != (Result{}) || len(handled) != 0 {
+		t.Errorf("Expected nothing replayed, got %+v", result)
+	}
+}
+
+func TestReplayer_Run_UnwrapsDeadLetterEnvelopes(t *testing.T) {
+	var handled []string
+	r := New(validJSON(&handled), &mockLogger{})
+
+	dump := `{"originalValue":"eyJ0cmFuc2FjdGlvbklkIjoiVFhOLTEifQ==","errorType":"invalid_transaction","attempts":1}
+{"transactionId":"TXN-2"}
+`
+	result, err := r.Run(context.Background(), strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("Run should not return error, got: %v", err)
+	}
+	if result != (Result{Succeeded: 2}) {
+		t.Errorf("Expected 2 succeeded, got %+v", result)
+	}
+	if len(handled) != 2 || handled[0] != `{"transactionId":"TXN-1"}` || handled[1] != `{"transactionId":"TXN-2"}` {
+		t.Errorf("Expected the original value of the envelope and the raw message, got %v", handled)
+	}
+}
+
+func TestReplayer_Run_FromSource(t *testing.T) {
+	var handled []string
+	var fetched []string
+	fetch := func(ctx context.Context, topic string, partition int, offset int64) ([]byte, error) {
+		fetched = append(fetched, fmt.Sprintf("%s/%d/%d", topic, partition, offset))
+		return []byte(fmt.Sprintf(`{"transactionId":"TXN-%d"}`, offset)), nil
+	}
+	r := New(validJSON(&handled), &mockLogger{}, WithFromSource(fetch), WithContinueOnError(true))
+
+	dump := `{"originalValue":"bm90IGpzb24=","errorType":"malformed","topic":"transactions","partition":2,"offset":17}
+{"originalValue":"bm90IGpzb24=","errorType":"malformed","partition":0,"offset":0}
+{"transactionId":"TXN-raw"}
+`
+	result, err := r.Run(context.Background(), strings.NewReader(dump))
+	if err != nil {
+		t.Fatalf("Run should not return error, got: %v", err)
+	}
+	if result != (Result{Succeeded: 2, Failed: 1}) {
+		t.Errorf("Expected 2 succeeded and the raw message failed, got %+v", result)
+	}
+	if len(fetched) != 2 || fetched[0] != "transactions/2/17" || fetched[1] != "/0/0" {
+		t.Errorf("Expected the recorded positions to be fetched, got %v", fetched)
+	}
+	if len(handled) != 2 || handled[0] != `{"transactionId":"TXN-17"}` {
+		t.Errorf("Expected the source values to be handled instead of the envelope copies, got %v", handled)
+	}
+}
+
+func TestReplayer_Run_FromSourceFetchFailure(t *testing.T) {
+	var handled []string
+	fetch := func(ctx context.Context, topic string, partition int, offset int64) ([]byte, error) {
+		return nil, errors.New("offset 17 is no longer available")
+	}
+	r := New(validJSON(&handled), &mockLogger{}, WithFromSource(fetch))
+
+	_, err := r.Run(context.Background(), strings.NewReader(`{"topic":"transactions","partition":2,"offset":17}`))
+	if err == nil || !strings.Contains(err.Error(), "no longer available") {
+		t.Errorf("Expected the fetch failure, got %v", err)
+	}
+	if len(handled) != 0 {
+		t.Errorf("Expected nothing handled, got %v", handled)
+	}
+}
@@ -0,0 +1,55 @@
+package usecases
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"transaction-consumer/internal/domain/entities"
+)
+
+// originalAmountKey is the metadata key keeping the amount of a transaction
+// as received when its sign is normalized
+const originalAmountKey = "originalAmount"
+
+// amountSigns maps the transaction types to the sign of their stored amount
+// when normalized: debits are negative and credits positive
+var amountSigns = map[entities.TransactionType]float64{
+	entities.TransactionTypeTopup:    1,
+	entities.TransactionTypeRefund:   1,
+	entities.TransactionTypePayment:  -1,
+	entities.TransactionTypeTransfer: -1,
+}
+
+// normalizeAmountSign signs the amount of transaction by its type, keeping the
+// amount as received in its metadata; types without a sign are left as is
+func (uc *transactionUseCase) normalizeAmountSign(transaction *entities.Transaction) error {
+	if !uc.amountSign {
+		return nil
+	}
+
+	sign, ok := amountSigns[transaction.TransactionType]
+	if !ok {
+		return nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if transaction.Metadata != nil {
+		if err := json.Unmarshal([]byte(*transaction.Metadata), &fields); err != nil {
+			return fmt.Errorf("%w: metadata must be a JSON object to keep the original amount", ErrInvalidTransaction)
+		}
+		if fields == nil {
+			fields = map[string]json.RawMessage{}
+		}
+	}
+	fields[originalAmountKey] = json.RawMessage(strconv.FormatFloat(transaction.Amount, 'f', -1, 64))
+
+	metadata, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to keep the original amount in metadata: %w", err)
+	}
+	encoded := string(metadata)
+	transaction.Metadata = &encoded
+	transaction.Amount = sign * math.Abs(transaction.Amount)
+	return nil
+}
@@ -0,0 +1,208 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
+)
+
+// ErrCircuitOpen is returned without calling the repository while the
+// circuit breaker is open; it is transient, and the message is retried
+// without using up its retries until the breaker closes
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker is open", ErrTransient)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreakerRepository fails fast while the wrapped repository keeps
+// failing. After threshold consecutive failures it opens and rejects every
+// call with ErrCircuitOpen for cooldown, then lets a single probe through:
+// its success closes the breaker again, its failure reopens it
+type circuitBreakerRepository struct {
+	repo      repositories.TransactionRepository
+	logger    logger.Logger
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreakerRepository wraps repo in a circuit breaker opening after
+// threshold consecutive failures for cooldown; a threshold below 1 returns
+// repo unchanged
+func NewCircuitBreakerRepository(repo repositories.TransactionRepository, log logger.Logger, threshold int, cooldown time.Duration) repositories.TransactionRepository {
+	if threshold < 1 {
+		return repo
+	}
+	return &circuitBreakerRepository{
+		repo:      repo,
+		logger:    log,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports ErrCircuitOpen unless a call may reach the repository
+func (b *circuitBreakerRepository) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.logger.Info("Circuit breaker half-open, probing the database")
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call it allowed
+func (b *circuitBreakerRepository) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !isBreakerFailure(err) {
+		if b.state != breakerClosed {
+			b.logger.Info("Circuit breaker closed, the database recovered")
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.logger.Warn("Circuit breaker opened, failing database calls fast",
+			"failures", b.failures, "cooldown", b.cooldown, "error", err)
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// isBreakerFailure reports whether err suggests the database is unhealthy,
+// as opposed to a result about the transaction itself or a cancelled call
+func isBreakerFailure(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, repositories.ErrDuplicateTransaction),
+		errors.Is(err, repositories.ErrTransactionNotFound),
+		errors.Is(err, repositories.ErrOutOfOrderUpdate),
+		errors.Is(err, context.Canceled):
+		return false
+	}
+	return true
+}
+
+// do runs call through the breaker
+func (b *circuitBreakerRepository) do(call func() error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := call()
+	b.record(err)
+	return err
+}
+
+// guard runs call through b, returning its result
+func guard[T any](b *circuitBreakerRepository, call func() (T, error)) (T, error) {
+	var result T
+	err := b.do(func() error {
+		var err error
+		result, err = call()
+		return err
+	})
+	return result, err
+}
+
+func (b *circuitBreakerRepository) Create(ctx context.Context, transaction *entities.Transaction) error {
+	return b.do(func() error { return b.repo.Create(ctx, transaction) })
+}
+
+func (b *circuitBreakerRepository) SaveOffset(ctx context.Context, offset *entities.ProcessedOffset) error {
+	return b.do(func() error { return b.repo.SaveOffset(ctx, offset) })
+}
+
+// WithTx counts the whole transaction as a single call; fn gets the
+// repository bound to the transaction, without the breaker
+func (b *circuitBreakerRepository) WithTx(ctx context.Context, fn func(repo repositories.TransactionRepository) error) error {
+	return b.do(func() error { return b.repo.WithTx(ctx, fn) })
+}
+
+func (b *circuitBreakerRepository) Upsert(ctx context.Context, transaction *entities.Transaction) error {
+	return b.do(func() error { return b.repo.Upsert(ctx, transaction) })
+}
+
+func (b *circuitBreakerRepository) GetByTransactionID(ctx context.Context, transactionID string, opts ...repositories.QueryOption) (*entities.Transaction, error) {
+	return guard(b, func() (*entities.Transaction, error) { return b.repo.GetByTransactionID(ctx, transactionID, opts...) })
+}
+
+func (b *circuitBreakerRepository) Exists(ctx context.Context, transactionID string) (bool, error) {
+	return guard(b, func() (bool, error) { return b.repo.Exists(ctx, transactionID) })
+}
+
+func (b *circuitBreakerRepository) ExistsWithStatus(ctx context.Context, transactionID string, status entities.TransactionStatus) (bool, error) {
+	return guard(b, func() (bool, error) { return b.repo.ExistsWithStatus(ctx, transactionID, status) })
+}
+
+func (b *circuitBreakerRepository) GetByAccountAndDateRange(ctx context.Context, accountID string, from, to time.Time) ([]*entities.Transaction, error) {
+	return guard(b, func() ([]*entities.Transaction, error) {
+		return b.repo.GetByAccountAndDateRange(ctx, accountID, from, to)
+	})
+}
+
+func (b *circuitBreakerRepository) GetLatestByAccount(ctx context.Context, accountID string) (*entities.Transaction, error) {
+	return guard(b, func() (*entities.Transaction, error) { return b.repo.GetLatestByAccount(ctx, accountID) })
+}
+
+func (b *circuitBreakerRepository) AggregateByType(ctx context.Context, from, to time.Time) ([]entities.TypeAggregate, error) {
+	return guard(b, func() ([]entities.TypeAggregate, error) { return b.repo.AggregateByType(ctx, from, to) })
+}
+
+func (b *circuitBreakerRepository) MarkReversed(ctx context.Context, transactionID string, reason string) error {
+	return b.do(func() error { return b.repo.MarkReversed(ctx, transactionID, reason) })
+}
+
+func (b *circuitBreakerRepository) UpdateStatus(ctx context.Context, transactionID string, status entities.TransactionStatus, balanceAfter float64) error {
+	return b.do(func() error { return b.repo.UpdateStatus(ctx, transactionID, status, balanceAfter) })
+}
+
+func (b *circuitBreakerRepository) ExportAll(ctx context.Context, w io.Writer, opts ...repositories.QueryOption) error {
+	return b.do(func() error { return b.repo.ExportAll(ctx, w, opts...) })
+}
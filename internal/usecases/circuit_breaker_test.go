@@ -0,0 +1,132 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"transaction-consumer/internal/domain/entities"
+	"transaction-consumer/internal/domain/repositories"
+)
+
+// countingRepository counts the Exists calls reaching the repository
+type countingRepository struct {
+	*mockTransactionRepository
+	calls int
+}
+
+func (r *countingRepository) Exists(ctx context.Context, transactionID string) (bool, error) {
+	r.calls++
+	return r.mockTransactionRepository.Exists(ctx, transactionID)
+}
+
+func newTestBreaker(repo repositories.TransactionRepository, threshold int, cooldown time.Duration) (*circuitBreakerRepository, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreakerRepository(repo, &mockLogger{}, threshold, cooldown).(*circuitBreakerRepository)
+	breaker.now = func() time.Time { return now }
+	return breaker, &now
+}
+
+func TestCircuitBreaker_OpensAfterThresholdAndFailsFast(t *testing.T) {
+	repo := &countingRepository{mockTransactionRepository: &mockTransactionRepository{existsError: errors.New("connection refused")}}
+	breaker, _ := newTestBreaker(repo, 3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if _, err := breaker.Exists(context.Background(), "txn-1"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d: expected the repository error, got %v", i, err)
+		}
+	}
+	if breaker.state != breakerOpen {
+		t.Fatalf("expected breaker to be open, got %s", breaker.state)
+	}
+
+	_, err := breaker.Exists(context.Background(), "txn-1")
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrTransient) {
+		t.Errorf("expected a transient circuit open error, got %v", err)
+	}
+	if repo.calls != 3 {
+		t.Errorf("expected an open breaker not to reach the repository, got %d calls", repo.calls)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbeSuccessCloses(t *testing.T) {
+	repo := &countingRepository{mockTransactionRepository: &mockTransactionRepository{existsError: errors.New("connection refused")}}
+	breaker, now := newTestBreaker(repo, 1, time.Minute)
+
+	breaker.Exists(context.Background(), "txn-1")
+	if breaker.state != breakerOpen {
+		t.Fatalf("expected breaker to be open, got %s", breaker.state)
+	}
+
+	*now = now.Add(time.Minute)
+	repo.existsError = nil
+	if _, err := breaker.Exists(context.Background(), "txn-1"); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	if breaker.state != breakerClosed || breaker.failures != 0 {
+		t.Errorf("expected breaker to be closed and reset, got %s with %d failures", breaker.state, breaker.failures)
+	}
+	if repo.calls != 2 {
+		t.Errorf("expected 2 repository calls, got %d", repo.calls)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenProbeFailureReopens(t *testing.T) {
+	repo := &countingRepository{mockTransactionRepository: &mockTransactionRepository{existsError: errors.New("connection refused")}}
+	breaker, now := newTestBreaker(repo, 2, time.Minute)
+
+	breaker.Exists(context.Background(), "txn-1")
+	breaker.Exists(context.Background(), "txn-1")
+
+	*now = now.Add(time.Minute)
+	if _, err := breaker.Exists(context.Background(), "txn-1"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the probe to reach the repository and fail, got %v", err)
+	}
+	if breaker.state != breakerOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %s", breaker.state)
+	}
+
+	*now = now.Add(time.Second)
+	if _, err := breaker.Exists(context.Background(), "txn-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected the cooldown to restart after a failed probe, got %v", err)
+	}
+	if repo.calls != 3 {
+		t.Errorf("expected 3 repository calls, got %d", repo.calls)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenAllowsSingleProbe(t *testing.T) {
+	repo := &countingRepository{mockTransactionRepository: &mockTransactionRepository{}}
+	breaker, now := newTestBreaker(repo, 1, time.Minute)
+	breaker.state = breakerOpen
+	breaker.openedAt = *now
+
+	*now = now.Add(time.Minute)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("expected the first call after the cooldown to probe, got %v", err)
+	}
+	if err := breaker.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected calls during the probe to fail fast, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_DomainErrorsAreNotFailures(t *testing.T) {
+	repo := &mockTransactionRepository{createError: repositories.ErrDuplicateTransaction}
+	breaker, _ := newTestBreaker(repo, 1, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.Create(context.Background(), &entities.Transaction{TransactionID: "txn-1"}); !errors.Is(err, repositories.ErrDuplicateTransaction) {
+			t.Fatalf("expected the duplicate error, got %v", err)
+		}
+	}
+	if breaker.state != breakerClosed {
+		t.Errorf("expected duplicates to keep the breaker closed, got %s", breaker.state)
+	}
+}
+
+func TestNewCircuitBreakerRepository_DisabledReturnsRepository(t *testing.T) {
+	repo := &mockTransactionRepository{}
+	if got := NewCircuitBreakerRepository(repo, &mockLogger{}, 0, time.Minute); got != repo {
+		t.Errorf("expected a zero threshold to return the repository unchanged, got %T", got)
+	}
+}
@@ -0,0 +1,68 @@
+package usecases
+
+import (
+	"container/list"
+	"sync"
+	"transaction-consumer/internal/domain/entities"
+)
+
+// dedupKey identifies a stored transaction status; follow-up events of a
+// transaction carry a new status and must not hit the cache
+type dedupKey struct {
+	transactionID string
+	status        entities.TransactionStatus
+}
+
+// dedupCache remembers the most recently stored transaction statuses, so
+// redelivered duplicates are skipped without a database lookup. It is best
+// effort: a miss falls back to the database, whose unique index stays the
+// source of truth
+type dedupCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[dedupKey]*list.Element
+}
+
+// newDedupCache returns a cache holding up to size entries, evicting the
+// least recently used one when full
+func newDedupCache(size int) *dedupCache {
+	return &dedupCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[dedupKey]*list.Element, size),
+	}
+}
+
+// contains reports whether transactionID was stored with status, marking the
+// entry as recently used
+func (c *dedupCache) contains(transactionID string, status entities.TransactionStatus) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[dedupKey{transactionID, status}]
+	if ok {
+		c.order.MoveToFront(element)
+	}
+	return ok
+}
+
+// add records that transactionID is stored with status
+func (c *dedupCache) add(transactionID string, status entities.TransactionStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := dedupKey{transactionID, status}
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(key)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(dedupKey))
+	}
+}
@@ -0,0 +1,39 @@
+package usecases
+
+import (
+	"testing"
+	"transaction-consumer/internal/domain/entities"
+)
+
+func TestDedupCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newDedupCache(2)
+	cache.add("trans-1", entities.TransactionStatusPending)
+	cache.add("trans-2", entities.TransactionStatusPending)
+
+	// Using trans-1 makes trans-2 the least recently used entry
+	if !cache.contains("trans-1", entities.TransactionStatusPending) {
+		t.Fatal("Expected trans-1 to be cached")
+	}
+	cache.add("trans-3", entities.TransactionStatusPending)
+
+	if cache.contains("trans-2", entities.TransactionStatusPending) {
+		t.Error("Expected trans-2 to be evicted")
+	}
+	for _, id := range []string{"trans-1", "trans-3"} {
+		if !cache.contains(id, entities.TransactionStatusPending) {
+			t.Errorf("Expected %s to be cached", id)
+		}
+	}
+}
+
+func TestDedupCache_KeyedByStatus(t *testing.T) {
+	cache := newDedupCache(10)
+	cache.add("trans-1", entities.TransactionStatusPending)
+
+	if cache.contains("trans-1", entities.TransactionStatusSuccess) {
+		t.Error("Expected a new status of a cached transaction to miss")
+	}
+	if !cache.contains("trans-1", entities.TransactionStatusPending) {
+		t.Error("Expected the stored status to hit")
+	}
+}
@@ -0,0 +1,38 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"transaction-consumer/internal/domain/repositories"
+)
+
+var (
+	// ErrInvalidTransaction is returned for transactions that fail
+	// validation; processing them again can never succeed
+	ErrInvalidTransaction = errors.New("invalid transaction data")
+
+	// ErrDuplicateTransaction is returned when the transaction was stored
+	// concurrently by another consumer
+	ErrDuplicateTransaction = repositories.ErrDuplicateTransaction
+
+	// ErrTransactionNotFound is returned when a status update matches no
+	// stored transaction
+	ErrTransactionNotFound = repositories.ErrTransactionNotFound
+
+	// ErrOutOfOrderUpdate is returned by the repository when a status
+	// update would move a transaction backwards
+	ErrOutOfOrderUpdate = repositories.ErrOutOfOrderUpdate
+
+	// ErrTransient is returned for failures of the storage layer that may
+	// succeed when retried
+	ErrTransient = errors.New("transient failure")
+)
+
+// transient marks err as worth retrying unless the repository already
+// classified it
+func transient(err error) error {
+	if errors.Is(err, ErrDuplicateTransaction) || errors.Is(err, ErrTransactionNotFound) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrTransient, err)
+}
@@ -2,61 +2,769 @@ package usecases
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
 	"transaction-consumer/internal/domain/entities"
 	"transaction-consumer/internal/domain/repositories"
 	"transaction-consumer/pkg/logger"
+	"transaction-consumer/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProcessResult reports what ProcessTransaction did with a transaction
+type ProcessResult string
+
+const (
+	// ProcessResultInserted means the transaction was stored as a new row
+	ProcessResultInserted ProcessResult = "inserted"
+	// ProcessResultUpdated means the status of the stored transaction changed
+	ProcessResultUpdated ProcessResult = "updated"
+	// ProcessResultSkipped means nothing was stored, e.g. for a duplicate, an
+	// out-of-order status update or a dry run
+	ProcessResultSkipped ProcessResult = "skipped"
+	// ProcessResultSpilled means the database was unavailable and the
+	// transaction was buffered in the spill, to be stored once it recovers
+	ProcessResultSpilled ProcessResult = "spilled"
 )
 
 type TransactionUseCase interface {
-	ProcessTransaction(ctx context.Context, transaction *entities.Transaction) error
+	ProcessTransaction(ctx context.Context, transaction *entities.Transaction) (ProcessResult, error)
+	ReprocessTransaction(ctx context.Context, transaction *entities.Transaction) error
 }
 
+// ErrReprocessingDisabled is returned by ReprocessTransaction unless
+// reprocessing was enabled with WithReprocessing
+var ErrReprocessingDisabled = errors.New("transaction reprocessing is disabled")
+
+// balanceEpsilon is the tolerance used when comparing balance deltas, half of
+// the smallest unit stored in the decimal(15,2) columns
+const balanceEpsilon = 0.005
+
 type transactionUseCase struct {
-	transactionRepo repositories.TransactionRepository
-	logger          logger.Logger
+	transactionRepo       repositories.TransactionRepository
+	logger                logger.Logger
+	rejectBalanceMismatch bool
+	rejectMagnitude       bool
+	balanceContinuity     bool
+	duplicateDiff         bool
+	amountSign            bool
+	allowZeroAmount       bool
+	transactionalOffsets  bool
+	reprocessing          bool
+	dryRun                bool
+	defaultCurrency       string
+	auditSink             repositories.AuditSink
+	persistedEvents       repositories.PersistedEventPublisher
+	requirePersisted      bool
+	spill                 repositories.TransactionSpill
+	dedup                 *dedupCache
+	typeHandlers          map[entities.TransactionType]TypeHandler
+	tracer                trace.Tracer
+
+	validatorNames   []string
+	customValidators []Validator
+	knownTypes       []entities.TransactionType
+	knownStatuses    []entities.TransactionStatus
+	validateAll      bool
+	validation       *ValidationPipeline
+}
+
+// offsetContextKey is the context key of the offset of the message being
+// processed
+type offsetContextKey struct{}
+
+// ContextWithOffset returns a copy of ctx carrying the offset of the Kafka
+// message the transaction was consumed from
+func ContextWithOffset(ctx context.Context, offset *entities.ProcessedOffset) context.Context {
+	return context.WithValue(ctx, offsetContextKey{}, offset)
+}
+
+// offsetFromContext returns the message offset stored in ctx, if any
+func offsetFromContext(ctx context.Context) *entities.ProcessedOffset {
+	offset, _ := ctx.Value(offsetContextKey{}).(*entities.ProcessedOffset)
+	return offset
+}
+
+// Option configures optional behaviour of the transaction use case
+type Option func(*transactionUseCase)
+
+// WithRejectBalanceMismatch rejects successful transactions whose balance
+// delta does not match the amount instead of only logging a warning
+func WithRejectBalanceMismatch(reject bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.rejectBalanceMismatch = reject
+	}
+}
+
+// WithRejectBalanceMagnitudeMismatch rejects transactions whose balance
+// change differs in size from their amount, running the balance-magnitude
+// validator even when WithValidators does not list it
+func WithRejectBalanceMagnitudeMismatch(reject bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.rejectMagnitude = reject
+	}
+}
+
+// WithBalanceContinuityCheck warns when a new transaction does not start
+// from the balance the previous transaction of its account left behind, at
+// the cost of an extra read per transaction
+func WithBalanceContinuityCheck(enabled bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.balanceContinuity = enabled
+	}
+}
+
+// WithDuplicateDiff warns when a skipped duplicate differs from the stored
+// transaction, which points at a producer bug, at the cost of an extra read
+// per duplicate
+func WithDuplicateDiff(enabled bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.duplicateDiff = enabled
+	}
+}
+
+// WithAmountSignNormalization stores debit transactions, e.g. PAYMENT and
+// TRANSFER, with a negative amount and credit ones with a positive amount,
+// keeping the amount as received under "originalAmount" in the metadata
+func WithAmountSignNormalization(enabled bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.amountSign = enabled
+	}
+}
+
+// WithAllowZeroAmount accepts transactions with a zero amount, e.g. balance
+// adjustments or fee-free transfers, which the amount-bounds validator
+// rejects otherwise; negative amounts stay rejected
+func WithAllowZeroAmount(allow bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.allowZeroAmount = allow
+	}
+}
+
+// WithTransactionalOffsets records the offset carried by the context in the
+// same database transaction as the inserted transaction
+func WithTransactionalOffsets(enabled bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.transactionalOffsets = enabled
+	}
+}
+
+// WithReprocessing allows ReprocessTransaction to overwrite stored
+// transactions; normal consumption stays append-only either way
+func WithReprocessing(enabled bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.reprocessing = enabled
+	}
+}
+
+// WithDryRun validates and logs transactions without touching the
+// repository
+func WithDryRun(enabled bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.dryRun = enabled
+	}
+}
+
+// WithDefaultCurrency stores currency for transactions received without one
+// instead of the empty string; currencies are uppercased either way
+func WithDefaultCurrency(currency string) Option {
+	return func(uc *transactionUseCase) {
+		uc.defaultCurrency = strings.ToUpper(strings.TrimSpace(currency))
+	}
+}
+
+// WithAuditSink emits an audit event to sink for every inserted transaction
+func WithAuditSink(sink repositories.AuditSink) Option {
+	return func(uc *transactionUseCase) {
+		uc.auditSink = sink
+	}
+}
+
+// WithPersistedEventPublisher publishes a confirmation of every inserted
+// transaction and status update to publisher; nil publishes nothing
+func WithPersistedEventPublisher(publisher repositories.PersistedEventPublisher) Option {
+	return func(uc *transactionUseCase) {
+		uc.persistedEvents = publisher
+	}
+}
+
+// WithPersistedEventRequired fails processing when the confirmation cannot be
+// published instead of only logging it, so the message is retried. Retries
+// find the transaction stored, so duplicates publish their confirmation
+// again, making confirmations at-least-once
+func WithPersistedEventRequired(required bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.requirePersisted = required
+	}
+}
+
+// WithSpill buffers transactions in spill instead of failing when the
+// repository fails transiently, so their messages are committed during
+// database outages; spilled transactions are stored later through
+// DrainSpilled
+func WithSpill(spill repositories.TransactionSpill) Option {
+	return func(uc *transactionUseCase) {
+		uc.spill = spill
+	}
+}
+
+// WithDedupCache remembers the last size stored transaction statuses in
+// memory and skips redelivered duplicates of them without the database
+// lookup, or the duplicate diff; a size below 1 disables the cache
+func WithDedupCache(size int) Option {
+	return func(uc *transactionUseCase) {
+		uc.dedup = nil
+		if size > 0 {
+			uc.dedup = newDedupCache(size)
+		}
+	}
 }
 
-func NewTransactionUseCase(repo repositories.TransactionRepository, log logger.Logger) TransactionUseCase {
-	return &transactionUseCase{
+// WithTypeHandler replaces the handler of transactionType, or adds one for a
+// type without a default handler
+func WithTypeHandler(transactionType entities.TransactionType, handler TypeHandler) Option {
+	return func(uc *transactionUseCase) {
+		uc.typeHandlers[transactionType] = handler
+	}
+}
+
+// WithValidators runs the built-in validators names, e.g.
+// ValidatorRequiredFields, in order instead of DefaultValidators; unknown
+// names are skipped and no names keep the defaults
+func WithValidators(names ...string) Option {
+	return func(uc *transactionUseCase) {
+		if len(names) == 0 {
+			return
+		}
+		uc.validatorNames = make([]string, len(names))
+		for i, name := range names {
+			uc.validatorNames[i] = strings.ToLower(strings.TrimSpace(name))
+		}
+	}
+}
+
+// WithTransactionTypes makes the enum validator accept types instead of
+// entities.TransactionTypes, e.g. to take a new type without a release; no
+// types keep the defaults
+func WithTransactionTypes(types ...string) Option {
+	return func(uc *transactionUseCase) {
+		if len(types) == 0 {
+			return
+		}
+		uc.knownTypes = make([]entities.TransactionType, len(types))
+		for i, transactionType := range types {
+			uc.knownTypes[i] = entities.TransactionType(strings.ToUpper(strings.TrimSpace(transactionType)))
+		}
+	}
+}
+
+// WithTransactionStatuses makes the enum validator accept statuses instead
+// of entities.TransactionStatuses; no statuses keep the defaults
+func WithTransactionStatuses(statuses ...string) Option {
+	return func(uc *transactionUseCase) {
+		if len(statuses) == 0 {
+			return
+		}
+		uc.knownStatuses = make([]entities.TransactionStatus, len(statuses))
+		for i, status := range statuses {
+			uc.knownStatuses[i] = entities.TransactionStatus(strings.ToUpper(strings.TrimSpace(status)))
+		}
+	}
+}
+
+// WithValidator runs validator after the built-in validators
+func WithValidator(validator Validator) Option {
+	return func(uc *transactionUseCase) {
+		uc.customValidators = append(uc.customValidators, validator)
+	}
+}
+
+// WithValidateAll reports the failures of every validator, joined, instead
+// of only the first
+func WithValidateAll(all bool) Option {
+	return func(uc *transactionUseCase) {
+		uc.validateAll = all
+	}
+}
+
+// WithTracerProvider traces transaction processing with tp
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(uc *transactionUseCase) {
+		uc.tracer = tracing.Tracer(tp)
+	}
+}
+
+func NewTransactionUseCase(repo repositories.TransactionRepository, log logger.Logger, opts ...Option) TransactionUseCase {
+	uc := &transactionUseCase{
 		transactionRepo: repo,
 		logger:          log,
+		typeHandlers:    defaultTypeHandlers(),
+		tracer:          tracing.Tracer(nil),
+		validatorNames:  DefaultValidators,
+		knownTypes:      entities.TransactionTypes,
+		knownStatuses:   entities.TransactionStatuses,
+	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	if uc.rejectMagnitude && !slices.Contains(uc.validatorNames, ValidatorBalanceMagnitude) {
+		uc.validatorNames = append(slices.Clone(uc.validatorNames), ValidatorBalanceMagnitude)
 	}
+
+	validators := make([]Validator, 0, len(uc.validatorNames)+len(uc.customValidators))
+	for _, name := range uc.validatorNames {
+		validator, ok := uc.builtinValidator(name)
+		if !ok {
+			log.Warn("Skipping unknown validator", "validator", name)
+			continue
+		}
+		validators = append(validators, validator)
+	}
+	uc.validation = NewValidationPipeline(uc.validateAll, append(validators, uc.customValidators...)...)
+	return uc
 }
 
-func (uc *transactionUseCase) ProcessTransaction(ctx context.Context, transaction *entities.Transaction) error {
+func (uc *transactionUseCase) ProcessTransaction(ctx context.Context, transaction *entities.Transaction) (result ProcessResult, err error) {
+	ctx, span := uc.tracer.Start(ctx, "ProcessTransaction",
+		trace.WithAttributes(attribute.String("transactionId", transaction.TransactionID)))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	log := logger.FromContext(ctx, uc.logger)
+
+	// Spill the transaction as received, so draining processes it afresh
+	received := *transaction
+
+	uc.normalizeCurrency(transaction)
+
 	// Validate transaction
-	if !transaction.IsValid() {
-		return fmt.Errorf("invalid transaction data")
+	if err := uc.validation.Validate(transaction); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
+	}
+
+	if err := uc.checkBalanceArithmetic(log, transaction); err != nil {
+		return "", err
+	}
+
+	if err := uc.normalizeAmountSign(transaction); err != nil {
+		return "", err
+	}
+
+	if uc.dryRun {
+		log.Info("dry-run: would insert", "transactionID", transaction.TransactionID, "transaction", transaction)
+		return ProcessResultSkipped, nil
+	}
+
+	if uc.dedup != nil && uc.dedup.contains(transaction.TransactionID, transaction.TransactionStatus) {
+		log.Info("Transaction recently stored with this status, skipping",
+			"transactionID", transaction.TransactionID,
+			"status", transaction.TransactionStatus)
+		return uc.skipDuplicate(ctx, log, transaction)
 	}
 
 	exists, err := uc.transactionRepo.Exists(ctx, transaction.TransactionID)
 	if err != nil {
-		uc.logger.Error("Failed to check transaction existence", "error", err, "transactionID", transaction.TransactionID)
-		return fmt.Errorf("failed to check transaction existence: %w", err)
+		log.Error("Failed to check transaction existence", "error", err, "transactionID", transaction.TransactionID)
+		return uc.spillOrFail(ctx, log, &received, fmt.Errorf("failed to check transaction existence: %w", transient(err)))
 	}
 
 	if exists {
-		uc.logger.Info("Transaction already exists, skipping", "transactionID", transaction.TransactionID)
-		return nil
+		return uc.processExisting(ctx, log, transaction, &received)
 	}
 
 	if transaction.TransactionStatus == entities.TransactionStatusFailed {
 		if transaction.BalanceBefore != transaction.BalanceAfter {
-			uc.logger.Warn("Failed transaction has balance change", "transactionID", transaction.TransactionID)
+			log.Warn("Failed transaction has balance change", "transactionID", transaction.TransactionID)
 		}
 	}
 
-	if err := uc.transactionRepo.Create(ctx, transaction); err != nil {
-		uc.logger.Error("Failed to create transaction", "error", err, "transactionID", transaction.TransactionID)
-		return fmt.Errorf("failed to create transaction: %w", err)
+	if uc.balanceContinuity {
+		uc.checkBalanceContinuity(ctx, log, transaction)
+	}
+
+	if err := uc.create(ctx, transaction); err != nil {
+		if errors.Is(err, ErrDuplicateTransaction) {
+			return uc.resolveInsertRace(ctx, log, transaction, &received, err)
+		}
+		log.Error("Failed to create transaction", "error", err, "transactionID", transaction.TransactionID)
+		return uc.spillOrFail(ctx, log, &received, fmt.Errorf("failed to create transaction: %w", transient(err)))
 	}
 
-	uc.logger.Info("Transaction processed successfully",
+	uc.remember(transaction)
+	uc.emitAudit(ctx, log, transaction)
+	uc.afterStore(ctx, log, transaction)
+
+	log.Info("Transaction processed successfully",
 		"transactionID", transaction.TransactionID,
 		"type", transaction.TransactionType,
 		"status", transaction.TransactionStatus,
 		"amount", transaction.Amount)
 
+	if err := uc.publishPersisted(ctx, log, transaction); err != nil {
+		return "", err
+	}
+	return ProcessResultInserted, nil
+}
+
+// processExisting applies transaction to the stored transaction with its ID.
+// Follow-up events of a stored transaction carry its status transition; only
+// a redelivery of the stored status is a duplicate
+func (uc *transactionUseCase) processExisting(ctx context.Context, log logger.Logger, transaction, received *entities.Transaction) (ProcessResult, error) {
+	duplicate, err := uc.transactionRepo.ExistsWithStatus(ctx, transaction.TransactionID, transaction.TransactionStatus)
+	if err != nil {
+		log.Error("Failed to check transaction existence", "error", err, "transactionID", transaction.TransactionID)
+		return uc.spillOrFail(ctx, log, received, fmt.Errorf("failed to check transaction existence: %w", transient(err)))
+	}
+	if duplicate {
+		log.Info("Transaction already exists with this status, skipping",
+			"transactionID", transaction.TransactionID,
+			"status", transaction.TransactionStatus)
+		uc.checkDuplicateDiff(ctx, log, transaction)
+		uc.remember(transaction)
+		return uc.skipDuplicate(ctx, log, transaction)
+	}
+
+	err = uc.transactionRepo.UpdateStatus(ctx, transaction.TransactionID, transaction.TransactionStatus, transaction.BalanceAfter)
+	if errors.Is(err, ErrOutOfOrderUpdate) {
+		log.Warn("Dropping out-of-order status update",
+			"transactionID", transaction.TransactionID,
+			"status", transaction.TransactionStatus)
+		return ProcessResultSkipped, nil
+	}
+	if err != nil {
+		log.Error("Failed to update transaction status", "error", err, "transactionID", transaction.TransactionID)
+		return uc.spillOrFail(ctx, log, received, fmt.Errorf("failed to update transaction status: %w", transient(err)))
+	}
+	log.Info("Transaction status updated",
+		"transactionID", transaction.TransactionID,
+		"status", transaction.TransactionStatus)
+	uc.remember(transaction)
+	uc.afterStore(ctx, log, transaction)
+	if err := uc.publishPersisted(ctx, log, transaction); err != nil {
+		return "", err
+	}
+	return ProcessResultUpdated, nil
+}
+
+// resolveInsertRace handles an insert that lost a race with another consumer
+// storing the same transaction after the existence check. The stored
+// transaction is processed like one found by that check, so a different
+// status still updates it; createErr is returned when it cannot be found
+func (uc *transactionUseCase) resolveInsertRace(ctx context.Context, log logger.Logger, transaction, received *entities.Transaction, createErr error) (ProcessResult, error) {
+	log.Info("Transaction stored concurrently, rechecking its status",
+		"transactionID", transaction.TransactionID,
+		"status", transaction.TransactionStatus)
+
+	result, err := uc.processExisting(ctx, log, transaction, received)
+	if errors.Is(err, ErrTransactionNotFound) {
+		return "", fmt.Errorf("failed to create transaction: %w", createErr)
+	}
+	return result, err
+}
+
+// ReprocessTransaction stores transaction even if it was already processed,
+// overwriting the stored fields, e.g. to repair rows written by a bug
+func (uc *transactionUseCase) ReprocessTransaction(ctx context.Context, transaction *entities.Transaction) (err error) {
+	ctx, span := uc.tracer.Start(ctx, "ReprocessTransaction",
+		trace.WithAttributes(attribute.String("transactionId", transaction.TransactionID)))
+	defer func() {
+		tracing.EndSpan(span, err)
+	}()
+
+	if !uc.reprocessing {
+		return ErrReprocessingDisabled
+	}
+
+	log := logger.FromContext(ctx, uc.logger)
+
+	uc.normalizeCurrency(transaction)
+
+	if err := uc.validation.Validate(transaction); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTransaction, err)
+	}
+
+	if err := uc.checkBalanceArithmetic(log, transaction); err != nil {
+		return err
+	}
+
+	if err := uc.normalizeAmountSign(transaction); err != nil {
+		return err
+	}
+
+	if uc.dryRun {
+		log.Info("dry-run: would upsert", "transactionID", transaction.TransactionID, "transaction", transaction)
+		return nil
+	}
+
+	if err := uc.transactionRepo.Upsert(ctx, transaction); err != nil {
+		log.Error("Failed to reprocess transaction", "error", err, "transactionID", transaction.TransactionID)
+		return fmt.Errorf("failed to reprocess transaction: %w", transient(err))
+	}
+
+	log.Info("Transaction reprocessed",
+		"transactionID", transaction.TransactionID,
+		"type", transaction.TransactionType,
+		"status", transaction.TransactionStatus,
+		"amount", transaction.Amount)
+
+	return nil
+}
+
+// spillOrFail buffers transaction in the spill when err is transient and a
+// spill is configured; otherwise, or when the spill fails too, e.g. because
+// it is full, it returns err so the message is retried
+func (uc *transactionUseCase) spillOrFail(ctx context.Context, log logger.Logger, transaction *entities.Transaction, err error) (ProcessResult, error) {
+	if uc.spill == nil || !errors.Is(err, ErrTransient) {
+		return "", err
+	}
+
+	if spillErr := uc.spill.Append(ctx, transaction); spillErr != nil {
+		log.Error("Failed to spill transaction", "error", spillErr, "transactionID", transaction.TransactionID)
+		return "", err
+	}
+
+	log.Warn("Spilled transaction until the database recovers", "error", err,
+		"transactionID", transaction.TransactionID)
+	return ProcessResultSpilled, nil
+}
+
+// DrainSpilled returns the function storing spilled transactions through uc,
+// which must not spill itself. Transient failures stop the drain to retry
+// later; transactions that can never be stored are logged and dropped so
+// they do not block the ones behind them
+func DrainSpilled(uc TransactionUseCase, log logger.Logger) func(ctx context.Context, transaction *entities.Transaction) error {
+	return func(ctx context.Context, transaction *entities.Transaction) error {
+		_, err := uc.ProcessTransaction(ctx, transaction)
+		switch {
+		case err == nil, errors.Is(err, ErrDuplicateTransaction):
+			return nil
+		case errors.Is(err, ErrTransient):
+			return err
+		}
+		log.Error("Dropping spilled transaction that cannot be stored", "error", err,
+			"transactionID", transaction.TransactionID)
+		return nil
+	}
+}
+
+// remember records the stored status of transaction in the dedup cache, if
+// any
+func (uc *transactionUseCase) remember(transaction *entities.Transaction) {
+	if uc.dedup != nil {
+		uc.dedup.add(transaction.TransactionID, transaction.TransactionStatus)
+	}
+}
+
+// create persists transaction, together with its message offset when
+// transactional offsets are enabled
+func (uc *transactionUseCase) create(ctx context.Context, transaction *entities.Transaction) error {
+	if offset := offsetFromContext(ctx); uc.transactionalOffsets && offset != nil {
+		return uc.createWithOffset(ctx, transaction, offset)
+	}
+	return uc.transactionRepo.Create(ctx, transaction)
+}
+
+// createWithOffset inserts transaction and records offset as processed in a
+// single database transaction, so either both persist or neither does
+func (uc *transactionUseCase) createWithOffset(ctx context.Context, transaction *entities.Transaction, offset *entities.ProcessedOffset) error {
+	err := uc.transactionRepo.WithTx(ctx, func(repo repositories.TransactionRepository) error {
+		if err := repo.Create(ctx, transaction); err != nil {
+			return err
+		}
+		return repo.SaveOffset(ctx, offset)
+	})
+	if err != nil {
+		// The generated ID was rolled back with the insert
+		transaction.ID = ""
+		return err
+	}
+	return nil
+}
+
+// emitAudit records transaction in the audit sink, if any; failures are
+// logged only, since the transaction itself is already stored
+func (uc *transactionUseCase) emitAudit(ctx context.Context, log logger.Logger, transaction *entities.Transaction) {
+	if uc.auditSink == nil {
+		return
+	}
+
+	event := &entities.AuditEvent{
+		TransactionID: transaction.TransactionID,
+		UserID:        transaction.UserID,
+		Amount:        transaction.Amount,
+		ProcessedAt:   time.Now().UTC(),
+	}
+	if err := uc.auditSink.Emit(ctx, event); err != nil {
+		log.Error("Failed to emit audit event", "error", err, "transactionID", transaction.TransactionID)
+	}
+}
+
+// publishPersisted publishes the confirmation of the stored transaction, if
+// a publisher is configured; failures are logged only unless publishing is
+// required, when they are returned as transient
+func (uc *transactionUseCase) publishPersisted(ctx context.Context, log logger.Logger, transaction *entities.Transaction) error {
+	if uc.persistedEvents == nil {
+		return nil
+	}
+
+	event := &entities.PersistedEvent{
+		TransactionID: transaction.TransactionID,
+		Status:        transaction.TransactionStatus,
+		PersistedAt:   time.Now().UTC(),
+	}
+	if err := uc.persistedEvents.PublishPersisted(ctx, event); err != nil {
+		log.Error("Failed to publish persisted event", "error", err, "transactionID", transaction.TransactionID)
+		if uc.requirePersisted {
+			return fmt.Errorf("failed to publish persisted event: %w", transient(err))
+		}
+	}
+	return nil
+}
+
+// skipDuplicate skips a transaction already stored with its status; when
+// confirmations are required it publishes the confirmation again, as a
+// failure to publish it may be why the message was redelivered
+func (uc *transactionUseCase) skipDuplicate(ctx context.Context, log logger.Logger, transaction *entities.Transaction) (ProcessResult, error) {
+	if uc.requirePersisted {
+		if err := uc.publishPersisted(ctx, log, transaction); err != nil {
+			return "", err
+		}
+	}
+	return ProcessResultSkipped, nil
+}
+
+// afterStore runs the side effects of the type handler of transaction;
+// failures are logged only, since the transaction itself is already stored
+func (uc *transactionUseCase) afterStore(ctx context.Context, log logger.Logger, transaction *entities.Transaction) {
+	handler, ok := uc.typeHandlers[transaction.TransactionType]
+	if !ok {
+		return
+	}
+
+	if err := handler.AfterStore(ctx, transaction); err != nil {
+		log.Error("Failed to run transaction type handler", "error", err,
+			"transactionID", transaction.TransactionID, "type", transaction.TransactionType)
+	}
+}
+
+// checkBalanceContinuity warns when the balance before transaction differs
+// from the balance after the latest stored transaction of its account, which
+// points at a missed or reordered transaction; failing to read the latest
+// transaction is logged only, as the check is advisory
+func (uc *transactionUseCase) checkBalanceContinuity(ctx context.Context, log logger.Logger, transaction *entities.Transaction) {
+	previous, err := uc.transactionRepo.GetLatestByAccount(ctx, transaction.AccountID)
+	if err != nil {
+		log.Error("Failed to get previous transaction for balance continuity check", "error", err,
+			"transactionID", transaction.TransactionID, "accountID", transaction.AccountID)
+		return
+	}
+	if previous == nil {
+		return
+	}
+
+	if math.Abs(transaction.BalanceBefore-previous.BalanceAfter) <= balanceEpsilon {
+		return
+	}
+
+	log.Warn("Balance does not continue from previous transaction",
+		"transactionID", transaction.TransactionID,
+		"accountID", transaction.AccountID,
+		"balanceBefore", transaction.BalanceBefore,
+		"previousTransactionID", previous.TransactionID,
+		"previousBalanceAfter", previous.BalanceAfter)
+}
+
+// checkDuplicateDiff warns when the duplicate transaction differs from the
+// stored one in any key field; failing to read the stored transaction is
+// logged only, as the check is advisory
+func (uc *transactionUseCase) checkDuplicateDiff(ctx context.Context, log logger.Logger, transaction *entities.Transaction) {
+	if !uc.duplicateDiff {
+		return
+	}
+
+	stored, err := uc.transactionRepo.GetByTransactionID(ctx, transaction.TransactionID)
+	if err != nil && !errors.Is(err, ErrTransactionNotFound) {
+		log.Error("Failed to get stored transaction for duplicate diff", "error", err,
+			"transactionID", transaction.TransactionID)
+		return
+	}
+	if stored == nil {
+		return
+	}
+
+	if fields := diffTransactions(stored, transaction); len(fields) > 0 {
+		log.Warn("Duplicate transaction differs from stored transaction",
+			"transactionID", transaction.TransactionID,
+			"fields", strings.Join(fields, ","))
+	}
+}
+
+// diffTransactions returns the names of the key fields in which incoming
+// differs from stored
+func diffTransactions(stored, incoming *entities.Transaction) []string {
+	var fields []string
+	add := func(name string, differs bool) {
+		if differs {
+			fields = append(fields, name)
+		}
+	}
+	add("userId", stored.UserID != incoming.UserID)
+	add("accountId", stored.AccountID != incoming.AccountID)
+	add("transactionType", stored.TransactionType != incoming.TransactionType)
+	add("transactionStatus", stored.TransactionStatus != incoming.TransactionStatus)
+	add("amount", math.Abs(stored.Amount-incoming.Amount) > balanceEpsilon)
+	add("balanceBefore", math.Abs(stored.BalanceBefore-incoming.BalanceBefore) > balanceEpsilon)
+	add("balanceAfter", math.Abs(stored.BalanceAfter-incoming.BalanceAfter) > balanceEpsilon)
+	add("currency", stored.Currency != incoming.Currency)
+	add("externalReference", derefString(stored.ExternalReference) != derefString(incoming.ExternalReference))
+	return fields
+}
+
+// derefString returns the value of s, or the empty string for nil
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// normalizeCurrency uppercases the currency of transaction, filling in the
+// default currency when the message carried none, so it is never stored as
+// the empty string
+func (uc *transactionUseCase) normalizeCurrency(transaction *entities.Transaction) {
+	transaction.Currency = strings.ToUpper(strings.TrimSpace(transaction.Currency))
+	if transaction.Currency == "" {
+		transaction.Currency = uc.defaultCurrency
+	}
+}
+
+// checkBalanceArithmetic applies the balance-math check to every
+// transaction, logging a mismatch and rejecting it only with
+// WithRejectBalanceMismatch
+func (uc *transactionUseCase) checkBalanceArithmetic(log logger.Logger, transaction *entities.Transaction) error {
+	mismatch := uc.validateBalanceMath(transaction)
+	if mismatch == nil {
+		return nil
+	}
+
+	log.Warn("Balance delta does not match amount",
+		"transactionID", transaction.TransactionID,
+		"type", transaction.TransactionType,
+		"amount", transaction.Amount,
+		"balanceBefore", transaction.BalanceBefore,
+		"balanceAfter", transaction.BalanceAfter,
+		"error", mismatch)
+
+	if uc.rejectBalanceMismatch {
+		return fmt.Errorf("%w: %w", ErrInvalidTransaction, mismatch)
+	}
+
 	return nil
 }
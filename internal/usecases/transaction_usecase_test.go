@@ -3,16 +3,23 @@ package usecases
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 	"transaction-consumer/internal/domain/entities"
-	_ "transaction-consumer/pkg/logger"
+	"transaction-consumer/internal/domain/repositories"
+	"transaction-consumer/pkg/logger"
 )
 
 // Mock repository for testing
 type mockTransactionRepository struct {
 	transactions map[string]*entities.Transaction
+	offsets      []*entities.ProcessedOffset
 	createError  error
 	existsError  error
+	updateError  error
 }
 
 func (m *mockTransactionRepository) Create(ctx context.Context, transaction *entities.Transaction) error {
@@ -26,7 +33,27 @@ func (m *mockTransactionRepository) Create(ctx context.Context, transaction *ent
 	return nil
 }
 
-func (m *mockTransactionRepository) GetByTransactionID(ctx context.Context, transactionID string) (*entities.Transaction, error) {
+func (m *mockTransactionRepository) SaveOffset(ctx context.Context, offset *entities.ProcessedOffset) error {
+	m.offsets = append(m.offsets, offset)
+	return nil
+}
+
+func (m *mockTransactionRepository) WithTx(ctx context.Context, fn func(repo repositories.TransactionRepository) error) error {
+	return fn(m)
+}
+
+func (m *mockTransactionRepository) Upsert(ctx context.Context, transaction *entities.Transaction) error {
+	if m.createError != nil {
+		return m.createError
+	}
+	if m.transactions == nil {
+		m.transactions = make(map[string]*entities.Transaction)
+	}
+	m.transactions[transaction.TransactionID] = transaction
+	return nil
+}
+
+func (m *mockTransactionRepository) GetByTransactionID(ctx context.Context, transactionID string, opts ...repositories.QueryOption) (*entities.Transaction, error) {
 	if m.transactions == nil {
 		return nil, nil
 	}
@@ -37,6 +64,33 @@ func (m *mockTransactionRepository) GetByTransactionID(ctx context.Context, tran
 	return transaction, nil
 }
 
+func (m *mockTransactionRepository) MarkReversed(ctx context.Context, transactionID string, reason string) error {
+	transaction, exists := m.transactions[transactionID]
+	if !exists {
+		return errors.New("transaction not found")
+	}
+	now := time.Now()
+	transaction.ReversedAt = &now
+	transaction.ReversalReason = &reason
+	return nil
+}
+
+func (m *mockTransactionRepository) UpdateStatus(ctx context.Context, transactionID string, status entities.TransactionStatus, balanceAfter float64) error {
+	if m.updateError != nil {
+		return m.updateError
+	}
+	transaction, exists := m.transactions[transactionID]
+	if !exists {
+		return repositories.ErrTransactionNotFound
+	}
+	if !transaction.TransactionStatus.CanTransitionTo(status) {
+		return repositories.ErrOutOfOrderUpdate
+	}
+	transaction.TransactionStatus = status
+	transaction.BalanceAfter = balanceAfter
+	return nil
+}
+
 func (m *mockTransactionRepository) Exists(ctx context.Context, transactionID string) (bool, error) {
 	if m.existsError != nil {
 		return false, m.existsError
@@ -48,6 +102,42 @@ func (m *mockTransactionRepository) Exists(ctx context.Context, transactionID st
 	return exists, nil
 }
 
+func (m *mockTransactionRepository) ExistsWithStatus(ctx context.Context, transactionID string, status entities.TransactionStatus) (bool, error) {
+	if m.existsError != nil {
+		return false, m.existsError
+	}
+	transaction, exists := m.transactions[transactionID]
+	return exists && transaction.TransactionStatus == status, nil
+}
+
+func (m *mockTransactionRepository) GetByAccountAndDateRange(ctx context.Context, accountID string, from, to time.Time) ([]*entities.Transaction, error) {
+	var result []*entities.Transaction
+	for _, transaction := range m.transactions {
+		if transaction.AccountID == accountID && !transaction.CreatedAt.Before(from) && !transaction.CreatedAt.After(to) {
+			result = append(result, transaction)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockTransactionRepository) GetLatestByAccount(ctx context.Context, accountID string) (*entities.Transaction, error) {
+	var latest *entities.Transaction
+	for _, transaction := range m.transactions {
+		if transaction.AccountID == accountID && (latest == nil || transaction.CreatedAt.After(latest.CreatedAt)) {
+			latest = transaction
+		}
+	}
+	return latest, nil
+}
+
+func (m *mockTransactionRepository) AggregateByType(ctx context.Context, from, to time.Time) ([]entities.TypeAggregate, error) {
+	return nil, nil
+}
+
+func (m *mockTransactionRepository) ExportAll(ctx context.Context, w io.Writer, opts ...repositories.QueryOption) error {
+	return nil
+}
+
 // Mock logger for testing
 type mockLogger struct {
 	debugMsgs []string
@@ -88,6 +178,10 @@ func (m *mockLogger) Fatal(msg string, args ...interface{}) {
 	m.Error(msg, args...)
 }
 
+func (m *mockLogger) With(args ...interface{}) logger.Logger {
+	return m
+}
+
 func TestNewTransactionUseCase(t *testing.T) {
 	mockRepo := &mockTransactionRepository{}
 	mockLog := &mockLogger{}
@@ -115,11 +209,14 @@ func TestTransactionUseCase_ProcessTransaction_Success(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := useCase.ProcessTransaction(ctx, transaction)
+	result, err := useCase.ProcessTransaction(ctx, transaction)
 
 	if err != nil {
 		t.Errorf("ProcessTransaction should not return error, got: %v", err)
 	}
+	if result != ProcessResultInserted {
+		t.Errorf("Expected result %s, got %s", ProcessResultInserted, result)
+	}
 
 	// Check if transaction was stored
 	exists, _ := mockRepo.Exists(ctx, transaction.TransactionID)
@@ -140,6 +237,170 @@ func TestTransactionUseCase_ProcessTransaction_Success(t *testing.T) {
 	}
 }
 
+func TestTransactionUseCase_ProcessTransaction_DefaultCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		expected string
+	}{
+		{"empty uses default", "", "USD"},
+		{"blank uses default", "  ", "USD"},
+		{"lowercase is uppercased", "sgd", "SGD"},
+		{"given currency is kept", "EUR", "EUR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{}
+			useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithDefaultCurrency("usd"))
+
+			transaction := &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-123",
+				TransactionType:   entities.TransactionTypeTopup,
+				TransactionStatus: entities.TransactionStatusSuccess,
+				Amount:            100.50,
+				BalanceBefore:     1000.00,
+				BalanceAfter:      1100.50,
+				Currency:          tt.currency,
+			}
+
+			if _, err := useCase.ProcessTransaction(context.Background(), transaction); err != nil {
+				t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+			}
+			if got := mockRepo.transactions["trans-123"].Currency; got != tt.expected {
+				t.Errorf("Expected currency %q to be inserted, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_AmountSignNormalization(t *testing.T) {
+	tests := []struct {
+		name            string
+		transactionType entities.TransactionType
+		balanceAfter    float64
+		expected        float64
+	}{
+		{"topup is a credit", entities.TransactionTypeTopup, 1100.50, 100.50},
+		{"refund is a credit", entities.TransactionTypeRefund, 1100.50, 100.50},
+		{"payment is a debit", entities.TransactionTypePayment, 899.50, -100.50},
+		{"transfer is a debit", entities.TransactionTypeTransfer, 899.50, -100.50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{}
+			useCase := NewTransactionUseCase(mockRepo, &mockLogger{},
+				WithAmountSignNormalization(true), WithRejectBalanceMismatch(true))
+
+			metadata := `{"channel":"mobile"}`
+			transaction := &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-123",
+				TransactionType:   tt.transactionType,
+				TransactionStatus: entities.TransactionStatusSuccess,
+				Amount:            100.50,
+				BalanceBefore:     1000.00,
+				BalanceAfter:      tt.balanceAfter,
+				Currency:          "IDR",
+				Metadata:          &metadata,
+			}
+
+			if _, err := useCase.ProcessTransaction(context.Background(), transaction); err != nil {
+				t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+			}
+			stored := mockRepo.transactions["trans-123"]
+			if stored.Amount != tt.expected {
+				t.Errorf("Expected amount %.2f to be inserted, got %.2f", tt.expected, stored.Amount)
+			}
+			if stored.Metadata == nil || *stored.Metadata != `{"channel":"mobile","originalAmount":100.5}` {
+				t.Errorf("Expected the original amount in the metadata, got %v", derefString(stored.Metadata))
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_AmountSignNormalizationDisabled(t *testing.T) {
+	mockRepo := &mockTransactionRepository{}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{})
+
+	transaction := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypePayment,
+		TransactionStatus: entities.TransactionStatusSuccess,
+		Amount:            100.50,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      899.50,
+		Currency:          "IDR",
+	}
+
+	if _, err := useCase.ProcessTransaction(context.Background(), transaction); err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+	stored := mockRepo.transactions["trans-123"]
+	if stored.Amount != 100.50 || stored.Metadata != nil {
+		t.Errorf("Expected the transaction to be stored as received, got amount %.2f and metadata %v",
+			stored.Amount, derefString(stored.Metadata))
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_AmountSignNormalizationMetadata(t *testing.T) {
+	tests := []struct {
+		name      string
+		metadata  string
+		expected  string
+		expectErr bool
+	}{
+		{"no metadata", "", `{"originalAmount":100.5}`, false},
+		{"null metadata", "null", `{"originalAmount":100.5}`, false},
+		{"array metadata", `["mobile"]`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{}
+			useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithAmountSignNormalization(true))
+
+			transaction := &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-123",
+				TransactionType:   entities.TransactionTypePayment,
+				TransactionStatus: entities.TransactionStatusSuccess,
+				Amount:            100.50,
+				BalanceBefore:     1000.00,
+				BalanceAfter:      899.50,
+				Currency:          "IDR",
+			}
+			if tt.metadata != "" {
+				transaction.Metadata = &tt.metadata
+			}
+
+			_, err := useCase.ProcessTransaction(context.Background(), transaction)
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidTransaction) {
+					t.Errorf("Expected ErrInvalidTransaction, got: %v", err)
+				}
+				if len(mockRepo.transactions) != 0 {
+					t.Error("Expected the transaction not to be inserted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+			}
+			if got := derefString(mockRepo.transactions["trans-123"].Metadata); got != tt.expected {
+				t.Errorf("Expected metadata %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
 func TestTransactionUseCase_ProcessTransaction_InvalidTransaction(t *testing.T) {
 	mockRepo := &mockTransactionRepository{}
 	mockLog := &mockLogger{}
@@ -151,14 +412,18 @@ func TestTransactionUseCase_ProcessTransaction_InvalidTransaction(t *testing.T)
 	}
 
 	ctx := context.Background()
-	err := useCase.ProcessTransaction(ctx, transaction)
+	_, err := useCase.ProcessTransaction(ctx, transaction)
 
 	if err == nil {
 		t.Error("ProcessTransaction should return error for invalid transaction")
 	}
 
-	if err.Error() != "invalid transaction data" {
-		t.Errorf("Expected 'invalid transaction data' error, got: %v", err)
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Errorf("Expected ErrInvalidTransaction, got: %v", err)
+	}
+
+	if err.Error() != "invalid transaction data: userId must be positive" {
+		t.Errorf("Expected 'invalid transaction data: userId must be positive' error, got: %v", err)
 	}
 }
 
@@ -179,7 +444,7 @@ func TestTransactionUseCase_ProcessTransaction_ExistsError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := useCase.ProcessTransaction(ctx, transaction)
+	_, err := useCase.ProcessTransaction(ctx, transaction)
 
 	if err == nil {
 		t.Error("ProcessTransaction should return error when repository.Exists fails")
@@ -217,22 +482,144 @@ func TestTransactionUseCase_ProcessTransaction_AlreadyExists(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := useCase.ProcessTransaction(ctx, transaction)
+	_, err := useCase.ProcessTransaction(ctx, transaction)
 
 	if err != nil {
 		t.Errorf("ProcessTransaction should not return error for existing transaction, got: %v", err)
 	}
 
-	// Check if skip message was logged
+	// The follow-up event updates the stored status instead of being skipped
+	if status := mockRepo.transactions["existing-trans"].TransactionStatus; status != entities.TransactionStatusSuccess {
+		t.Errorf("Expected stored status SUCCESS, got %s", status)
+	}
+
+	found := false
+	for _, msg := range mockLog.infoMsgs {
+		if msg == "Transaction status updated" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("Status update should be logged")
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_PendingThenSuccess(t *testing.T) {
+	mockRepo := &mockTransactionRepository{}
+	mockLog := &mockLogger{}
+	useCase := NewTransactionUseCase(mockRepo, mockLog)
+
+	pending := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypePayment,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100,
+		BalanceBefore:     1000,
+		BalanceAfter:      1000,
+	}
+	success := *pending
+	success.TransactionStatus = entities.TransactionStatusSuccess
+	success.BalanceAfter = 900
+
+	ctx := context.Background()
+	result, err := useCase.ProcessTransaction(ctx, pending)
+	if err != nil {
+		t.Fatalf("ProcessTransaction(PENDING) should not return error, got: %v", err)
+	}
+	if result != ProcessResultInserted {
+		t.Errorf("Expected PENDING to be %s, got %s", ProcessResultInserted, result)
+	}
+	result, err = useCase.ProcessTransaction(ctx, &success)
+	if err != nil {
+		t.Fatalf("ProcessTransaction(SUCCESS) should not return error, got: %v", err)
+	}
+	if result != ProcessResultUpdated {
+		t.Errorf("Expected SUCCESS to be %s, got %s", ProcessResultUpdated, result)
+	}
+
+	stored := mockRepo.transactions["trans-123"]
+	if stored.TransactionStatus != entities.TransactionStatusSuccess || stored.BalanceAfter != 900 {
+		t.Errorf("Expected the SUCCESS event to be applied, got status %s balance %v",
+			stored.TransactionStatus, stored.BalanceAfter)
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_DuplicateStatusSkipped(t *testing.T) {
+	mockRepo := &mockTransactionRepository{
+		transactions: map[string]*entities.Transaction{
+			"existing-trans": {TransactionID: "existing-trans", TransactionStatus: entities.TransactionStatusSuccess},
+		},
+		// Any update would fail, so the redelivery must not attempt one
+		updateError: errors.New("unexpected update"),
+	}
+	mockLog := &mockLogger{}
+	useCase := NewTransactionUseCase(mockRepo, mockLog)
+
+	transaction := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "existing-trans",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusSuccess,
+		Amount:            100.50,
+	}
+
+	result, err := useCase.ProcessTransaction(context.Background(), transaction)
+	if err != nil {
+		t.Errorf("ProcessTransaction should skip a redelivered status, got: %v", err)
+	}
+	if result != ProcessResultSkipped {
+		t.Errorf("Expected result %s, got %s", ProcessResultSkipped, result)
+	}
+
 	found := false
 	for _, msg := range mockLog.infoMsgs {
-		if msg == "Transaction already exists, skipping" {
+		if msg == "Transaction already exists with this status, skipping" {
 			found = true
 			break
 		}
 	}
 	if !found {
-		t.Error("Skip message should be logged")
+		t.Error("Skipped duplicate should be logged")
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_UpdateStatusError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+	}{
+		{"not found", fmt.Errorf("update: %w", repositories.ErrTransactionNotFound), ErrTransactionNotFound},
+		{"database error", errors.New("connection reset"), ErrTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{
+				transactions: map[string]*entities.Transaction{
+					"existing-trans": {TransactionID: "existing-trans"},
+				},
+				updateError: tt.err,
+			}
+			useCase := NewTransactionUseCase(mockRepo, &mockLogger{})
+
+			_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "existing-trans",
+				TransactionType:   entities.TransactionTypeTopup,
+				TransactionStatus: entities.TransactionStatusFailed,
+				Amount:            100.50,
+			})
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected error matching %v, got: %v", tt.expected, err)
+			}
+		})
 	}
 }
 
@@ -253,7 +640,7 @@ func TestTransactionUseCase_ProcessTransaction_CreateError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := useCase.ProcessTransaction(ctx, transaction)
+	_, err := useCase.ProcessTransaction(ctx, transaction)
 
 	if err == nil {
 		t.Error("ProcessTransaction should return error when repository.Create fails")
@@ -290,7 +677,7 @@ func TestTransactionUseCase_ProcessTransaction_FailedTransactionWithBalanceChang
 	}
 
 	ctx := context.Background()
-	err := useCase.ProcessTransaction(ctx, transaction)
+	_, err := useCase.ProcessTransaction(ctx, transaction)
 
 	if err != nil {
 		t.Errorf("ProcessTransaction should not return error, got: %v", err)
@@ -327,7 +714,7 @@ func TestTransactionUseCase_ProcessTransaction_FailedTransactionNoBalanceChange(
 	}
 
 	ctx := context.Background()
-	err := useCase.ProcessTransaction(ctx, transaction)
+	_, err := useCase.ProcessTransaction(ctx, transaction)
 
 	if err != nil {
 		t.Errorf("ProcessTransaction should not return error, got: %v", err)
@@ -367,7 +754,7 @@ func TestTransactionUseCase_ProcessTransaction_AllTransactionTypes(t *testing.T)
 			BalanceAfter:      1100.50,
 		}
 
-		err := useCase.ProcessTransaction(ctx, transaction)
+		_, err := useCase.ProcessTransaction(ctx, transaction)
 		if err != nil {
 			t.Errorf("ProcessTransaction should not return error for %s, got: %v", transactionType, err)
 		}
@@ -390,3 +777,1253 @@ func TestTransactionUseCase_ProcessTransaction_AllTransactionTypes(t *testing.T)
 		t.Errorf("Expected %d success messages, got %d", len(transactionTypes), successCount)
 	}
 }
+
+func TestTransactionUseCase_ProcessTransaction_BalanceArithmetic(t *testing.T) {
+	tests := []struct {
+		name          string
+		txType        entities.TransactionType
+		balanceBefore float64
+		balanceAfter  float64
+		mismatch      bool
+	}{
+		{"topup correct", entities.TransactionTypeTopup, 1000.00, 1100.50, false},
+		{"topup incorrect", entities.TransactionTypeTopup, 1000.00, 1000.00, true},
+		{"payment correct", entities.TransactionTypePayment, 1000.00, 899.50, false},
+		{"payment incorrect", entities.TransactionTypePayment, 1000.00, 1100.50, true},
+		{"refund correct", entities.TransactionTypeRefund, 1000.00, 1100.50, false},
+		{"refund incorrect", entities.TransactionTypeRefund, 1000.00, 899.50, true},
+		{"transfer correct", entities.TransactionTypeTransfer, 1000.00, 899.50, false},
+		{"transfer incorrect", entities.TransactionTypeTransfer, 1000.00, 1100.50, true},
+		{"float rounding within epsilon", entities.TransactionTypeTopup, 0.1, 100.6 + 0.0000001, false},
+	}
+
+	for _, tt := range tests {
+		for _, reject := range []bool{false, true} {
+			name := tt.name
+			if reject {
+				name += " rejecting"
+			}
+			t.Run(name, func(t *testing.T) {
+				mockRepo := &mockTransactionRepository{}
+				mockLog := &mockLogger{}
+				useCase := NewTransactionUseCase(mockRepo, mockLog, WithRejectBalanceMismatch(reject))
+
+				transaction := &entities.Transaction{
+					UserID:            123,
+					AccountID:         "account-123",
+					TransactionID:     "trans-balance",
+					TransactionType:   tt.txType,
+					TransactionStatus: entities.TransactionStatusSuccess,
+					Amount:            100.50,
+					BalanceBefore:     tt.balanceBefore,
+					BalanceAfter:      tt.balanceAfter,
+				}
+
+				_, err := useCase.ProcessTransaction(context.Background(), transaction)
+
+				warned := false
+				for _, msg := range mockLog.warnMsgs {
+					if msg == "Balance delta does not match amount" {
+						warned = true
+					}
+				}
+				if warned != tt.mismatch {
+					t.Errorf("Expected mismatch warning %v, got %v", tt.mismatch, warned)
+				}
+
+				if tt.mismatch && reject {
+					if err == nil {
+						t.Error("ProcessTransaction should reject mismatched balance")
+					}
+					if len(mockRepo.transactions) != 0 {
+						t.Error("Rejected transaction should not be stored")
+					}
+				} else if err != nil {
+					t.Errorf("ProcessTransaction should not return error, got: %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_BalanceArithmeticIgnoresNonSuccess(t *testing.T) {
+	mockRepo := &mockTransactionRepository{}
+	mockLog := &mockLogger{}
+	useCase := NewTransactionUseCase(mockRepo, mockLog, WithRejectBalanceMismatch(true))
+
+	transaction := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-pending",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      1000.00,
+	}
+
+	if _, err := useCase.ProcessTransaction(context.Background(), transaction); err != nil {
+		t.Errorf("ProcessTransaction should not check balance math for pending transactions, got: %v", err)
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_TransactionalOffsets(t *testing.T) {
+	offset := &entities.ProcessedOffset{Topic: "transactions", Partition: 1, Offset: 42}
+	newTransaction := func() *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-offset",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: entities.TransactionStatusPending,
+			Amount:            100.50,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		enabled       bool
+		ctx           context.Context
+		expectOffsets int
+	}{
+		{"enabled with offset", true, ContextWithOffset(context.Background(), offset), 1},
+		{"enabled without offset", true, context.Background(), 0},
+		{"disabled", false, ContextWithOffset(context.Background(), offset), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{}
+			useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithTransactionalOffsets(tt.enabled))
+
+			if _, err := useCase.ProcessTransaction(tt.ctx, newTransaction()); err != nil {
+				t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+			}
+
+			if len(mockRepo.transactions) != 1 {
+				t.Errorf("Expected transaction to be created, got %d", len(mockRepo.transactions))
+			}
+			if len(mockRepo.offsets) != tt.expectOffsets {
+				t.Fatalf("Expected %d recorded offsets, got %d", tt.expectOffsets, len(mockRepo.offsets))
+			}
+			if tt.expectOffsets == 1 && mockRepo.offsets[0] != offset {
+				t.Errorf("Expected offset %+v, got %+v", offset, mockRepo.offsets[0])
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ReprocessTransaction_OverwritesExisting(t *testing.T) {
+	existing := &entities.Transaction{
+		TransactionID:     "trans-123",
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.00,
+	}
+	mockRepo := &mockTransactionRepository{
+		transactions: map[string]*entities.Transaction{"trans-123": existing},
+	}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithReprocessing(true))
+
+	corrected := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusSuccess,
+		Amount:            150.00,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      1150.00,
+	}
+
+	if err := useCase.ReprocessTransaction(context.Background(), corrected); err != nil {
+		t.Fatalf("ReprocessTransaction should not return error, got: %v", err)
+	}
+
+	stored := mockRepo.transactions["trans-123"]
+	if stored.Amount != 150.00 || stored.TransactionStatus != entities.TransactionStatusSuccess {
+		t.Errorf("Expected stored transaction to be overwritten, got %+v", stored)
+	}
+}
+
+func TestTransactionUseCase_ReprocessTransaction_DefaultCurrency(t *testing.T) {
+	mockRepo := &mockTransactionRepository{}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithReprocessing(true), WithDefaultCurrency("IDR"))
+
+	transaction := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusSuccess,
+		Amount:            150.00,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      1150.00,
+	}
+
+	if err := useCase.ReprocessTransaction(context.Background(), transaction); err != nil {
+		t.Fatalf("ReprocessTransaction should not return error, got: %v", err)
+	}
+	if got := mockRepo.transactions["trans-123"].Currency; got != "IDR" {
+		t.Errorf("Expected the default currency to be upserted, got %q", got)
+	}
+}
+
+func TestTransactionUseCase_ReprocessTransaction_Disabled(t *testing.T) {
+	mockRepo := &mockTransactionRepository{}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{})
+
+	err := useCase.ReprocessTransaction(context.Background(), &entities.Transaction{TransactionID: "trans-123"})
+	if !errors.Is(err, ErrReprocessingDisabled) {
+		t.Errorf("Expected ErrReprocessingDisabled, got: %v", err)
+	}
+	if len(mockRepo.transactions) != 0 {
+		t.Error("No transaction should be stored when reprocessing is disabled")
+	}
+}
+
+func TestTransactionUseCase_ReprocessTransaction_Invalid(t *testing.T) {
+	useCase := NewTransactionUseCase(&mockTransactionRepository{}, &mockLogger{}, WithReprocessing(true))
+
+	if err := useCase.ReprocessTransaction(context.Background(), &entities.Transaction{}); err == nil {
+		t.Error("ReprocessTransaction should reject invalid transactions")
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_ErrorTypes(t *testing.T) {
+	valid := func() *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-123",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: entities.TransactionStatusSuccess,
+			Amount:            100.50,
+			BalanceBefore:     1000.00,
+			BalanceAfter:      1100.50,
+		}
+	}
+	mismatched := valid()
+	mismatched.BalanceAfter = 1000.00
+
+	tests := []struct {
+		name        string
+		repo        *mockTransactionRepository
+		transaction *entities.Transaction
+		opts        []Option
+		expected    error
+	}{
+		{
+			name:        "invalid transaction",
+			repo:        &mockTransactionRepository{},
+			transaction: &entities.Transaction{TransactionID: "trans-123"},
+			expected:    ErrInvalidTransaction,
+		},
+		{
+			name:        "rejected balance mismatch",
+			repo:        &mockTransactionRepository{},
+			transaction: mismatched,
+			opts:        []Option{WithRejectBalanceMismatch(true)},
+			expected:    ErrInvalidTransaction,
+		},
+		{
+			name:        "concurrent duplicate",
+			repo:        &mockTransactionRepository{createError: fmt.Errorf("insert: %w", repositories.ErrDuplicateTransaction)},
+			transaction: valid(),
+			expected:    ErrDuplicateTransaction,
+		},
+		{
+			name:        "exists failure",
+			repo:        &mockTransactionRepository{existsError: errors.New("connection reset")},
+			transaction: valid(),
+			expected:    ErrTransient,
+		},
+		{
+			name:        "create failure",
+			repo:        &mockTransactionRepository{createError: errors.New("connection reset")},
+			transaction: valid(),
+			expected:    ErrTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := NewTransactionUseCase(tt.repo, &mockLogger{}, tt.opts...)
+
+			_, err := useCase.ProcessTransaction(context.Background(), tt.transaction)
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected error matching %v, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_DuplicateIsNotTransient(t *testing.T) {
+	mockRepo := &mockTransactionRepository{createError: repositories.ErrDuplicateTransaction}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{})
+
+	_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	})
+
+	if errors.Is(err, ErrTransient) {
+		t.Errorf("Expected duplicate not to be transient, got: %v", err)
+	}
+}
+
+// racingRepository stores winner just before the first insert, like another
+// consumer storing the same transaction after the existence check
+type racingRepository struct {
+	*mockTransactionRepository
+	winner *entities.Transaction
+}
+
+func (r *racingRepository) Create(ctx context.Context, transaction *entities.Transaction) error {
+	if r.winner != nil {
+		r.mockTransactionRepository.Create(ctx, r.winner)
+		r.winner = nil
+		return fmt.Errorf("insert: %w", repositories.ErrDuplicateTransaction)
+	}
+	return r.mockTransactionRepository.Create(ctx, transaction)
+}
+
+func (r *racingRepository) WithTx(ctx context.Context, fn func(repo repositories.TransactionRepository) error) error {
+	return fn(r)
+}
+
+func TestTransactionUseCase_ProcessTransaction_InsertRace(t *testing.T) {
+	newTransaction := func(status entities.TransactionStatus) *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-123",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: status,
+			Amount:            100.50,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		winnerStatus   entities.TransactionStatus
+		expectedResult ProcessResult
+		expectedStatus entities.TransactionStatus
+	}{
+		{
+			name:           "same status",
+			winnerStatus:   entities.TransactionStatusPending,
+			expectedResult: ProcessResultSkipped,
+			expectedStatus: entities.TransactionStatusPending,
+		},
+		{
+			name:           "different status",
+			winnerStatus:   entities.TransactionStatusPending,
+			expectedResult: ProcessResultUpdated,
+			expectedStatus: entities.TransactionStatusSuccess,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &racingRepository{
+				mockTransactionRepository: &mockTransactionRepository{},
+				winner:                    newTransaction(tt.winnerStatus),
+			}
+			mockLog := &mockLogger{}
+			useCase := NewTransactionUseCase(repo, mockLog)
+
+			result, err := useCase.ProcessTransaction(context.Background(), newTransaction(tt.expectedStatus))
+
+			if err != nil {
+				t.Fatalf("Expected lost insert race to be handled, got: %v", err)
+			}
+			if result != tt.expectedResult {
+				t.Errorf("Expected result %q, got %q", tt.expectedResult, result)
+			}
+			if status := repo.transactions["trans-123"].TransactionStatus; status != tt.expectedStatus {
+				t.Errorf("Expected stored status %s, got %s", tt.expectedStatus, status)
+			}
+			if len(mockLog.errorMsgs) != 0 {
+				t.Errorf("Expected no error logs, got: %v", mockLog.errorMsgs)
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_DryRun(t *testing.T) {
+	// Any repository call fails, so a nil error proves none was made
+	mockRepo := &mockTransactionRepository{
+		existsError: errors.New("exists called"),
+		createError: errors.New("create called"),
+	}
+	mockLog := &mockLogger{}
+	useCase := NewTransactionUseCase(mockRepo, mockLog, WithDryRun(true))
+
+	transaction := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	}
+
+	if _, err := useCase.ProcessTransaction(context.Background(), transaction); err != nil {
+		t.Errorf("ProcessTransaction should not touch the repository in dry-run, got: %v", err)
+	}
+	if len(mockRepo.transactions) != 0 {
+		t.Errorf("Expected no stored transactions, got %d", len(mockRepo.transactions))
+	}
+
+	found := false
+	for _, msg := range mockLog.infoMsgs {
+		if msg == "dry-run: would insert" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("Expected dry-run insert to be logged")
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_DryRunStillValidates(t *testing.T) {
+	mockRepo := &mockTransactionRepository{}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithDryRun(true))
+
+	_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{TransactionID: "trans-123"})
+
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Errorf("Expected ErrInvalidTransaction in dry-run, got: %v", err)
+	}
+}
+
+func TestTransactionUseCase_ReprocessTransaction_DryRun(t *testing.T) {
+	mockRepo := &mockTransactionRepository{createError: errors.New("upsert called")}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithReprocessing(true), WithDryRun(true))
+
+	err := useCase.ReprocessTransaction(context.Background(), &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	})
+
+	if err != nil {
+		t.Errorf("ReprocessTransaction should not touch the repository in dry-run, got: %v", err)
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_StatusTransitions(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   entities.TransactionStatus
+		incoming entities.TransactionStatus
+		expected entities.TransactionStatus
+		dropped  bool
+	}{
+		{"pending to success", entities.TransactionStatusPending, entities.TransactionStatusSuccess, entities.TransactionStatusSuccess, false},
+		{"pending to failed", entities.TransactionStatusPending, entities.TransactionStatusFailed, entities.TransactionStatusFailed, false},
+		{"pending to cancelled", entities.TransactionStatusPending, entities.TransactionStatusCancelled, entities.TransactionStatusCancelled, false},
+		{"redelivered success", entities.TransactionStatusSuccess, entities.TransactionStatusSuccess, entities.TransactionStatusSuccess, false},
+		{"success back to pending", entities.TransactionStatusSuccess, entities.TransactionStatusPending, entities.TransactionStatusSuccess, true},
+		{"failed back to pending", entities.TransactionStatusFailed, entities.TransactionStatusPending, entities.TransactionStatusFailed, true},
+		{"cancelled to success", entities.TransactionStatusCancelled, entities.TransactionStatusSuccess, entities.TransactionStatusCancelled, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{
+				transactions: map[string]*entities.Transaction{
+					"trans-123": {TransactionID: "trans-123", TransactionStatus: tt.stored},
+				},
+			}
+			mockLog := &mockLogger{}
+			useCase := NewTransactionUseCase(mockRepo, mockLog)
+
+			_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-123",
+				TransactionType:   entities.TransactionTypePayment,
+				TransactionStatus: tt.incoming,
+				Amount:            100,
+				BalanceBefore:     1000,
+				BalanceAfter:      900,
+			})
+			if err != nil {
+				t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+			}
+
+			if status := mockRepo.transactions["trans-123"].TransactionStatus; status != tt.expected {
+				t.Errorf("Expected stored status %s, got %s", tt.expected, status)
+			}
+
+			dropped := false
+			for _, msg := range mockLog.warnMsgs {
+				if msg == "Dropping out-of-order status update" {
+					dropped = true
+				}
+			}
+			if dropped != tt.dropped {
+				t.Errorf("Expected dropped warning %v, got %v", tt.dropped, dropped)
+			}
+		})
+	}
+}
+
+// Mock audit sink for testing
+type mockAuditSink struct {
+	events  []*entities.AuditEvent
+	emitErr error
+}
+
+func (m *mockAuditSink) Emit(ctx context.Context, event *entities.AuditEvent) error {
+	if m.emitErr != nil {
+		return m.emitErr
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestTransactionUseCase_ProcessTransaction_EmitsAuditEvent(t *testing.T) {
+	sink := &mockAuditSink{}
+	useCase := NewTransactionUseCase(&mockTransactionRepository{}, &mockLogger{}, WithAuditSink(sink))
+
+	before := time.Now().UTC()
+	_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	})
+	if err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("Expected 1 audit event, got %d", len(sink.events))
+	}
+	event := sink.events[0]
+	if event.TransactionID != "trans-123" || event.UserID != 123 || event.Amount != 100.50 {
+		t.Errorf("Unexpected audit event: %+v", event)
+	}
+	if event.ProcessedAt.Before(before) {
+		t.Errorf("Expected processed-at timestamp after %v, got %v", before, event.ProcessedAt)
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_AuditFailureIsLogged(t *testing.T) {
+	mockRepo := &mockTransactionRepository{}
+	mockLog := &mockLogger{}
+	sink := &mockAuditSink{emitErr: errors.New("audit unavailable")}
+	useCase := NewTransactionUseCase(mockRepo, mockLog, WithAuditSink(sink))
+
+	_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	})
+
+	if err != nil {
+		t.Errorf("Audit failure should not fail processing, got: %v", err)
+	}
+	if len(mockRepo.transactions) != 1 {
+		t.Errorf("Expected the transaction to be stored, got %d", len(mockRepo.transactions))
+	}
+	found := false
+	for _, msg := range mockLog.errorMsgs {
+		if msg == "Failed to emit audit event" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Audit failure should be logged")
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_NoAuditForExisting(t *testing.T) {
+	sink := &mockAuditSink{}
+	mockRepo := &mockTransactionRepository{
+		transactions: map[string]*entities.Transaction{
+			"trans-123": {TransactionID: "trans-123", TransactionStatus: entities.TransactionStatusPending},
+		},
+	}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithAuditSink(sink))
+
+	_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusFailed,
+		Amount:            100.50,
+	})
+	if err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+
+	if len(sink.events) != 0 {
+		t.Errorf("Expected no audit event for a status update, got %d", len(sink.events))
+	}
+}
+
+// notifyingRefundHandler records the refunds it is notified about
+type notifyingRefundHandler struct {
+	CreditHandler
+	notified []string
+	err      error
+}
+
+func (h *notifyingRefundHandler) AfterStore(ctx context.Context, transaction *entities.Transaction) error {
+	h.notified = append(h.notified, transaction.TransactionID+":"+string(transaction.TransactionStatus))
+	return h.err
+}
+
+func TestTransactionUseCase_ProcessTransaction_TypeHandler(t *testing.T) {
+	handler := &notifyingRefundHandler{}
+	mockRepo := &mockTransactionRepository{}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{},
+		WithRejectBalanceMismatch(true),
+		WithTypeHandler(entities.TransactionTypeRefund, handler))
+
+	refund := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "refund-1",
+		TransactionType:   entities.TransactionTypeRefund,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      1000.00,
+	}
+	if _, err := useCase.ProcessTransaction(context.Background(), refund); err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+
+	success := *refund
+	success.TransactionStatus = entities.TransactionStatusSuccess
+	success.BalanceAfter = 1100.50
+	if _, err := useCase.ProcessTransaction(context.Background(), &success); err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+
+	// A redelivery is skipped without notifying again
+	if _, err := useCase.ProcessTransaction(context.Background(), &success); err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+
+	payment := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "payment-1",
+		TransactionType:   entities.TransactionTypePayment,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	}
+	if _, err := useCase.ProcessTransaction(context.Background(), payment); err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+
+	expected := []string{"refund-1:PENDING", "refund-1:SUCCESS"}
+	if fmt.Sprint(handler.notified) != fmt.Sprint(expected) {
+		t.Errorf("Expected refund hook calls %v, got %v", expected, handler.notified)
+	}
+
+	// The embedded default keeps the credit balance check of refunds
+	mismatch := *refund
+	mismatch.TransactionID = "refund-2"
+	mismatch.TransactionStatus = entities.TransactionStatusSuccess
+	mismatch.BalanceAfter = 899.50
+	if _, err := useCase.ProcessTransaction(context.Background(), &mismatch); !errors.Is(err, ErrInvalidTransaction) {
+		t.Errorf("Expected ErrInvalidTransaction for a refund lowering the balance, got %v", err)
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_TypeHandlerFailureIsLogged(t *testing.T) {
+	handler := &notifyingRefundHandler{err: errors.New("notification service unavailable")}
+	mockRepo := &mockTransactionRepository{}
+	mockLog := &mockLogger{}
+	useCase := NewTransactionUseCase(mockRepo, mockLog, WithTypeHandler(entities.TransactionTypeRefund, handler))
+
+	_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "refund-1",
+		TransactionType:   entities.TransactionTypeRefund,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	})
+	if err != nil {
+		t.Errorf("Type handler failure should not fail processing, got: %v", err)
+	}
+	if len(mockRepo.transactions) != 1 {
+		t.Errorf("Expected the transaction to be stored, got %d", len(mockRepo.transactions))
+	}
+	found := false
+	for _, msg := range mockLog.errorMsgs {
+		if msg == "Failed to run transaction type handler" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Type handler failure should be logged")
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_BalanceContinuity(t *testing.T) {
+	tests := []struct {
+		name          string
+		previous      *entities.Transaction
+		balanceBefore float64
+		mismatch      bool
+	}{
+		{"first transaction of account", nil, 1000.00, false},
+		{"continues from previous", &entities.Transaction{TransactionID: "trans-1", AccountID: "account-123", BalanceAfter: 1000.00}, 1000.00, false},
+		{"gap after previous", &entities.Transaction{TransactionID: "trans-1", AccountID: "account-123", BalanceAfter: 900.00}, 1000.00, true},
+		{"other account ignored", &entities.Transaction{TransactionID: "trans-1", AccountID: "account-456", BalanceAfter: 900.00}, 1000.00, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{transactions: map[string]*entities.Transaction{}}
+			if tt.previous != nil {
+				mockRepo.transactions[tt.previous.TransactionID] = tt.previous
+			}
+			mockLog := &mockLogger{}
+			useCase := NewTransactionUseCase(mockRepo, mockLog, WithBalanceContinuityCheck(true))
+
+			_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-2",
+				TransactionType:   entities.TransactionTypePayment,
+				TransactionStatus: entities.TransactionStatusSuccess,
+				Amount:            100.00,
+				BalanceBefore:     tt.balanceBefore,
+				BalanceAfter:      tt.balanceBefore - 100.00,
+			})
+			if err != nil {
+				t.Fatalf("A continuity gap should not fail processing, got: %v", err)
+			}
+			if _, stored := mockRepo.transactions["trans-2"]; !stored {
+				t.Error("Expected the transaction to be stored")
+			}
+
+			warned := false
+			for _, msg := range mockLog.warnMsgs {
+				if msg == "Balance does not continue from previous transaction" {
+					warned = true
+				}
+			}
+			if warned != tt.mismatch {
+				t.Errorf("Expected continuity warning %v, got %v", tt.mismatch, warned)
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_BalanceContinuityDisabled(t *testing.T) {
+	mockRepo := &mockTransactionRepository{transactions: map[string]*entities.Transaction{
+		"trans-1": {TransactionID: "trans-1", AccountID: "account-123", BalanceAfter: 900.00},
+	}}
+	mockLog := &mockLogger{}
+	useCase := NewTransactionUseCase(mockRepo, mockLog)
+
+	_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-2",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.00,
+		BalanceBefore:     1000.00,
+		BalanceAfter:      1000.00,
+	})
+	if err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+	for _, msg := range mockLog.warnMsgs {
+		if msg == "Balance does not continue from previous transaction" {
+			t.Error("Continuity should not be checked unless enabled")
+		}
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_DuplicateDiff(t *testing.T) {
+	stored := func() *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-1",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: entities.TransactionStatusPending,
+			Amount:            100.00,
+			BalanceBefore:     1000.00,
+			BalanceAfter:      1000.00,
+			Currency:          "IDR",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		enabled bool
+		modify  func(*entities.Transaction)
+		warned  bool
+	}{
+		{"identical", true, func(*entities.Transaction) {}, false},
+		{"different amount", true, func(tx *entities.Transaction) { tx.Amount = 150.00 }, true},
+		{"different but disabled", false, func(tx *entities.Transaction) { tx.Amount = 150.00 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{transactions: map[string]*entities.Transaction{"trans-1": stored()}}
+			mockLog := &mockLogger{}
+			useCase := NewTransactionUseCase(mockRepo, mockLog, WithDuplicateDiff(tt.enabled))
+
+			incoming := stored()
+			tt.modify(incoming)
+			if _, err := useCase.ProcessTransaction(context.Background(), incoming); err != nil {
+				t.Fatalf("A duplicate should be skipped, got: %v", err)
+			}
+			if mockRepo.transactions["trans-1"].Amount != 100.00 {
+				t.Error("Expected the stored transaction to be left unchanged")
+			}
+
+			warned := false
+			for _, msg := range mockLog.warnMsgs {
+				if msg == "Duplicate transaction differs from stored transaction" {
+					warned = true
+				}
+			}
+			if warned != tt.warned {
+				t.Errorf("Expected duplicate diff warning %v, got %v", tt.warned, warned)
+			}
+		})
+	}
+}
+
+func TestDiffTransactions(t *testing.T) {
+	reference := "INV-1"
+	stored := &entities.Transaction{AccountID: "account-123", Amount: 100.00, Currency: "IDR"}
+	incoming := &entities.Transaction{AccountID: "account-456", Amount: 100.001, Currency: "IDR", ExternalReference: &reference}
+
+	fields := diffTransactions(stored, incoming)
+	expected := []string{"accountId", "externalReference"}
+	if strings.Join(fields, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected differing fields %v, got %v", expected, fields)
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_ZeroAmount(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowZero bool
+		amount    float64
+		expectErr bool
+	}{
+		{"zero rejected by default", false, 0, true},
+		{"zero allowed", true, 0, false},
+		{"negative rejected when zero allowed", true, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{}
+			useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, WithAllowZeroAmount(tt.allowZero))
+
+			result, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-zero",
+				TransactionType:   entities.TransactionTypeTransfer,
+				TransactionStatus: entities.TransactionStatusSuccess,
+				Amount:            tt.amount,
+				BalanceBefore:     1000,
+				BalanceAfter:      1000,
+			})
+
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidTransaction) {
+					t.Errorf("Expected ErrInvalidTransaction, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+			}
+			if result != ProcessResultInserted {
+				t.Errorf("Expected the zero amount transaction to be inserted, got %s", result)
+			}
+		})
+	}
+}
+
+type mockSpill struct {
+	transactions []*entities.Transaction
+	appendErr    error
+}
+
+func (m *mockSpill) Append(ctx context.Context, transaction *entities.Transaction) error {
+	if m.appendErr != nil {
+		return m.appendErr
+	}
+	m.transactions = append(m.transactions, transaction)
+	return nil
+}
+
+func TestTransactionUseCase_ProcessTransaction_SpillOnFailure(t *testing.T) {
+	stored := &entities.Transaction{TransactionID: "trans-123", TransactionStatus: entities.TransactionStatusPending}
+	tests := []struct {
+		name string
+		repo *mockTransactionRepository
+	}{
+		{"exists failure", &mockTransactionRepository{existsError: errors.New("connection refused")}},
+		{"create failure", &mockTransactionRepository{createError: errors.New("connection reset")}},
+		{"update failure", &mockTransactionRepository{
+			transactions: map[string]*entities.Transaction{"trans-123": stored},
+			updateError:  errors.New("connection reset"),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spill := &mockSpill{}
+			useCase := NewTransactionUseCase(tt.repo, &mockLogger{},
+				WithSpill(spill), WithAmountSignNormalization(true))
+
+			result, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-123",
+				TransactionType:   entities.TransactionTypePayment,
+				TransactionStatus: entities.TransactionStatusSuccess,
+				Amount:            100,
+				BalanceBefore:     500,
+				BalanceAfter:      400,
+				Currency:          "idr",
+			})
+			if err != nil {
+				t.Fatalf("Expected transaction to be spilled, got: %v", err)
+			}
+			if result != ProcessResultSpilled {
+				t.Errorf("Expected result %q, got %q", ProcessResultSpilled, result)
+			}
+
+			if len(spill.transactions) != 1 {
+				t.Fatalf("Expected 1 spilled transaction, got %d", len(spill.transactions))
+			}
+			// Spilled as received, so draining normalizes and validates it again
+			spilled := spill.transactions[0]
+			if spilled.Amount != 100 || spilled.Currency != "idr" || spilled.Metadata != nil {
+				t.Errorf("Expected transaction to be spilled as received, got: %+v", spilled)
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_SpillNotUsed(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     *mockTransactionRepository
+		spill    *mockSpill
+		expected error
+	}{
+		{
+			name:     "duplicate",
+			repo:     &mockTransactionRepository{createError: repositories.ErrDuplicateTransaction},
+			spill:    &mockSpill{},
+			expected: ErrDuplicateTransaction,
+		},
+		{
+			name:     "spill full",
+			repo:     &mockTransactionRepository{createError: errors.New("connection reset")},
+			spill:    &mockSpill{appendErr: repositories.ErrSpillFull},
+			expected: ErrTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useCase := NewTransactionUseCase(tt.repo, &mockLogger{}, WithSpill(tt.spill))
+
+			_, err := useCase.ProcessTransaction(context.Background(), &entities.Transaction{
+				UserID:            123,
+				AccountID:         "account-123",
+				TransactionID:     "trans-123",
+				TransactionType:   entities.TransactionTypeTopup,
+				TransactionStatus: entities.TransactionStatusPending,
+				Amount:            100.50,
+			})
+
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected error matching %v, got: %v", tt.expected, err)
+			}
+			if len(tt.spill.transactions) != 0 {
+				t.Errorf("Expected nothing spilled, got %d transactions", len(tt.spill.transactions))
+			}
+		})
+	}
+}
+
+func TestDrainSpilled(t *testing.T) {
+	valid := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-123",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	}
+	tests := []struct {
+		name        string
+		repo        *mockTransactionRepository
+		transaction *entities.Transaction
+		expectErr   bool
+		expectRows  int
+	}{
+		{"recovered", &mockTransactionRepository{}, valid, false, 1},
+		{"still unavailable", &mockTransactionRepository{existsError: errors.New("connection refused")}, valid, true, 0},
+		{"duplicate", &mockTransactionRepository{createError: repositories.ErrDuplicateTransaction}, valid, false, 0},
+		{"invalid is dropped", &mockTransactionRepository{}, &entities.Transaction{TransactionID: "trans-456"}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			drain := DrainSpilled(NewTransactionUseCase(tt.repo, &mockLogger{}), &mockLogger{})
+
+			transaction := *tt.transaction
+			err := drain(context.Background(), &transaction)
+
+			if (err != nil) != tt.expectErr {
+				t.Errorf("drain() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if len(tt.repo.transactions) != tt.expectRows {
+				t.Errorf("Expected %d stored transactions, got %d", tt.expectRows, len(tt.repo.transactions))
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_DedupCache(t *testing.T) {
+	transaction := func(id string, status entities.TransactionStatus) *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     id,
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: status,
+			Amount:            100.50,
+		}
+	}
+	type step struct {
+		transaction *entities.Transaction
+		result      ProcessResult
+		existsCalls int
+	}
+	tests := []struct {
+		name  string
+		size  int
+		steps []step
+	}{
+		{
+			name: "hit after insert",
+			size: 10,
+			steps: []step{
+				{transaction("trans-1", entities.TransactionStatusPending), ProcessResultInserted, 1},
+				{transaction("trans-1", entities.TransactionStatusPending), ProcessResultSkipped, 1},
+			},
+		},
+		{
+			name: "miss for new status, hit after update",
+			size: 10,
+			steps: []step{
+				{transaction("trans-1", entities.TransactionStatusPending), ProcessResultInserted, 1},
+				{transaction("trans-1", entities.TransactionStatusSuccess), ProcessResultUpdated, 2},
+				{transaction("trans-1", entities.TransactionStatusSuccess), ProcessResultSkipped, 2},
+			},
+		},
+		{
+			name: "miss after eviction falls back to the database",
+			size: 1,
+			steps: []step{
+				{transaction("trans-1", entities.TransactionStatusPending), ProcessResultInserted, 1},
+				{transaction("trans-2", entities.TransactionStatusPending), ProcessResultInserted, 2},
+				{transaction("trans-1", entities.TransactionStatusPending), ProcessResultSkipped, 3},
+			},
+		},
+		{
+			name: "disabled",
+			size: 0,
+			steps: []step{
+				{transaction("trans-1", entities.TransactionStatusPending), ProcessResultInserted, 1},
+				{transaction("trans-1", entities.TransactionStatusPending), ProcessResultSkipped, 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &countingRepository{mockTransactionRepository: &mockTransactionRepository{}}
+			useCase := NewTransactionUseCase(repo, &mockLogger{}, WithDedupCache(tt.size))
+
+			for i, step := range tt.steps {
+				result, err := useCase.ProcessTransaction(context.Background(), step.transaction)
+				if err != nil {
+					t.Fatalf("step %d: ProcessTransaction should not return error, got: %v", i, err)
+				}
+				if result != step.result {
+					t.Errorf("step %d: expected result %q, got %q", i, step.result, result)
+				}
+				if repo.calls != step.existsCalls {
+					t.Errorf("step %d: expected %d existence lookups, got %d", i, step.existsCalls, repo.calls)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_DedupCacheSkipsFailedInsert(t *testing.T) {
+	repo := &countingRepository{mockTransactionRepository: &mockTransactionRepository{createError: errors.New("connection reset")}}
+	useCase := NewTransactionUseCase(repo, &mockLogger{}, WithDedupCache(10))
+	transaction := &entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionID:     "trans-1",
+		TransactionType:   entities.TransactionTypeTopup,
+		TransactionStatus: entities.TransactionStatusPending,
+		Amount:            100.50,
+	}
+
+	if _, err := useCase.ProcessTransaction(context.Background(), transaction); err == nil {
+		t.Fatal("Expected the failed insert to return an error")
+	}
+	repo.createError = nil
+	result, err := useCase.ProcessTransaction(context.Background(), transaction)
+	if err != nil {
+		t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+	}
+	if result != ProcessResultInserted || repo.calls != 2 {
+		t.Errorf("Expected the retry to reach the database and insert, got %q after %d lookups", result, repo.calls)
+	}
+}
+
+type mockPersistedEventPublisher struct {
+	events     []*entities.PersistedEvent
+	publishErr error
+}
+
+func (m *mockPersistedEventPublisher) PublishPersisted(ctx context.Context, event *entities.PersistedEvent) error {
+	if m.publishErr != nil {
+		return m.publishErr
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestTransactionUseCase_ProcessTransaction_PublishesPersistedEvent(t *testing.T) {
+	publisher := &mockPersistedEventPublisher{}
+	useCase := NewTransactionUseCase(&mockTransactionRepository{}, &mockLogger{}, WithPersistedEventPublisher(publisher))
+	transaction := func(status entities.TransactionStatus) *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-123",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: status,
+			Amount:            100.50,
+		}
+	}
+
+	before := time.Now().UTC()
+	for _, status := range []entities.TransactionStatus{
+		entities.TransactionStatusPending,
+		entities.TransactionStatusSuccess,
+		entities.TransactionStatusSuccess,
+	} {
+		if _, err := useCase.ProcessTransaction(context.Background(), transaction(status)); err != nil {
+			t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+		}
+	}
+
+	// The duplicate SUCCESS is not confirmed again
+	expected := []entities.TransactionStatus{entities.TransactionStatusPending, entities.TransactionStatusSuccess}
+	if len(publisher.events) != len(expected) {
+		t.Fatalf("Expected %d persisted events, got %d", len(expected), len(publisher.events))
+	}
+	for i, event := range publisher.events {
+		if event.TransactionID != "trans-123" || event.Status != expected[i] {
+			t.Errorf("event %d: expected trans-123 with status %s, got %+v", i, expected[i], event)
+		}
+		if event.PersistedAt.Before(before) || event.PersistedAt.Location() != time.UTC {
+			t.Errorf("event %d: expected a UTC persisted-at time after %v, got %v", i, before, event.PersistedAt)
+		}
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_PersistedEventFailure(t *testing.T) {
+	transaction := func() *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-123",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: entities.TransactionStatusPending,
+			Amount:            100.50,
+		}
+	}
+
+	t.Run("logged only by default", func(t *testing.T) {
+		publisher := &mockPersistedEventPublisher{publishErr: errors.New("broker unavailable")}
+		useCase := NewTransactionUseCase(&mockTransactionRepository{}, &mockLogger{}, WithPersistedEventPublisher(publisher))
+
+		result, err := useCase.ProcessTransaction(context.Background(), transaction())
+		if err != nil {
+			t.Fatalf("Expected publish failure not to fail processing, got: %v", err)
+		}
+		if result != ProcessResultInserted {
+			t.Errorf("Expected result %q, got %q", ProcessResultInserted, result)
+		}
+	})
+
+	t.Run("required", func(t *testing.T) {
+		publisher := &mockPersistedEventPublisher{publishErr: errors.New("broker unavailable")}
+		repo := &mockTransactionRepository{}
+		useCase := NewTransactionUseCase(repo, &mockLogger{},
+			WithPersistedEventPublisher(publisher), WithPersistedEventRequired(true))
+
+		_, err := useCase.ProcessTransaction(context.Background(), transaction())
+		if !errors.Is(err, ErrTransient) {
+			t.Fatalf("Expected a transient error, got: %v", err)
+		}
+		if len(repo.transactions) != 1 {
+			t.Fatalf("Expected the transaction to be stored, got %d", len(repo.transactions))
+		}
+
+		// The redelivered message finds the transaction stored and confirms it
+		publisher.publishErr = nil
+		result, err := useCase.ProcessTransaction(context.Background(), transaction())
+		if err != nil {
+			t.Fatalf("ProcessTransaction should not return error, got: %v", err)
+		}
+		if result != ProcessResultSkipped {
+			t.Errorf("Expected result %q, got %q", ProcessResultSkipped, result)
+		}
+		if len(publisher.events) != 1 || publisher.events[0].TransactionID != "trans-123" {
+			t.Errorf("Expected the duplicate to publish the confirmation, got %+v", publisher.events)
+		}
+	})
+}
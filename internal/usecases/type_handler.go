@@ -0,0 +1,51 @@
+package usecases
+
+import (
+	"context"
+	"transaction-consumer/internal/domain/entities"
+)
+
+// TypeHandler holds the behaviour specific to a transaction type
+type TypeHandler interface {
+	// ExpectedBalanceAfter returns the balance a successful transaction
+	// should leave behind
+	ExpectedBalanceAfter(transaction *entities.Transaction) float64
+	// AfterStore runs side effects once a new transaction or a status update
+	// of it is stored; errors are logged only, as the change is already
+	// persisted and a redelivery would be skipped as a duplicate
+	AfterStore(ctx context.Context, transaction *entities.Transaction) error
+}
+
+// CreditHandler is the default handler of types adding the amount to the
+// balance; embed it to add side effects to such a type
+type CreditHandler struct{}
+
+func (CreditHandler) ExpectedBalanceAfter(transaction *entities.Transaction) float64 {
+	return transaction.BalanceBefore + transaction.Amount
+}
+
+func (CreditHandler) AfterStore(ctx context.Context, transaction *entities.Transaction) error {
+	return nil
+}
+
+// DebitHandler is the default handler of types subtracting the amount from
+// the balance; embed it to add side effects to such a type
+type DebitHandler struct{}
+
+func (DebitHandler) ExpectedBalanceAfter(transaction *entities.Transaction) float64 {
+	return transaction.BalanceBefore - transaction.Amount
+}
+
+func (DebitHandler) AfterStore(ctx context.Context, transaction *entities.Transaction) error {
+	return nil
+}
+
+// defaultTypeHandlers returns the handlers of the known transaction types
+func defaultTypeHandlers() map[entities.TransactionType]TypeHandler {
+	return map[entities.TransactionType]TypeHandler{
+		entities.TransactionTypeTopup:    CreditHandler{},
+		entities.TransactionTypeRefund:   CreditHandler{},
+		entities.TransactionTypePayment:  DebitHandler{},
+		entities.TransactionTypeTransfer: DebitHandler{},
+	}
+}
@@ -0,0 +1,162 @@
+package usecases
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"transaction-consumer/internal/domain/entities"
+)
+
+// Names of the built-in validators, as listed in WithValidators
+const (
+	ValidatorRequiredFields = "required-fields"
+	ValidatorEnum           = "enum"
+	ValidatorCurrency       = "currency"
+	ValidatorBalanceMath    = "balance-math"
+	ValidatorAmountBounds   = "amount-bounds"
+	ValidatorMetadata       = "metadata"
+
+	ValidatorBalanceMagnitude = "balance-magnitude"
+)
+
+// DefaultValidators are the built-in validators run unless WithValidators
+// lists others; together they check what Transaction.Validate does
+var DefaultValidators = []string{ValidatorRequiredFields, ValidatorAmountBounds, ValidatorMetadata}
+
+// Validator checks a single aspect of a transaction before it is stored
+type Validator interface {
+	Validate(transaction *entities.Transaction) error
+}
+
+// ValidatorFunc adapts a function to a Validator
+type ValidatorFunc func(transaction *entities.Transaction) error
+
+func (f ValidatorFunc) Validate(transaction *entities.Transaction) error {
+	return f(transaction)
+}
+
+// ValidationPipeline runs validators in order, stopping at the first failure
+// unless it collects all of them
+type ValidationPipeline struct {
+	validators []Validator
+	collectAll bool
+}
+
+// NewValidationPipeline creates a pipeline running validators in order;
+// with collectAll every validator runs and their failures are joined
+func NewValidationPipeline(collectAll bool, validators ...Validator) *ValidationPipeline {
+	return &ValidationPipeline{validators: validators, collectAll: collectAll}
+}
+
+// Validate runs the validators of the pipeline against transaction
+func (p *ValidationPipeline) Validate(transaction *entities.Transaction) error {
+	var errs []error
+	for _, validator := range p.validators {
+		if err := validator.Validate(transaction); err != nil {
+			if !p.collectAll {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// builtinValidator returns the built-in validator name, with enums checked
+// against the known types and statuses and balance math against the type
+// handlers of the use case
+func (uc *transactionUseCase) builtinValidator(name string) (Validator, bool) {
+	switch name {
+	case ValidatorRequiredFields:
+		return ValidatorFunc((*entities.Transaction).ValidateRequired), true
+	case ValidatorEnum:
+		return ValidatorFunc(uc.validateEnums), true
+	case ValidatorCurrency:
+		return ValidatorFunc(validateCurrency), true
+	case ValidatorBalanceMath:
+		return ValidatorFunc(uc.validateBalanceMath), true
+	case ValidatorAmountBounds:
+		if uc.allowZeroAmount {
+			return ValidatorFunc((*entities.Transaction).ValidateAmountsAllowZero), true
+		}
+		return ValidatorFunc((*entities.Transaction).ValidateAmounts), true
+	case ValidatorMetadata:
+		return ValidatorFunc((*entities.Transaction).ValidateMetadata), true
+	case ValidatorBalanceMagnitude:
+		return ValidatorFunc(validateBalanceMagnitude), true
+	}
+	return nil, false
+}
+
+// validateEnums checks that the type and status are among the known ones,
+// as configured with WithTransactionTypes and WithTransactionStatuses
+func (uc *transactionUseCase) validateEnums(transaction *entities.Transaction) error {
+	if !slices.Contains(uc.knownTypes, transaction.TransactionType) {
+		return fmt.Errorf("unknown transactionType: %s", transaction.TransactionType)
+	}
+	if !slices.Contains(uc.knownStatuses, transaction.TransactionStatus) {
+		return fmt.Errorf("unknown transactionStatus: %s", transaction.TransactionStatus)
+	}
+	return nil
+}
+
+// validateCurrency checks that the currency, if any, is a three-letter code;
+// it runs after the currency was uppercased
+func validateCurrency(transaction *entities.Transaction) error {
+	if transaction.Currency == "" {
+		return nil
+	}
+	if len(transaction.Currency) != 3 {
+		return fmt.Errorf("currency must be a three-letter code, got: %s", transaction.Currency)
+	}
+	for _, r := range transaction.Currency {
+		if r < 'A' || r > 'Z' {
+			return fmt.Errorf("currency must be a three-letter code, got: %s", transaction.Currency)
+		}
+	}
+	return nil
+}
+
+// validateBalanceMath rejects successful transactions whose balance delta
+// does not match the amount for their type. Like every balance validator it
+// always rejects a mismatch; checkBalanceArithmetic runs the same check on
+// every transaction but only rejects with WithRejectBalanceMismatch
+func (uc *transactionUseCase) validateBalanceMath(transaction *entities.Transaction) error {
+	if transaction.TransactionStatus != entities.TransactionStatusSuccess {
+		return nil
+	}
+	handler, ok := uc.typeHandlers[transaction.TransactionType]
+	if !ok {
+		return nil
+	}
+	if expected := handler.ExpectedBalanceAfter(transaction); math.Abs(transaction.BalanceAfter-expected) > balanceEpsilon {
+		return fmt.Errorf("balanceAfter must be %.2f for a successful %s, got: %.2f",
+			expected, transaction.TransactionType, transaction.BalanceAfter)
+	}
+	return nil
+}
+
+// balanceMagnitudeTypes are the transaction types whose balance changes by
+// exactly their amount
+var balanceMagnitudeTypes = []entities.TransactionType{
+	entities.TransactionTypeTopup,
+	entities.TransactionTypePayment,
+}
+
+// validateBalanceMagnitude rejects successful TOPUP or PAYMENT transactions
+// whose balance changes by another size than their amount, ignoring signs,
+// which catches unit mismatches such as amounts sent in cents.
+// WithRejectBalanceMagnitudeMismatch enables it when it is not listed
+func validateBalanceMagnitude(transaction *entities.Transaction) error {
+	if transaction.TransactionStatus != entities.TransactionStatusSuccess ||
+		!slices.Contains(balanceMagnitudeTypes, transaction.TransactionType) {
+		return nil
+	}
+
+	change := math.Abs(transaction.BalanceAfter - transaction.BalanceBefore)
+	if math.Abs(change-math.Abs(transaction.Amount)) > balanceEpsilon {
+		return fmt.Errorf("balance change of %.2f does not match amount %.2f", change, transaction.Amount)
+	}
+	return nil
+}
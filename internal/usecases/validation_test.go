@@ -0,0 +1,214 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"transaction-consumer/internal/domain/entities"
+)
+
+func TestValidationPipeline_StopsAtFirstFailure(t *testing.T) {
+	var ran []string
+	validator := func(name string, err error) Validator {
+		return ValidatorFunc(func(*entities.Transaction) error {
+			ran = append(ran, name)
+			return err
+		})
+	}
+
+	pipeline := NewValidationPipeline(false,
+		validator("first", nil),
+		validator("second", errors.New("second failed")),
+		validator("third", errors.New("third failed")))
+
+	err := pipeline.Validate(&entities.Transaction{})
+	if err == nil || err.Error() != "second failed" {
+		t.Errorf("Expected the first failure only, got %v", err)
+	}
+	if strings.Join(ran, ",") != "first,second" {
+		t.Errorf("Expected validators after the failure not to run, ran %v", ran)
+	}
+}
+
+func TestValidationPipeline_CollectsAllFailures(t *testing.T) {
+	uc := NewTransactionUseCase(&mockTransactionRepository{}, &mockLogger{}).(*transactionUseCase)
+	var validators []Validator
+	for _, name := range []string{ValidatorRequiredFields, ValidatorEnum, ValidatorCurrency, ValidatorAmountBounds} {
+		validator, ok := uc.builtinValidator(name)
+		if !ok {
+			t.Fatalf("Expected built-in validator %s", name)
+		}
+		validators = append(validators, validator)
+	}
+	pipeline := NewValidationPipeline(true, validators...)
+
+	err := pipeline.Validate(&entities.Transaction{
+		UserID:            123,
+		AccountID:         "account-123",
+		TransactionType:   "GIFT",
+		TransactionStatus: entities.TransactionStatusSuccess,
+		Currency:          "RUPIAH",
+		Amount:            -1,
+	})
+	if err == nil {
+		t.Fatal("Expected validation to fail")
+	}
+	for _, expected := range []string{"transactionId is required", "unknown transactionType", "currency must be", "amount must not be negative"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected the joined error to contain %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestValidateEnums_ConfiguredTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		txType    entities.TransactionType
+		status    entities.TransactionStatus
+		expectErr bool
+	}{
+		{"custom type rejected by default", nil, "WITHDRAWAL", entities.TransactionStatusSuccess, true},
+		{"custom type configured", []Option{WithTransactionTypes("TOPUP", " withdrawal ")}, "WITHDRAWAL", entities.TransactionStatusSuccess, false},
+		{"default type not configured", []Option{WithTransactionTypes("WITHDRAWAL")}, entities.TransactionTypeTopup, entities.TransactionStatusSuccess, true},
+		{"no types keep the defaults", []Option{WithTransactionTypes()}, entities.TransactionTypeTopup, entities.TransactionStatusSuccess, false},
+		{"custom status configured", []Option{WithTransactionStatuses("SUCCESS", "REVERSED")}, entities.TransactionTypeTopup, "REVERSED", false},
+		{"custom status rejected by default", nil, entities.TransactionTypeTopup, "REVERSED", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewTransactionUseCase(&mockTransactionRepository{}, &mockLogger{}, tt.opts...).(*transactionUseCase)
+			validator, _ := uc.builtinValidator(ValidatorEnum)
+
+			err := validator.Validate(&entities.Transaction{TransactionType: tt.txType, TransactionStatus: tt.status})
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Validate() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestValidateBalanceMagnitude(t *testing.T) {
+	tests := []struct {
+		name          string
+		txType        entities.TransactionType
+		status        entities.TransactionStatus
+		amount        float64
+		balanceBefore float64
+		balanceAfter  float64
+		mismatch      bool
+	}{
+		{"topup matches", entities.TransactionTypeTopup, entities.TransactionStatusSuccess, 100, 500, 600, false},
+		{"payment matches", entities.TransactionTypePayment, entities.TransactionStatusSuccess, 100, 500, 400, false},
+		{"signed amount matches", entities.TransactionTypePayment, entities.TransactionStatusSuccess, -100, 500, 400, false},
+		{"float epsilon", entities.TransactionTypeTopup, entities.TransactionStatusSuccess, 0.2, 0.1, 0.3, false},
+		{"within epsilon", entities.TransactionTypeTopup, entities.TransactionStatusSuccess, 100, 500, 600.004, false},
+		{"cents mismatch", entities.TransactionTypeTopup, entities.TransactionStatusSuccess, 10000, 500, 600, true},
+		{"just beyond epsilon", entities.TransactionTypePayment, entities.TransactionStatusSuccess, 100, 500, 399.99, true},
+		{"pending is not checked", entities.TransactionTypeTopup, entities.TransactionStatusPending, 100, 500, 500, false},
+		{"refund is not checked", entities.TransactionTypeRefund, entities.TransactionStatusSuccess, 100, 500, 500, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := &entities.Transaction{
+				TransactionType:   tt.txType,
+				TransactionStatus: tt.status,
+				Amount:            tt.amount,
+				BalanceBefore:     tt.balanceBefore,
+				BalanceAfter:      tt.balanceAfter,
+			}
+
+			uc := NewTransactionUseCase(&mockTransactionRepository{}, &mockLogger{}).(*transactionUseCase)
+			validator, _ := uc.builtinValidator(ValidatorBalanceMagnitude)
+			if err := validator.Validate(transaction); (err != nil) != tt.mismatch {
+				t.Errorf("Validate() error = %v, mismatch %v", err, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_RejectBalanceMagnitudeMismatch(t *testing.T) {
+	// Sent in cents, which the balance arithmetic check only warns about
+	transaction := func() *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-cents",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: entities.TransactionStatusSuccess,
+			Amount:            10000,
+			BalanceBefore:     500,
+			BalanceAfter:      600,
+		}
+	}
+
+	mockRepo := &mockTransactionRepository{}
+	useCase := NewTransactionUseCase(mockRepo, &mockLogger{})
+	if _, err := useCase.ProcessTransaction(context.Background(), transaction()); err != nil {
+		t.Fatalf("Expected the default validators to accept the transaction, got: %v", err)
+	}
+
+	mockRepo = &mockTransactionRepository{}
+	useCase = NewTransactionUseCase(mockRepo, &mockLogger{}, WithRejectBalanceMagnitudeMismatch(true))
+	_, err := useCase.ProcessTransaction(context.Background(), transaction())
+	if !errors.Is(err, ErrInvalidTransaction) {
+		t.Errorf("Expected the magnitude mismatch to be rejected, got: %v", err)
+	}
+	if len(mockRepo.transactions) != 0 {
+		t.Error("Rejected transaction should not be stored")
+	}
+}
+
+func TestValidationPipeline_Empty(t *testing.T) {
+	if err := NewValidationPipeline(true).Validate(&entities.Transaction{}); err != nil {
+		t.Errorf("Expected an empty pipeline to pass, got %v", err)
+	}
+}
+
+func TestTransactionUseCase_ProcessTransaction_ConfiguredValidators(t *testing.T) {
+	transaction := func() *entities.Transaction {
+		return &entities.Transaction{
+			UserID:            123,
+			AccountID:         "account-123",
+			TransactionID:     "trans-1",
+			TransactionType:   entities.TransactionTypeTopup,
+			TransactionStatus: entities.TransactionStatusSuccess,
+			Amount:            100.00,
+			BalanceBefore:     1000.00,
+			BalanceAfter:      1200.00,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		expectErr bool
+	}{
+		{"defaults only warn on balance math", nil, false},
+		{"balance math rejects", []Option{WithValidators(ValidatorRequiredFields, ValidatorBalanceMath)}, true},
+		{"custom validator", []Option{WithValidator(ValidatorFunc(func(tx *entities.Transaction) error {
+			return errors.New("blocked account")
+		}))}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockTransactionRepository{}
+			useCase := NewTransactionUseCase(mockRepo, &mockLogger{}, tt.opts...)
+
+			_, err := useCase.ProcessTransaction(context.Background(), transaction())
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("ProcessTransaction() error = %v, expectErr %v", err, tt.expectErr)
+			}
+			if tt.expectErr && !errors.Is(err, ErrInvalidTransaction) {
+				t.Errorf("Expected an invalid transaction error, got %v", err)
+			}
+			if _, stored := mockRepo.transactions["trans-1"]; stored == tt.expectErr {
+				t.Errorf("Expected stored %v", !tt.expectErr)
+			}
+		})
+	}
+}
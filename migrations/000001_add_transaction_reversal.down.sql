@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_historical_transactions_reversed_at;
+
+ALTER TABLE historical_transactions
+    DROP COLUMN IF EXISTS reversal_reason,
+    DROP COLUMN IF EXISTS reversed_at;
@@ -0,0 +1,6 @@
+ALTER TABLE historical_transactions
+    ADD COLUMN IF NOT EXISTS reversed_at TIMESTAMP NULL,
+    ADD COLUMN IF NOT EXISTS reversal_reason TEXT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_historical_transactions_reversed_at
+    ON historical_transactions (reversed_at);
@@ -0,0 +1,2 @@
+ALTER TABLE historical_transactions
+    ALTER COLUMN metadata TYPE TEXT USING metadata::text;
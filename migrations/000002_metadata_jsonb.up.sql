@@ -0,0 +1,2 @@
+ALTER TABLE historical_transactions
+    ALTER COLUMN metadata TYPE JSONB USING NULLIF(BTRIM(metadata), '')::JSONB;
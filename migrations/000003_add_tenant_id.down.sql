@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_historical_transactions_tenant_id;
+
+ALTER TABLE historical_transactions
+    DROP COLUMN IF EXISTS tenant_id;
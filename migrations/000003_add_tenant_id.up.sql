@@ -0,0 +1,5 @@
+ALTER TABLE historical_transactions
+    ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NULL;
+
+CREATE INDEX IF NOT EXISTS idx_historical_transactions_tenant_id
+    ON historical_transactions (tenant_id);
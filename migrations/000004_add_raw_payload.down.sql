@@ -0,0 +1,2 @@
+ALTER TABLE historical_transactions
+    DROP COLUMN IF EXISTS raw_payload;
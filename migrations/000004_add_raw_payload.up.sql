@@ -0,0 +1,2 @@
+ALTER TABLE historical_transactions
+    ADD COLUMN IF NOT EXISTS raw_payload JSONB NULL;
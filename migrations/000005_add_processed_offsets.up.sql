@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS processed_offsets (
+    topic VARCHAR(255) NOT NULL,
+    partition INTEGER NOT NULL,
+    "offset" BIGINT NOT NULL,
+    processed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (topic, partition)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS processing_log (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id VARCHAR(50) NULL,
+    outcome VARCHAR(20) NOT NULL,
+    error TEXT NULL,
+    received_at TIMESTAMP NOT NULL,
+    processed_at TIMESTAMP NOT NULL,
+    latency_ms BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_processing_log_transaction_id
+    ON processing_log (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_processing_log_outcome
+    ON processing_log (outcome);
+CREATE INDEX IF NOT EXISTS idx_processing_log_processed_at
+    ON processing_log (processed_at);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id VARCHAR(50) NOT NULL,
+    user_id BIGINT NOT NULL,
+    amount DECIMAL(15, 2) NOT NULL,
+    processed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_transaction_id
+    ON audit_log (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_processed_at
+    ON audit_log (processed_at);
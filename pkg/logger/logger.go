@@ -1,8 +1,11 @@
 package logger
 
 import (
+	"context"
+	"io"
 	"log/slog"
 	"os"
+	"time"
 )
 
 type Logger interface {
@@ -11,17 +14,64 @@ type Logger interface {
 	Warn(msg string, args ...interface{})
 	Error(msg string, args ...interface{})
 	Fatal(msg string, args ...interface{})
+	With(args ...interface{}) Logger
 }
 
 type logger struct {
 	slog *slog.Logger
 }
 
+// DefaultTimeFormat is the layout of the time field unless configured
+// otherwise
+const DefaultTimeFormat = time.RFC3339Nano
+
 func NewLogger() Logger {
+	return NewLoggerWithTimeFormat(DefaultTimeFormat)
+}
+
+// NewLoggerWithTimeFormat creates a JSON logger writing to stdout whose time
+// field is in UTC and formatted with layout, e.g. time.RFC3339; an empty or
+// invalid layout falls back to DefaultTimeFormat
+func NewLoggerWithTimeFormat(layout string) Logger {
+	return NewLoggerWithHandler(newJSONHandler(os.Stdout, layout))
+}
+
+// newJSONHandler returns the JSON handler of NewLoggerWithTimeFormat writing
+// to w
+func newJSONHandler(w io.Writer, layout string) slog.Handler {
+	if !validTimeFormat(layout) {
+		layout = DefaultTimeFormat
+	}
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey && a.Value.Kind() == slog.KindTime {
+				a.Value = slog.StringValue(a.Value.Time().UTC().Format(layout))
+			}
+			return a
+		},
+	})
+}
+
+// validTimeFormat reports whether layout formats times, rather than being
+// empty or literal text that time.Format would print unchanged
+func validTimeFormat(layout string) bool {
+	if layout == "" {
+		return false
+	}
+	reference := time.Date(2024, time.January, 15, 10, 30, 45, 0, time.UTC)
+	formatted := reference.Format(layout)
+	if formatted == layout {
+		return false
+	}
+	_, err := time.Parse(layout, formatted)
+	return err == nil
+}
+
+// NewLoggerWithHandler creates a logger writing through the given slog handler
+func NewLoggerWithHandler(handler slog.Handler) Logger {
 	return &logger{
-		slog: slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		})),
+		slog: slog.New(handler),
 	}
 }
 
@@ -45,3 +95,23 @@ func (l *logger) Fatal(msg string, args ...interface{}) {
 	l.slog.Error(msg, args...)
 	os.Exit(1)
 }
+
+// With returns a logger that includes args in every log line
+func (l *logger) With(args ...interface{}) Logger {
+	return &logger{slog: l.slog.With(args...)}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if there is none
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return l
+	}
+	return fallback
+}
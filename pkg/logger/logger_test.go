@@ -2,12 +2,14 @@ package logger
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"log/slog"
 	"os"
 	"os/exec"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewLogger(t *testing.T) {
@@ -460,3 +462,74 @@ func TestLogger_Interface(t *testing.T) {
 	// Test that NewLogger returns something that implements Logger interface
 	var _ Logger = NewLogger()
 }
+
+func TestLogger_With(t *testing.T) {
+	var buf bytes.Buffer
+	base := NewLoggerWithHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	scoped := base.With("transactionId", "trans-123")
+	scoped.Info("scoped message", "key", "value")
+
+	var logEntry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &logEntry); err != nil {
+		t.Fatalf("Output should be valid JSON: %v", err)
+	}
+	if logEntry["transactionId"] != "trans-123" {
+		t.Errorf("Expected transactionId field, got %v", logEntry["transactionId"])
+	}
+	if logEntry["key"] != "value" {
+		t.Errorf("Expected key field, got %v", logEntry["key"])
+	}
+
+	buf.Reset()
+	base.Info("base message")
+	if strings.Contains(buf.String(), "transactionId") {
+		t.Error("With should not modify the parent logger")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	fallback := NewLogger()
+	scoped := fallback.With("transactionId", "trans-123")
+
+	if got := FromContext(context.Background(), fallback); got != fallback {
+		t.Error("FromContext should return the fallback when ctx carries no logger")
+	}
+
+	ctx := NewContext(context.Background(), scoped)
+	if got := FromContext(ctx, fallback); got != scoped {
+		t.Error("FromContext should return the logger carried by ctx")
+	}
+}
+
+func TestNewJSONHandler_TimeFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		parse  string
+	}{
+		{"configured", "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05Z07:00"},
+		{"empty", "", DefaultTimeFormat},
+		{"invalid", "not a layout", DefaultTimeFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			NewLoggerWithHandler(newJSONHandler(&buf, tt.layout)).Info("test message")
+
+			var logEntry map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &logEntry); err != nil {
+				t.Fatalf("Output should be valid JSON: %v", err)
+			}
+			value, _ := logEntry["time"].(string)
+			logged, err := time.Parse(tt.parse, value)
+			if err != nil {
+				t.Fatalf("Expected time in layout %q, got %q: %v", tt.parse, value, err)
+			}
+			if _, offset := logged.Zone(); offset != 0 || !strings.HasSuffix(value, "Z") {
+				t.Errorf("Expected time in UTC, got %q", value)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// sampler counts log lines per level and message within the current interval
+type sampler struct {
+	mu          sync.Mutex
+	everyN      int
+	interval    time.Duration
+	now         func() time.Time
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// allow reports whether the line with the given level and message should be
+// written: the first one of every interval and every Nth after it
+func (s *sampler) allow(level, msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.counts == nil || now.Sub(s.windowStart) >= s.interval {
+		s.windowStart = now
+		s.counts = make(map[string]int)
+	}
+
+	key := level + "\x00" + msg
+	s.counts[key]++
+	return (s.counts[key]-1)%s.everyN == 0
+}
+
+type sampledLogger struct {
+	base    Logger
+	sampler *sampler
+}
+
+// NewSampledLogger wraps base so that, per interval, only one of every everyN
+// lines sharing a level and message is written, keeping log floods during
+// incidents in check. Fatal is never sampled; everyN below 2 returns base
+func NewSampledLogger(base Logger, everyN int, interval time.Duration) Logger {
+	if everyN < 2 {
+		return base
+	}
+	return &sampledLogger{
+		base: base,
+		sampler: &sampler{
+			everyN:   everyN,
+			interval: interval,
+			now:      time.Now,
+		},
+	}
+}
+
+func (l *sampledLogger) Debug(msg string, args ...interface{}) {
+	if l.sampler.allow("debug", msg) {
+		l.base.Debug(msg, args...)
+	}
+}
+
+func (l *sampledLogger) Info(msg string, args ...interface{}) {
+	if l.sampler.allow("info", msg) {
+		l.base.Info(msg, args...)
+	}
+}
+
+func (l *sampledLogger) Warn(msg string, args ...interface{}) {
+	if l.sampler.allow("warn", msg) {
+		l.base.Warn(msg, args...)
+	}
+}
+
+func (l *sampledLogger) Error(msg string, args ...interface{}) {
+	if l.sampler.allow("error", msg) {
+		l.base.Error(msg, args...)
+	}
+}
+
+func (l *sampledLogger) Fatal(msg string, args ...interface{}) {
+	l.base.Fatal(msg, args...)
+}
+
+// With returns a sampled logger including args that shares the sampling
+// budget of l
+func (l *sampledLogger) With(args ...interface{}) Logger {
+	return &sampledLogger{base: l.base.With(args...), sampler: l.sampler}
+}
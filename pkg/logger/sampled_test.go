@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newSampledTestLogger(everyN int, interval time.Duration) (*sampledLogger, *bytes.Buffer, *time.Time) {
+	var buf bytes.Buffer
+	base := NewLoggerWithHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewSampledLogger(base, everyN, interval).(*sampledLogger)
+	l.sampler.now = func() time.Time { return now }
+	return l, &buf, &now
+}
+
+func TestSampledLogger_EmitsEveryNth(t *testing.T) {
+	l, buf, _ := newSampledTestLogger(10, time.Second)
+
+	for i := 0; i < 100; i++ {
+		l.Error("Failed to process message", "offset", i)
+	}
+
+	if got := strings.Count(buf.String(), "Failed to process message"); got != 10 {
+		t.Errorf("Expected 10 sampled lines, got %d", got)
+	}
+}
+
+func TestSampledLogger_SamplesPerLevelAndMessage(t *testing.T) {
+	l, buf, _ := newSampledTestLogger(5, time.Second)
+
+	for i := 0; i < 5; i++ {
+		l.Error("first failure")
+		l.Error("second failure")
+		l.Warn("first failure")
+	}
+
+	output := buf.String()
+	if got := strings.Count(output, `"level":"ERROR","msg":"first failure"`); got != 1 {
+		t.Errorf("Expected 1 error line for first failure, got %d", got)
+	}
+	if got := strings.Count(output, "second failure"); got != 1 {
+		t.Errorf("Expected 1 line for second failure, got %d", got)
+	}
+	if got := strings.Count(output, `"level":"WARN"`); got != 1 {
+		t.Errorf("Expected 1 warn line, got %d", got)
+	}
+}
+
+func TestSampledLogger_ResetsEveryInterval(t *testing.T) {
+	l, buf, now := newSampledTestLogger(100, time.Second)
+
+	l.Error("Failed to process message")
+	l.Error("Failed to process message")
+	*now = now.Add(time.Second)
+	l.Error("Failed to process message")
+
+	if got := strings.Count(buf.String(), "Failed to process message"); got != 2 {
+		t.Errorf("Expected 2 lines across two intervals, got %d", got)
+	}
+}
+
+func TestSampledLogger_WithSharesBudget(t *testing.T) {
+	l, buf, _ := newSampledTestLogger(4, time.Second)
+
+	for i := 0; i < 8; i++ {
+		l.With("offset", i).Error("Failed to process message")
+	}
+
+	if got := strings.Count(buf.String(), "Failed to process message"); got != 2 {
+		t.Errorf("Expected 2 sampled lines, got %d", got)
+	}
+}
+
+func TestNewSampledLogger_DisabledReturnsBase(t *testing.T) {
+	base := NewLogger()
+	if NewSampledLogger(base, 1, time.Second) != base {
+		t.Error("NewSampledLogger should return base when everyN is below 2")
+	}
+}